@@ -1,11 +1,10 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -17,10 +16,14 @@ type File struct {
 	userConfig interface{}
 	watcher    *fsnotify.Watcher
 	updated    func()
+	load       func() error
+
+	mu      sync.Mutex
+	loadErr error
 }
 
 // New creates a new config file and starts watching for changes
-// filepath is the JSON formatted file to monitor
+// filepath is the JSON, YAML or HCL formatted file to monitor
 // c is the interface to attempt to marshal the file into
 // updated is called when there are updates to the file
 func New(fp string, c interface{}, updated func()) (*File, error) {
@@ -47,23 +50,40 @@ func (f *File) Close() {
 		}
 	}()
 
+	if f.watcher == nil {
+		return
+	}
+
 	f.watcher.Close()
 }
 
+// Err returns the error from the last attempt to reload the file, or nil if
+// the last reload succeeded
+func (f *File) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.loadErr
+}
+
+func (f *File) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.loadErr = err
+}
+
 // load the data from the config into the defined structure
 func (f *File) loadData() error {
-	cf, err := os.OpenFile(f.path, os.O_RDONLY, 0655)
-	if err != nil {
-		return err
+	if f.load != nil {
+		return f.load()
 	}
-	defer cf.Close()
 
-	jd := json.NewDecoder(cf)
-	return jd.Decode(f.userConfig)
+	return decodeFile(f.path, f.userConfig)
 }
 
 // watch a file for changes
-func (f *File) watch(filepath string) {
+func (f *File) watch(fp string) {
 	// creates a new file watcher
 	var err error
 	f.watcher, err = fsnotify.NewWatcher()
@@ -79,16 +99,23 @@ func (f *File) watch(filepath string) {
 				if !ok {
 					return
 				}
+				// other files in the same directory are ignored
+				if filepath.Clean(event.Name) != fp {
+					continue
+				}
 				// running on Docker we are not going to reliably get the Write or create event
 				if event.Op&fsnotify.Write == fsnotify.Write ||
 					event.Op&fsnotify.Create == fsnotify.Create ||
 					event.Op&fsnotify.Rename == fsnotify.Rename ||
 					event.Op&fsnotify.Remove == fsnotify.Remove ||
 					event.Op&fsnotify.Chmod == fsnotify.Chmod {
+					// the file may be part way through being written, keep
+					// watching as a later event will contain the full file
 					err := f.loadData()
+					f.setErr(err)
 					if err != nil {
 						log.Println("error", err)
-						return
+						continue
 					}
 
 					if f.updated != nil {
@@ -104,7 +131,9 @@ func (f *File) watch(filepath string) {
 		}
 	}()
 
-	err = f.watcher.Add(filepath)
+	// watch the directory as editors and config management often replace the
+	// file, which removes a watch on the file itself
+	err = f.watcher.Add(filepath.Dir(fp))
 	if err != nil {
 		log.Println("ERROR", err)
 	}
@@ -0,0 +1,585 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable used to locate the config file
+const FileEnv = "CONFIG_FILE"
+
+// FileFlag is the command line flag used to locate the config file
+const FileFlag = "config"
+
+const redacted = "********"
+
+// Loader builds a configuration by layering, from lowest to highest precedence:
+//
+//  1. defaults declared with the `default` struct tag
+//  2. a JSON, YAML or HCL config file, decoded using the `json` struct tags
+//  3. environment variables named by the `env` struct tag
+//  4. command line flags, named by the `flag` tag or derived from the `json` tag
+//
+// Fields tagged `validate:"required"` must have a non zero value once all layers
+// have been applied and fields tagged `secret:"true"` are redacted by Print.
+type Loader struct {
+	defaultPath string
+	args        []string
+	lookupEnv   func(string) (string, bool)
+}
+
+// NewLoader creates a Loader which reads the config file from defaultPath unless
+// overridden by the CONFIG_FILE environment variable or the --config flag.
+// args are the command line arguments without the program name.
+func NewLoader(defaultPath string, args []string) *Loader {
+	return &Loader{defaultPath, args, os.LookupEnv}
+}
+
+// Load populates the struct pointed to by c with the merged configuration
+func (l *Loader) Load(c interface{}) error {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct, got %T", c)
+	}
+
+	fs := fields(v.Elem(), "")
+
+	flags, path, err := l.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fs {
+		if f.def == "" {
+			continue
+		}
+
+		if err := setString(f.value, f.def); err != nil {
+			return fmt.Errorf("invalid default for %s: %w", f.name, err)
+		}
+	}
+
+	// the default config file is optional, one set explicitly must exist
+	explicit := path != l.defaultPath
+	if _, err := os.Stat(path); err == nil || explicit {
+		if err := decodeFile(path, c); err != nil {
+			return fmt.Errorf("unable to load config file %s: %w", path, err)
+		}
+	}
+
+	for _, f := range fs {
+		if f.env == "" {
+			continue
+		}
+
+		if ev, ok := l.lookupEnv(f.env); ok {
+			if err := setString(f.value, ev); err != nil {
+				return fmt.Errorf("invalid value for environment variable %s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range fs {
+		if fv, ok := flags[f.flag]; ok {
+			if err := setString(f.value, fv); err != nil {
+				return fmt.Errorf("invalid value for flag --%s: %w", f.flag, err)
+			}
+		}
+	}
+
+	return validate(c, fs)
+}
+
+// Path returns the location of the config file that Load will read
+func (l *Loader) Path() string {
+	_, p, err := l.parseFlags(nil)
+	if err != nil {
+		return l.defaultPath
+	}
+
+	return p
+}
+
+// Watch loads the configuration into c and reloads it whenever the config file
+// changes, calling updated after each successful reload. Values set by
+// environment variables and flags keep their precedence over the file.
+func (l *Loader) Watch(c interface{}, updated func()) (*File, error) {
+	if err := l.Load(c); err != nil {
+		return nil, err
+	}
+
+	ap, err := filepath.Abs(l.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{path: ap, userConfig: c, updated: updated}
+	if _, err := os.Stat(ap); err != nil {
+		// no config file to watch, the config came from the environment or flags
+		return f, nil
+	}
+
+	f.load = func() error {
+		// load into a copy so that a bad file does not leave c half updated
+		nc := reflect.New(reflect.TypeOf(c).Elem())
+		if err := l.Load(nc.Interface()); err != nil {
+			return err
+		}
+
+		reflect.ValueOf(c).Elem().Set(nc.Elem())
+		return nil
+	}
+
+	go f.watch(ap)
+
+	// sleep to allow the watch to setup
+	time.Sleep(10 * time.Millisecond)
+
+	return f, nil
+}
+
+// Print writes the configuration as indented JSON with secret values redacted
+func Print(w io.Writer, c interface{}) error {
+	d, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(d, &m); err != nil {
+		return err
+	}
+
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		if f.secret && !f.value.IsZero() {
+			redact(m, strings.Split(f.name, "."))
+		}
+	}
+
+	d, err = json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(d))
+	return err
+}
+
+func redact(m map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		if _, ok := m[path[0]]; ok {
+			m[path[0]] = redacted
+		}
+		return
+	}
+
+	if child, ok := m[path[0]].(map[string]interface{}); ok {
+		redact(child, path[1:])
+	}
+}
+
+// Validator can be implemented by a config struct to add checks which run
+// after the required fields have been validated
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError lists every problem found with a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (v *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(v.Problems, "; ")
+}
+
+func validate(c interface{}, fs []field) error {
+	problems := []string{}
+
+	for _, f := range fs {
+		if !f.required || !f.value.IsZero() {
+			continue
+		}
+
+		sources := []string{"the config file"}
+		if f.env != "" {
+			sources = append(sources, fmt.Sprintf("the %s environment variable", f.env))
+		}
+		sources = append(sources, fmt.Sprintf("the --%s flag", f.flag))
+
+		problems = append(problems, fmt.Sprintf("%s is required, set it using %s", f.name, strings.Join(sources, ", ")))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{problems}
+	}
+
+	if v, ok := c.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return &ValidationError{[]string{err.Error()}}
+		}
+	}
+
+	return nil
+}
+
+// field is a settable leaf value in a config struct
+type field struct {
+	name     string // dotted path using the json names
+	env      string
+	flag     string
+	def      string
+	help     string
+	secret   bool
+	required bool
+	value    reflect.Value
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// fields walks a struct returning all of the leaf values, nested structs are
+// flattened with their names joined by "." and their flags joined by "-"
+func fields(v reflect.Value, prefix string) []field {
+	fs := []field{}
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = sf.Name
+		}
+
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && !reflect.PtrTo(sf.Type).Implements(textUnmarshalerType) {
+			fs = append(fs, fields(fv, prefix+name+".")...)
+			continue
+		}
+
+		f := field{
+			name:     prefix + name,
+			env:      sf.Tag.Get("env"),
+			flag:     sf.Tag.Get("flag"),
+			def:      sf.Tag.Get("default"),
+			help:     sf.Tag.Get("help"),
+			secret:   sf.Tag.Get("secret") == "true",
+			required: sf.Tag.Get("validate") == "required",
+			value:    fv,
+		}
+
+		if f.flag == "" {
+			f.flag = strings.NewReplacer(".", "-", "_", "-").Replace(f.name)
+		}
+
+		fs = append(fs, f)
+	}
+
+	return fs
+}
+
+// flagValue records the raw value of a flag so it can be applied after the file
+// and environment layers
+type flagValue struct {
+	name   string
+	isBool bool
+	values map[string]string
+}
+
+func (f *flagValue) String() string { return "" }
+
+func (f *flagValue) Set(s string) error {
+	f.values[f.name] = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+func (l *Loader) parseFlags(fs []field) (map[string]string, string, error) {
+	values := map[string]string{}
+
+	set := flag.NewFlagSet("product-api", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	set.Var(&flagValue{FileFlag, false, values}, FileFlag, "Path to a JSON, YAML or HCL config file")
+
+	for _, f := range fs {
+		set.Var(&flagValue{f.flag, f.value.Kind() == reflect.Bool, values}, f.flag, f.help)
+	}
+
+	// before the fields are known only the config flag can be parsed
+	args := l.args
+	if fs == nil {
+		args = onlyFlag(args, FileFlag)
+	}
+
+	if err := set.Parse(args); err != nil {
+		return nil, "", fmt.Errorf("unable to parse flags: %w", err)
+	}
+
+	path := l.defaultPath
+	if p, ok := l.lookupEnv(FileEnv); ok && p != "" {
+		path = p
+	}
+	if p, ok := values[FileFlag]; ok {
+		path = p
+	}
+	delete(values, FileFlag)
+
+	return values, path, nil
+}
+
+// onlyFlag filters args down to the named flag and its value
+func onlyFlag(args []string, name string) []string {
+	out := []string{}
+	for i := 0; i < len(args); i++ {
+		a := strings.TrimLeft(args[i], "-")
+		switch {
+		case a == name && i+1 < len(args):
+			out = append(out, args[i], args[i+1])
+			i++
+		case strings.HasPrefix(a, name+"="):
+			out = append(out, args[i])
+		}
+	}
+
+	return out
+}
+
+// setString parses s into the value v, slices are comma separated and maps
+// are comma separated key=value pairs
+func setString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := splitList(s)
+		sl := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setString(sl.Index(i), p); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, p := range splitList(s) {
+			kv := strings.SplitN(p, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("expected key=value, got %q", p)
+			}
+
+			mv := reflect.New(v.Type().Elem()).Elem()
+			if err := setString(mv, kv[1]); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(kv[0]).Convert(v.Type().Key()), mv)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func splitList(s string) []string {
+	parts := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	return parts
+}
+
+// decodeFile decodes a JSON, YAML or HCL file into c, the format is chosen
+// using the file extension and defaults to JSON
+func decodeFile(path string, c interface{}) error {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		m := map[string]interface{}{}
+		if err := yaml.Unmarshal(d, &m); err != nil {
+			return err
+		}
+
+		if d, err = json.Marshal(m); err != nil {
+			return err
+		}
+	case ".hcl":
+		m := map[string]interface{}{}
+		if err := hcl.Unmarshal(d, &m); err != nil {
+			return err
+		}
+
+		// HCL decodes every block as a list, unwrap the ones that map to a struct
+		nm := unwrapBlocks(m, reflect.TypeOf(c))
+		if d, err = json.Marshal(nm); err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(d, c)
+}
+
+func unwrapBlocks(v interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if l, ok := v.([]map[string]interface{}); ok && len(l) == 1 {
+			v = l[0]
+		}
+
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name := strings.Split(sf.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = sf.Name
+			}
+
+			if fv, ok := m[name]; ok {
+				m[name] = unwrapBlocks(fv, sf.Type)
+			}
+		}
+
+		return m
+	case reflect.Map:
+		if l, ok := v.([]map[string]interface{}); ok && len(l) == 1 {
+			v = l[0]
+		}
+
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+
+		for k, mv := range m {
+			m[k] = unwrapBlocks(mv, t.Elem())
+		}
+
+		return m
+	case reflect.Slice:
+		l, ok := v.([]map[string]interface{})
+		if !ok {
+			return v
+		}
+
+		out := make([]interface{}, len(l))
+		for i, e := range l {
+			out[i] = unwrapBlocks(e, t.Elem())
+		}
+
+		return out
+	}
+
+	return v
+}
+
+// Duration is a time.Duration which can be decoded from strings such as "30s"
+// in config files as well as from a number of nanoseconds
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	pd, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(pd)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch dv := v.(type) {
+	case string:
+		return d.UnmarshalText([]byte(dv))
+	case float64:
+		*d = Duration(dv)
+		return nil
+	}
+
+	return fmt.Errorf("invalid duration %s", string(b))
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Duration returns the value as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLimit struct {
+	Rate  int      `json:"rate" env:"TEST_LIMIT_RATE"`
+	Every Duration `json:"every" default:"1m"`
+}
+
+type testLayeredConfig struct {
+	DBConnection string            `json:"db_connection" env:"TEST_DB_CONNECTION" secret:"true" validate:"required"`
+	BindAddress  string            `json:"bind_address" env:"TEST_BIND_ADDRESS" default:"localhost:9090"`
+	MaxRetries   int               `json:"max_retries" env:"TEST_MAX_RETRIES" default:"60"`
+	Timeout      time.Duration     `json:"-" flag:"timeout" default:"5s"`
+	Origins      []string          `json:"origins" env:"TEST_ORIGINS"`
+	Rates        map[string]string `json:"rates"`
+	Limit        testLimit         `json:"limit"`
+}
+
+func writeConfig(t *testing.T, name, data string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func setupLoader(path string, env map[string]string, args ...string) *Loader {
+	l := NewLoader(path, args)
+	l.lookupEnv = func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	return l
+}
+
+func TestLoaderAppliesDefaults(t *testing.T) {
+	l := setupLoader("/does/not/exist.json", nil, "--db-connection", "host=db")
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "localhost:9090", c.BindAddress)
+	assert.Equal(t, 60, c.MaxRetries)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Equal(t, time.Minute, c.Limit.Every.Duration())
+}
+
+func TestLoaderFileOverridesDefaults(t *testing.T) {
+	p := writeConfig(t, "conf.json", `{"db_connection": "host=file", "max_retries": 3, "limit": {"rate": 10, "every": "10s"}}`)
+	l := setupLoader(p, nil)
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=file", c.DBConnection)
+	assert.Equal(t, 3, c.MaxRetries)
+	assert.Equal(t, "localhost:9090", c.BindAddress)
+	assert.Equal(t, 10, c.Limit.Rate)
+	assert.Equal(t, 10*time.Second, c.Limit.Every.Duration())
+}
+
+func TestLoaderEnvOverridesFileAndFlagsOverrideEnv(t *testing.T) {
+	p := writeConfig(t, "conf.json", `{"db_connection": "host=file", "bind_address": "file:9090"}`)
+	l := setupLoader(
+		p,
+		map[string]string{"TEST_DB_CONNECTION": "host=env", "TEST_BIND_ADDRESS": "env:9090", "TEST_LIMIT_RATE": "4"},
+		"--bind-address", "flag:9090",
+	)
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=env", c.DBConnection)
+	assert.Equal(t, "flag:9090", c.BindAddress)
+	assert.Equal(t, 4, c.Limit.Rate)
+}
+
+func TestLoaderPartialEnvStillLoadsFile(t *testing.T) {
+	p := writeConfig(t, "conf.json", `{"db_connection": "host=file", "max_retries": 3}`)
+	l := setupLoader(p, map[string]string{"TEST_BIND_ADDRESS": "env:9090"})
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=file", c.DBConnection)
+	assert.Equal(t, "env:9090", c.BindAddress)
+	assert.Equal(t, 3, c.MaxRetries)
+}
+
+func TestLoaderParsesListsAndMapsFromEnv(t *testing.T) {
+	l := setupLoader("/does/not/exist.json", map[string]string{"TEST_DB_CONNECTION": "host=env", "TEST_ORIGINS": "a.com, b.com"})
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"a.com", "b.com"}, c.Origins)
+}
+
+func TestLoaderReadsYAML(t *testing.T) {
+	p := writeConfig(t, "conf.yaml", "db_connection: host=yaml\nmax_retries: 7\norigins:\n  - a.com\nlimit:\n  rate: 2\n  every: 30s\n")
+	l := setupLoader(p, nil)
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=yaml", c.DBConnection)
+	assert.Equal(t, 7, c.MaxRetries)
+	assert.Equal(t, []string{"a.com"}, c.Origins)
+	assert.Equal(t, 2, c.Limit.Rate)
+	assert.Equal(t, 30*time.Second, c.Limit.Every.Duration())
+}
+
+func TestLoaderReadsHCL(t *testing.T) {
+	p := writeConfig(t, "conf.hcl", `
+db_connection = "host=hcl"
+max_retries = 9
+
+rates {
+  usd = "1.0"
+}
+
+limit {
+  rate = 3
+  every = "2s"
+}
+`)
+	l := setupLoader(p, nil)
+
+	c := &testLayeredConfig{}
+	err := l.Load(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=hcl", c.DBConnection)
+	assert.Equal(t, 9, c.MaxRetries)
+	assert.Equal(t, "1.0", c.Rates["usd"])
+	assert.Equal(t, 3, c.Limit.Rate)
+	assert.Equal(t, 2*time.Second, c.Limit.Every.Duration())
+}
+
+func TestLoaderReadsFileFromEnvAndFlag(t *testing.T) {
+	pe := writeConfig(t, "env.json", `{"db_connection": "host=envfile"}`)
+	pf := writeConfig(t, "flag.json", `{"db_connection": "host=flagfile"}`)
+
+	c := &testLayeredConfig{}
+	err := setupLoader("./conf.json", map[string]string{FileEnv: pe}).Load(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "host=envfile", c.DBConnection)
+
+	c = &testLayeredConfig{}
+	err = setupLoader("./conf.json", map[string]string{FileEnv: pe}, "--config", pf).Load(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "host=flagfile", c.DBConnection)
+}
+
+func TestLoaderErrorsWhenExplicitFileIsMissing(t *testing.T) {
+	l := setupLoader("./conf.json", map[string]string{FileEnv: "/does/not/exist.json"})
+
+	err := l.Load(&testLayeredConfig{})
+	assert.Error(t, err)
+}
+
+func TestLoaderReturnsDescriptiveValidationErrors(t *testing.T) {
+	l := setupLoader("/does/not/exist.json", nil)
+
+	err := l.Load(&testLayeredConfig{})
+	assert.IsType(t, &ValidationError{}, err)
+	assert.Contains(t, err.Error(), "db_connection is required")
+	assert.Contains(t, err.Error(), "TEST_DB_CONNECTION")
+	assert.Contains(t, err.Error(), "--db-connection")
+}
+
+func TestLoaderReturnsErrorForInvalidEnvValue(t *testing.T) {
+	l := setupLoader("/does/not/exist.json", map[string]string{"TEST_DB_CONNECTION": "host=env", "TEST_MAX_RETRIES": "lots"})
+
+	err := l.Load(&testLayeredConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TEST_MAX_RETRIES")
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	c := &testLayeredConfig{DBConnection: "password=secret", BindAddress: "localhost:9090"}
+
+	b := bytes.NewBuffer(nil)
+	err := Print(b, c)
+	assert.NoError(t, err)
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(b.Bytes(), &m)
+	assert.NoError(t, err)
+
+	assert.Equal(t, redacted, m["db_connection"])
+	assert.Equal(t, "localhost:9090", m["bind_address"])
+	assert.NotContains(t, b.String(), "secret")
+}
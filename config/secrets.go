@@ -0,0 +1,393 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leaseRefreshFraction is the portion of a lease which can elapse before a
+// secret is read again, leaving time to retry before the old value expires
+const leaseRefreshFraction = 2.0 / 3.0
+
+// maxVaultCache is the longest a leased Vault response is reused
+const maxVaultCache = 5 * time.Second
+
+// Secret is a value returned by a SecretProvider
+type Secret struct {
+	Value string
+	// LeaseDuration is how long the value is valid for, zero if it does not expire
+	LeaseDuration time.Duration
+}
+
+// SecretProvider resolves a secret reference such as file:///run/secrets/db_password
+type SecretProvider interface {
+	Resolve(ref *url.URL) (Secret, error)
+}
+
+// Resolver replaces references to secrets in config values with the secret
+// value, references are URLs using the scheme of a registered SecretProvider
+// and can be the whole value or embedded in a value such as a connection string
+// e.g. "host=db password=vault://secret/data/product-api#password"
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]SecretProvider
+}
+
+// NewResolver creates a Resolver with the file provider registered
+func NewResolver() *Resolver {
+	r := &Resolver{providers: map[string]SecretProvider{}}
+	r.Register("file", &FileProvider{})
+
+	return r
+}
+
+// Register a provider for the given URL scheme
+func (r *Resolver) Register(scheme string, p SecretProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[scheme] = p
+}
+
+func (r *Resolver) pattern() *regexp.Regexp {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemes := []string{}
+	for s := range r.providers {
+		schemes = append(schemes, regexp.QuoteMeta(s))
+	}
+
+	return regexp.MustCompile(`(` + strings.Join(schemes, "|") + `)://[^\s'"]+`)
+}
+
+// ResolveString replaces every secret reference in s, returning the shortest
+// lease of the secrets used
+func (r *Resolver) ResolveString(s string) (string, time.Duration, error) {
+	var lease time.Duration
+	var rerr error
+
+	out := r.pattern().ReplaceAllStringFunc(s, func(ref string) string {
+		if rerr != nil {
+			return ref
+		}
+
+		u, err := url.Parse(ref)
+		if err != nil {
+			rerr = fmt.Errorf("invalid secret reference: %w", err)
+			return ref
+		}
+
+		r.mu.RLock()
+		p := r.providers[u.Scheme]
+		r.mu.RUnlock()
+
+		sec, err := p.Resolve(u)
+		if err != nil {
+			rerr = fmt.Errorf("unable to resolve secret %s://%s%s: %w", u.Scheme, u.Host, u.Path, err)
+			return ref
+		}
+
+		if sec.LeaseDuration > 0 && (lease == 0 || sec.LeaseDuration < lease) {
+			lease = sec.LeaseDuration
+		}
+
+		return sec.Value
+	})
+
+	return out, lease, rerr
+}
+
+// Resolve replaces the secret references held in the string fields of the
+// struct pointed to by c, the returned Secrets can be used to read them again
+func (r *Resolver) Resolve(c interface{}) (*Secrets, error) {
+	s := &Secrets{resolver: r, config: c}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+type secretRef struct {
+	value    reflect.Value
+	raw      string
+	resolved string
+}
+
+// Secrets holds the secret references found in a config so they can be
+// re-read when their lease is close to expiring
+type Secrets struct {
+	resolver *Resolver
+	config   interface{}
+
+	mu    sync.Mutex
+	refs  []secretRef
+	lease time.Duration
+	// resolved is a copy of the config when its secrets were last resolved,
+	// it is restored when a reloaded config can not be resolved
+	resolved reflect.Value
+}
+
+// Reload scans the config for secret references and resolves them, it must be
+// called after the config has been reloaded from file. When a secret can not
+// be resolved the config is restored to how it was when its secrets were last
+// resolved, so it is never left holding references instead of values.
+func (s *Secrets) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.resolver.pattern()
+	refs := []secretRef{}
+	for _, f := range fields(reflect.ValueOf(s.config).Elem(), "") {
+		if f.value.Kind() == reflect.String && p.MatchString(f.value.String()) {
+			refs = append(refs, secretRef{value: f.value, raw: f.value.String()})
+		}
+	}
+
+	// fields which still hold a resolved value keep their original reference
+	for _, old := range s.refs {
+		if old.value.String() == old.resolved && !p.MatchString(old.value.String()) {
+			refs = append(refs, old)
+		}
+	}
+
+	previous := s.refs
+	s.refs = refs
+
+	_, err := s.refresh()
+	if err != nil && s.resolved.IsValid() {
+		reflect.ValueOf(s.config).Elem().Set(s.resolved)
+		s.refs = previous
+	}
+
+	return err
+}
+
+// Refresh reads all secrets again, returning true when any value has changed
+func (s *Secrets) Refresh() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refresh()
+}
+
+func (s *Secrets) refresh() (bool, error) {
+	values := make([]string, len(s.refs))
+	var lease time.Duration
+
+	// resolve everything before updating the config so a failure does not leave
+	// a mix of old and new credentials
+	for i, r := range s.refs {
+		v, l, err := s.resolver.ResolveString(r.raw)
+		if err != nil {
+			return false, err
+		}
+
+		if l > 0 && (lease == 0 || l < lease) {
+			lease = l
+		}
+
+		values[i] = v
+	}
+
+	changed := false
+	for i := range s.refs {
+		if s.refs[i].value.String() != values[i] {
+			s.refs[i].value.SetString(values[i])
+			changed = true
+		}
+
+		s.refs[i].resolved = values[i]
+	}
+
+	s.lease = lease
+
+	c := reflect.ValueOf(s.config).Elem()
+	s.resolved = reflect.New(c.Type()).Elem()
+	s.resolved.Set(c)
+
+	return changed, nil
+}
+
+// NextRefresh returns how long until the secrets should be read again, or zero
+// if none of the secrets have a lease
+func (s *Secrets) NextRefresh() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return time.Duration(float64(s.lease) * leaseRefreshFraction)
+}
+
+// Watch re-reads the secrets before their leases expire, and at least every
+// interval when interval is greater than zero, calling updated when a value
+// changes. Errors are passed to errored and the read is retried. Watch blocks
+// until done is closed.
+func (s *Secrets) Watch(done <-chan struct{}, interval time.Duration, updated func(), errored func(error)) {
+	retry := time.Second
+
+	for {
+		next := s.NextRefresh()
+		if next == 0 || (interval > 0 && interval < next) {
+			next = interval
+		}
+
+		var tick <-chan time.Time
+		if next > 0 {
+			tick = time.After(next)
+		}
+
+		select {
+		case <-done:
+			return
+		case <-tick:
+		}
+
+		changed, err := s.Refresh()
+		for err != nil {
+			if errored != nil {
+				errored(err)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-time.After(retry):
+			}
+
+			changed, err = s.Refresh()
+		}
+
+		if changed && updated != nil {
+			updated()
+		}
+	}
+}
+
+// FileProvider reads secrets from files, e.g. file:///run/secrets/db_password
+// trailing new lines are removed from the file contents
+type FileProvider struct{}
+
+// Resolve implements SecretProvider
+func (f *FileProvider) Resolve(ref *url.URL) (Secret, error) {
+	d, err := ioutil.ReadFile(ref.Host + ref.Path)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	return Secret{Value: strings.TrimRight(string(d), "\r\n")}, nil
+}
+
+// VaultProvider reads secrets from the HTTP API of a Vault compatible secret
+// store, references are in the form vault://<path>#<key>
+// e.g. vault://secret/data/product-api#password reads the key password from
+// the KV version 2 secret product-api. Leased responses are cached briefly so
+// that related keys such as a dynamic username and password are read from a
+// single response, while credentials rejected by the database can be re-read
+// straight away.
+type VaultProvider struct {
+	address string
+	token   string
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]vaultCacheEntry
+}
+
+type vaultCacheEntry struct {
+	data    map[string]interface{}
+	lease   time.Duration
+	expires time.Time
+}
+
+// NewVaultProvider creates a provider for the Vault server at address
+func NewVaultProvider(address, token string) *VaultProvider {
+	return &VaultProvider{
+		address: strings.TrimRight(address, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		cache:   map[string]vaultCacheEntry{},
+	}
+}
+
+// vaultResponse is the subset of a Vault secret response used by the provider
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// Resolve implements SecretProvider
+func (v *VaultProvider) Resolve(ref *url.URL) (Secret, error) {
+	if ref.Fragment == "" {
+		return Secret{}, fmt.Errorf("vault reference must include a key, e.g. vault://secret/data/app#password")
+	}
+
+	e, err := v.read(ref.Host + ref.Path)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	val, ok := e.data[ref.Fragment]
+	if !ok {
+		return Secret{}, fmt.Errorf("key %s not found", ref.Fragment)
+	}
+
+	return Secret{Value: fmt.Sprintf("%v", val), LeaseDuration: e.lease}, nil
+}
+
+func (v *VaultProvider) read(path string) (vaultCacheEntry, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if e, ok := v.cache[path]; ok && time.Now().Before(e.expires) {
+		return e, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s", v.address, strings.TrimLeft(path, "/")), nil)
+	if err != nil {
+		return vaultCacheEntry{}, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return vaultCacheEntry{}, err
+	}
+	defer resp.Body.Close()
+
+	vr := vaultResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil && resp.StatusCode == http.StatusOK {
+		return vaultCacheEntry{}, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return vaultCacheEntry{}, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.Join(vr.Errors, ", "))
+	}
+
+	// KV version 2 nests the secret inside a second data object
+	data := vr.Data
+	if inner, ok := vr.Data["data"].(map[string]interface{}); ok {
+		if _, ok := vr.Data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	e := vaultCacheEntry{data: data, lease: time.Duration(vr.LeaseDuration) * time.Second}
+	ttl := time.Duration(float64(e.lease) * leaseRefreshFraction)
+	if ttl > maxVaultCache {
+		ttl = maxVaultCache
+	}
+	e.expires = time.Now().Add(ttl)
+	v.cache[path] = e
+
+	return e, nil
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSecretConfig struct {
+	DBConnection string `json:"db_connection"`
+	JWTSecret    string `json:"jwt_secret"`
+	Name         string `json:"name"`
+}
+
+// vaultStub is a local stand in for the Vault HTTP API
+type vaultStub struct {
+	mu       sync.Mutex
+	password string
+	lease    int
+	reads    int
+}
+
+func (v *vaultStub) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "root" {
+		rw.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(rw, `{"errors": ["permission denied"]}`)
+		return
+	}
+
+	v.reads++
+
+	switch r.URL.Path {
+	case "/v1/secret/data/product-api":
+		fmt.Fprintf(rw, `{"lease_duration": 0, "data": {"data": {"password": "%s", "jwt": "signing"}, "metadata": {"version": 1}}}`, v.password)
+	case "/v1/database/creds/product-api":
+		fmt.Fprintf(rw, `{"lease_duration": %d, "data": {"username": "v-user-%d", "password": "%s"}}`, v.lease, v.reads, v.password)
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(rw, `{"errors": []}`)
+	}
+}
+
+func setupVault(t *testing.T) (*vaultStub, *Resolver) {
+	v := &vaultStub{password: "first", lease: 3}
+	s := httptest.NewServer(v)
+	t.Cleanup(s.Close)
+
+	r := NewResolver()
+	r.Register("vault", NewVaultProvider(s.URL, "root"))
+
+	return v, r
+}
+
+func TestResolvesFileSecret(t *testing.T) {
+	p := writeConfig(t, "db_password", "s3cret\n")
+
+	c := &testSecretConfig{DBConnection: "host=db password=file://" + p + " dbname=products", Name: "plain"}
+	_, err := NewResolver().Resolve(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=db password=s3cret dbname=products", c.DBConnection)
+	assert.Equal(t, "plain", c.Name)
+}
+
+func TestReturnsErrorForMissingFileSecret(t *testing.T) {
+	c := &testSecretConfig{JWTSecret: "file:///does/not/exist"}
+	_, err := NewResolver().Resolve(c)
+
+	assert.Error(t, err)
+}
+
+func TestResolvesVaultKVSecret(t *testing.T) {
+	_, r := setupVault(t)
+
+	c := &testSecretConfig{
+		DBConnection: "host=db password=vault://secret/data/product-api#password",
+		JWTSecret:    "vault://secret/data/product-api#jwt",
+	}
+	s, err := r.Resolve(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "host=db password=first", c.DBConnection)
+	assert.Equal(t, "signing", c.JWTSecret)
+	assert.Equal(t, time.Duration(0), s.NextRefresh())
+}
+
+func TestReturnsErrorForUnknownVaultKey(t *testing.T) {
+	_, r := setupVault(t)
+
+	c := &testSecretConfig{JWTSecret: "vault://secret/data/product-api#missing"}
+	_, err := r.Resolve(c)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing")
+}
+
+func TestReadsLeasedSecretKeysFromOneResponse(t *testing.T) {
+	_, r := setupVault(t)
+
+	c := &testSecretConfig{
+		DBConnection: "user=vault://database/creds/product-api#username password=vault://database/creds/product-api#password",
+	}
+	s, err := r.Resolve(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "user=v-user-1 password=first", c.DBConnection)
+	assert.Equal(t, 2*time.Second, s.NextRefresh())
+}
+
+func TestRefreshUpdatesRotatedSecrets(t *testing.T) {
+	v, r := setupVault(t)
+
+	c := &testSecretConfig{JWTSecret: "vault://secret/data/product-api#password"}
+	s, err := r.Resolve(c)
+	assert.NoError(t, err)
+
+	changed, err := s.Refresh()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	v.mu.Lock()
+	v.password = "second"
+	v.mu.Unlock()
+
+	changed, err = s.Refresh()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "second", c.JWTSecret)
+}
+
+func TestReloadRestoresConfigWhenSecretCanNotBeResolved(t *testing.T) {
+	p := writeConfig(t, "db_password", "s3cret")
+
+	c := &testSecretConfig{DBConnection: "password=file://" + p, Name: "plain"}
+	s, err := NewResolver().Resolve(c)
+	assert.NoError(t, err)
+
+	// the config file changes to reference a secret which does not exist
+	*c = testSecretConfig{DBConnection: "password=file:///does/not/exist", JWTSecret: "file:///does/not/exist", Name: "changed"}
+
+	err = s.Reload()
+	assert.Error(t, err)
+
+	assert.Equal(t, "password=s3cret", c.DBConnection)
+	assert.Equal(t, "", c.JWTSecret)
+	assert.Equal(t, "plain", c.Name)
+
+	// the previous references are still refreshed
+	_, err = s.Refresh()
+	assert.NoError(t, err)
+	assert.Equal(t, "password=s3cret", c.DBConnection)
+}
+
+func TestWatchRereadsLeasedSecretsBeforeExpiry(t *testing.T) {
+	v, r := setupVault(t)
+	v.lease = 1
+
+	c := &testSecretConfig{DBConnection: "vault://database/creds/product-api#username"}
+	s, err := r.Resolve(c)
+	assert.NoError(t, err)
+
+	updated := make(chan struct{}, 10)
+	done := make(chan struct{})
+	defer close(done)
+
+	go s.Watch(done, 0, func() { updated <- struct{}{} }, nil)
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for secrets to be refreshed")
+	}
+
+	assert.NotEqual(t, "v-user-1", c.DBConnection)
+}
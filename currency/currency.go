@@ -0,0 +1,223 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// ErrUnsupported is returned when there is no exchange rate for a currency
+var ErrUnsupported = errors.New("Currency is not supported")
+
+// exponents are the number of minor units in the major unit of each ISO 4217
+// currency as a power of ten, e.g. 2 for USD as there are 100 cents in a
+// dollar
+var exponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"CZK": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MXN": 2,
+	"NOK": 2,
+	"NZD": 2,
+	"PLN": 2,
+	"SEK": 2,
+	"SGD": 2,
+	"USD": 2,
+	"ZAR": 2,
+}
+
+// Exponent returns the number of minor units in the major unit of a currency
+// as a power of ten, returning false when the currency is not known
+func Exponent(code string) (int, bool) {
+	e, ok := exponents[code]
+	return e, ok
+}
+
+// Normalize returns the upper case ISO 4217 code of a currency, returning an
+// error when it is not known
+func Normalize(code string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(code))
+
+	if _, ok := exponents[c]; !ok {
+		return "", fmt.Errorf("unknown currency %q, expected an ISO 4217 code e.g. USD", code)
+	}
+
+	return c, nil
+}
+
+// Rates are the amount of each currency one unit of the base currency buys,
+// kept as exact fractions so prices are never converted with floating point
+type Rates map[string]*big.Rat
+
+// ParseRates parses exchange rates in the form <currency>=<rate>, separated
+// by commas, e.g. "EUR=0.92,GBP=0.79". An empty string has no rates.
+func ParseRates(s string) (Rates, error) {
+	rs := Rates{}
+
+	for _, p := range strings.Split(s, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid exchange rate %q, expected <currency>=<rate> e.g. EUR=0.92", p)
+		}
+
+		c, err := Normalize(kv[0])
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := new(big.Rat).SetString(strings.TrimSpace(kv[1]))
+		if !ok || r.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q for %s, expected a number greater than 0", kv[1], c)
+		}
+
+		rs[c] = r
+	}
+
+	return rs, nil
+}
+
+// UnmarshalText allows Rates to be set from config
+func (r *Rates) UnmarshalText(text []byte) error {
+	p, err := ParseRates(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = p
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (r Rates) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// String returns the rates in the form accepted by ParseRates
+func (r Rates) String() string {
+	ps := []string{}
+
+	for _, c := range r.currencies() {
+		ps = append(ps, c+"="+r[c].FloatString(rateDigits(r[c])))
+	}
+
+	return strings.Join(ps, ",")
+}
+
+// rateDigits returns the number of decimal places needed to show a rate
+// exactly, up to 10 for rates which do not end
+func rateDigits(r *big.Rat) int {
+	for n := 0; n < 10; n++ {
+		if new(big.Int).Mod(new(big.Int).Mul(r.Num(), pow10(n)), r.Denom()).Sign() == 0 {
+			return n
+		}
+	}
+
+	return 10
+}
+
+func (r Rates) currencies() []string {
+	cs := []string{}
+	for c := range r {
+		cs = append(cs, c)
+	}
+
+	sort.Strings(cs)
+	return cs
+}
+
+// Converter converts prices from the base currency using exchange rates
+type Converter struct {
+	Base  string
+	Rates Rates
+}
+
+// Currencies returns the base currency followed by the currencies which have
+// an exchange rate
+func (c Converter) Currencies() []string {
+	cs := []string{c.Base}
+
+	for _, r := range c.Rates.currencies() {
+		if r != c.Base {
+			cs = append(cs, r)
+		}
+	}
+
+	return cs
+}
+
+// Supported returns the normalized code of a currency prices can be shown in,
+// returning ErrUnsupported when there is no exchange rate for it
+func (c Converter) Supported(code string) (string, error) {
+	n, err := Normalize(code)
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	if _, ok := c.Rates[n]; !ok && n != c.Base {
+		return "", ErrUnsupported
+	}
+
+	return n, nil
+}
+
+// Convert converts an amount in minor units of the base currency to minor
+// units of another currency, rounding half away from zero
+func (c Converter) Convert(amount int, to string) (int, error) {
+	if to == c.Base {
+		return amount, nil
+	}
+
+	rate, ok := c.Rates[to]
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	from, ok := exponents[c.Base]
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	// amount * rate * 10^(to exponent - base exponent)
+	num := new(big.Int).Mul(big.NewInt(int64(amount)), rate.Num())
+	num.Mul(num, pow10(exponents[to]))
+	den := new(big.Int).Mul(rate.Denom(), pow10(from))
+
+	return roundDiv(num, den), nil
+}
+
+// roundDiv divides num by den, rounding half away from zero
+func roundDiv(num, den *big.Int) int {
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	if new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	return int(q.Int64())
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,115 @@
+package currency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRates(t *testing.T) {
+	r, err := ParseRates("eur=0.92, GBP=0.79,JPY=151.5")
+	assert.NoError(t, err)
+
+	assert.Len(t, r, 3)
+	assert.Equal(t, "EUR=0.92,GBP=0.79,JPY=151.5", r.String())
+}
+
+func TestParseRatesEmptyHasNoRates(t *testing.T) {
+	r, err := ParseRates("")
+	assert.NoError(t, err)
+
+	assert.Empty(t, r)
+}
+
+func TestParseRatesRejectsInvalidRates(t *testing.T) {
+	for _, s := range []string{"EUR", "XXX=1", "EUR=abc", "EUR=0", "EUR=-1"} {
+		_, err := ParseRates(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestConvertRoundsHalfAwayFromZero(t *testing.T) {
+	r, _ := ParseRates("EUR=0.925")
+	c := Converter{"USD", r}
+
+	// 2.00 * 0.925 = 1.85
+	a, err := c.Convert(200, "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, 185, a)
+
+	// 1.50 * 0.925 = 1.3875
+	a, _ = c.Convert(150, "EUR")
+	assert.Equal(t, 139, a)
+
+	// -0.02 * 0.925 = -0.0185
+	a, _ = c.Convert(-2, "EUR")
+	assert.Equal(t, -2, a)
+}
+
+func TestConvertUsesMinorUnitsOfEachCurrency(t *testing.T) {
+	r, _ := ParseRates("JPY=151.5,KWD=0.308")
+	c := Converter{"USD", r}
+
+	// $2.50 is ¥378.75
+	a, _ := c.Convert(250, "JPY")
+	assert.Equal(t, 379, a)
+
+	// $2.50 is 0.770 KWD
+	a, _ = c.Convert(250, "KWD")
+	assert.Equal(t, 770, a)
+}
+
+func TestConvertIsExactForLargeAmounts(t *testing.T) {
+	r, _ := ParseRates("EUR=0.1")
+	c := Converter{"USD", r}
+
+	a, _ := c.Convert(900719925474099, "EUR")
+	assert.Equal(t, 90071992547410, a)
+}
+
+func TestConvertReturnsErrorWithoutRate(t *testing.T) {
+	c := Converter{"USD", Rates{}}
+
+	_, err := c.Convert(200, "EUR")
+	assert.Equal(t, ErrUnsupported, err)
+
+	a, err := c.Convert(200, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, a)
+}
+
+func TestSupported(t *testing.T) {
+	r, _ := ParseRates("EUR=0.92")
+	c := Converter{"USD", r}
+
+	s, err := c.Supported("eur")
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", s)
+
+	_, err = c.Supported("GBP")
+	assert.Equal(t, ErrUnsupported, err)
+
+	_, err = c.Supported("dollars")
+	assert.Equal(t, ErrUnsupported, err)
+
+	assert.Equal(t, []string{"USD", "EUR"}, c.Currencies())
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "$1,234.56", Format(123456, "USD", "en"))
+	assert.Equal(t, "$0.05", Format(5, "USD", "en"))
+	assert.Equal(t, "-$2.00", Format(-200, "USD", "en"))
+	assert.Equal(t, "1.234,56\u00a0€", Format(123456, "EUR", "de"))
+	assert.Equal(t, "1\u00a0234,56\u00a0€", Format(123456, "EUR", "fr"))
+	assert.Equal(t, "¥1,235", Format(1235, "JPY", "ja"))
+	assert.Equal(t, "CHF\u00a04.50", Format(450, "CHF", "en"))
+	assert.Equal(t, "€4.50", Format(450, "EUR", "xx"))
+}
+
+func TestLanguage(t *testing.T) {
+	assert.Equal(t, "de", Language("de-CH, de;q=0.9, en;q=0.8"))
+	assert.Equal(t, "fr", Language("FR;q=0.5"))
+	assert.Equal(t, "", Language(""))
+	assert.Equal(t, "", Language(`"x`))
+	assert.Equal(t, "", Language("*"))
+}
@@ -0,0 +1,113 @@
+package currency
+
+import (
+	"strconv"
+	"strings"
+)
+
+// symbols are shown instead of the code for well known currencies
+var symbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"INR": "₹",
+	"JPY": "¥",
+	"KRW": "₩",
+	"USD": "$",
+}
+
+// nbsp separates symbols and groups of digits so they are not split across
+// lines
+const nbsp = "\u00a0"
+
+// style is how a language writes amounts of money
+type style struct {
+	decimal string
+	group   string
+	// after puts the symbol after the amount
+	after bool
+}
+
+// styles are keyed by the language of a locale, languages which are not
+// listed use English
+var styles = map[string]style{
+	"de": {decimal: ",", group: ".", after: true},
+	"en": {decimal: ".", group: ","},
+	"es": {decimal: ",", group: ".", after: true},
+	"fr": {decimal: ",", group: nbsp, after: true},
+	"it": {decimal: ",", group: ".", after: true},
+	"ja": {decimal: ".", group: ","},
+	"nl": {decimal: ",", group: "."},
+	"pt": {decimal: ",", group: ".", after: true},
+	"sv": {decimal: ",", group: nbsp, after: true},
+}
+
+// Language returns the language of the first locale in an Accept-Language
+// header, e.g. de for "de-CH, de;q=0.9, en;q=0.8", or an empty string when it
+// is not made of letters
+func Language(acceptLanguage string) string {
+	l := strings.Split(acceptLanguage, ",")[0]
+	l = strings.Split(l, ";")[0]
+	l = strings.Split(l, "-")[0]
+	l = strings.ToLower(strings.TrimSpace(l))
+
+	for _, c := range l {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+
+	return l
+}
+
+// Format formats an amount in minor units of a currency for a language, e.g.
+// 123456 USD is $1,234.56 in English and 1.234,56 $ in German
+func Format(amount int, code string, language string) string {
+	s, ok := styles[language]
+	if !ok {
+		s = styles["en"]
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.Itoa(amount)
+	exp := exponents[code]
+
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+
+	major, minor := digits[:len(digits)-exp], digits[len(digits)-exp:]
+
+	n := group(major, s.group)
+	if exp > 0 {
+		n += s.decimal + minor
+	}
+
+	symbol, ok := symbols[code]
+	if !ok {
+		symbol = code
+	}
+
+	if s.after {
+		return sign + n + nbsp + symbol
+	}
+
+	if !ok {
+		return sign + symbol + nbsp + n
+	}
+
+	return sign + symbol + n
+}
+
+// group separates the thousands of a whole number
+func group(digits string, sep string) string {
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + sep + digits[i:]
+	}
+
+	return digits
+}
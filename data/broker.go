@@ -0,0 +1,190 @@
+package data
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/lib/pq"
+)
+
+// eventChannel is the Postgres channel events are sent on
+const eventChannel = "outbox_events"
+
+// Broker shares events published from the outbox between replicas of the
+// service so each can push them to the streams connected to it. A zero event
+// is sent to the handler when events may have been missed.
+type Broker interface {
+	// Publish sends an event to every replica, including this one
+	Publish(e model.OutboxEvent) error
+	// Subscribe sets the function called for events
+	Subscribe(handler func(e model.OutboxEvent))
+}
+
+// LocalBroker is used when there is a single replica, events are only sent
+// to this process
+type LocalBroker struct {
+	mu      sync.Mutex
+	handler func(e model.OutboxEvent)
+}
+
+// Publish implements Broker
+func (l *LocalBroker) Publish(e model.OutboxEvent) error {
+	l.mu.Lock()
+	h := l.handler
+	l.mu.Unlock()
+
+	if h != nil {
+		h(e)
+	}
+
+	return nil
+}
+
+// Subscribe implements Broker
+func (l *LocalBroker) Subscribe(handler func(e model.OutboxEvent)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.handler = handler
+}
+
+// OutboxReader reads an event from the outbox, it is implemented by
+// PostgresSQL
+type OutboxReader interface {
+	GetOutboxEvent(id int64) (model.OutboxEvent, error)
+}
+
+// PostgresBroker shares events using Postgres LISTEN/NOTIFY. Notifications
+// only carry the ID of the event, which is read from the outbox, as payloads
+// can be larger than a notification allows.
+type PostgresBroker struct {
+	notifier Notifier
+	reader   OutboxReader
+	log      hclog.Logger
+
+	mu       sync.Mutex
+	listener *pq.Listener
+	handler  func(e model.OutboxEvent)
+	done     chan struct{}
+}
+
+// NewPostgresBroker creates a Broker which listens using the connection
+// string, sends notifications using n and reads events using r
+func NewPostgresBroker(connection string, n Notifier, r OutboxReader, l hclog.Logger) (*PostgresBroker, error) {
+	p := &PostgresBroker{notifier: n, reader: r, log: l}
+
+	if err := p.Reconnect(connection); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Reconnect starts listening with a new connection string, for example after
+// the database credentials have been rotated
+func (p *PostgresBroker) Reconnect(connection string) error {
+	l := pq.NewListener(connection, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			p.log.Error("Event listener error", "error", err)
+		}
+	})
+
+	if err := l.Listen(eventChannel); err != nil {
+		l.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	go p.receive(l, done)
+
+	p.mu.Lock()
+	old, oldDone := p.listener, p.done
+	p.listener, p.done = l, done
+	p.mu.Unlock()
+
+	if old != nil {
+		close(oldDone)
+		old.Close()
+		// notifications sent while switching listeners may have been missed
+		p.dispatch(model.OutboxEvent{})
+	}
+
+	return nil
+}
+
+// Publish implements Broker
+func (p *PostgresBroker) Publish(e model.OutboxEvent) error {
+	return p.notifier.Notify(eventChannel, strconv.FormatInt(e.ID, 10))
+}
+
+// Subscribe implements Broker
+func (p *PostgresBroker) Subscribe(handler func(e model.OutboxEvent)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handler = handler
+}
+
+// Close stops listening for events
+func (p *PostgresBroker) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.listener == nil {
+		return nil
+	}
+
+	close(p.done)
+	err := p.listener.Close()
+	p.listener = nil
+
+	return err
+}
+
+func (p *PostgresBroker) receive(l *pq.Listener, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case n, ok := <-l.NotificationChannel():
+			if !ok {
+				return
+			}
+
+			// a nil notification is sent after the connection is re-established
+			if n == nil {
+				p.log.Info("Event listener reconnected, events may have been missed")
+				p.dispatch(model.OutboxEvent{})
+				continue
+			}
+
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				p.log.Error("Unable to decode event notification", "payload", n.Extra, "error", err)
+				continue
+			}
+
+			e, err := p.reader.GetOutboxEvent(id)
+			if err != nil {
+				p.log.Error("Unable to read event", "id", id, "error", err)
+				p.dispatch(model.OutboxEvent{})
+				continue
+			}
+
+			p.dispatch(e)
+		}
+	}
+}
+
+func (p *PostgresBroker) dispatch(e model.OutboxEvent) {
+	p.mu.Lock()
+	h := p.handler
+	p.mu.Unlock()
+
+	if h != nil {
+		h(e)
+	}
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/telemetry"
+	"github.com/hashicorp/go-hclog"
+)
+
+// CachedConnection is a Connection which caches validated tokens so that
+// authenticating a request does not always query the database. Tokens are
+// cached for a short TTL and are removed as soon as they are revoked in this
+// process, revocations in other replicas are received through an Invalidator.
+type CachedConnection struct {
+	Connection
+
+	ttl         time.Duration
+	invalidator Invalidator
+	log         hclog.Logger
+	telemetry   *telemetry.Telemetry
+
+	mu      sync.Mutex
+	size    int
+	entries map[tokenKey]*list.Element
+	lru     *list.List
+	// generation changes on every invalidation so a lookup which started
+	// before a token was revoked does not cache the stale result
+	generation uint64
+}
+
+type tokenKey struct {
+	tokenID int
+	userID  int
+}
+
+type cacheEntry struct {
+	key     tokenKey
+	token   model.Token
+	expires time.Time
+}
+
+// NewCachedConnection wraps con with a token cache holding at most size
+// tokens for ttl
+func NewCachedConnection(con Connection, size int, ttl time.Duration, inv Invalidator, t *telemetry.Telemetry, l hclog.Logger) *CachedConnection {
+	if t != nil {
+		t.AddCounter("auth.token_cache.hit")
+		t.AddCounter("auth.token_cache.miss")
+	}
+
+	c := &CachedConnection{
+		Connection:  con,
+		ttl:         ttl,
+		invalidator: inv,
+		log:         l,
+		telemetry:   t,
+		size:        size,
+		entries:     map[tokenKey]*list.Element{},
+		lru:         list.New(),
+	}
+
+	inv.Subscribe(c.invalidate)
+
+	return c
+}
+
+// Reconnect implements Reconnector when the wrapped connection does
+func (c *CachedConnection) Reconnect(connection string) error {
+	r, ok := c.Connection.(Reconnector)
+	if !ok {
+		return fmt.Errorf("connection does not support reconnecting")
+	}
+
+	return r.Reconnect(connection)
+}
+
+// GetToken returns a cached token or checks the token in the database
+func (c *CachedConnection) GetToken(tokenID int, userID int) (model.Token, error) {
+	key := tokenKey{tokenID, userID}
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if time.Now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.increment("auth.token_cache.hit")
+			return e.token, nil
+		}
+
+		c.remove(el)
+	}
+	gen := c.generation
+	c.mu.Unlock()
+
+	c.increment("auth.token_cache.miss")
+
+	t, err := c.Connection.GetToken(tokenID, userID)
+	if err != nil {
+		return t, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.generation {
+		return t, nil
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key, t, time.Now().Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+
+	return t, nil
+}
+
+// DeleteToken revokes a token and removes it from the cache
+func (c *CachedConnection) DeleteToken(tokenID int, userID int) error {
+	err := c.Connection.DeleteToken(tokenID, userID)
+	c.revoked(Invalidation{TokenID: tokenID, UserID: userID})
+
+	return err
+}
+
+// DeleteTokens revokes all tokens for a user and removes them from the cache
+func (c *CachedConnection) DeleteTokens(userID int) error {
+	err := c.Connection.DeleteTokens(userID)
+	c.revoked(Invalidation{UserID: userID})
+
+	return err
+}
+
+// ChangePassword changes the password and removes the user's tokens from the cache
+func (c *CachedConnection) ChangePassword(userID int, tokenID int, password string) error {
+	err := c.Connection.ChangePassword(userID, tokenID, password)
+	c.revoked(Invalidation{UserID: userID})
+
+	return err
+}
+
+// ResetPassword resets the password and removes the user's tokens from the cache
+func (c *CachedConnection) ResetPassword(tokenHash string, password string) (int, error) {
+	userID, err := c.Connection.ResetPassword(tokenHash, password)
+	if err == nil {
+		c.revoked(Invalidation{UserID: userID})
+	}
+
+	return userID, err
+}
+
+// DeleteUser deletes the user and removes their tokens from the cache
+func (c *CachedConnection) DeleteUser(userID int) error {
+	err := c.Connection.DeleteUser(userID)
+	c.revoked(Invalidation{UserID: userID})
+
+	return err
+}
+
+// SetUserDisabled disables the user and removes their tokens from the cache
+func (c *CachedConnection) SetUserDisabled(userID int, disabled bool) error {
+	err := c.Connection.SetUserDisabled(userID, disabled)
+	c.revoked(Invalidation{UserID: userID})
+
+	return err
+}
+
+// revoked invalidates the local cache and publishes the invalidation, this
+// happens even when the database call failed as it may have been applied
+func (c *CachedConnection) revoked(i Invalidation) {
+	c.invalidate(i)
+
+	if err := c.invalidator.Publish(i); err != nil {
+		c.log.Error("Unable to publish token invalidation", "error", err)
+	}
+}
+
+func (c *CachedConnection) invalidate(i Invalidation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	if !i.All && i.TokenID != 0 {
+		if el, ok := c.entries[tokenKey{i.TokenID, i.UserID}]; ok {
+			c.remove(el)
+		}
+
+		return
+	}
+
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		k := el.Value.(*cacheEntry).key
+
+		if i.All || k.userID == i.UserID {
+			c.remove(el)
+		}
+
+		el = next
+	}
+}
+
+// remove an element, callers must hold c.mu
+func (c *CachedConnection) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+func (c *CachedConnection) increment(key string) {
+	if c.telemetry != nil {
+		c.telemetry.Increment(key)
+	}
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testInvalidator records published invalidations and allows invalidations
+// from other replicas to be simulated
+type testInvalidator struct {
+	published []Invalidation
+	handler   func(i Invalidation)
+}
+
+func (t *testInvalidator) Publish(i Invalidation) error {
+	t.published = append(t.published, i)
+	return nil
+}
+
+func (t *testInvalidator) Subscribe(handler func(i Invalidation)) {
+	t.handler = handler
+}
+
+func setupCache(size int, ttl time.Duration) (*CachedConnection, *MockConnection, *testInvalidator) {
+	m := &MockConnection{}
+	m.On("GetToken").Return(model.Token{ID: 1, UserID: 1}, nil)
+	m.On("DeleteToken").Return(nil)
+	m.On("DeleteTokens", 1).Return(nil)
+
+	inv := &testInvalidator{}
+
+	return NewCachedConnection(m, size, ttl, inv, nil, hclog.NewNullLogger()), m, inv
+}
+
+func TestCachesValidTokens(t *testing.T) {
+	c, m, _ := setupCache(10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		tk, err := c.GetToken(1, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, tk.ID)
+	}
+
+	m.AssertNumberOfCalls(t, "GetToken", 1)
+}
+
+func TestDoesNotCacheInvalidTokens(t *testing.T) {
+	m := &MockConnection{}
+	m.On("GetToken").Return(nil, errors.New("Invalid token"))
+	c := NewCachedConnection(m, 10, time.Minute, &LocalInvalidator{}, nil, hclog.NewNullLogger())
+
+	c.GetToken(1, 1)
+	_, err := c.GetToken(1, 1)
+
+	assert.Error(t, err)
+	m.AssertNumberOfCalls(t, "GetToken", 2)
+}
+
+func TestExpiresCachedTokens(t *testing.T) {
+	c, m, _ := setupCache(10, time.Millisecond)
+
+	c.GetToken(1, 1)
+	time.Sleep(5 * time.Millisecond)
+	c.GetToken(1, 1)
+
+	m.AssertNumberOfCalls(t, "GetToken", 2)
+}
+
+func TestEvictsLeastRecentlyUsedTokens(t *testing.T) {
+	c, m, _ := setupCache(2, time.Minute)
+
+	c.GetToken(1, 1)
+	c.GetToken(2, 1)
+	c.GetToken(1, 1)
+	c.GetToken(3, 1)
+
+	assert.Len(t, c.entries, 2)
+	assert.Contains(t, c.entries, tokenKey{1, 1})
+	assert.NotContains(t, c.entries, tokenKey{2, 1})
+	m.AssertNumberOfCalls(t, "GetToken", 3)
+}
+
+func TestDeleteTokenInvalidatesAndPublishes(t *testing.T) {
+	c, m, inv := setupCache(10, time.Minute)
+
+	c.GetToken(1, 1)
+	c.GetToken(2, 1)
+	assert.NoError(t, c.DeleteToken(1, 1))
+
+	assert.NotContains(t, c.entries, tokenKey{1, 1})
+	assert.Contains(t, c.entries, tokenKey{2, 1})
+	assert.Equal(t, []Invalidation{{TokenID: 1, UserID: 1}}, inv.published)
+
+	c.GetToken(1, 1)
+	m.AssertNumberOfCalls(t, "GetToken", 3)
+}
+
+func TestDeleteTokensInvalidatesAllForUser(t *testing.T) {
+	c, _, _ := setupCache(10, time.Minute)
+
+	c.GetToken(1, 1)
+	c.GetToken(2, 1)
+	c.GetToken(3, 2)
+	assert.NoError(t, c.DeleteTokens(1))
+
+	assert.Len(t, c.entries, 1)
+	assert.Contains(t, c.entries, tokenKey{3, 2})
+}
+
+func TestAppliesInvalidationsFromOtherReplicas(t *testing.T) {
+	c, _, inv := setupCache(10, time.Minute)
+
+	c.GetToken(1, 1)
+	c.GetToken(3, 2)
+
+	inv.handler(Invalidation{TokenID: 1, UserID: 1})
+	assert.Len(t, c.entries, 1)
+
+	inv.handler(Invalidation{All: true})
+	assert.Len(t, c.entries, 0)
+}
+
+func TestDoesNotCacheLookupRacingInvalidation(t *testing.T) {
+	c, _, _ := setupCache(10, time.Minute)
+
+	// simulate a revocation while the database lookup is in flight
+	m := &MockConnection{}
+	m.On("GetToken").Run(func(a mock.Arguments) {
+		c.invalidate(Invalidation{TokenID: 1, UserID: 1})
+	}).Return(model.Token{ID: 1, UserID: 1}, nil)
+	c.Connection = m
+
+	_, err := c.GetToken(1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, c.entries, 0)
+}
@@ -1,49 +1,283 @@
 package data
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
-	//"database/sql"
+	"github.com/hashicorp-demoapp/product-api-go/promotions"
+	"github.com/hashicorp-demoapp/product-api-go/telemetry"
+	"github.com/hashicorp/go-hclog"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// SchemaVersion is the version of the database schema this code requires
+const SchemaVersion = 23
+
+// lastUsedInterval limits how often the last used time of a token is written
+const lastUsedInterval = time.Minute
+
+// ErrInvalidCredentials is returned by AuthUser when the username or password
+// is wrong, it does not say which so usernames can not be discovered
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+// ErrInvalidResetToken is returned by ResetPassword when the token does not
+// exist, has expired or has already been used
+var ErrInvalidResetToken = errors.New("Invalid or expired reset token")
+
+// ErrEmailInUse is returned by UpdateUser when another user has the email address
+var ErrEmailInUse = errors.New("Email already in use")
+
+// ErrUsernameInUse is returned by CreateUserWithIdentity when the username is
+// taken
+var ErrUsernameInUse = errors.New("Username already in use")
+
+// ErrUserNotFound is returned when a user does not exist or has been deleted
+var ErrUserNotFound = errors.New("User not found")
+
+// ErrSessionNotFound is returned when a token does not exist, belongs to
+// another user or has already been revoked
+var ErrSessionNotFound = errors.New("Session not found")
+
+// ErrUnknownIdentity is returned by GetUserByIdentity when the identity is not
+// linked to a user
+var ErrUnknownIdentity = errors.New("Identity is not linked to a user")
+
+// ErrIdentityInUse is returned when the identity is already linked to a user
+var ErrIdentityInUse = errors.New("Identity is already linked to a user")
+
+// ErrOrderNotFound is returned when the order does not exist or belongs to
+// another user
+var ErrOrderNotFound = errors.New("Order not found")
+
+// ErrOrderItemNotFound is returned when the item is not part of the order
+var ErrOrderItemNotFound = errors.New("Order item not found")
+
+// ErrCoffeeNotFound is returned when an order item is for a coffee which
+// does not exist
+var ErrCoffeeNotFound = errors.New("Coffee not found")
+
+// ErrCoffeeUnavailable is returned when ordering a coffee which the store
+// of the order does not sell
+var ErrCoffeeUnavailable = errors.New("Coffee is not available at this store")
+
+// ErrStoreNotFound is returned when a store does not exist or has been
+// deleted
+var ErrStoreNotFound = errors.New("Store not found")
+
+// ErrCartItemNotFound is returned when the item is not in the user's cart
+var ErrCartItemNotFound = errors.New("Cart item not found")
+
+// ErrCartEmpty is returned when checking out a cart without items
+var ErrCartEmpty = errors.New("Cart is empty")
+
+// ErrCartChanged is returned when the price or availability of items in a cart
+// changed since they were added, the cart is updated to the current prices
+var ErrCartChanged = errors.New("Cart has changed")
+
+// ErrPromotionNotFound is returned when a promotion does not exist or has
+// been deleted
+var ErrPromotionNotFound = errors.New("Promotion not found")
+
+// ErrPromotionCodeInUse is returned when creating a promotion with the code
+// of an existing promotion
+var ErrPromotionCodeInUse = errors.New("Promotion code is already in use")
+
+// ErrOrderPaid is returned when changing or paying for an order which has
+// already been paid for
+var ErrOrderPaid = errors.New("Order has been paid for")
+
+// ErrPaymentInProgress is returned when changing or paying for an order while
+// a payment for it is in progress
+var ErrPaymentInProgress = errors.New("Payment is in progress")
+
+// ErrPaymentNotFound is returned when a payment does not exist
+var ErrPaymentNotFound = errors.New("Payment not found")
+
+// ErrPaymentChanged is returned by UpdatePayment when the payment no longer
+// has the status it was read with, the payment is not updated
+var ErrPaymentChanged = errors.New("Payment has changed")
+
+// ErrPickupSlotFull is returned when creating an order for a pickup time in a
+// window which has no capacity left
+var ErrPickupSlotFull = errors.New("Pickup slot is full")
+
+// ErrOrderNotQueued is returned when preparing an order which is not waiting
+// in the queue or being prepared
+var ErrOrderNotQueued = errors.New("Order is not in the queue")
+
+// ErrOrderClaimed is returned when preparing an order which another member of
+// staff has claimed
+var ErrOrderClaimed = errors.New("Order has been claimed by someone else")
+
+// ErrOrderItemsNotPrepared is returned when completing an order before all of
+// its items have been prepared
+var ErrOrderItemsNotPrepared = errors.New("Order items have not been prepared")
+
+// ErrWebhookSubscriptionNotFound is returned when a webhook subscription does
+// not exist or has been deleted
+var ErrWebhookSubscriptionNotFound = errors.New("Webhook subscription not found")
+
+// ErrWebhookDeliveryNotFound is returned when a webhook delivery does not exist
+var ErrWebhookDeliveryNotFound = errors.New("Webhook delivery not found")
+
+// ErrVersionMismatch is returned when a change is made to an older version of
+// a record than the one stored
+var ErrVersionMismatch = errors.New("Version does not match")
+
+// ErrInvalidAPIKey is returned by GetAPIKey when the key does not exist, has
+// been revoked or has expired
+var ErrInvalidAPIKey = errors.New("Invalid API key")
+
+// apiKeyColumns are the columns selected when reading an API key
+const apiKeyColumns = `id, name, prefix, user_id, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+// promotionColumns are the columns selected when reading a promotion
+const promotionColumns = `id, code, name, type, percent, amount, buy_quantity, coffee_id, collection, stackable, starts_at, ends_at, max_uses, max_uses_per_user, created_at, 
+	(SELECT count(*) FROM order_discounts d WHERE d.promotion_id = promotions.id) AS uses, 
+	deleted_at IS NULL AND (starts_at IS NULL OR starts_at <= now() at time zone 'utc') AND (ends_at IS NULL OR ends_at > now() at time zone 'utc') AS active`
+
+// userColumns are the columns selected when reading a user
+const userColumns = `id, username, role, display_name, COALESCE(email, '') AS email, preferences, disabled_at IS NOT NULL AS disabled`
+
 type Connection interface {
 	IsConnected() (bool, error)
+	GetSchemaVersion() (int, error)
 	GetCoffees(*int) (model.Coffees, error)
 	GetIngredientsForCoffee(int) (model.Ingredients, error)
 	CreateUser(string, string) (model.User, error)
 	AuthUser(string, string) (model.User, error)
-	CreateToken(int) (model.Token, error)
+	GetUser(int) (model.User, error)
+	GetUserByUsername(string) (model.User, error)
+	UpdateUser(model.User) (model.User, error)
+	DeleteUser(int) error
+	ListUsers(string, int, int) (model.Users, error)
+	SetUserDisabled(int, bool) error
+	ChangePassword(int, int, string) error
+	CreatePasswordReset(int, string, time.Time) error
+	ResetPassword(string, string) (int, error)
+	CreateToken(model.Token) (model.Token, error)
 	GetToken(int, int) (model.Token, error)
 	DeleteToken(int, int) error
+	GetSessions(int) (model.Sessions, error)
+	DeleteTokens(int) error
+	PurgeTokens() (int64, error)
+	CreateAPIKey(model.APIKey, string) (model.APIKey, error)
+	GetAPIKey(string) (model.APIKey, error)
+	ListAPIKeys() (model.APIKeys, error)
+	RevokeAPIKey(int) error
+	GetUserByIdentity(string, string) (model.User, error)
+	CreateUserWithIdentity(model.User, model.Identity) (model.User, error)
+	LinkIdentity(int, model.Identity) error
+	GetIdentities(int) (model.Identities, error)
+	ClaimIdempotencyKey(model.IdempotencyKey, time.Duration, time.Duration) (model.IdempotencyKey, bool, error)
+	CompleteIdempotencyKey(model.IdempotencyKey) error
+	ReleaseIdempotencyKey(int, string) error
+	PurgeIdempotencyKeys() (int64, error)
 	GetOrders(int, *int) (model.Orders, error)
-	CreateOrder(int, []model.OrderItems) (model.Order, error)
-	UpdateOrder(int, int, []model.OrderItems) (model.Order, error)
-	DeleteOrder(int, int) error
+	CreateOrder(int, []model.OrderItems, []string, *model.PickupSlot, *int) (model.Order, error)
+	UpdateOrder(int, int, []model.OrderItems, *int) (model.Order, error)
+	DeleteOrder(int, int, *int) error
+	AddOrderItem(int, int, model.OrderItems, *int) (model.Order, error)
+	UpdateOrderItem(int, int, int, int, *int) (model.Order, error)
+	DeleteOrderItem(int, int, int, *int) (model.Order, error)
+	GetCart(int) (model.Cart, error)
+	AddCartItem(int, int, int, *int) (model.Cart, error)
+	UpdateCartItem(int, int, int, *int) (model.Cart, error)
+	DeleteCartItem(int, int, *int) (model.Cart, error)
+	CheckoutCart(int, *int, []string, *model.PickupSlot, *int) (model.Order, model.CartChanges, error)
+	CreatePromotion(model.Promotion) (model.Promotion, error)
+	ListPromotions() (model.Promotions, error)
+	DeletePromotion(int) error
+	CreatePayment(int, int, string) (model.Payment, error)
+	UpdatePayment(model.Payment, string) (model.Payment, error)
+	GetPaymentByReference(string, string) (model.Payment, error)
+	GetPayments(int) (model.Payments, error)
+	CreateWebhookSubscription(model.WebhookSubscription) (model.WebhookSubscription, error)
+	ListWebhookSubscriptions() (model.WebhookSubscriptions, error)
+	DeleteWebhookSubscription(int) error
+	ListWebhookDeliveries(int, string, int, int) (model.WebhookDeliveries, error)
+	RetryWebhookDelivery(int) error
+	ClaimWebhookDeliveries(int, time.Duration) (model.WebhookDeliveries, error)
+	UpdateWebhookDelivery(model.WebhookDelivery, time.Duration) error
+	QueueWebhookDeliveries(model.OutboxEvent) error
+	RelayOutboxEvents(int, int, func(model.OutboxEvent) error) (int, int, error)
+	GetOutboxLag() (int, time.Duration, error)
+	PurgeOutboxEvents(time.Duration) (int64, error)
+	GetOutboxEvent(int64) (model.OutboxEvent, error)
+	GetOrderEvents(int, *int, int64, int) ([]model.OutboxEvent, error)
+	GetOrderQueue(*int, int, int) (model.QueuedOrders, error)
+	ClaimOrder(int, int) (model.QueuedOrder, error)
+	PrepareOrderItem(int, int, int) (model.QueuedOrder, error)
+	CompleteOrder(int, int) (model.QueuedOrder, error)
+	ReleaseScheduledOrders(time.Duration) (int, error)
 	CreateCoffee(model.Coffee) (model.Coffee, error)
+	CreateStore(model.Store) (model.Store, error)
+	ListStores() (model.Stores, error)
+	GetStore(int) (model.Store, error)
+	UpdateStore(model.Store) (model.Store, error)
+	DeleteStore(int) error
+	GetStoreCoffees(int) (model.Coffees, error)
+	ListStoreCoffees(int) (model.StoreCoffees, error)
+	SetStoreCoffee(model.StoreCoffee) (model.StoreCoffee, error)
+	DeleteStoreCoffee(int, int) error
+	GetPriceList(string) (model.CoffeePrices, error)
+	SetCoffeePrice(model.CoffeePrice) (model.CoffeePrice, error)
+	DeleteCoffeePrice(int, string) error
 	UpsertCoffeeIngredient(model.Coffee, model.Ingredient) (model.CoffeeIngredient, error)
+	CreateAuditEvent(model.AuditEvent) error
+}
+
+// Reconnector is implemented by connections which can switch to new
+// credentials without a restart
+type Reconnector interface {
+	Reconnect(connection string) error
 }
 
 type PostgresSQL struct {
-	db *sqlx.DB
+	pool *pool
 }
 
 // New creates a new connection to the database
 func New(connection string) (Connection, error) {
-	db, err := sqlx.Connect("postgres", connection)
+	return NewRotating(connection, nil, nil, hclog.NewNullLogger())
+}
+
+// NewRotating creates a new connection to the database which calls credentials
+// to fetch a new connection string when the database rejects the credentials
+// in use, for example after they have been rotated. Queries switch to a new
+// connection pool using the new credentials and the old pool is drained.
+func NewRotating(connection string, credentials CredentialsFunc, t *telemetry.Telemetry, l hclog.Logger) (Connection, error) {
+	p, err := newPool(connection, credentials, t, l)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PostgresSQL{db}, nil
+	return &PostgresSQL{p}, nil
+}
+
+// db returns the current connection pool
+func (c *PostgresSQL) db() *sqlx.DB {
+	return c.pool.get()
+}
+
+// Reconnect switches to a new connection pool when the connection string has
+// changed. New queries use the new pool immediately and the old pool is closed
+// once the queries already running on it have finished.
+func (c *PostgresSQL) Reconnect(connection string) error {
+	return c.pool.reconnect(connection)
 }
 
 // IsConnected checks the connection to the database and returns an error if not connected
 func (c *PostgresSQL) IsConnected() (bool, error) {
-	err := c.db.Ping()
+	err := c.db().Ping()
 	if err != nil {
 		return false, err
 	}
@@ -51,41 +285,62 @@ func (c *PostgresSQL) IsConnected() (bool, error) {
 	return true, nil
 }
 
+// GetSchemaVersion returns the latest schema migration applied to the database
+func (c *PostgresSQL) GetSchemaVersion() (int, error) {
+	v := 0
+
+	err := c.db().Get(&v, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
 // GetCoffees returns all coffees from the database
 func (c *PostgresSQL) GetCoffees(coffeeid *int) (model.Coffees, error) {
 	cos := model.Coffees{}
 
 	if coffeeid != nil {
-		err := c.db.Select(&cos, "SELECT * FROM coffees WHERE id = $1", &coffeeid)
+		err := c.db().Select(&cos, "SELECT * FROM coffees WHERE id = $1", &coffeeid)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		err := c.db.Select(&cos, "SELECT * FROM coffees")
+		err := c.db().Select(&cos, "SELECT * FROM coffees")
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// fetch the ingredients for each coffee
+	err := c.fillCoffeeIngredients(cos)
+	if err != nil {
+		return nil, err
+	}
+
+	return cos, nil
+}
+
+// fillCoffeeIngredients fetches the ingredients for each coffee
+func (c *PostgresSQL) fillCoffeeIngredients(cos model.Coffees) error {
 	for n, cof := range cos {
 		i := []model.CoffeeIngredient{}
-		err := c.db.Select(&i, "SELECT ingredient_id FROM coffee_ingredients WHERE coffee_id=$1 AND quantity > 0", cof.ID)
+		err := c.db().Select(&i, "SELECT ingredient_id FROM coffee_ingredients WHERE coffee_id=$1 AND quantity > 0", cof.ID)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		cos[n].Ingredients = i
 	}
 
-	return cos, nil
+	return nil
 }
 
 // GetIngredientsForCoffee get the ingredients for the given coffeeid
 func (c *PostgresSQL) GetIngredientsForCoffee(coffeeid int) (model.Ingredients, error) {
 	is := []model.Ingredient{}
 
-	err := c.db.Select(&is,
+	err := c.db().Select(&is,
 		`SELECT ingredients.id, ingredients.name, coffee_ingredients.quantity, coffee_ingredients.unit FROM ingredients 
 		 LEFT JOIN coffee_ingredients ON ingredients.id=coffee_ingredients.ingredient_id 
 		 WHERE coffee_ingredients.coffee_id=$1 AND coffee_ingredients.deleted_at IS NULL`,
@@ -102,7 +357,7 @@ func (c *PostgresSQL) GetIngredientsForCoffee(coffeeid int) (model.Ingredients,
 func (c *PostgresSQL) CreateUser(username string, password string) (model.User, error) {
 	u := model.User{}
 
-	rows, err := c.db.NamedQuery(
+	rows, err := c.db().NamedQuery(
 		`INSERT INTO users (username, password, created_at, updated_at) 
 		VALUES(:username, crypt(:password, gen_salt('bf')), now(), now()) 
 		RETURNING id, username;`, map[string]interface{}{
@@ -126,18 +381,50 @@ func (c *PostgresSQL) CreateUser(username string, password string) (model.User,
 
 // AuthUser checks whether username and password matches
 func (c *PostgresSQL) AuthUser(username string, password string) (model.User, error) {
+	us := []struct {
+		model.User
+		Valid bool `db:"valid"`
+	}{}
+
+	err := c.db().Select(&us,
+		`SELECT `+userColumns+`, password = crypt($2, password) AS valid FROM users 
+		WHERE username = $1 AND deleted_at IS NULL AND disabled_at IS NULL;`,
+		username, password,
+	)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	// If user does not exist, or is deleted or disabled, hash the password anyway so the response takes
+	// the same time as for a user which does exist
+	if len(us) < 1 {
+		if _, err := c.db().Exec(`SELECT crypt($1, gen_salt('bf'));`, password); err != nil {
+			return model.User{}, err
+		}
+
+		return model.User{}, ErrInvalidCredentials
+	}
+
+	if !us[0].Valid {
+		return model.User{}, ErrInvalidCredentials
+	}
+
+	return us[0].User, nil
+}
+
+// GetUser returns the user with the given id
+func (c *PostgresSQL) GetUser(userID int) (model.User, error) {
 	us := []model.User{}
 
-	err := c.db.Select(&us,
-		`SELECT id, username FROM users 
-		WHERE username = $1 AND password = crypt($2, password);`,
-		username, password,
+	err := c.db().Select(&us,
+		`SELECT `+userColumns+` FROM users 
+		WHERE id = $1 AND deleted_at IS NULL;`,
+		userID,
 	)
 	if err != nil {
 		return model.User{}, err
 	}
 
-	// If user does not exist
 	if len(us) < 1 {
 		return model.User{}, errors.New("User does not exist")
 	}
@@ -145,288 +432,2551 @@ func (c *PostgresSQL) AuthUser(username string, password string) (model.User, er
 	return us[0], nil
 }
 
-// CreateToken creates a new token
-func (c *PostgresSQL) CreateToken(userID int) (model.Token, error) {
-	token := model.Token{}
+// GetUserByUsername returns the user with the given username
+func (c *PostgresSQL) GetUserByUsername(username string) (model.User, error) {
+	us := []model.User{}
 
-	rows, err := c.db.NamedQuery(
-		`INSERT INTO tokens (user_id, created_at) 
-		VALUES(:user_id, now()) 
-		RETURNING id;`, map[string]interface{}{
-			"user_id": userID,
-		})
+	err := c.db().Select(&us,
+		`SELECT `+userColumns+` FROM users 
+		WHERE username = $1 AND deleted_at IS NULL AND disabled_at IS NULL;`,
+		username,
+	)
 	if err != nil {
-		return token, err
+		return model.User{}, err
 	}
-	defer rows.Close()
 
-	if rows.Next() {
-		err := rows.StructScan(&token)
-		if err != nil {
-			return token, err
-		}
+	if len(us) < 1 {
+		return model.User{}, errors.New("User does not exist")
 	}
 
-	return token, nil
+	return us[0], nil
 }
 
-// GetToken checks whether token exists
-func (c *PostgresSQL) GetToken(tokenID int, userID int) (model.Token, error) {
-	token := []model.Token{}
+// UpdateUser updates the profile of a user
+func (c *PostgresSQL) UpdateUser(u model.User) (model.User, error) {
+	us := []model.User{}
 
-	err := c.db.Select(&token,
-		`SELECT id, user_id FROM tokens 
-		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL;`,
-		tokenID, userID,
+	err := c.db().Select(&us,
+		`UPDATE users SET display_name = $2, email = NULLIF($3, ''), preferences = $4, updated_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL 
+		RETURNING `+userColumns,
+		u.ID, u.DisplayName, u.Email, u.Preferences,
 	)
 	if err != nil {
-		return model.Token{}, err
+		if isUniqueViolation(err) {
+			return model.User{}, ErrEmailInUse
+		}
+
+		return model.User{}, err
 	}
 
-	if len(token) == 0 {
-		return model.Token{}, fmt.Errorf("Invalid token")
+	if len(us) < 1 {
+		return model.User{}, errors.New("User does not exist")
 	}
 
-	return token[0], nil
+	return us[0], nil
 }
 
-// DeleteToken deletes an existing token in the database
-func (c *PostgresSQL) DeleteToken(tokenID int, userID int) error {
-	tx := c.db.MustBegin()
+// DeleteUser soft deletes a user and revokes all of their tokens
+func (c *PostgresSQL) DeleteUser(userID int) error {
+	tx, err := c.db().Beginx()
+	if err != nil {
+		return err
+	}
 
-	_, err := tx.NamedExec(
-		`UPDATE tokens SET deleted_at = now()
-		WHERE id = :token_id AND user_id = :user_id AND deleted_at IS NULL`, map[string]interface{}{
-			"token_id": tokenID,
-			"user_id":  userID,
-		})
+	_, err = tx.Exec(
+		`UPDATE users SET deleted_at = now(), updated_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, userID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	err = tx.Commit()
+	_, err = tx.Exec(
+		`UPDATE tokens SET deleted_at = now() 
+		WHERE user_id = $1 AND deleted_at IS NULL`, userID)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	return nil
-}
-
-// GetOrders returns orders from the database
-func (c *PostgresSQL) GetOrders(userID int, orderID *int) (model.Orders, error) {
-	orders := model.Orders{}
-
-	if orderID != nil {
-		err := c.db.Select(&orders,
-			`SELECT * FROM orders WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL`,
-			userID, orderID)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		err := c.db.Select(&orders,
-			`SELECT * FROM orders WHERE user_id = $1 AND deleted_at IS NULL`,
-			userID)
-		if err != nil {
-			return nil, err
-		}
+	// unlink external identities so they can sign up again
+	_, err = tx.Exec(`DELETE FROM user_identities WHERE user_id = $1`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	// fetch the coffee for each order
-	for n, order := range orders {
-		items := []model.OrderItems{}
-		err := c.db.Select(&items,
-			`SELECT * FROM order_items WHERE order_id=$1 AND deleted_at IS NULL`, order.ID)
-		if err != nil {
-			return nil, err
-		}
-		orders[n].Items = items
-
-		for i, item := range items {
-			coffee := model.Coffees{}
-			err := c.db.Select(&coffee,
-				`SELECT * FROM coffees WHERE id=$1 AND deleted_at IS NULL`, item.CoffeeID)
-			if err != nil {
-				return nil, err
-			}
-
-			if len(coffee) > 0 {
-				orders[n].Items[i].Coffee = coffee[0]
+	_, err = tx.Exec(
+		`DELETE FROM cart_items 
+		WHERE cart_id IN (SELECT id FROM carts WHERE user_id = $1)`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
-				ing := []model.CoffeeIngredient{}
-				err := c.db.Select(&ing, "SELECT ingredient_id FROM coffee_ingredients WHERE coffee_id=$1 AND quantity > 0", orders[n].Items[i].Coffee.ID)
-				if err != nil {
-					return nil, err
-				}
+	return tx.Commit()
+}
 
-				orders[n].Items[i].Coffee.Ingredients = ing
-			}
-		}
+// ListUsers returns users whose username, display name or email contains
+// query, ordered by id
+func (c *PostgresSQL) ListUsers(query string, limit int, offset int) (model.Users, error) {
+	us := model.Users{}
+
+	err := c.db().Select(&us,
+		`SELECT `+userColumns+` FROM users 
+		WHERE deleted_at IS NULL 
+		AND ($1 = '' OR username ILIKE '%' || $1 || '%' OR display_name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%') 
+		ORDER BY id LIMIT $2 OFFSET $3;`,
+		query, limit, offset,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	return orders, nil
+	return us, nil
 }
 
-// CreateOrder creates a new order in the database
-func (c *PostgresSQL) CreateOrder(userID int, orderItems []model.OrderItems) (model.Order, error) {
-	tx := c.db.MustBegin()
-
-	o := model.Order{}
-	rows, err := tx.NamedQuery(
-		`INSERT INTO orders (user_id, created_at, updated_at) 
-		VALUES (:user_id, now(), now()) RETURNING id`, map[string]interface{}{
-			"user_id": userID,
-		})
+// SetUserDisabled disables or enables a user, all tokens for a disabled user
+// are revoked
+func (c *PostgresSQL) SetUserDisabled(userID int, disabled bool) error {
+	tx, err := c.db().Beginx()
 	if err != nil {
-		return o, err
+		return err
 	}
-	if rows.Next() {
-		err := rows.StructScan(&o)
-		if err != nil {
-			tx.Rollback()
-			return o, err
-		}
+
+	res, err := tx.Exec(
+		`UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END, updated_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, userID, disabled)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	rows.Close()
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		tx.Rollback()
+		return ErrUserNotFound
+	}
 
-	for _, item := range orderItems {
-		_, err = tx.NamedExec(
-			`INSERT INTO order_items (order_id, coffee_id, quantity, created_at, updated_at) 
-			VALUES (:order_id, :coffee_id, :quantity, now(), now())`, map[string]interface{}{
-				"order_id":  o.ID,
-				"coffee_id": item.Coffee.ID,
-				"quantity":  item.Quantity,
-			})
+	if disabled {
+		_, err = tx.Exec(
+			`UPDATE tokens SET deleted_at = now() 
+			WHERE user_id = $1 AND deleted_at IS NULL`, userID)
 		if err != nil {
 			tx.Rollback()
-			return o, err
+			return err
 		}
 	}
 
-	err = tx.Commit()
+	return tx.Commit()
+}
+
+// ChangePassword sets a new password for the user and revokes every token
+// other than tokenID so other sessions must sign in again
+func (c *PostgresSQL) ChangePassword(userID int, tokenID int, password string) error {
+	tx, err := c.db().Beginx()
 	if err != nil {
-		return o, err
+		return err
 	}
 
-	orders, err := c.GetOrders(userID, &o.ID)
+	_, err = tx.Exec(
+		`UPDATE users SET password = crypt($2, gen_salt('bf')), updated_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, userID, password)
 	if err != nil {
-		return o, err
+		tx.Rollback()
+		return err
 	}
 
-	if len(orders) == 0 {
-		return o, err
+	_, err = tx.Exec(
+		`UPDATE tokens SET deleted_at = now() 
+		WHERE user_id = $1 AND id <> $2 AND deleted_at IS NULL`, userID, tokenID)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	return orders[0], nil
+	return tx.Commit()
 }
 
-// UpdateOrder updates an existing order in the database
-func (c *PostgresSQL) UpdateOrder(userID int, orderID int, orderItems []model.OrderItems) (model.Order, error) {
-	tx := c.db.MustBegin()
-
-	o := model.Order{}
-	rows, err := tx.NamedQuery(
-		`UPDATE orders SET updated_at = now()
-		WHERE user_id = :user_id AND id = :order_id RETURNING *`, map[string]interface{}{
-			"user_id":  userID,
-			"order_id": orderID,
-		})
+// CreatePasswordReset stores the hash of a reset token for the user, reset
+// tokens issued earlier are no longer valid
+func (c *PostgresSQL) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := c.db().Beginx()
 	if err != nil {
-		return o, err
-	}
-	if rows.Next() {
-		err := rows.StructScan(&o)
-		if err != nil {
-			tx.Rollback()
-			return o, err
-		}
+		return err
 	}
 
-	rows.Close()
-
-	// remove existing items from order
-	_, err = tx.NamedExec(
-		`UPDATE order_items SET deleted_at = now()
-		WHERE order_id = :order_id AND deleted_at IS NULL`, map[string]interface{}{
-			"order_id": orderID,
-		})
+	_, err = tx.Exec(
+		`UPDATE password_resets SET used_at = now() 
+		WHERE user_id = $1 AND used_at IS NULL`, userID)
 	if err != nil {
 		tx.Rollback()
-		return o, err
+		return err
 	}
 
-	for _, item := range orderItems {
-		_, err = tx.NamedExec(
-			`INSERT INTO order_items (order_id, coffee_id, quantity, created_at, updated_at) 
-			VALUES (:order_id, :coffee_id, :quantity, now(), now())`, map[string]interface{}{
-				"order_id":  o.ID,
-				"coffee_id": item.Coffee.ID,
-				"quantity":  item.Quantity,
-			})
-		if err != nil {
-			tx.Rollback()
-			return o, err
-		}
+	_, err = tx.Exec(
+		`INSERT INTO password_resets (user_id, token_hash, expires_at, created_at) 
+		VALUES ($1, $2, $3, now())`, userID, tokenHash, expiresAt.UTC())
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	err = tx.Commit()
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password for the user who was issued the reset
+// token, marks the token as used and revokes all of the user's tokens
+func (c *PostgresSQL) ResetPassword(tokenHash string, password string) (int, error) {
+	tx, err := c.db().Beginx()
 	if err != nil {
-		return o, err
+		return 0, err
 	}
 
-	orders, err := c.GetOrders(userID, &orderID)
+	ids := []int{}
+	err = tx.Select(&ids,
+		`UPDATE password_resets SET used_at = now() 
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() at time zone 'utc' 
+		RETURNING user_id`, tokenHash)
 	if err != nil {
-		return o, err
+		tx.Rollback()
+		return 0, err
 	}
 
-	if len(orders) > 0 {
-		return o, err
+	if len(ids) < 1 {
+		tx.Rollback()
+		return 0, ErrInvalidResetToken
 	}
 
-	return orders[0], nil
-}
+	userID := ids[0]
 
-// DeleteOrder deletes an existing order in the database
-func (c *PostgresSQL) DeleteOrder(userID int, orderID int) error {
-	tx := c.db.MustBegin()
+	_, err = tx.Exec(
+		`UPDATE users SET password = crypt($2, gen_salt('bf')), updated_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, userID, password)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 
-	// remove existing items from order
-	_, err := tx.NamedExec(
-		`UPDATE order_items SET deleted_at = now()
-		WHERE order_id = :order_id AND deleted_at IS NULL`, map[string]interface{}{
-			"order_id": orderID,
+	_, err = tx.Exec(
+		`UPDATE tokens SET deleted_at = now() 
+		WHERE user_id = $1 AND deleted_at IS NULL`, userID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// CreateToken creates a new token
+func (c *PostgresSQL) CreateToken(t model.Token) (model.Token, error) {
+	token := model.Token{}
+
+	rows, err := c.db().NamedQuery(
+		`INSERT INTO tokens (user_id, ip, user_agent, expires_at, created_at) 
+		VALUES(:user_id, :ip, :user_agent, :expires_at, now()) 
+		RETURNING id;`, map[string]interface{}{
+			"user_id":    t.UserID,
+			"ip":         t.IP,
+			"user_agent": t.UserAgent,
+			"expires_at": t.ExpiresAt,
+		})
+	if err != nil {
+		return token, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		err := rows.StructScan(&token)
+		if err != nil {
+			return token, err
+		}
+	}
+
+	return token, nil
+}
+
+// GetToken checks whether token exists, has not expired and belongs to a user
+// who can sign in, the time the token was last used is recorded
+func (c *PostgresSQL) GetToken(tokenID int, userID int) (model.Token, error) {
+	token := []model.Token{}
+
+	err := c.db().Select(&token,
+		`SELECT t.id, t.user_id FROM tokens t 
+		JOIN users u ON u.id = t.user_id 
+		WHERE t.id = $1 AND t.user_id = $2 AND t.deleted_at IS NULL 
+		AND t.expires_at > now() at time zone 'utc' 
+		AND u.deleted_at IS NULL AND u.disabled_at IS NULL;`,
+		tokenID, userID,
+	)
+	if err != nil {
+		return model.Token{}, err
+	}
+
+	if len(token) == 0 {
+		return model.Token{}, fmt.Errorf("Invalid token")
+	}
+
+	// only write when the recorded time is stale so every request is not a write
+	_, err = c.db().Exec(
+		`UPDATE tokens SET last_used_at = now() 
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - $2 * interval '1 second')`,
+		tokenID, lastUsedInterval.Seconds(),
+	)
+	if err != nil {
+		return model.Token{}, err
+	}
+
+	return token[0], nil
+}
+
+// GetSessions returns the tokens for a user which have not been revoked or expired
+func (c *PostgresSQL) GetSessions(userID int) (model.Sessions, error) {
+	ss := model.Sessions{}
+
+	err := c.db().Select(&ss,
+		`SELECT id, created_at, last_used_at, expires_at, ip, user_agent FROM tokens 
+		WHERE user_id = $1 AND deleted_at IS NULL AND expires_at > now() at time zone 'utc' 
+		ORDER BY created_at DESC;`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// DeleteTokens revokes all tokens for a user
+func (c *PostgresSQL) DeleteTokens(userID int) error {
+	_, err := c.db().Exec(
+		`UPDATE tokens SET deleted_at = now() 
+		WHERE user_id = $1 AND deleted_at IS NULL`, userID)
+
+	return err
+}
+
+// PurgeTokens removes tokens which have been revoked or have expired,
+// returning the number of tokens removed
+func (c *PostgresSQL) PurgeTokens() (int64, error) {
+	res, err := c.db().Exec(
+		`DELETE FROM tokens 
+		WHERE deleted_at IS NOT NULL OR expires_at <= now() at time zone 'utc'`)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteToken deletes an existing token in the database, returning
+// ErrSessionNotFound when the user has no such token
+func (c *PostgresSQL) DeleteToken(tokenID int, userID int) error {
+	tx := c.db().MustBegin()
+
+	res, err := tx.NamedExec(
+		`UPDATE tokens SET deleted_at = now()
+		WHERE id = :token_id AND user_id = :user_id AND deleted_at IS NULL`, map[string]interface{}{
+			"token_id": tokenID,
+			"user_id":  userID,
 		})
 	if err != nil {
 		tx.Rollback()
-		return err
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		tx.Rollback()
+		return ErrSessionNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateAPIKey stores a new API key, only the hash of the key is stored
+func (c *PostgresSQL) CreateAPIKey(k model.APIKey, keyHash string) (model.APIKey, error) {
+	ks := []model.APIKey{}
+
+	err := c.db().Select(&ks,
+		`INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, expires_at, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, now()) 
+		RETURNING `+apiKeyColumns,
+		k.Name, k.Prefix, keyHash, k.UserID, k.Scopes, k.ExpiresAt,
+	)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	if len(ks) < 1 {
+		return model.APIKey{}, errors.New("Unable to create API key")
+	}
+
+	return ks[0], nil
+}
+
+// GetAPIKey returns the API key with the given hash if it can be used, the
+// time the key was last used is recorded
+func (c *PostgresSQL) GetAPIKey(keyHash string) (model.APIKey, error) {
+	ks := []model.APIKey{}
+
+	err := c.db().Select(&ks,
+		`SELECT k.id, k.name, k.prefix, k.user_id, k.scopes, k.created_at, k.last_used_at, k.expires_at, k.revoked_at 
+		FROM api_keys k 
+		JOIN users u ON u.id = k.user_id 
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL 
+		AND (k.expires_at IS NULL OR k.expires_at > now() at time zone 'utc') 
+		AND u.deleted_at IS NULL AND u.disabled_at IS NULL;`,
+		keyHash,
+	)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	if len(ks) < 1 {
+		return model.APIKey{}, ErrInvalidAPIKey
+	}
+
+	_, err = c.db().Exec(
+		`UPDATE api_keys SET last_used_at = now() 
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - $2 * interval '1 second')`,
+		ks[0].ID, lastUsedInterval.Seconds(),
+	)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	return ks[0], nil
+}
+
+// ListAPIKeys returns every API key, including revoked keys
+func (c *PostgresSQL) ListAPIKeys() (model.APIKeys, error) {
+	ks := model.APIKeys{}
+
+	err := c.db().Select(&ks, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// RevokeAPIKey revokes an API key so it can no longer be used
+func (c *PostgresSQL) RevokeAPIKey(id int) error {
+	res, err := c.db().Exec(
+		`UPDATE api_keys SET revoked_at = now() 
+		WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("API key does not exist or has been revoked")
+	}
+
+	return nil
+}
+
+// GetUserByIdentity returns the user linked to the identity with the given
+// issuer and subject, disabled users are returned so callers can refuse them
+func (c *PostgresSQL) GetUserByIdentity(issuer string, subject string) (model.User, error) {
+	us := []model.User{}
+
+	err := c.db().Select(&us,
+		`SELECT u.id, u.username, u.role, u.display_name, COALESCE(u.email, '') AS email, u.preferences, u.disabled_at IS NOT NULL AS disabled 
+		FROM user_identities i 
+		JOIN users u ON u.id = i.user_id 
+		WHERE i.issuer = $1 AND i.subject = $2 AND u.deleted_at IS NULL;`,
+		issuer, subject,
+	)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	if len(us) < 1 {
+		return model.User{}, ErrUnknownIdentity
+	}
+
+	return us[0], nil
+}
+
+// CreateUserWithIdentity creates a user linked to an external identity. The
+// user is given a random password, they can set one with a password reset.
+func (c *PostgresSQL) CreateUserWithIdentity(u model.User, i model.Identity) (model.User, error) {
+	tx, err := c.db().Beginx()
+	if err != nil {
+		return model.User{}, err
+	}
+
+	us := []model.User{}
+	err = tx.Select(&us,
+		`INSERT INTO users (username, password, display_name, email, created_at, updated_at) 
+		VALUES ($1, crypt(encode(gen_random_bytes(32), 'hex'), gen_salt('bf')), $2, NULLIF($3, ''), now(), now()) 
+		RETURNING `+userColumns+`;`,
+		u.Username, u.DisplayName, u.Email,
+	)
+	if err != nil {
+		tx.Rollback()
+		return model.User{}, uniqueViolationError(err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_identities (user_id, issuer, subject, email, created_at) 
+		VALUES ($1, $2, $3, $4, now())`,
+		us[0].ID, i.Issuer, i.Subject, i.Email,
+	)
+	if err != nil {
+		tx.Rollback()
+		return model.User{}, uniqueViolationError(err)
+	}
+
+	return us[0], tx.Commit()
+}
+
+// LinkIdentity links an external identity to an existing user
+func (c *PostgresSQL) LinkIdentity(userID int, i model.Identity) error {
+	_, err := c.db().Exec(
+		`INSERT INTO user_identities (user_id, issuer, subject, email, created_at) 
+		VALUES ($1, $2, $3, $4, now())`,
+		userID, i.Issuer, i.Subject, i.Email,
+	)
+
+	return uniqueViolationError(err)
+}
+
+// GetIdentities returns the external identities linked to a user
+func (c *PostgresSQL) GetIdentities(userID int) (model.Identities, error) {
+	is := model.Identities{}
+
+	err := c.db().Select(&is,
+		`SELECT id, user_id, issuer, subject, email, created_at FROM user_identities 
+		WHERE user_id = $1 ORDER BY id;`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return is, nil
+}
+
+// idempotencyKeyColumns are the columns selected when reading an idempotency key
+const idempotencyKeyColumns = `user_id, key, request_hash, status_code, content_type, response_body`
+
+// ClaimIdempotencyKey stores k for a request which is about to run and returns
+// true. When the key is already stored it is returned instead, unless it has
+// expired or its request has been running for longer than lockTimeout in
+// which case it is claimed again. Keys expire after ttl.
+func (c *PostgresSQL) ClaimIdempotencyKey(k model.IdempotencyKey, ttl time.Duration, lockTimeout time.Duration) (model.IdempotencyKey, bool, error) {
+	// the stored key can be released between the insert and select, so try
+	// to claim it again when that happens
+	for i := 0; i < 3; i++ {
+		ks := []model.IdempotencyKey{}
+
+		err := c.db().Select(&ks,
+			`INSERT INTO idempotency_keys (user_id, key, request_hash, status_code, content_type, response_body, locked_at, created_at, expires_at) 
+			VALUES ($1, $2, $3, 0, '', '', now(), now(), now() + $4 * interval '1 second') 
+			ON CONFLICT (user_id, key) DO UPDATE SET 
+				request_hash = EXCLUDED.request_hash, status_code = 0, content_type = '', response_body = '', 
+				locked_at = now(), created_at = now(), expires_at = EXCLUDED.expires_at 
+			WHERE idempotency_keys.expires_at <= now() 
+			OR (idempotency_keys.status_code = 0 AND idempotency_keys.locked_at < now() - $5 * interval '1 second') 
+			RETURNING `+idempotencyKeyColumns+`;`,
+			k.UserID, k.Key, k.RequestHash, ttl.Seconds(), lockTimeout.Seconds(),
+		)
+		if err != nil {
+			return model.IdempotencyKey{}, false, err
+		}
+
+		if len(ks) > 0 {
+			return ks[0], true, nil
+		}
+
+		err = c.db().Select(&ks,
+			`SELECT `+idempotencyKeyColumns+` FROM idempotency_keys 
+			WHERE user_id = $1 AND key = $2;`,
+			k.UserID, k.Key,
+		)
+		if err != nil {
+			return model.IdempotencyKey{}, false, err
+		}
+
+		if len(ks) > 0 {
+			return ks[0], false, nil
+		}
+	}
+
+	return model.IdempotencyKey{}, false, errors.New("Unable to claim idempotency key")
+}
+
+// CompleteIdempotencyKey stores the response to the request which claimed
+// the key
+func (c *PostgresSQL) CompleteIdempotencyKey(k model.IdempotencyKey) error {
+	_, err := c.db().Exec(
+		`UPDATE idempotency_keys SET status_code = $3, content_type = $4, response_body = $5 
+		WHERE user_id = $1 AND key = $2 AND status_code = 0`,
+		k.UserID, k.Key, k.StatusCode, k.ContentType, k.ResponseBody,
+	)
+
+	return err
+}
+
+// ReleaseIdempotencyKey deletes a key whose request failed so it can be
+// retried
+func (c *PostgresSQL) ReleaseIdempotencyKey(userID int, key string) error {
+	_, err := c.db().Exec(
+		`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status_code = 0`,
+		userID, key,
+	)
+
+	return err
+}
+
+// PurgeIdempotencyKeys deletes keys which have expired
+func (c *PostgresSQL) PurgeIdempotencyKeys() (int64, error) {
+	res, err := c.db().Exec(`DELETE FROM idempotency_keys WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetOrders returns orders from the database
+func (c *PostgresSQL) GetOrders(userID int, orderID *int) (model.Orders, error) {
+	orders := model.Orders{}
+
+	if orderID != nil {
+		err := c.db().Select(&orders,
+			`SELECT * FROM orders WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL`,
+			userID, orderID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := c.db().Select(&orders,
+			`SELECT * FROM orders WHERE user_id = $1 AND deleted_at IS NULL`,
+			userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// fetch the coffee for each order
+	for n, order := range orders {
+		items := []model.OrderItems{}
+		err := c.db().Select(&items,
+			`SELECT * FROM order_items 
+			WHERE order_id = $1 AND deleted_at IS NULL ORDER BY id`, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		orders[n].Items = items
+
+		ds := []model.OrderDiscount{}
+		err = c.db().Select(&ds,
+			`SELECT * FROM order_discounts WHERE order_id=$1 ORDER BY id`, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		orders[n].Discounts = ds
+
+		for i, item := range items {
+			coffee := model.Coffees{}
+			err := c.db().Select(&coffee,
+				`SELECT * FROM coffees WHERE id=$1 AND deleted_at IS NULL`, item.CoffeeID)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(coffee) > 0 {
+				orders[n].Items[i].Coffee = coffee[0]
+
+				ing := []model.CoffeeIngredient{}
+				err := c.db().Select(&ing, "SELECT ingredient_id FROM coffee_ingredients WHERE coffee_id=$1 AND quantity > 0", orders[n].Items[i].Coffee.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				orders[n].Items[i].Coffee.Ingredients = ing
+			}
+		}
+	}
+
+	return orders, nil
+}
+
+// CreateOrder creates a new order in the database, to be collected in the
+// pickup slot or as soon as possible when pickup is nil. Orders for a store
+// use its menu, the default catalog is used when storeID is nil.
+func (c *PostgresSQL) CreateOrder(userID int, orderItems []model.OrderItems, codes []string, pickup *model.PickupSlot, storeID *int) (model.Order, error) {
+	tx := c.db().MustBegin()
+
+	o := model.Order{}
+
+	err := insertOrder(tx, userID, storeID, pickup, &o.ID)
+	if err != nil {
+		tx.Rollback()
+		return o, err
+	}
+
+	for _, item := range orderItems {
+		err = setOrderItemQuantity(tx, o.ID, item.Coffee.ID, item.Quantity, true)
+		if err != nil {
+			tx.Rollback()
+			return o, err
+		}
+	}
+
+	err = applyPromotions(tx, userID, o.ID, codes)
+	if err != nil {
+		tx.Rollback()
+		return o, err
+	}
+
+	err = recordOrderEvent(tx, model.EventOrderCreated, o.ID)
+	if err != nil {
+		tx.Rollback()
+		return o, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return o, err
+	}
+
+	orders, err := c.GetOrders(userID, &o.ID)
+	if err != nil {
+		return o, err
+	}
+
+	if len(orders) == 0 {
+		return o, err
+	}
+
+	return orders[0], nil
+}
+
+// UpdateOrder replaces the items of an existing order in the database. When
+// version is not nil the order is only updated if it is at that version.
+func (c *PostgresSQL) UpdateOrder(userID int, orderID int, orderItems []model.OrderItems, version *int) (model.Order, error) {
+	tx := c.db().MustBegin()
+
+	err := lockOrderVersion(tx, userID, orderID, version)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	// items keep their identity when their coffee is still in the order
+	coffeeIDs := []int64{}
+	for _, item := range orderItems {
+		coffeeIDs = append(coffeeIDs, int64(item.Coffee.ID))
+	}
+
+	_, err = tx.Exec(
+		`UPDATE order_items SET deleted_at = now(), updated_at = now() 
+		WHERE order_id = $1 AND deleted_at IS NULL AND NOT (coffee_id = ANY($2))`,
+		orderID, pq.Array(coffeeIDs),
+	)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	for _, item := range orderItems {
+		err = setOrderItemQuantity(tx, orderID, item.Coffee.ID, item.Quantity, false)
+		if err != nil {
+			tx.Rollback()
+			return model.Order{}, err
+		}
+	}
+
+	err = updateOrderDiscounts(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	err = recordOrderEvent(tx, model.EventOrderUpdated, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	orders, err := c.GetOrders(userID, &orderID)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if len(orders) == 0 {
+		return model.Order{}, ErrOrderNotFound
+	}
+
+	return orders[0], nil
+}
+
+// DeleteOrder deletes an existing order in the database. When version is not
+// nil the order is only deleted if it is at that version.
+func (c *PostgresSQL) DeleteOrder(userID int, orderID int, version *int) error {
+	tx := c.db().MustBegin()
+
+	err := lockOrderVersion(tx, userID, orderID, version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// remove existing items from order
+	_, err = tx.NamedExec(
+		`UPDATE order_items SET deleted_at = now()
+		WHERE order_id = :order_id AND deleted_at IS NULL`, map[string]interface{}{
+			"order_id": orderID,
+		})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.NamedExec(
+		`UPDATE orders SET deleted_at = now()
+		WHERE user_id = :user_id AND id = :order_id AND deleted_at IS NULL`, map[string]interface{}{
+			"user_id":  userID,
+			"order_id": orderID,
+		})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordOrderEvent(tx, model.EventOrderDeleted, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddOrderItem adds an item to an order, when the order already has an item
+// for the coffee its quantity is increased instead
+func (c *PostgresSQL) AddOrderItem(userID int, orderID int, item model.OrderItems, version *int) (model.Order, error) {
+	return c.changeOrderItems(userID, orderID, version, func(tx *sqlx.Tx) error {
+		return setOrderItemQuantity(tx, orderID, item.Coffee.ID, item.Quantity, true)
+	})
+}
+
+// UpdateOrderItem sets the quantity of an item in an order
+func (c *PostgresSQL) UpdateOrderItem(userID int, orderID int, itemID int, quantity int, version *int) (model.Order, error) {
+	return c.changeOrderItems(userID, orderID, version, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE order_items SET quantity = $3, updated_at = now() 
+			WHERE id = $1 AND order_id = $2 AND deleted_at IS NULL`,
+			itemID, orderID, quantity,
+		)
+
+		return orderItemChanged(res, err)
+	})
+}
+
+// DeleteOrderItem removes an item from an order
+func (c *PostgresSQL) DeleteOrderItem(userID int, orderID int, itemID int, version *int) (model.Order, error) {
+	return c.changeOrderItems(userID, orderID, version, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE order_items SET deleted_at = now(), updated_at = now() 
+			WHERE id = $1 AND order_id = $2 AND deleted_at IS NULL`,
+			itemID, orderID,
+		)
+
+		return orderItemChanged(res, err)
+	})
+}
+
+// applyPromotions applies promotion codes to a new order and records the
+// discount each gives. Promotions are locked while their usage is counted so
+// usage limits hold when the same code is used by concurrent orders.
+func applyPromotions(tx *sqlx.Tx, userID int, orderID int, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	ps := []model.Promotion{}
+	seen := map[string]bool{}
+
+	for _, code := range codes {
+		if seen[strings.ToLower(code)] {
+			continue
+		}
+		seen[strings.ToLower(code)] = true
+
+		ids := []int{}
+
+		err := tx.Select(&ids,
+			`SELECT id FROM promotions 
+			WHERE lower(code) = lower($1) AND deleted_at IS NULL FOR UPDATE`, code)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) < 1 {
+			return &promotions.Error{Code: code, Err: promotions.ErrUnknownCode}
+		}
+
+		p := model.Promotion{}
+
+		err = tx.Get(&p, `SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, ids[0])
+		if err != nil {
+			return err
+		}
+
+		u := promotions.Usage{}
+
+		err = tx.QueryRow(
+			`SELECT count(*), count(*) FILTER (WHERE user_id = $2) 
+			FROM order_discounts WHERE promotion_id = $1`, p.ID, userID,
+		).Scan(&u.Total, &u.User)
+		if err != nil {
+			return err
+		}
+
+		err = promotions.Check(p, u)
+		if err != nil {
+			return err
+		}
+
+		ps = append(ps, p)
+	}
+
+	lines, err := orderLines(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	ds, err := promotions.Apply(lines, ps)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range ds {
+		_, err = tx.Exec(
+			`INSERT INTO order_discounts (order_id, promotion_id, user_id, code, name, amount, created_at) 
+			VALUES ($1, $2, $3, $4, $5, $6, now())`,
+			orderID, d.PromotionID, userID, d.Code, d.Name, d.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateOrderDiscounts recalculates the discounts of an order after its items
+// change, promotions stay applied even if they no longer discount anything
+func updateOrderDiscounts(tx *sqlx.Tx, orderID int) error {
+	ds := []model.OrderDiscount{}
+
+	err := tx.Select(&ds, `SELECT * FROM order_discounts WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil || len(ds) == 0 {
+		return err
+	}
+
+	ps := []model.Promotion{}
+
+	for _, d := range ds {
+		p := model.Promotion{}
+
+		err = tx.Get(&p, `SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, d.PromotionID)
+		if err != nil {
+			return err
+		}
+
+		ps = append(ps, p)
+	}
+
+	lines, err := orderLines(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for i, d := range promotions.Calculate(lines, ps) {
+		_, err = tx.Exec(`UPDATE order_discounts SET amount = $2 WHERE id = $1`, ds[i].ID, d.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orderLine is an item in an order with the current price of its coffee at
+// the store of the order
+type orderLine struct {
+	CoffeeID   int    `db:"coffee_id"`
+	Collection string `db:"collection"`
+	Price      int    `db:"price"`
+	Quantity   int    `db:"quantity"`
+}
+
+// orderLines returns the items of an order for calculating discounts
+func orderLines(tx *sqlx.Tx, orderID int) ([]promotions.Line, error) {
+	ols := []orderLine{}
+
+	err := tx.Select(&ols,
+		`SELECT i.coffee_id, COALESCE(c.collection, '') AS collection, i.price, i.quantity 
+		FROM order_items i 
+		JOIN coffees c ON c.id = i.coffee_id 
+		WHERE i.order_id = $1 AND i.deleted_at IS NULL ORDER BY i.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []promotions.Line{}
+	for _, l := range ols {
+		lines = append(lines, promotions.Line{CoffeeID: l.CoffeeID, Collection: l.Collection, Price: l.Price, Quantity: l.Quantity})
+	}
+
+	return lines, nil
+}
+
+// CreatePromotion creates a promotion, returning ErrPromotionCodeInUse when
+// another promotion has the same code
+func (c *PostgresSQL) CreatePromotion(p model.Promotion) (model.Promotion, error) {
+	id := 0
+
+	err := c.db().Get(&id,
+		`INSERT INTO promotions (code, name, type, percent, amount, buy_quantity, coffee_id, collection, stackable, starts_at, ends_at, max_uses, max_uses_per_user, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, now()) 
+		RETURNING id`,
+		p.Code, p.Name, p.Type, p.Percent, p.Amount, p.BuyQuantity, p.CoffeeID, p.Collection, p.Stackable, p.StartsAt, p.EndsAt, p.MaxUses, p.MaxUsesPerUser,
+	)
+	if err != nil {
+		var pe *pq.Error
+		if errors.As(err, &pe) && pe.Code == "23505" && pe.Constraint == "promotions_code" {
+			return model.Promotion{}, ErrPromotionCodeInUse
+		}
+
+		return model.Promotion{}, err
+	}
+
+	err = c.db().Get(&p, `SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, id)
+	if err != nil {
+		return model.Promotion{}, err
+	}
+
+	return p, nil
+}
+
+// ListPromotions returns every promotion which has not been deleted
+func (c *PostgresSQL) ListPromotions() (model.Promotions, error) {
+	ps := model.Promotions{}
+
+	err := c.db().Select(&ps, `SELECT `+promotionColumns+` FROM promotions WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// DeletePromotion deletes a promotion so its code can no longer be used,
+// discounts already given stay on their orders
+func (c *PostgresSQL) DeletePromotion(id int) error {
+	res, err := c.db().Exec(
+		`UPDATE promotions SET deleted_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrPromotionNotFound
+	}
+
+	return nil
+}
+
+// changeOrderItems runs change in a transaction after checking the version of
+// the order, then returns the changed order
+func (c *PostgresSQL) changeOrderItems(userID int, orderID int, version *int, change func(tx *sqlx.Tx) error) (model.Order, error) {
+	tx := c.db().MustBegin()
+
+	err := lockOrderVersion(tx, userID, orderID, version)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	err = change(tx)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	err = updateOrderDiscounts(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	err = recordOrderEvent(tx, model.EventOrderUpdated, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	orders, err := c.GetOrders(userID, &orderID)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if len(orders) == 0 {
+		return model.Order{}, ErrOrderNotFound
+	}
+
+	return orders[0], nil
+}
+
+// setOrderItemQuantity sets, or when add is true increases, the quantity of
+// the order's item for a coffee, adding the item if the order does not have
+// one. A new item is priced at the current price of the coffee at the store of
+// the order, an existing item keeps its price. ErrCoffeeNotFound is returned when the coffee does not exist or
+// has been deleted and ErrCoffeeUnavailable when the store of the order does
+// not sell it.
+func setOrderItemQuantity(tx *sqlx.Tx, orderID int, coffeeID int, quantity int, add bool) error {
+	available := false
+
+	err := tx.Get(&available,
+		`SELECT NOT EXISTS (SELECT 1 FROM orders o 
+		JOIN store_coffees sc ON sc.store_id = o.store_id AND sc.coffee_id = $2 
+		WHERE o.id = $1 AND NOT sc.available)`, orderID, coffeeID)
+	if err != nil {
+		return err
+	}
+
+	if !available {
+		return ErrCoffeeUnavailable
+	}
+
+	// the price is kept with the item so the order total does not change
+	// when the price of the coffee does
+	prices := []int{}
+
+	err = tx.Select(&prices,
+		`SELECT COALESCE(sc.price, c.price) FROM coffees c 
+		JOIN orders o ON o.id = $1 
+		LEFT JOIN store_coffees sc ON sc.store_id = o.store_id AND sc.coffee_id = c.id 
+		WHERE c.id = $2 AND c.deleted_at IS NULL`, orderID, coffeeID)
+	if err != nil {
+		return err
+	}
+
+	if len(prices) < 1 {
+		return ErrCoffeeNotFound
+	}
+
+	res, err := tx.Exec(
+		`UPDATE order_items SET quantity = CASE WHEN $4 THEN quantity + $3 ELSE $3 END, updated_at = now() 
+		WHERE order_id = $1 AND coffee_id = $2 AND deleted_at IS NULL`,
+		orderID, coffeeID, quantity, add,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO order_items (order_id, coffee_id, quantity, price, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, now(), now())`,
+		orderID, coffeeID, quantity, prices[0],
+	)
+
+	return err
+}
+
+// pickupLockID is the first key of the advisory locks held while reserving a
+// pickup slot, the second is the start of the slot in minutes
+const pickupLockID = 5400601
+
+// pickupHold is how long an unpaid order holds its place in a pickup slot,
+// after that it only gets a place if there is one left when it is paid for
+const pickupHold = 15 * time.Minute
+
+// insertOrder creates an order without items and sets id to its ID. When
+// pickup is not nil the order is for the pickup time, ErrPickupSlotFull is
+// returned when the slot has no capacity left at the store.
+func insertOrder(tx *sqlx.Tx, userID int, storeID *int, pickup *model.PickupSlot, id *int) error {
+	var at, start, end *time.Time
+	capacity := 0
+
+	if pickup != nil {
+		at, start, end, capacity = &pickup.At, &pickup.Start, &pickup.End, pickup.Capacity
+
+		err := reservePickupSlot(tx, storeID, pickup.Start, pickup.End, capacity, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tx.Get(id,
+		`INSERT INTO orders (user_id, store_id, pickup_at, pickup_slot_start, pickup_slot_end, pickup_capacity, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, now(), now()) RETURNING id`, userID, storeID, at, start, end, capacity)
+
+	var pe *pq.Error
+	if errors.As(err, &pe) && pe.Code == "23503" {
+		return ErrStoreNotFound
+	}
+
+	return err
+}
+
+// reservePickupSlot returns ErrPickupSlotFull when the pickup slot from start
+// to end has no capacity left at the store, not counting the order except.
+// Paid orders, and unpaid orders inside their hold or with a payment in
+// progress, have a place. A payment waiting on the provider can be captured
+// after the hold has expired, so its order keeps its place until the payment
+// ends. The slot is locked until tx ends so orders for it are counted one after
+// the other.
+func reservePickupSlot(tx *sqlx.Tx, storeID *int, start, end time.Time, capacity int, except int) error {
+	if capacity <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, pickupLockID, int32(start.Unix()/60))
+	if err != nil {
+		return err
+	}
+
+	count := 0
+
+	err = tx.Get(&count,
+		`SELECT count(*) FROM orders 
+		WHERE pickup_at >= $1 AND pickup_at < $2 AND deleted_at IS NULL AND id <> $3 
+		AND store_id IS NOT DISTINCT FROM $4 
+		AND (status IN ($5, $6, $7, $8) OR (status = $9 AND (
+			created_at >= now() - $10 * interval '1 second' 
+			OR EXISTS (
+				SELECT 1 FROM payments p WHERE p.order_id = orders.id 
+				AND (p.status IN ($11, $12) OR (p.status = $13 AND p.created_at >= now() - $14 * interval '1 second'))
+			)
+		)))`,
+		start, end, except, storeID,
+		model.OrderScheduled, model.OrderPaid, model.OrderPreparing, model.OrderCompleted,
+		model.OrderPending, pickupHold.Seconds(),
+		model.PaymentPending, model.PaymentAuthorized, model.PaymentStarted, paymentStartTimeout.Seconds())
+	if err != nil {
+		return err
+	}
+
+	if count >= capacity {
+		return ErrPickupSlotFull
+	}
+
+	return nil
+}
+
+// reservePickupSlotForPayment returns ErrPickupSlotFull when an order whose
+// hold on its pickup slot has expired can no longer get a place in it
+func reservePickupSlotForPayment(tx *sqlx.Tx, orderID int) error {
+	os := []struct {
+		StoreID  *int       `db:"store_id"`
+		Start    *time.Time `db:"pickup_slot_start"`
+		End      *time.Time `db:"pickup_slot_end"`
+		Capacity int        `db:"pickup_capacity"`
+		Held     bool       `db:"held"`
+	}{}
+
+	err := tx.Select(&os,
+		`SELECT store_id, pickup_slot_start, pickup_slot_end, pickup_capacity, 
+		created_at >= now() - $2 * interval '1 second' AS held 
+		FROM orders WHERE id = $1`, orderID, pickupHold.Seconds())
+	if err != nil {
+		return err
+	}
+
+	if len(os) < 1 || os[0].Held || os[0].Start == nil || os[0].End == nil {
+		return nil
+	}
+
+	return reservePickupSlot(tx, os[0].StoreID, *os[0].Start, *os[0].End, os[0].Capacity, orderID)
+}
+
+// orderItemChanged returns ErrOrderItemNotFound when no item was changed
+func orderItemChanged(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrOrderItemNotFound
+	}
+
+	return nil
+}
+
+// paymentStartTimeout is how long a payment can be started without a result
+// from the provider before it fails, so that another payment can be made
+const paymentStartTimeout = 10 * time.Minute
+
+// lockUnpaidOrder locks an order until tx ends, returning ErrOrderPaid when it
+// has been paid for and ErrPaymentInProgress while a payment is in progress
+func lockUnpaidOrder(tx *sqlx.Tx, userID int, orderID int) error {
+	ss := []string{}
+
+	err := tx.Select(&ss,
+		`SELECT status FROM orders 
+		WHERE user_id = $1 AND id = $2 AND deleted_at IS NULL FOR UPDATE`,
+		userID, orderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(ss) < 1 {
+		return ErrOrderNotFound
+	}
+
+	if ss[0] != model.OrderPending {
+		return ErrOrderPaid
+	}
+
+	// payments which were never sent to the provider, e.g. when the request
+	// was cancelled, would otherwise stop the order from being paid or changed
+	_, err = tx.Exec(
+		`UPDATE payments SET status = $2, failure_reason = 'expired', updated_at = now() 
+		WHERE order_id = $1 AND status = $3 AND created_at < now() - $4 * interval '1 second'`,
+		orderID, model.PaymentFailed, model.PaymentStarted, paymentStartTimeout.Seconds(),
+	)
+	if err != nil {
+		return err
+	}
+
+	paying := false
+
+	err = tx.Get(&paying,
+		`SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status IN ($2, $3, $4))`,
+		orderID, model.PaymentStarted, model.PaymentPending, model.PaymentAuthorized,
+	)
+	if err != nil {
+		return err
+	}
+
+	if paying {
+		return ErrPaymentInProgress
+	}
+
+	return nil
+}
+
+// lockOrderVersion increments the version of an order, returning
+// ErrVersionMismatch when version is not nil and the order is at another
+// version. Orders which have been paid for, or are being paid for, can not be
+// changed. The order row stays locked until tx ends so concurrent changes are
+// made one after the other.
+func lockOrderVersion(tx *sqlx.Tx, userID int, orderID int, version *int) error {
+	err := lockUnpaidOrder(tx, userID, orderID)
+	if err != nil {
+		return err
+	}
+
+	vs := []int{}
+
+	err = tx.Select(&vs, `SELECT version FROM orders WHERE id = $1`, orderID)
+	if err != nil {
+		return err
+	}
+
+	if version != nil && *version != vs[0] {
+		return ErrVersionMismatch
+	}
+
+	_, err = tx.Exec(
+		`UPDATE orders SET version = version + 1, updated_at = now() 
+		WHERE id = $1`, orderID)
+
+	return err
+}
+
+// GetCart returns the cart of a user, creating an empty cart if the user does
+// not have one
+func (c *PostgresSQL) GetCart(userID int) (model.Cart, error) {
+	_, err := c.db().Exec(
+		`INSERT INTO carts (user_id, created_at, updated_at) 
+		VALUES ($1, now(), now()) ON CONFLICT (user_id) DO NOTHING`, userID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+
+	cart := model.Cart{}
+
+	err = c.db().Get(&cart, `SELECT * FROM carts WHERE user_id = $1`, userID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+
+	cart.Items = []model.CartItem{}
+
+	err = c.db().Select(&cart.Items,
+		`SELECT cart_items.*, coffees.deleted_at IS NULL AS available FROM cart_items 
+		JOIN coffees ON coffees.id = cart_items.coffee_id 
+		WHERE cart_items.cart_id = $1 ORDER BY cart_items.id`, cart.ID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+
+	for i, item := range cart.Items {
+		coffee, err := c.GetCoffees(&item.CoffeeID)
+		if err != nil {
+			return model.Cart{}, err
+		}
+
+		if len(coffee) > 0 {
+			cart.Items[i].Coffee = coffee[0]
+		}
+	}
+
+	return cart, nil
+}
+
+// AddCartItem adds a coffee to a cart at its current price, when the cart
+// already has the coffee its quantity is increased instead
+func (c *PostgresSQL) AddCartItem(userID int, coffeeID int, quantity int, version *int) (model.Cart, error) {
+	return c.changeCart(userID, version, func(tx *sqlx.Tx, cartID int) error {
+		prices := []int{}
+
+		err := tx.Select(&prices,
+			`SELECT price FROM coffees WHERE id = $1 AND deleted_at IS NULL`, coffeeID)
+		if err != nil {
+			return err
+		}
+
+		if len(prices) < 1 {
+			return ErrCoffeeNotFound
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO cart_items (cart_id, coffee_id, quantity, price, created_at, updated_at) 
+			VALUES ($1, $2, $3, $4, now(), now()) 
+			ON CONFLICT (cart_id, coffee_id) DO UPDATE 
+			SET quantity = cart_items.quantity + $3, price = $4, updated_at = now()`,
+			cartID, coffeeID, quantity, prices[0],
+		)
+
+		return err
+	})
+}
+
+// UpdateCartItem sets the quantity of an item in a cart
+func (c *PostgresSQL) UpdateCartItem(userID int, itemID int, quantity int, version *int) (model.Cart, error) {
+	return c.changeCart(userID, version, func(tx *sqlx.Tx, cartID int) error {
+		res, err := tx.Exec(
+			`UPDATE cart_items SET quantity = $3, updated_at = now() 
+			WHERE id = $1 AND cart_id = $2`,
+			itemID, cartID, quantity,
+		)
+
+		return cartItemChanged(res, err)
+	})
+}
+
+// DeleteCartItem removes an item from a cart
+func (c *PostgresSQL) DeleteCartItem(userID int, itemID int, version *int) (model.Cart, error) {
+	return c.changeCart(userID, version, func(tx *sqlx.Tx, cartID int) error {
+		res, err := tx.Exec(
+			`DELETE FROM cart_items WHERE id = $1 AND cart_id = $2`,
+			itemID, cartID,
+		)
+
+		return cartItemChanged(res, err)
+	})
+}
+
+// cartItemCheck is the price and availability of a cart item at checkout
+type cartItemCheck struct {
+	ID           int  `db:"id"`
+	CoffeeID     int  `db:"coffee_id"`
+	Quantity     int  `db:"quantity"`
+	Price        int  `db:"price"`
+	CurrentPrice int  `db:"current_price"`
+	Available    bool `db:"available"`
+}
+
+// CheckoutCart places an order for the items in a cart and empties it in a
+// single transaction. When the price of an item has changed or its coffee is
+// no longer available, the cart is updated and the changes are returned with
+// ErrCartChanged so the user can review them before checking out again.
+// Promotion codes are applied to the order as in CreateOrder.
+func (c *PostgresSQL) CheckoutCart(userID int, version *int, codes []string, pickup *model.PickupSlot, storeID *int) (model.Order, model.CartChanges, error) {
+	tx := c.db().MustBegin()
+
+	cartID, err := lockCartVersion(tx, userID, version)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, nil, err
+	}
+
+	items := []cartItemCheck{}
+
+	err = tx.Select(&items,
+		`SELECT cart_items.id, cart_items.coffee_id, cart_items.quantity, cart_items.price, 
+		COALESCE(sc.price, coffees.price) AS current_price, 
+		coffees.deleted_at IS NULL AND COALESCE(sc.available, true) AS available FROM cart_items 
+		JOIN coffees ON coffees.id = cart_items.coffee_id 
+		LEFT JOIN store_coffees sc ON sc.store_id = $2 AND sc.coffee_id = cart_items.coffee_id 
+		WHERE cart_items.cart_id = $1 ORDER BY cart_items.id`, cartID, storeID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, nil, err
+	}
+
+	if len(items) < 1 {
+		tx.Rollback()
+		return model.Order{}, nil, ErrCartEmpty
+	}
+
+	changes := model.CartChanges{}
+
+	for _, i := range items {
+		switch {
+		case !i.Available:
+			changes = append(changes, model.CartChange{ItemID: i.ID, CoffeeID: i.CoffeeID, Reason: model.CartChangeUnavailable, Price: i.Price})
+			_, err = tx.Exec(`DELETE FROM cart_items WHERE id = $1`, i.ID)
+		case i.Price != i.CurrentPrice:
+			changes = append(changes, model.CartChange{ItemID: i.ID, CoffeeID: i.CoffeeID, Reason: model.CartChangePrice, Price: i.Price, CurrentPrice: i.CurrentPrice})
+			_, err = tx.Exec(`UPDATE cart_items SET price = $2, updated_at = now() WHERE id = $1`, i.ID, i.CurrentPrice)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return model.Order{}, nil, err
+		}
+	}
+
+	// keep the updated cart so checking out again places the order
+	if len(changes) > 0 {
+		err = tx.Commit()
+		if err != nil {
+			return model.Order{}, nil, err
+		}
+
+		return model.Order{}, changes, ErrCartChanged
+	}
+
+	orderID := 0
+
+	err = insertOrder(tx, userID, storeID, pickup, &orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, nil, err
+	}
+
+	for _, i := range items {
+		err = setOrderItemQuantity(tx, orderID, i.CoffeeID, i.Quantity, true)
+		if err != nil {
+			tx.Rollback()
+			return model.Order{}, nil, err
+		}
+	}
+
+	err = applyPromotions(tx, userID, orderID, codes)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, nil, err
+	}
+
+	err = recordOrderEvent(tx, model.EventOrderCreated, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM cart_items WHERE cart_id = $1`, cartID)
+	if err != nil {
+		tx.Rollback()
+		return model.Order{}, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return model.Order{}, nil, err
+	}
+
+	orders, err := c.GetOrders(userID, &orderID)
+	if err != nil {
+		return model.Order{}, nil, err
+	}
+
+	if len(orders) == 0 {
+		return model.Order{}, nil, ErrOrderNotFound
+	}
+
+	return orders[0], nil, nil
+}
+
+// changeCart runs change in a transaction after checking the version of the
+// user's cart, then returns the changed cart
+func (c *PostgresSQL) changeCart(userID int, version *int, change func(tx *sqlx.Tx, cartID int) error) (model.Cart, error) {
+	tx := c.db().MustBegin()
+
+	cartID, err := lockCartVersion(tx, userID, version)
+	if err != nil {
+		tx.Rollback()
+		return model.Cart{}, err
+	}
+
+	err = change(tx, cartID)
+	if err != nil {
+		tx.Rollback()
+		return model.Cart{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return model.Cart{}, err
+	}
+
+	return c.GetCart(userID)
+}
+
+// lockCartVersion creates the user's cart if needed and increments its
+// version, returning ErrVersionMismatch when version is not nil and the cart
+// is at another version. The cart row stays locked until tx ends.
+func lockCartVersion(tx *sqlx.Tx, userID int, version *int) (int, error) {
+	_, err := tx.Exec(
+		`INSERT INTO carts (user_id, created_at, updated_at) 
+		VALUES ($1, now(), now()) ON CONFLICT (user_id) DO NOTHING`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	cart := model.Cart{}
+
+	err = tx.Get(&cart, `SELECT * FROM carts WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if version != nil && *version != cart.Version {
+		return 0, ErrVersionMismatch
+	}
+
+	_, err = tx.Exec(
+		`UPDATE carts SET version = version + 1, updated_at = now() 
+		WHERE id = $1`, cart.ID)
+
+	return cart.ID, err
+}
+
+// cartItemChanged returns ErrCartItemNotFound when no item was changed
+func cartItemChanged(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrCartItemNotFound
+	}
+
+	return nil
+}
+
+// CreatePayment records the start of a payment for the total of an unpaid
+// order, after its discounts. ErrPickupSlotFull is returned when the order's
+// hold on its pickup slot has expired and the slot has been filled.
+func (c *PostgresSQL) CreatePayment(userID int, orderID int, provider string) (model.Payment, error) {
+	tx := c.db().MustBegin()
+
+	err := lockUnpaidOrder(tx, userID, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Payment{}, err
+	}
+
+	err = reservePickupSlotForPayment(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Payment{}, err
+	}
+
+	lines, err := orderLines(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Payment{}, err
+	}
+
+	discount := 0
+
+	err = tx.Get(&discount, `SELECT COALESCE(sum(amount), 0) FROM order_discounts WHERE order_id = $1`, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.Payment{}, err
+	}
+
+	amount := -discount
+	for _, l := range lines {
+		amount += l.Price * l.Quantity
+	}
+
+	if amount < 0 {
+		amount = 0
+	}
+
+	p := model.Payment{}
+
+	err = tx.Get(&p,
+		`INSERT INTO payments (order_id, provider, amount, status, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, now(), now()) RETURNING *`,
+		orderID, provider, amount, model.PaymentStarted,
+	)
+	if err != nil {
+		tx.Rollback()
+		return model.Payment{}, err
+	}
+
+	return p, tx.Commit()
+}
+
+// UpdatePayment records the result of a payment from the provider when the
+// payment still has the status from, returning the current payment and
+// ErrPaymentChanged when it does not. The order is marked paid when the
+// payment is captured and refunded when it is refunded. Orders with a pickup
+// time are scheduled instead of paid until ReleaseScheduledOrders releases
+// them.
+func (c *PostgresSQL) UpdatePayment(p model.Payment, from string) (model.Payment, error) {
+	tx := c.db().MustBegin()
+
+	ps := []model.Payment{}
+
+	err := tx.Select(&ps,
+		`UPDATE payments SET status = $2, reference = $3, failure_reason = $4, updated_at = now() 
+		WHERE id = $1 AND status = $5 RETURNING *`,
+		p.ID, p.Status, p.Reference, p.FailureReason, from,
+	)
+	if err != nil {
+		tx.Rollback()
+		return model.Payment{}, err
+	}
+
+	if len(ps) < 1 {
+		err = tx.Select(&ps, `SELECT * FROM payments WHERE id = $1`, p.ID)
+		tx.Rollback()
+
+		if err != nil {
+			return model.Payment{}, err
+		}
+
+		if len(ps) < 1 {
+			return model.Payment{}, ErrPaymentNotFound
+		}
+
+		return ps[0], ErrPaymentChanged
+	}
+
+	status := ""
+
+	switch p.Status {
+	case model.PaymentCaptured:
+		status = model.OrderPaid
+	case model.PaymentRefunded:
+		status = model.OrderRefunded
+	}
+
+	if status != "" {
+		_, err = tx.Exec(
+			`UPDATE orders SET version = version + 1, updated_at = now(), 
+			status = CASE WHEN $2 = $3 AND pickup_at IS NOT NULL THEN $4 ELSE $2 END, 
+			paid_at = CASE WHEN $2 = $3 THEN now() ELSE paid_at END 
+			WHERE id = $1`, ps[0].OrderID, status, model.OrderPaid, model.OrderScheduled)
+		if err != nil {
+			tx.Rollback()
+			return model.Payment{}, err
+		}
+
+		err = recordOrderEvent(tx, model.EventOrderUpdated, ps[0].OrderID)
+		if err != nil {
+			tx.Rollback()
+			return model.Payment{}, err
+		}
+	}
+
+	return ps[0], tx.Commit()
+}
+
+// GetPaymentByReference returns the payment with the provider's reference
+func (c *PostgresSQL) GetPaymentByReference(provider string, reference string) (model.Payment, error) {
+	ps := []model.Payment{}
+
+	err := c.db().Select(&ps,
+		`SELECT * FROM payments WHERE provider = $1 AND reference = $2 AND reference <> ''`,
+		provider, reference,
+	)
+	if err != nil {
+		return model.Payment{}, err
+	}
+
+	if len(ps) < 1 {
+		return model.Payment{}, ErrPaymentNotFound
+	}
+
+	return ps[0], nil
+}
+
+// GetPayments returns the payments for an order, oldest first
+func (c *PostgresSQL) GetPayments(orderID int) (model.Payments, error) {
+	ps := model.Payments{}
+
+	err := c.db().Select(&ps, `SELECT * FROM payments WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// webhookDeliveryColumns are the columns selected when reading a delivery
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, 
+	last_status_code, last_error, created_at, delivered_at`
+
+// recordOrderEvent writes an event with the current state of an order to the
+// outbox. It runs in the transaction which changed the order so events are
+// only published for changes which are committed.
+func recordOrderEvent(tx *sqlx.Tx, eventType string, orderID int) error {
+	d := model.OrderEventData{Items: []model.OrderEventItem{}}
+
+	err := tx.QueryRowx(
+		`SELECT id, user_id, status, version FROM orders WHERE id = $1`, orderID,
+	).Scan(&d.ID, &d.UserID, &d.Status, &d.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Select(&d.Items,
+		`SELECT id, coffee_id, quantity, prepared_at FROM order_items 
+		WHERE order_id = $1 AND deleted_at IS NULL ORDER BY id`, orderID)
+	if err != nil {
+		return err
+	}
+
+	return recordEvent(tx, model.AggregateOrder, orderID, eventType, d)
+}
+
+// recordCoffeeEvent writes an event with the current state of a coffee to
+// the outbox in the transaction which changed it
+func recordCoffeeEvent(tx *sqlx.Tx, eventType string, coffeeID int) error {
+	d := model.CoffeeEventData{}
+
+	err := tx.Get(&d, `SELECT id, name, price, version FROM coffees WHERE id = $1`, coffeeID)
+	if err != nil {
+		return err
+	}
+
+	return recordEvent(tx, model.AggregateCoffee, coffeeID, eventType, d)
+}
+
+// recordEvent writes an event to the outbox
+func recordEvent(tx *sqlx.Tx, aggregateType string, aggregateID int, eventType string, data interface{}) error {
+	id, err := newEventID()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(model.Event{ID: id, Type: eventType, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO outbox_events (event_id, aggregate_type, aggregate_id, event_type, payload, created_at) 
+		VALUES ($1, $2, $3, $4, $5, now())`,
+		id, aggregateType, aggregateID, eventType, string(payload),
+	)
+
+	return err
+}
+
+// newEventID returns a random ID for an event, subscribers use it to ignore
+// events which are delivered more than once
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return "evt_" + hex.EncodeToString(b), nil
+}
+
+// CreateWebhookSubscription stores a new webhook subscription, the secret is
+// only returned here
+func (c *PostgresSQL) CreateWebhookSubscription(s model.WebhookSubscription) (model.WebhookSubscription, error) {
+	ss := []model.WebhookSubscription{}
+
+	err := c.db().Select(&ss,
+		`INSERT INTO webhook_subscriptions (url, secret, events, created_at) 
+		VALUES ($1, $2, $3, now()) RETURNING id, url, secret, events, created_at`,
+		s.URL, s.Secret, s.Events,
+	)
+	if err != nil {
+		return model.WebhookSubscription{}, err
+	}
+
+	if len(ss) < 1 {
+		return model.WebhookSubscription{}, errors.New("Unable to create webhook subscription")
+	}
+
+	return ss[0], nil
+}
+
+// ListWebhookSubscriptions returns the webhook subscriptions which have not
+// been deleted, without their secrets
+func (c *PostgresSQL) ListWebhookSubscriptions() (model.WebhookSubscriptions, error) {
+	ss := model.WebhookSubscriptions{}
+
+	err := c.db().Select(&ss,
+		`SELECT id, url, events, created_at FROM webhook_subscriptions 
+		WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription, its pending
+// deliveries are marked dead so they are not sent
+func (c *PostgresSQL) DeleteWebhookSubscription(id int) error {
+	tx := c.db().MustBegin()
+
+	res, err := tx.Exec(
+		`UPDATE webhook_subscriptions SET deleted_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+
+		return ErrWebhookSubscriptionNotFound
+	}
+
+	_, err = tx.Exec(
+		`UPDATE webhook_deliveries SET status = $2, last_error = 'Subscription deleted', updated_at = now() 
+		WHERE subscription_id = $1 AND status = $3`,
+		id, model.WebhookDead, model.WebhookPending,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListWebhookDeliveries returns the deliveries for a subscription, newest
+// first. When status is not empty only deliveries with that status are
+// returned.
+func (c *PostgresSQL) ListWebhookDeliveries(subscriptionID int, status string, limit int, offset int) (model.WebhookDeliveries, error) {
+	exists := false
+
+	err := c.db().Get(&exists,
+		`SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1 AND deleted_at IS NULL)`,
+		subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrWebhookSubscriptionNotFound
+	}
+
+	ds := model.WebhookDeliveries{}
+
+	err = c.db().Select(&ds,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries 
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2) 
+		ORDER BY id DESC LIMIT $3 OFFSET $4`,
+		subscriptionID, status, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// RetryWebhookDelivery queues a delivery to be sent again straight away,
+// including deliveries which are dead
+func (c *PostgresSQL) RetryWebhookDelivery(id int) error {
+	res, err := c.db().Exec(
+		`UPDATE webhook_deliveries d SET status = $2, attempts = 0, next_attempt_at = now(), updated_at = now() 
+		FROM webhook_subscriptions s 
+		WHERE d.id = $1 AND s.id = d.subscription_id AND s.deleted_at IS NULL`,
+		id, model.WebhookPending,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+
+		return ErrWebhookDeliveryNotFound
+	}
+
+	return nil
+}
+
+// QueueWebhookDeliveries queues an event for every webhook subscribed to its
+// type. An event which is published again is not queued twice.
+func (c *PostgresSQL) QueueWebhookDeliveries(e model.OutboxEvent) error {
+	_, err := c.db().Exec(
+		`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at) 
+		SELECT id, $1, $2, $3, $4, now(), now(), now() FROM webhook_subscriptions 
+		WHERE deleted_at IS NULL AND $2 = ANY(string_to_array(events, ' ')) 
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`,
+		e.EventID, e.EventType, string(e.Payload), model.WebhookPending,
+	)
+
+	return err
+}
+
+// ClaimWebhookDeliveries returns up to limit deliveries which are due to be
+// sent, with the URL and secret of their subscription. Claimed deliveries are
+// not due again until lease has passed, so they are retried if the worker
+// which claimed them stops before recording the result.
+func (c *PostgresSQL) ClaimWebhookDeliveries(limit int, lease time.Duration) (model.WebhookDeliveries, error) {
+	ds := model.WebhookDeliveries{}
+
+	err := c.db().Select(&ds,
+		`WITH claimed AS (
+			UPDATE webhook_deliveries SET next_attempt_at = now() + $2 * interval '1 second', updated_at = now() 
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries 
+				WHERE status = $3 AND next_attempt_at <= now() 
+				ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED
+			) RETURNING `+webhookDeliveryColumns+`
+		) 
+		SELECT claimed.*, s.url, s.secret FROM claimed 
+		JOIN webhook_subscriptions s ON s.id = claimed.subscription_id 
+		ORDER BY claimed.id`,
+		limit, lease.Seconds(), model.WebhookPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// UpdateWebhookDelivery records the result of sending a delivery. Pending
+// deliveries are sent again after retryIn.
+func (c *PostgresSQL) UpdateWebhookDelivery(d model.WebhookDelivery, retryIn time.Duration) error {
+	_, err := c.db().Exec(
+		`UPDATE webhook_deliveries SET status = $2, attempts = $3, last_status_code = $4, last_error = $5, 
+		next_attempt_at = CASE WHEN $2 = $7 THEN now() + $6 * interval '1 second' END, 
+		delivered_at = CASE WHEN $2 = $8 THEN now() END, updated_at = now() 
+		WHERE id = $1`,
+		d.ID, d.Status, d.Attempts, d.LastStatusCode, d.LastError, retryIn.Seconds(),
+		model.WebhookPending, model.WebhookDelivered,
+	)
+
+	return err
+}
+
+// outboxColumns are the columns selected when reading an outbox event
+const outboxColumns = `id, event_id, aggregate_type, aggregate_id, event_type, payload, attempts, last_error, created_at, published_at, dead_at`
+
+// outboxLockID is the advisory lock held while relaying the outbox, so events
+// are published by one replica at a time in the order they were recorded
+const outboxLockID = 5400501
+
+// RelayOutboxEvents passes up to limit unpublished events to publish, oldest
+// first, and marks them published when it returns nil. When publish fails the
+// error is recorded and later events for the same aggregate are held back
+// until it is published, so each aggregate's events are published in order.
+// Held back events are not selected, so they do not stop other aggregates
+// being published. An event which has failed maxAttempts times is marked dead
+// and no longer holds back its aggregate. Events can be published more than
+// once if the relay stops before they are marked. Returns the number of events
+// published and failed, when another replica is relaying nothing is published.
+func (c *PostgresSQL) RelayOutboxEvents(limit int, maxAttempts int, publish func(model.OutboxEvent) error) (int, int, error) {
+	tx := c.db().MustBegin()
+
+	locked := false
+
+	err := tx.Get(&locked, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockID)
+	if err != nil || !locked {
+		tx.Rollback()
+		return 0, 0, err
+	}
+
+	es := []model.OutboxEvent{}
+
+	err = tx.Select(&es,
+		`SELECT `+outboxColumns+` FROM outbox_events e 
+		WHERE published_at IS NULL AND dead_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM outbox_events f 
+			WHERE f.aggregate_type = e.aggregate_type AND f.aggregate_id = e.aggregate_id AND f.id < e.id 
+			AND f.published_at IS NULL AND f.dead_at IS NULL AND f.attempts > 0
+		) ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+
+	published, failed, err := relayInOrder(es, publish, func(e model.OutboxEvent, perr error) error {
+		if perr != nil {
+			_, err := tx.Exec(
+				`UPDATE outbox_events SET attempts = attempts + 1, last_error = $2, 
+				dead_at = CASE WHEN attempts + 1 >= $3 THEN now() END WHERE id = $1`,
+				e.ID, perr.Error(), maxAttempts)
+			return err
+		}
+
+		_, err := tx.Exec(
+			`UPDATE outbox_events SET attempts = attempts + 1, last_error = '', published_at = now() WHERE id = $1`,
+			e.ID)
+		return err
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+
+	return published, failed, tx.Commit()
+}
+
+// relayInOrder passes events to publish and the result of each to done. Once
+// an event fails the later events for its aggregate are skipped so they are
+// not published before it.
+func relayInOrder(es []model.OutboxEvent, publish func(model.OutboxEvent) error, done func(model.OutboxEvent, error) error) (int, int, error) {
+	published, failed := 0, 0
+	blocked := map[string]bool{}
+
+	for _, e := range es {
+		aggregate := fmt.Sprintf("%s:%d", e.AggregateType, e.AggregateID)
+		if blocked[aggregate] {
+			continue
+		}
+
+		perr := publish(e)
+		if perr != nil {
+			blocked[aggregate] = true
+			failed++
+		} else {
+			published++
+		}
+
+		err := done(e, perr)
+		if err != nil {
+			return published, failed, err
+		}
+	}
+
+	return published, failed, nil
+}
+
+// GetOutboxLag returns the number of unpublished events and how long the
+// oldest has been waiting
+func (c *PostgresSQL) GetOutboxLag() (int, time.Duration, error) {
+	count := 0
+	seconds := 0.0
+
+	err := c.db().QueryRowx(
+		`SELECT count(*), COALESCE(EXTRACT(EPOCH FROM now() - min(created_at)), 0) 
+		FROM outbox_events WHERE published_at IS NULL AND dead_at IS NULL`,
+	).Scan(&count, &seconds)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, time.Duration(seconds * float64(time.Second)), nil
+}
+
+// GetOutboxEvent returns an event from the outbox
+func (c *PostgresSQL) GetOutboxEvent(id int64) (model.OutboxEvent, error) {
+	e := model.OutboxEvent{}
+
+	err := c.db().Get(&e, `SELECT `+outboxColumns+` FROM outbox_events WHERE id = $1`, id)
+
+	return e, err
+}
+
+// GetOrderEvents returns up to limit published events for a user's orders
+// which were recorded after the event with ID after, oldest first. When
+// orderID is not nil only events for that order are returned.
+func (c *PostgresSQL) GetOrderEvents(userID int, orderID *int, after int64, limit int) ([]model.OutboxEvent, error) {
+	es := []model.OutboxEvent{}
+
+	err := c.db().Select(&es,
+		`SELECT e.id, e.event_id, e.aggregate_type, e.aggregate_id, e.event_type, e.payload, 
+		e.attempts, e.last_error, e.created_at, e.published_at FROM outbox_events e 
+		JOIN orders o ON o.id = e.aggregate_id 
+		WHERE e.aggregate_type = $1 AND o.user_id = $2 AND ($3::int IS NULL OR o.id = $3) 
+		AND e.id > $4 AND e.published_at IS NOT NULL 
+		ORDER BY e.id LIMIT $5`,
+		model.AggregateOrder, userID, orderID, after, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return es, nil
+}
+
+// queuedOrderColumns are the columns selected when reading an order in the
+// queue
+const queuedOrderColumns = `id, user_id, store_id, status, version, created_at, paid_at, pickup_at, claimed_by, claimed_at`
+
+// GetOrderQueue returns the orders of every user which have been paid for and
+// not completed, in the order they were paid for or by their pickup time.
+// When storeID is not nil only orders for that store are returned.
+func (c *PostgresSQL) GetOrderQueue(storeID *int, limit int, offset int) (model.QueuedOrders, error) {
+	os := model.QueuedOrders{}
+
+	err := c.db().Select(&os,
+		`SELECT `+queuedOrderColumns+` FROM orders 
+		WHERE status IN ($1, $2) AND deleted_at IS NULL AND ($3::int IS NULL OR store_id = $3) 
+		ORDER BY COALESCE(pickup_at, paid_at), id LIMIT $4 OFFSET $5`,
+		model.OrderPaid, model.OrderPreparing, storeID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillQueuedOrders(c.db(), os)
+	if err != nil {
+		return nil, err
+	}
+
+	return os, nil
+}
+
+// ClaimOrder marks an order in the queue as being prepared by staffID,
+// claiming an order again is allowed
+func (c *PostgresSQL) ClaimOrder(staffID int, orderID int) (model.QueuedOrder, error) {
+	tx := c.db().MustBegin()
+
+	claimed, err := lockQueuedOrder(tx, staffID, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	if claimed {
+		o, err := getQueuedOrder(tx, orderID)
+		if err != nil {
+			tx.Rollback()
+			return model.QueuedOrder{}, err
+		}
+
+		return o, tx.Commit()
+	}
+
+	o, err := updateQueuedOrder(tx, staffID, orderID, model.OrderPreparing)
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
 	}
 
-	_, err = tx.NamedExec(
-		`UPDATE orders SET deleted_at = now()
-		WHERE user_id = :user_id AND id = :order_id AND deleted_at IS NULL`, map[string]interface{}{
-			"user_id":  userID,
-			"order_id": orderID,
-		})
+	return o, tx.Commit()
+}
+
+// PrepareOrderItem marks an item of an order in the queue as prepared, the
+// order is claimed by staffID if nobody has claimed it
+func (c *PostgresSQL) PrepareOrderItem(staffID int, orderID int, itemID int) (model.QueuedOrder, error) {
+	tx := c.db().MustBegin()
+
+	_, err := lockQueuedOrder(tx, staffID, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	err = orderItemChanged(tx.Exec(
+		`UPDATE order_items SET prepared_at = COALESCE(prepared_at, now()), updated_at = now() 
+		WHERE order_id = $1 AND id = $2 AND deleted_at IS NULL`,
+		orderID, itemID,
+	))
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	o, err := updateQueuedOrder(tx, staffID, orderID, model.OrderPreparing)
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	return o, tx.Commit()
+}
+
+// CompleteOrder removes an order from the queue once all of its items have
+// been prepared
+func (c *PostgresSQL) CompleteOrder(staffID int, orderID int) (model.QueuedOrder, error) {
+	tx := c.db().MustBegin()
+
+	_, err := lockQueuedOrder(tx, staffID, orderID)
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	remaining := 0
+
+	err = tx.Get(&remaining,
+		`SELECT count(*) FROM order_items 
+		WHERE order_id = $1 AND deleted_at IS NULL AND prepared_at IS NULL`, orderID)
 	if err != nil {
 		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	if remaining > 0 {
+		tx.Rollback()
+		return model.QueuedOrder{}, ErrOrderItemsNotPrepared
+	}
+
+	o, err := updateQueuedOrder(tx, staffID, orderID, model.OrderCompleted)
+	if err != nil {
+		tx.Rollback()
+		return model.QueuedOrder{}, err
+	}
+
+	return o, tx.Commit()
+}
+
+// ReleaseScheduledOrders moves scheduled orders which are due to be collected
+// within lead into the queue, returning the number released
+func (c *PostgresSQL) ReleaseScheduledOrders(lead time.Duration) (int, error) {
+	tx := c.db().MustBegin()
+
+	ids := []int{}
+
+	err := tx.Select(&ids,
+		`SELECT id FROM orders 
+		WHERE status = $1 AND deleted_at IS NULL AND pickup_at <= now() + $2 * interval '1 second' 
+		ORDER BY pickup_at, id FOR UPDATE SKIP LOCKED`,
+		model.OrderScheduled, lead.Seconds(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, id := range ids {
+		_, err = tx.Exec(
+			`UPDATE orders SET status = $2, version = version + 1, updated_at = now() WHERE id = $1`,
+			id, model.OrderPaid)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		err = recordOrderEvent(tx, model.EventOrderUpdated, id)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return len(ids), tx.Commit()
+}
+
+// lockQueuedOrder locks an order until tx ends, returning ErrOrderNotQueued
+// when it is not waiting to be or being prepared and ErrOrderClaimed when
+// another member of staff has claimed it. It returns true when staffID has
+// already claimed the order.
+func lockQueuedOrder(tx *sqlx.Tx, staffID int, orderID int) (bool, error) {
+	os := []model.QueuedOrder{}
+
+	err := tx.Select(&os,
+		`SELECT `+queuedOrderColumns+` FROM orders 
+		WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, orderID)
+	if err != nil {
+		return false, err
+	}
+
+	if len(os) < 1 {
+		return false, ErrOrderNotFound
+	}
+
+	if os[0].Status != model.OrderPaid && os[0].Status != model.OrderPreparing {
+		return false, ErrOrderNotQueued
+	}
+
+	if os[0].ClaimedBy != nil && *os[0].ClaimedBy != staffID {
+		return false, ErrOrderClaimed
+	}
+
+	return os[0].ClaimedBy != nil, nil
+}
+
+// updateQueuedOrder claims an order for staffID and sets its status, the
+// version is incremented and an event recorded in tx
+func updateQueuedOrder(tx *sqlx.Tx, staffID int, orderID int, status string) (model.QueuedOrder, error) {
+	_, err := tx.Exec(
+		`UPDATE orders SET status = $2, claimed_by = $3, claimed_at = COALESCE(claimed_at, now()), 
+		completed_at = CASE WHEN $2 = $4 THEN now() ELSE completed_at END, 
+		version = version + 1, updated_at = now() 
+		WHERE id = $1`,
+		orderID, status, staffID, model.OrderCompleted,
+	)
+	if err != nil {
+		return model.QueuedOrder{}, err
+	}
+
+	err = recordOrderEvent(tx, model.EventOrderUpdated, orderID)
+	if err != nil {
+		return model.QueuedOrder{}, err
+	}
+
+	return getQueuedOrder(tx, orderID)
+}
+
+// getQueuedOrder returns an order with its items and ingredients
+func getQueuedOrder(q sqlx.Queryer, orderID int) (model.QueuedOrder, error) {
+	os := model.QueuedOrders{}
+
+	err := sqlx.Select(q, &os, `SELECT `+queuedOrderColumns+` FROM orders WHERE id = $1`, orderID)
+	if err != nil {
+		return model.QueuedOrder{}, err
+	}
+
+	if len(os) < 1 {
+		return model.QueuedOrder{}, ErrOrderNotFound
+	}
+
+	err = fillQueuedOrders(q, os)
+	if err != nil {
+		return model.QueuedOrder{}, err
+	}
+
+	return os[0], nil
+}
+
+// fillQueuedOrders reads the items of the orders and sums the ingredients
+// from coffee_ingredients needed to make them
+func fillQueuedOrders(q sqlx.Queryer, os model.QueuedOrders) error {
+	if len(os) < 1 {
+		return nil
+	}
+
+	ids := make([]int64, len(os))
+	byID := map[int]*model.QueuedOrder{}
+
+	for i := range os {
+		ids[i] = int64(os[i].ID)
+		os[i].Items = []model.QueuedOrderItem{}
+		os[i].Ingredients = []model.IngredientRequirement{}
+		byID[os[i].ID] = &os[i]
+	}
+
+	items := []model.QueuedOrderItem{}
+
+	err := sqlx.Select(q, &items,
+		`SELECT oi.id, oi.order_id, oi.coffee_id, c.name AS coffee_name, oi.quantity, oi.prepared_at 
+		FROM order_items oi JOIN coffees c ON c.id = oi.coffee_id 
+		WHERE oi.order_id = ANY($1) AND oi.deleted_at IS NULL 
+		ORDER BY oi.order_id, oi.id`,
+		pq.Array(ids),
+	)
+	if err != nil {
 		return err
 	}
 
-	err = tx.Commit()
+	for _, i := range items {
+		o := byID[i.OrderID]
+		o.Items = append(o.Items, i)
+	}
+
+	ingredients := []model.IngredientRequirement{}
+
+	err = sqlx.Select(q, &ingredients,
+		`SELECT oi.order_id, i.id AS ingredient_id, i.name, sum(ci.quantity * oi.quantity) AS quantity, ci.unit 
+		FROM order_items oi 
+		JOIN coffee_ingredients ci ON ci.coffee_id = oi.coffee_id AND ci.deleted_at IS NULL 
+		JOIN ingredients i ON i.id = ci.ingredient_id 
+		WHERE oi.order_id = ANY($1) AND oi.deleted_at IS NULL 
+		GROUP BY oi.order_id, i.id, i.name, ci.unit 
+		ORDER BY oi.order_id, i.id`,
+		pq.Array(ids),
+	)
 	if err != nil {
 		return err
 	}
 
+	for _, i := range ingredients {
+		o := byID[i.OrderID]
+		o.Ingredients = append(o.Ingredients, i)
+	}
+
 	return nil
 }
 
+// PurgeOutboxEvents deletes events which were published or marked dead more
+// than retention ago
+func (c *PostgresSQL) PurgeOutboxEvents(retention time.Duration) (int64, error) {
+	res, err := c.db().Exec(
+		`DELETE FROM outbox_events 
+		WHERE COALESCE(published_at, dead_at) < now() - $1 * interval '1 second'`,
+		retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
 // CreateCoffee creates a new coffee
 func (c *PostgresSQL) CreateCoffee(coffee model.Coffee) (model.Coffee, error) {
+	tx := c.db().MustBegin()
+
 	m := model.Coffee{}
 
-	rows, err := c.db.NamedQuery(
+	rows, err := tx.NamedQuery(
 		`INSERT INTO coffees (name, teaser, description, price, image, created_at, updated_at) 
 		VALUES(:name, :teaser, :description, :price, :image, now(), now()) 
 		RETURNING id;`, map[string]interface{}{
@@ -437,25 +2987,36 @@ func (c *PostgresSQL) CreateCoffee(coffee model.Coffee) (model.Coffee, error) {
 			"image":       coffee.Image,
 		})
 	if err != nil {
+		tx.Rollback()
 		return m, err
 	}
-	defer rows.Close()
 
 	if rows.Next() {
 		err := rows.StructScan(&m)
 		if err != nil {
+			rows.Close()
+			tx.Rollback()
 			return m, err
 		}
 	}
+	rows.Close()
+
+	err = recordCoffeeEvent(tx, model.EventCoffeeCreated, m.ID)
+	if err != nil {
+		tx.Rollback()
+		return m, err
+	}
 
-	return m, nil
+	return m, tx.Commit()
 }
 
 // UpsertCoffeeIngredient upserts a new coffee ingredient
 func (c *PostgresSQL) UpsertCoffeeIngredient(coffee model.Coffee, ingredient model.Ingredient) (model.CoffeeIngredient, error) {
+	tx := c.db().MustBegin()
+
 	i := model.CoffeeIngredient{}
 
-	rows, err := c.db.NamedQuery(
+	rows, err := tx.NamedQuery(
 		`INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) 
 		VALUES(:coffee_id, :ingredient_id, :quantity, :unit, now(), now()) 
 		ON CONFLICT ON CONSTRAINT unique_coffee_ingredient
@@ -467,16 +3028,285 @@ func (c *PostgresSQL) UpsertCoffeeIngredient(coffee model.Coffee, ingredient mod
 			"unit":          ingredient.Unit,
 		})
 	if err != nil {
+		tx.Rollback()
 		return i, err
 	}
-	defer rows.Close()
 
 	if rows.Next() {
 		err := rows.StructScan(&i)
 		if err != nil {
+			rows.Close()
+			tx.Rollback()
 			return i, err
 		}
 	}
+	rows.Close()
+
+	// the ingredients are part of the coffee so its version changes
+	_, err = tx.Exec(
+		`UPDATE coffees SET version = version + 1, updated_at = now() WHERE id = $1`, coffee.ID)
+	if err != nil {
+		tx.Rollback()
+		return i, err
+	}
+
+	err = recordCoffeeEvent(tx, model.EventCoffeeUpdated, coffee.ID)
+	if err != nil {
+		tx.Rollback()
+		return i, err
+	}
+
+	return i, tx.Commit()
+}
+
+// CreateAuditEvent records an audit event
+func (c *PostgresSQL) CreateAuditEvent(e model.AuditEvent) error {
+	_, err := c.db().NamedExec(
+		`INSERT INTO audit_events (actor_id, action, subject, ip, created_at) 
+		VALUES(:actor_id, :action, :subject, :ip, now());`, e)
+
+	return err
+}
+
+// CreateStore creates a store
+func (c *PostgresSQL) CreateStore(st model.Store) (model.Store, error) {
+	id := 0
+
+	err := c.db().Get(&id,
+		`INSERT INTO stores (name, address, latitude, longitude, hours, timezone, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, now(), now()) RETURNING id`,
+		st.Name, st.Address, st.Latitude, st.Longitude, st.Hours, st.Timezone,
+	)
+	if err != nil {
+		return model.Store{}, err
+	}
+
+	return c.GetStore(id)
+}
+
+// ListStores returns the stores which have not been deleted
+func (c *PostgresSQL) ListStores() (model.Stores, error) {
+	ss := model.Stores{}
+
+	err := c.db().Select(&ss, `SELECT * FROM stores WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// GetStore returns a store, ErrStoreNotFound is returned when it does not
+// exist or has been deleted
+func (c *PostgresSQL) GetStore(id int) (model.Store, error) {
+	ss := model.Stores{}
+
+	err := c.db().Select(&ss, `SELECT * FROM stores WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return model.Store{}, err
+	}
+
+	if len(ss) < 1 {
+		return model.Store{}, ErrStoreNotFound
+	}
+
+	return ss[0], nil
+}
+
+// UpdateStore replaces the details of a store
+func (c *PostgresSQL) UpdateStore(st model.Store) (model.Store, error) {
+	res, err := c.db().Exec(
+		`UPDATE stores SET name = $2, address = $3, latitude = $4, longitude = $5, hours = $6, timezone = $7, 
+		updated_at = now() WHERE id = $1 AND deleted_at IS NULL`,
+		st.ID, st.Name, st.Address, st.Latitude, st.Longitude, st.Hours, st.Timezone,
+	)
+	if err != nil {
+		return model.Store{}, err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return model.Store{}, ErrStoreNotFound
+	}
+
+	return c.GetStore(st.ID)
+}
+
+// DeleteStore deletes a store, orders already placed for it are kept
+func (c *PostgresSQL) DeleteStore(id int) error {
+	res, err := c.db().Exec(
+		`UPDATE stores SET deleted_at = now(), updated_at = now() 
+		WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrStoreNotFound
+	}
+
+	return nil
+}
+
+// GetStoreCoffees returns the menu of a store, the coffees which have not
+// been deleted or made unavailable at the store at the store's prices
+func (c *PostgresSQL) GetStoreCoffees(storeID int) (model.Coffees, error) {
+	_, err := c.GetStore(storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	cos := model.Coffees{}
+
+	err = c.db().Select(&cos,
+		`SELECT c.id, c.name, c.teaser, c.collection, c.origin, c.color, c.description, 
+		COALESCE(sc.price, c.price) AS price, c.price AS catalog_price, 
+		c.image, c.created_at, c.updated_at, c.deleted_at, c.version 
+		FROM coffees c 
+		LEFT JOIN store_coffees sc ON sc.store_id = $1 AND sc.coffee_id = c.id 
+		WHERE c.deleted_at IS NULL AND COALESCE(sc.available, true) 
+		ORDER BY c.id`, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.fillCoffeeIngredients(cos)
+	if err != nil {
+		return nil, err
+	}
+
+	return cos, nil
+}
+
+// ListStoreCoffees returns the changes a store makes to the default catalog
+func (c *PostgresSQL) ListStoreCoffees(storeID int) (model.StoreCoffees, error) {
+	_, err := c.GetStore(storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	scs := model.StoreCoffees{}
+
+	err = c.db().Select(&scs, `SELECT * FROM store_coffees WHERE store_id = $1 ORDER BY coffee_id`, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scs, nil
+}
+
+// SetStoreCoffee sets the price and availability of a coffee at a store
+func (c *PostgresSQL) SetStoreCoffee(sc model.StoreCoffee) (model.StoreCoffee, error) {
+	_, err := c.GetStore(sc.StoreID)
+	if err != nil {
+		return model.StoreCoffee{}, err
+	}
+
+	m := model.StoreCoffee{}
+
+	err = c.db().Get(&m,
+		`INSERT INTO store_coffees (store_id, coffee_id, price, available, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, now(), now()) 
+		ON CONFLICT (store_id, coffee_id) DO UPDATE 
+		SET price = $3, available = $4, updated_at = now() 
+		RETURNING *`,
+		sc.StoreID, sc.CoffeeID, sc.Price, sc.Available,
+	)
+
+	var pe *pq.Error
+	if errors.As(err, &pe) && pe.Code == "23503" {
+		return model.StoreCoffee{}, ErrCoffeeNotFound
+	}
+
+	return m, err
+}
+
+// DeleteStoreCoffee returns a coffee to its default price and availability
+// at a store
+func (c *PostgresSQL) DeleteStoreCoffee(storeID int, coffeeID int) error {
+	_, err := c.GetStore(storeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db().Exec(`DELETE FROM store_coffees WHERE store_id = $1 AND coffee_id = $2`, storeID, coffeeID)
+
+	return err
+}
+
+// GetPriceList returns the prices of coffees in a currency, coffees without
+// a price are converted from the base currency
+func (c *PostgresSQL) GetPriceList(currency string) (model.CoffeePrices, error) {
+	ps := model.CoffeePrices{}
+
+	err := c.db().Select(&ps, `SELECT * FROM coffee_prices WHERE currency = $1 ORDER BY coffee_id`, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// SetCoffeePrice sets the price of a coffee in a currency
+func (c *PostgresSQL) SetCoffeePrice(p model.CoffeePrice) (model.CoffeePrice, error) {
+	m := model.CoffeePrice{}
+
+	err := c.db().Get(&m,
+		`INSERT INTO coffee_prices (coffee_id, currency, price, created_at, updated_at) 
+		VALUES ($1, $2, $3, now(), now()) 
+		ON CONFLICT (coffee_id, currency) DO UPDATE 
+		SET price = $3, updated_at = now() 
+		RETURNING *`,
+		p.CoffeeID, p.Currency, p.Price,
+	)
+
+	var pe *pq.Error
+	if errors.As(err, &pe) && pe.Code == "23503" {
+		return model.CoffeePrice{}, ErrCoffeeNotFound
+	}
+
+	return m, err
+}
+
+// DeleteCoffeePrice removes the price of a coffee in a currency so it is
+// converted from the base currency
+func (c *PostgresSQL) DeleteCoffeePrice(coffeeID int, currency string) error {
+	_, err := c.db().Exec(`DELETE FROM coffee_prices WHERE coffee_id = $1 AND currency = $2`, coffeeID, currency)
+
+	return err
+}
+
+// Notify sends a notification on a Postgres channel
+func (c *PostgresSQL) Notify(channel, payload string) error {
+	_, err := c.db().Exec(`SELECT pg_notify($1, $2)`, channel, payload)
+	return err
+}
+
+// isUniqueViolation returns true when a unique constraint was violated
+func isUniqueViolation(err error) bool {
+	var pe *pq.Error
+	if errors.As(err, &pe) {
+		return pe.Code == "23505"
+	}
+
+	return false
+}
+
+// uniqueViolationError returns the error for the unique constraint violated
+// when creating users and identities, other errors are returned unchanged
+func uniqueViolationError(err error) error {
+	var pe *pq.Error
+	if !errors.As(err, &pe) || pe.Code != "23505" {
+		return err
+	}
+
+	switch pe.Constraint {
+	case "users_username_key":
+		return ErrUsernameInUse
+	case "users_email":
+		return ErrEmailInUse
+	case "user_identities_issuer_subject_key":
+		return ErrIdentityInUse
+	}
 
-	return i, nil
+	return err
 }
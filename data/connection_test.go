@@ -0,0 +1,52 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayInOrderSkipsLaterEventsOfFailedAggregate(t *testing.T) {
+	es := []model.OutboxEvent{
+		{ID: 1, AggregateType: model.AggregateOrder, AggregateID: 1},
+		{ID: 2, AggregateType: model.AggregateOrder, AggregateID: 2},
+		{ID: 3, AggregateType: model.AggregateOrder, AggregateID: 1},
+		{ID: 4, AggregateType: model.AggregateCoffee, AggregateID: 1},
+		{ID: 5, AggregateType: model.AggregateOrder, AggregateID: 2},
+	}
+
+	sent := []int64{}
+	done := map[int64]error{}
+
+	published, failed, err := relayInOrder(es, func(e model.OutboxEvent) error {
+		sent = append(sent, e.ID)
+		if e.ID == 2 {
+			return errors.New("boom")
+		}
+
+		return nil
+	}, func(e model.OutboxEvent, err error) error {
+		done[e.ID] = err
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, []int64{1, 2, 3, 4}, sent)
+	assert.Error(t, done[2])
+	assert.NotContains(t, done, int64(5))
+}
+
+func TestRelayInOrderStopsWhenDoneFails(t *testing.T) {
+	es := []model.OutboxEvent{{ID: 1}, {ID: 2}}
+
+	published, _, err := relayInOrder(es, func(model.OutboxEvent) error { return nil }, func(model.OutboxEvent, error) error {
+		return errors.New("db gone")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, published)
+}
@@ -0,0 +1,175 @@
+package data
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/lib/pq"
+)
+
+// invalidationChannel is the Postgres channel invalidations are sent on
+const invalidationChannel = "token_invalidation"
+
+// Invalidation removes cached tokens, TokenID zero removes every token for
+// the user and All removes every cached token
+type Invalidation struct {
+	TokenID int  `json:"token_id,omitempty"`
+	UserID  int  `json:"user_id,omitempty"`
+	All     bool `json:"all,omitempty"`
+}
+
+// Invalidator shares cache invalidations between replicas of the service
+type Invalidator interface {
+	// Publish sends an invalidation to the other replicas
+	Publish(i Invalidation) error
+	// Subscribe sets the function called for invalidations from other replicas
+	Subscribe(handler func(i Invalidation))
+}
+
+// LocalInvalidator is used when there is a single replica, invalidations
+// only apply to the cache in this process
+type LocalInvalidator struct{}
+
+// Publish implements Invalidator
+func (l *LocalInvalidator) Publish(i Invalidation) error {
+	return nil
+}
+
+// Subscribe implements Invalidator
+func (l *LocalInvalidator) Subscribe(handler func(i Invalidation)) {}
+
+// Notifier sends a Postgres notification, it is implemented by PostgresSQL
+type Notifier interface {
+	Notify(channel, payload string) error
+}
+
+// PostgresInvalidator shares invalidations using Postgres LISTEN/NOTIFY. If
+// the listener loses its connection notifications may have been missed so
+// every cached token is invalidated when it reconnects.
+type PostgresInvalidator struct {
+	notifier Notifier
+	log      hclog.Logger
+
+	mu       sync.Mutex
+	listener *pq.Listener
+	handler  func(i Invalidation)
+	done     chan struct{}
+}
+
+// NewPostgresInvalidator creates an Invalidator which listens using the
+// connection string and sends notifications using n
+func NewPostgresInvalidator(connection string, n Notifier, l hclog.Logger) (*PostgresInvalidator, error) {
+	p := &PostgresInvalidator{notifier: n, log: l}
+
+	if err := p.Reconnect(connection); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Reconnect starts listening with a new connection string, for example after
+// the database credentials have been rotated
+func (p *PostgresInvalidator) Reconnect(connection string) error {
+	l := pq.NewListener(connection, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			p.log.Error("Token invalidation listener error", "error", err)
+		}
+	})
+
+	if err := l.Listen(invalidationChannel); err != nil {
+		l.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	go p.receive(l, done)
+
+	p.mu.Lock()
+	old, oldDone := p.listener, p.done
+	p.listener, p.done = l, done
+	p.mu.Unlock()
+
+	if old != nil {
+		close(oldDone)
+		old.Close()
+		// notifications sent while switching listeners may have been missed
+		p.dispatch(Invalidation{All: true})
+	}
+
+	return nil
+}
+
+// Publish implements Invalidator
+func (p *PostgresInvalidator) Publish(i Invalidation) error {
+	d, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	return p.notifier.Notify(invalidationChannel, string(d))
+}
+
+// Subscribe implements Invalidator
+func (p *PostgresInvalidator) Subscribe(handler func(i Invalidation)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handler = handler
+}
+
+// Close stops listening for invalidations
+func (p *PostgresInvalidator) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.listener == nil {
+		return nil
+	}
+
+	close(p.done)
+	err := p.listener.Close()
+	p.listener = nil
+
+	return err
+}
+
+func (p *PostgresInvalidator) receive(l *pq.Listener, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case n, ok := <-l.NotificationChannel():
+			if !ok {
+				return
+			}
+
+			// a nil notification is sent after the connection is re-established
+			if n == nil {
+				p.log.Info("Token invalidation listener reconnected, clearing token cache")
+				p.dispatch(Invalidation{All: true})
+				continue
+			}
+
+			i := Invalidation{}
+			if err := json.Unmarshal([]byte(n.Extra), &i); err != nil {
+				p.log.Error("Unable to decode token invalidation", "payload", n.Extra, "error", err)
+				continue
+			}
+
+			p.dispatch(i)
+		}
+	}
+}
+
+func (p *PostgresInvalidator) dispatch(i Invalidation) {
+	p.mu.Lock()
+	h := p.handler
+	p.mu.Unlock()
+
+	if h != nil {
+		h(i)
+	}
+}
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,6 +16,17 @@ func (c *MockConnection) IsConnected() (bool, error) {
 	return true, nil
 }
 
+// GetSchemaVersion -
+func (c *MockConnection) GetSchemaVersion() (int, error) {
+	args := c.Called()
+
+	if v, ok := args.Get(0).(int); ok {
+		return v, args.Error(1)
+	}
+
+	return 0, args.Error(1)
+}
+
 // GetCoffees -
 func (c *MockConnection) GetCoffees(*int) (model.Coffees, error) {
 	args := c.Called()
@@ -58,8 +71,107 @@ func (c *MockConnection) AuthUser(username string, password string) (model.User,
 	return model.User{}, args.Error(1)
 }
 
+// GetUser -
+func (c *MockConnection) GetUser(userID int) (model.User, error) {
+	args := c.Called()
+
+	if m, ok := args.Get(0).(model.User); ok {
+		return m, args.Error(1)
+	}
+
+	return model.User{}, args.Error(1)
+}
+
+// GetUserByUsername -
+func (c *MockConnection) GetUserByUsername(username string) (model.User, error) {
+	args := c.Called()
+
+	if m, ok := args.Get(0).(model.User); ok {
+		return m, args.Error(1)
+	}
+
+	return model.User{}, args.Error(1)
+}
+
+// UpdateUser -
+func (c *MockConnection) UpdateUser(u model.User) (model.User, error) {
+	args := c.Called(u)
+
+	if m, ok := args.Get(0).(model.User); ok {
+		return m, args.Error(1)
+	}
+
+	return model.User{}, args.Error(1)
+}
+
+// DeleteUser -
+func (c *MockConnection) DeleteUser(userID int) error {
+	args := c.Called(userID)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ListUsers -
+func (c *MockConnection) ListUsers(query string, limit int, offset int) (model.Users, error) {
+	args := c.Called(query, limit, offset)
+
+	if m, ok := args.Get(0).(model.Users); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// SetUserDisabled -
+func (c *MockConnection) SetUserDisabled(userID int, disabled bool) error {
+	args := c.Called(userID, disabled)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ChangePassword -
+func (c *MockConnection) ChangePassword(userID int, tokenID int, password string) error {
+	args := c.Called(userID, tokenID, password)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// CreatePasswordReset -
+func (c *MockConnection) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	args := c.Called(userID, tokenHash)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword -
+func (c *MockConnection) ResetPassword(tokenHash string, password string) (int, error) {
+	args := c.Called(tokenHash, password)
+
+	if v, ok := args.Get(0).(int); ok {
+		return v, args.Error(1)
+	}
+
+	return 0, args.Error(1)
+}
+
 // CreateToken -
-func (c *MockConnection) CreateToken(userID int) (model.Token, error) {
+func (c *MockConnection) CreateToken(t model.Token) (model.Token, error) {
 	args := c.Called()
 
 	if m, ok := args.Get(0).(model.Token); ok {
@@ -91,6 +203,171 @@ func (c *MockConnection) DeleteToken(tokenID int, userID int) error {
 	return nil
 }
 
+// GetSessions -
+func (c *MockConnection) GetSessions(userID int) (model.Sessions, error) {
+	args := c.Called(userID)
+
+	if m, ok := args.Get(0).(model.Sessions); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// DeleteTokens -
+func (c *MockConnection) DeleteTokens(userID int) error {
+	args := c.Called(userID)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeTokens -
+func (c *MockConnection) PurgeTokens() (int64, error) {
+	args := c.Called()
+
+	if n, ok := args.Get(0).(int64); ok {
+		return n, args.Error(1)
+	}
+
+	return 0, args.Error(1)
+}
+
+// CreateAPIKey -
+func (c *MockConnection) CreateAPIKey(k model.APIKey, keyHash string) (model.APIKey, error) {
+	args := c.Called(k, keyHash)
+
+	if m, ok := args.Get(0).(model.APIKey); ok {
+		return m, args.Error(1)
+	}
+
+	return model.APIKey{}, args.Error(1)
+}
+
+// GetAPIKey -
+func (c *MockConnection) GetAPIKey(keyHash string) (model.APIKey, error) {
+	args := c.Called(keyHash)
+
+	if m, ok := args.Get(0).(model.APIKey); ok {
+		return m, args.Error(1)
+	}
+
+	return model.APIKey{}, args.Error(1)
+}
+
+// ListAPIKeys -
+func (c *MockConnection) ListAPIKeys() (model.APIKeys, error) {
+	args := c.Called()
+
+	if m, ok := args.Get(0).(model.APIKeys); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// RevokeAPIKey -
+func (c *MockConnection) RevokeAPIKey(id int) error {
+	args := c.Called(id)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// GetUserByIdentity -
+func (c *MockConnection) GetUserByIdentity(issuer string, subject string) (model.User, error) {
+	args := c.Called(issuer, subject)
+
+	if m, ok := args.Get(0).(model.User); ok {
+		return m, args.Error(1)
+	}
+
+	return model.User{}, args.Error(1)
+}
+
+// CreateUserWithIdentity -
+func (c *MockConnection) CreateUserWithIdentity(u model.User, i model.Identity) (model.User, error) {
+	args := c.Called(u, i)
+
+	if m, ok := args.Get(0).(model.User); ok {
+		return m, args.Error(1)
+	}
+
+	return model.User{}, args.Error(1)
+}
+
+// LinkIdentity -
+func (c *MockConnection) LinkIdentity(userID int, i model.Identity) error {
+	args := c.Called(userID, i)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// GetIdentities -
+func (c *MockConnection) GetIdentities(userID int) (model.Identities, error) {
+	args := c.Called(userID)
+
+	if m, ok := args.Get(0).(model.Identities); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// ClaimIdempotencyKey -
+func (c *MockConnection) ClaimIdempotencyKey(k model.IdempotencyKey, ttl time.Duration, lockTimeout time.Duration) (model.IdempotencyKey, bool, error) {
+	args := c.Called(k)
+
+	if m, ok := args.Get(0).(model.IdempotencyKey); ok {
+		return m, args.Bool(1), args.Error(2)
+	}
+
+	return model.IdempotencyKey{}, false, args.Error(2)
+}
+
+// CompleteIdempotencyKey -
+func (c *MockConnection) CompleteIdempotencyKey(k model.IdempotencyKey) error {
+	args := c.Called(k)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey -
+func (c *MockConnection) ReleaseIdempotencyKey(userID int, key string) error {
+	args := c.Called(userID, key)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeIdempotencyKeys -
+func (c *MockConnection) PurgeIdempotencyKeys() (int64, error) {
+	args := c.Called()
+
+	if n, ok := args.Get(0).(int64); ok {
+		return n, args.Error(1)
+	}
+
+	return 0, args.Error(1)
+}
+
 // GetOrders -
 func (c *MockConnection) GetOrders(userID int, orderID *int) (model.Orders, error) {
 	args := c.Called()
@@ -103,7 +380,7 @@ func (c *MockConnection) GetOrders(userID int, orderID *int) (model.Orders, erro
 }
 
 // CreateOrder -
-func (c *MockConnection) CreateOrder(userID int, orderItems []model.OrderItems) (model.Order, error) {
+func (c *MockConnection) CreateOrder(userID int, orderItems []model.OrderItems, codes []string, pickup *model.PickupSlot, storeID *int) (model.Order, error) {
 	args := c.Called()
 
 	if m, ok := args.Get(0).(model.Order); ok {
@@ -114,7 +391,7 @@ func (c *MockConnection) CreateOrder(userID int, orderItems []model.OrderItems)
 }
 
 // UpdateOrder -
-func (c *MockConnection) UpdateOrder(userID int, orderID int, orderItems []model.OrderItems) (model.Order, error) {
+func (c *MockConnection) UpdateOrder(userID int, orderID int, orderItems []model.OrderItems, version *int) (model.Order, error) {
 	args := c.Called()
 
 	if m, ok := args.Get(0).(model.Order); ok {
@@ -125,7 +402,7 @@ func (c *MockConnection) UpdateOrder(userID int, orderID int, orderItems []model
 }
 
 // DeleteOrder -
-func (c *MockConnection) DeleteOrder(userID int, orderID int) error {
+func (c *MockConnection) DeleteOrder(userID int, orderID int, version *int) error {
 	args := c.Called()
 
 	if err, ok := args.Get(0).(error); ok {
@@ -135,6 +412,247 @@ func (c *MockConnection) DeleteOrder(userID int, orderID int) error {
 	return nil
 }
 
+// AddOrderItem -
+func (c *MockConnection) AddOrderItem(userID int, orderID int, item model.OrderItems, version *int) (model.Order, error) {
+	args := c.Called(userID, orderID, item, version)
+
+	if m, ok := args.Get(0).(model.Order); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Order{}, args.Error(1)
+}
+
+// UpdateOrderItem -
+func (c *MockConnection) UpdateOrderItem(userID int, orderID int, itemID int, quantity int, version *int) (model.Order, error) {
+	args := c.Called(userID, orderID, itemID, quantity, version)
+
+	if m, ok := args.Get(0).(model.Order); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Order{}, args.Error(1)
+}
+
+// DeleteOrderItem -
+func (c *MockConnection) DeleteOrderItem(userID int, orderID int, itemID int, version *int) (model.Order, error) {
+	args := c.Called(userID, orderID, itemID, version)
+
+	if m, ok := args.Get(0).(model.Order); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Order{}, args.Error(1)
+}
+
+// GetCart -
+func (c *MockConnection) GetCart(userID int) (model.Cart, error) {
+	args := c.Called(userID)
+
+	if m, ok := args.Get(0).(model.Cart); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Cart{}, args.Error(1)
+}
+
+// AddCartItem -
+func (c *MockConnection) AddCartItem(userID int, coffeeID int, quantity int, version *int) (model.Cart, error) {
+	args := c.Called(userID, coffeeID, quantity, version)
+
+	if m, ok := args.Get(0).(model.Cart); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Cart{}, args.Error(1)
+}
+
+// UpdateCartItem -
+func (c *MockConnection) UpdateCartItem(userID int, itemID int, quantity int, version *int) (model.Cart, error) {
+	args := c.Called(userID, itemID, quantity, version)
+
+	if m, ok := args.Get(0).(model.Cart); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Cart{}, args.Error(1)
+}
+
+// DeleteCartItem -
+func (c *MockConnection) DeleteCartItem(userID int, itemID int, version *int) (model.Cart, error) {
+	args := c.Called(userID, itemID, version)
+
+	if m, ok := args.Get(0).(model.Cart); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Cart{}, args.Error(1)
+}
+
+// CheckoutCart -
+func (c *MockConnection) CheckoutCart(userID int, version *int, codes []string, pickup *model.PickupSlot, storeID *int) (model.Order, model.CartChanges, error) {
+	args := c.Called(userID, version, codes, pickup, storeID)
+
+	o, _ := args.Get(0).(model.Order)
+	ch, _ := args.Get(1).(model.CartChanges)
+
+	return o, ch, args.Error(2)
+}
+
+// CreatePromotion -
+func (c *MockConnection) CreatePromotion(p model.Promotion) (model.Promotion, error) {
+	args := c.Called(p)
+
+	if m, ok := args.Get(0).(model.Promotion); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Promotion{}, args.Error(1)
+}
+
+// ListPromotions -
+func (c *MockConnection) ListPromotions() (model.Promotions, error) {
+	args := c.Called()
+
+	if m, ok := args.Get(0).(model.Promotions); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// DeletePromotion -
+func (c *MockConnection) DeletePromotion(id int) error {
+	args := c.Called(id)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// CreatePayment -
+func (c *MockConnection) CreatePayment(userID int, orderID int, provider string) (model.Payment, error) {
+	args := c.Called(userID, orderID, provider)
+
+	if m, ok := args.Get(0).(model.Payment); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Payment{}, args.Error(1)
+}
+
+// UpdatePayment -
+func (c *MockConnection) UpdatePayment(p model.Payment, from string) (model.Payment, error) {
+	args := c.Called(p, from)
+
+	if m, ok := args.Get(0).(model.Payment); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Payment{}, args.Error(1)
+}
+
+// GetPaymentByReference -
+func (c *MockConnection) GetPaymentByReference(provider string, reference string) (model.Payment, error) {
+	args := c.Called(provider, reference)
+
+	if m, ok := args.Get(0).(model.Payment); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Payment{}, args.Error(1)
+}
+
+// GetPayments -
+func (c *MockConnection) GetPayments(orderID int) (model.Payments, error) {
+	args := c.Called(orderID)
+
+	if m, ok := args.Get(0).(model.Payments); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// CreateWebhookSubscription -
+func (c *MockConnection) CreateWebhookSubscription(s model.WebhookSubscription) (model.WebhookSubscription, error) {
+	args := c.Called(s)
+
+	if m, ok := args.Get(0).(model.WebhookSubscription); ok {
+		return m, args.Error(1)
+	}
+
+	return model.WebhookSubscription{}, args.Error(1)
+}
+
+// ListWebhookSubscriptions -
+func (c *MockConnection) ListWebhookSubscriptions() (model.WebhookSubscriptions, error) {
+	args := c.Called()
+
+	if m, ok := args.Get(0).(model.WebhookSubscriptions); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// DeleteWebhookSubscription -
+func (c *MockConnection) DeleteWebhookSubscription(id int) error {
+	args := c.Called(id)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries -
+func (c *MockConnection) ListWebhookDeliveries(subscriptionID int, status string, limit int, offset int) (model.WebhookDeliveries, error) {
+	args := c.Called(subscriptionID, status, limit, offset)
+
+	if m, ok := args.Get(0).(model.WebhookDeliveries); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// RetryWebhookDelivery -
+func (c *MockConnection) RetryWebhookDelivery(id int) error {
+	args := c.Called(id)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries -
+func (c *MockConnection) ClaimWebhookDeliveries(limit int, lease time.Duration) (model.WebhookDeliveries, error) {
+	args := c.Called(limit, lease)
+
+	if m, ok := args.Get(0).(model.WebhookDeliveries); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// UpdateWebhookDelivery -
+func (c *MockConnection) UpdateWebhookDelivery(d model.WebhookDelivery, retryIn time.Duration) error {
+	args := c.Called(d, retryIn)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
 // CreateCoffee creates a new coffee type
 func (c *MockConnection) CreateCoffee(coffee model.Coffee) (model.Coffee, error) {
 	args := c.Called()
@@ -156,3 +674,262 @@ func (c *MockConnection) UpsertCoffeeIngredient(coffee model.Coffee, ingredient
 
 	return model.CoffeeIngredient{}, args.Error(1)
 }
+
+// CreateAuditEvent -
+func (c *MockConnection) CreateAuditEvent(e model.AuditEvent) error {
+	args := c.Called(e)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// QueueWebhookDeliveries -
+func (c *MockConnection) QueueWebhookDeliveries(e model.OutboxEvent) error {
+	args := c.Called(e)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// RelayOutboxEvents passes the events given to Return to publish
+func (c *MockConnection) RelayOutboxEvents(limit int, maxAttempts int, publish func(model.OutboxEvent) error) (int, int, error) {
+	args := c.Called(limit, maxAttempts)
+
+	es, ok := args.Get(0).([]model.OutboxEvent)
+	if !ok {
+		return 0, 0, args.Error(1)
+	}
+
+	published, failed, _ := relayInOrder(es, publish, func(model.OutboxEvent, error) error { return nil })
+
+	return published, failed, args.Error(1)
+}
+
+// GetOutboxLag -
+func (c *MockConnection) GetOutboxLag() (int, time.Duration, error) {
+	args := c.Called()
+
+	return args.Int(0), args.Get(1).(time.Duration), args.Error(2)
+}
+
+// PurgeOutboxEvents -
+func (c *MockConnection) PurgeOutboxEvents(retention time.Duration) (int64, error) {
+	args := c.Called(retention)
+
+	if n, ok := args.Get(0).(int64); ok {
+		return n, args.Error(1)
+	}
+
+	return 0, args.Error(1)
+}
+
+// GetOutboxEvent -
+func (c *MockConnection) GetOutboxEvent(id int64) (model.OutboxEvent, error) {
+	args := c.Called(id)
+
+	if m, ok := args.Get(0).(model.OutboxEvent); ok {
+		return m, args.Error(1)
+	}
+
+	return model.OutboxEvent{}, args.Error(1)
+}
+
+// GetOrderEvents -
+func (c *MockConnection) GetOrderEvents(userID int, orderID *int, after int64, limit int) ([]model.OutboxEvent, error) {
+	args := c.Called(userID, orderID, after, limit)
+
+	if m, ok := args.Get(0).([]model.OutboxEvent); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// GetOrderQueue -
+func (c *MockConnection) GetOrderQueue(storeID *int, limit int, offset int) (model.QueuedOrders, error) {
+	args := c.Called(storeID, limit, offset)
+
+	if m, ok := args.Get(0).(model.QueuedOrders); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// ClaimOrder -
+func (c *MockConnection) ClaimOrder(staffID int, orderID int) (model.QueuedOrder, error) {
+	args := c.Called(staffID, orderID)
+
+	if m, ok := args.Get(0).(model.QueuedOrder); ok {
+		return m, args.Error(1)
+	}
+
+	return model.QueuedOrder{}, args.Error(1)
+}
+
+// PrepareOrderItem -
+func (c *MockConnection) PrepareOrderItem(staffID int, orderID int, itemID int) (model.QueuedOrder, error) {
+	args := c.Called(staffID, orderID, itemID)
+
+	if m, ok := args.Get(0).(model.QueuedOrder); ok {
+		return m, args.Error(1)
+	}
+
+	return model.QueuedOrder{}, args.Error(1)
+}
+
+// CompleteOrder -
+func (c *MockConnection) CompleteOrder(staffID int, orderID int) (model.QueuedOrder, error) {
+	args := c.Called(staffID, orderID)
+
+	if m, ok := args.Get(0).(model.QueuedOrder); ok {
+		return m, args.Error(1)
+	}
+
+	return model.QueuedOrder{}, args.Error(1)
+}
+
+// ReleaseScheduledOrders -
+func (c *MockConnection) ReleaseScheduledOrders(lead time.Duration) (int, error) {
+	args := c.Called(lead)
+
+	return args.Int(0), args.Error(1)
+}
+
+// CreateStore -
+func (c *MockConnection) CreateStore(st model.Store) (model.Store, error) {
+	args := c.Called(st)
+
+	if m, ok := args.Get(0).(model.Store); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Store{}, args.Error(1)
+}
+
+// ListStores -
+func (c *MockConnection) ListStores() (model.Stores, error) {
+	args := c.Called()
+
+	if m, ok := args.Get(0).(model.Stores); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// GetStore -
+func (c *MockConnection) GetStore(id int) (model.Store, error) {
+	args := c.Called(id)
+
+	if m, ok := args.Get(0).(model.Store); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Store{}, args.Error(1)
+}
+
+// UpdateStore -
+func (c *MockConnection) UpdateStore(st model.Store) (model.Store, error) {
+	args := c.Called(st)
+
+	if m, ok := args.Get(0).(model.Store); ok {
+		return m, args.Error(1)
+	}
+
+	return model.Store{}, args.Error(1)
+}
+
+// GetStoreCoffees -
+func (c *MockConnection) GetStoreCoffees(storeID int) (model.Coffees, error) {
+	args := c.Called(storeID)
+
+	if m, ok := args.Get(0).(model.Coffees); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// ListStoreCoffees -
+func (c *MockConnection) ListStoreCoffees(storeID int) (model.StoreCoffees, error) {
+	args := c.Called(storeID)
+
+	if m, ok := args.Get(0).(model.StoreCoffees); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// SetStoreCoffee -
+func (c *MockConnection) SetStoreCoffee(sc model.StoreCoffee) (model.StoreCoffee, error) {
+	args := c.Called(sc)
+
+	if m, ok := args.Get(0).(model.StoreCoffee); ok {
+		return m, args.Error(1)
+	}
+
+	return model.StoreCoffee{}, args.Error(1)
+}
+
+// DeleteStore -
+func (c *MockConnection) DeleteStore(id int) error {
+	args := c.Called(id)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteStoreCoffee -
+func (c *MockConnection) DeleteStoreCoffee(storeID int, coffeeID int) error {
+	args := c.Called(storeID, coffeeID)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// GetPriceList -
+func (c *MockConnection) GetPriceList(currency string) (model.CoffeePrices, error) {
+	args := c.Called(currency)
+
+	if m, ok := args.Get(0).(model.CoffeePrices); ok {
+		return m, args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+// SetCoffeePrice -
+func (c *MockConnection) SetCoffeePrice(p model.CoffeePrice) (model.CoffeePrice, error) {
+	args := c.Called(p)
+
+	if m, ok := args.Get(0).(model.CoffeePrice); ok {
+		return m, args.Error(1)
+	}
+
+	return model.CoffeePrice{}, args.Error(1)
+}
+
+// DeleteCoffeePrice -
+func (c *MockConnection) DeleteCoffeePrice(coffeeID int, currency string) error {
+	args := c.Called(coffeeID, currency)
+
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Scopes which can be granted to an API key
+const (
+	ScopeCatalogRead  = "catalog:read"
+	ScopeCatalogWrite = "catalog:write"
+	ScopeOrdersRead   = "orders:read"
+	ScopeOrdersWrite  = "orders:write"
+)
+
+// KnownScopes lists every scope which can be granted to an API key
+var KnownScopes = []string{ScopeCatalogRead, ScopeCatalogWrite, ScopeOrdersRead, ScopeOrdersWrite}
+
+// APIKey is a long lived credential for a service, requests made with the key
+// act as the user who owns it but only for routes allowed by its scopes
+type APIKey struct {
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	// Prefix is the start of the key so it can be recognised, the key itself
+	// is only returned when it is created
+	Prefix     string  `db:"prefix" json:"prefix"`
+	Key        string  `db:"-" json:"key,omitempty"`
+	UserID     int     `db:"user_id" json:"user_id"`
+	Scopes     Scopes  `db:"scopes" json:"scopes"`
+	CreatedAt  string  `db:"created_at" json:"created_at,omitempty"`
+	LastUsedAt *string `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt  *string `db:"expires_at" json:"expires_at"`
+	RevokedAt  *string `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// APIKeys is a collection of APIKey
+type APIKeys []APIKey
+
+// FromJSON serializes data from json
+func (a *APIKey) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(a)
+}
+
+// ToJSON converts the key to json
+func (a *APIKey) ToJSON() ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// ToJSON converts the collection to json
+func (a *APIKeys) ToJSON() ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// Scopes are the permissions granted to an API key, stored as a space
+// separated list
+type Scopes []string
+
+// Has returns true when scope has been granted
+func (s Scopes) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate returns an error if any scope is not known
+func (s Scopes) Validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, v := range s {
+		known := false
+		for _, k := range KnownScopes {
+			known = known || v == k
+		}
+
+		if !known {
+			return fmt.Errorf("unknown scope %q, must be one of %s", v, strings.Join(KnownScopes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Value implements driver.Valuer
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+// Scan implements sql.Scanner
+func (s *Scopes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = Scopes{}
+	case []byte:
+		*s = strings.Fields(string(v))
+	case string:
+		*s = strings.Fields(v)
+	default:
+		return fmt.Errorf("unable to scan %T into Scopes", src)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyDeserializeFromJSON(t *testing.T) {
+	a := APIKey{}
+
+	err := a.FromJSON(bytes.NewReader([]byte(apiKeyData)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "kiosk", a.Name)
+	assert.Equal(t, Scopes{"catalog:read", "orders:write"}, a.Scopes)
+}
+
+func TestAPIKeySerializesToJSON(t *testing.T) {
+	a := APIKey{ID: 1, Name: "kiosk", Prefix: "pak_abcd", Scopes: Scopes{ScopeOrdersRead}}
+
+	d, err := a.ToJSON()
+	assert.NoError(t, err)
+
+	ad := make(map[string]interface{}, 0)
+	err = json.Unmarshal(d, &ad)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "pak_abcd", ad["prefix"])
+	assert.NotContains(t, ad, "key")
+}
+
+func TestScopesValidate(t *testing.T) {
+	assert.NoError(t, Scopes{ScopeCatalogRead, ScopeOrdersWrite}.Validate())
+	assert.Error(t, Scopes{}.Validate())
+	assert.Error(t, Scopes{"admin"}.Validate())
+}
+
+func TestScopesScan(t *testing.T) {
+	s := Scopes{}
+
+	assert.NoError(t, s.Scan([]byte("catalog:read orders:read")))
+	assert.True(t, s.Has(ScopeOrdersRead))
+	assert.False(t, s.Has(ScopeOrdersWrite))
+
+	v, err := s.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "catalog:read orders:read", v)
+}
+
+var apiKeyData = `
+{
+	"id": 1,
+	"name": "kiosk",
+	"prefix": "pak_abcd",
+	"user_id": 2,
+	"scopes": ["catalog:read", "orders:write"]
+}
+`
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+)
+
+// Audit actions
+const (
+	AuditUserLocked         = "user.locked"
+	AuditIPLocked           = "ip.locked"
+	AuditUserUnlocked       = "user.unlocked"
+	AuditIPUnlocked         = "ip.unlocked"
+	AuditUserDeleted        = "user.deleted"
+	AuditUserDisabled       = "user.disabled"
+	AuditUserEnabled        = "user.enabled"
+	AuditAPIKeyIssued       = "apikey.issued"
+	AuditAPIKeyRevoked      = "apikey.revoked"
+	AuditIdentityLinked     = "identity.linked"
+	AuditPromotionCreated   = "promotion.created"
+	AuditPromotionDeleted   = "promotion.deleted"
+	AuditPaymentRefunded    = "payment.refunded"
+	AuditWebhookCreated     = "webhook.created"
+	AuditWebhookDeleted     = "webhook.deleted"
+	AuditStoreCreated       = "store.created"
+	AuditStoreUpdated       = "store.updated"
+	AuditStoreDeleted       = "store.deleted"
+	AuditStoreMenuChanged   = "store.menu_changed"
+	AuditCoffeePriceChanged = "coffee.price_changed"
+)
+
+// AuditEvent records a security relevant action
+type AuditEvent struct {
+	ID int `db:"id" json:"id"`
+	// ActorID is the user who performed the action, null for the system
+	ActorID   sql.NullInt64 `db:"actor_id" json:"-"`
+	Action    string        `db:"action" json:"action"`
+	Subject   string        `db:"subject" json:"subject"`
+	IP        string        `db:"ip" json:"ip"`
+	CreatedAt string        `db:"created_at" json:"created_at"`
+}
+
+// FromJSON serializes data from json
+func (a *AuditEvent) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(a)
+}
+
+// ToJSON converts the event to json
+func (a *AuditEvent) ToJSON() ([]byte, error) {
+	return json.Marshal(a)
+}
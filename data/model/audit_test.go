@@ -0,0 +1,44 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditEventDeserializeFromJSON(t *testing.T) {
+	a := AuditEvent{}
+
+	err := a.FromJSON(bytes.NewReader([]byte(auditData)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, a.ID)
+	assert.Equal(t, AuditUserLocked, a.Action)
+	assert.Equal(t, "nic", a.Subject)
+}
+
+func TestAuditEventSerializesToJSON(t *testing.T) {
+	a := AuditEvent{ID: 1, Action: AuditIPLocked, Subject: "10.0.0.1", IP: "10.0.0.1"}
+
+	d, err := a.ToJSON()
+	assert.NoError(t, err)
+
+	ad := make(map[string]interface{}, 0)
+	err = json.Unmarshal(d, &ad)
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), ad["id"])
+	assert.Equal(t, "ip.locked", ad["action"])
+	assert.NotContains(t, ad, "actor_id")
+}
+
+var auditData = `
+{
+	"id": 1,
+	"action": "user.locked",
+	"subject": "nic",
+	"ip": "10.0.0.1"
+}
+`
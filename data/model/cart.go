@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Cart reasons an item changed between being added and checkout
+const (
+	CartChangePrice       = "price_changed"
+	CartChangeUnavailable = "unavailable"
+)
+
+// Cart is the coffees a user is going to order, it is stored until checkout so
+// it is kept when the user signs out
+type Cart struct {
+	ID        int    `db:"id" json:"-"`
+	UserID    int    `db:"user_id" json:"-"`
+	CreatedAt string `db:"created_at" json:"-"`
+	UpdatedAt string `db:"updated_at" json:"-"`
+	// Version is incremented each time the cart changes
+	Version int        `db:"version" json:"version,omitempty"`
+	Items   []CartItem `json:"items"`
+}
+
+// ToJSON converts the cart to json
+func (c *Cart) ToJSON() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// OrderItems returns the items in the cart as the items of an order
+func (c *Cart) OrderItems() []OrderItems {
+	items := []OrderItems{}
+
+	for _, i := range c.Items {
+		items = append(items, OrderItems{Coffee: Coffee{ID: i.CoffeeID}, Quantity: i.Quantity})
+	}
+
+	return items
+}
+
+// CartItem is a coffee and quantity in a cart with the price of the coffee
+// when it was added, in minor units of the base currency
+type CartItem struct {
+	ID        int    `db:"id" json:"id"`
+	CartID    int    `db:"cart_id" json:"-"`
+	CoffeeID  int    `db:"coffee_id" json:"-"`
+	Coffee    Coffee `json:"coffee"`
+	Quantity  int    `db:"quantity" json:"quantity"`
+	Price     int    `db:"price" json:"price"`
+	Available bool   `db:"available" json:"available"`
+	CreatedAt string `db:"created_at" json:"-"`
+	UpdatedAt string `db:"updated_at" json:"-"`
+}
+
+// FromJSON serializes data from json
+func (c *CartItem) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(c)
+}
+
+// CartChanges is a list of CartChange
+type CartChanges []CartChange
+
+// CartChange is an item in a cart which changed after it was added, the cart
+// can not be checked out until the user has seen the change
+type CartChange struct {
+	ItemID   int    `json:"item_id"`
+	CoffeeID int    `json:"coffee_id"`
+	Reason   string `json:"reason"`
+	// Price is the price when the item was added
+	Price int `json:"price"`
+	// CurrentPrice is the price the order would be placed at
+	CurrentPrice int `json:"current_price,omitempty"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCartItemDeserializesFromJSON(t *testing.T) {
+	i := CartItem{}
+
+	err := i.FromJSON(bytes.NewReader([]byte(`{"coffee":{"id":3},"quantity":2}`)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, i.Coffee.ID)
+	assert.Equal(t, 2, i.Quantity)
+}
+
+func TestCartReturnsOrderItems(t *testing.T) {
+	c := Cart{Items: []CartItem{
+		{ID: 7, CoffeeID: 1, Quantity: 2, Price: 200},
+		{ID: 8, CoffeeID: 3, Quantity: 1, Price: 150},
+	}}
+
+	items := c.OrderItems()
+
+	assert.Len(t, items, 2)
+	assert.Equal(t, 1, items[0].Coffee.ID)
+	assert.Equal(t, 2, items[0].Quantity)
+	assert.Equal(t, 3, items[1].Coffee.ID)
+	assert.Equal(t, 0, items[1].ID)
+}
+
+func TestCartSerializesEmptyItems(t *testing.T) {
+	c := Cart{Items: []CartItem{}}
+
+	d, err := c.ToJSON()
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"items":[]}`, string(d))
+}
@@ -22,18 +22,28 @@ func (c *Coffees) ToJSON() ([]byte, error) {
 
 // Coffee defines a coffee in the database
 type Coffee struct {
-	ID          int                `db:"id" json:"id"`
-	Name        string             `db:"name" json:"name"`
-	Teaser      string             `db:"teaser" json:"teaser"`
-	Collection  string             `db:"collection" json:"collection"`
-	Origin      string             `db:"origin" json:"origin"`
-	Color       string             `db:"color" json:"color"`
-	Description string             `db:"description" json:"description"`
-	Price       float64            `db:"price" json:"price"`
-	Image       string             `db:"image" json:"image"`
-	CreatedAt   string             `db:"created_at" json:"-"`
-	UpdatedAt   string             `db:"updated_at" json:"-"`
-	DeletedAt   sql.NullString     `db:"deleted_at" json:"-"`
+	ID          int    `db:"id" json:"id"`
+	Name        string `db:"name" json:"name"`
+	Teaser      string `db:"teaser" json:"teaser"`
+	Collection  string `db:"collection" json:"collection"`
+	Origin      string `db:"origin" json:"origin"`
+	Color       string `db:"color" json:"color"`
+	Description string `db:"description" json:"description"`
+	// Price is in minor units of Currency, e.g. cents
+	Price int `db:"price" json:"price"`
+	// CatalogPrice is the price in the catalog when Price is the price at a
+	// store or of an order item, it is nil when Price is the catalog price
+	CatalogPrice *int `db:"catalog_price" json:"-"`
+	// Currency is the ISO 4217 code of the price, FormattedPrice is the price
+	// written for the language of the request
+	Currency       string         `json:"currency,omitempty"`
+	FormattedPrice string         `json:"formatted_price,omitempty"`
+	Image          string         `db:"image" json:"image"`
+	CreatedAt      string         `db:"created_at" json:"-"`
+	UpdatedAt      string         `db:"updated_at" json:"-"`
+	DeletedAt      sql.NullString `db:"deleted_at" json:"-"`
+	// Version is incremented each time the coffee or its ingredients change
+	Version     int                `db:"version" json:"version,omitempty"`
 	Ingredients []CoffeeIngredient `json:"ingredients"`
 }
 
@@ -16,11 +16,12 @@ func TestCoffeesDeserializeFromJSON(t *testing.T) {
 	assert.Len(t, c, 2)
 	assert.Equal(t, 1, c[0].ID)
 	assert.Equal(t, 2, c[1].ID)
+	assert.Equal(t, 3000, c[1].Price)
 }
 
 func TestCoffeesSerializesToJSON(t *testing.T) {
 	c := Coffees{
-		Coffee{ID: 1, Name: "test", Price: 120.12},
+		Coffee{ID: 1, Name: "test", Price: 12012, Currency: "USD", FormattedPrice: "$120.12"},
 	}
 
 	d, err := c.ToJSON()
@@ -32,7 +33,9 @@ func TestCoffeesSerializesToJSON(t *testing.T) {
 
 	assert.Equal(t, float64(1), cd[0]["id"])
 	assert.Equal(t, "test", cd[0]["name"])
-	assert.Equal(t, float64(120.12), cd[0]["price"])
+	assert.Equal(t, float64(12012), cd[0]["price"])
+	assert.Equal(t, "USD", cd[0]["currency"])
+	assert.Equal(t, "$120.12", cd[0]["formatted_price"])
 }
 
 var coffeesData = `
@@ -40,12 +43,12 @@ var coffeesData = `
 	{
 		"id": 1,
 		"name": "Latte",
-		"price": 50.0
+		"price": 5000
 	},
 	{
 		"id": 2,
 		"name": "Americano",
-		"price": 30.0
+		"price": 3000
 	}
 ]
 `
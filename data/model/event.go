@@ -0,0 +1,73 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of aggregate events are recorded for, events for the same aggregate
+// are published in the order they happened
+const (
+	AggregateOrder  = "order"
+	AggregateCoffee = "coffee"
+)
+
+// Types of event
+const (
+	EventOrderCreated  = "order.created"
+	EventOrderUpdated  = "order.updated"
+	EventOrderDeleted  = "order.deleted"
+	EventCoffeeCreated = "coffee.created"
+	EventCoffeeUpdated = "coffee.updated"
+)
+
+// Event is something which happened to an order or coffee, it is the payload
+// published from the outbox
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// OrderEventData is the data of an order event
+type OrderEventData struct {
+	ID      int              `json:"id"`
+	UserID  int              `json:"user_id"`
+	Status  string           `json:"status,omitempty"`
+	Version int              `json:"version"`
+	Items   []OrderEventItem `json:"items"`
+}
+
+// OrderEventItem is an item in the data of an order event
+type OrderEventItem struct {
+	ID       int `db:"id" json:"id"`
+	CoffeeID int `db:"coffee_id" json:"coffee_id"`
+	Quantity int `db:"quantity" json:"quantity"`
+	// PreparedAt is set when staff have made the item
+	PreparedAt *string `db:"prepared_at" json:"prepared_at,omitempty"`
+}
+
+// CoffeeEventData is the data of a coffee event
+type CoffeeEventData struct {
+	ID      int    `db:"id" json:"id"`
+	Name    string `db:"name" json:"name"`
+	Price   int    `db:"price" json:"price"`
+	Version int    `db:"version" json:"version"`
+}
+
+// OutboxEvent is an event waiting in the outbox to be published, it is
+// written in the same transaction as the change it records
+type OutboxEvent struct {
+	ID            int64           `db:"id" json:"-"`
+	EventID       string          `db:"event_id" json:"id"`
+	AggregateType string          `db:"aggregate_type" json:"aggregate_type"`
+	AggregateID   int             `db:"aggregate_id" json:"aggregate_id"`
+	EventType     string          `db:"event_type" json:"type"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	Attempts      int             `db:"attempts" json:"-"`
+	LastError     string          `db:"last_error" json:"-"`
+	CreatedAt     string          `db:"created_at" json:"created_at"`
+	PublishedAt   *string         `db:"published_at" json:"-"`
+	DeadAt        *string         `db:"dead_at" json:"-"`
+}
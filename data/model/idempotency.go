@@ -0,0 +1,19 @@
+package model
+
+// IdempotencyKey is the response stored for a request sent with an
+// Idempotency-Key header
+type IdempotencyKey struct {
+	UserID int    `db:"user_id"`
+	Key    string `db:"key"`
+	// RequestHash identifies the request the key was first used with
+	RequestHash string `db:"request_hash"`
+	// StatusCode is 0 while the first request with the key is running
+	StatusCode   int    `db:"status_code"`
+	ContentType  string `db:"content_type"`
+	ResponseBody []byte `db:"response_body"`
+}
+
+// Completed returns true when the response to the request has been stored
+func (i *IdempotencyKey) Completed() bool {
+	return i.StatusCode != 0
+}
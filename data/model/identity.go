@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Identity links an account with an external OpenID Connect provider to a
+// user, the account is identified by the issuer and subject
+type Identity struct {
+	ID        int    `db:"id" json:"id"`
+	UserID    int    `db:"user_id" json:"-"`
+	Issuer    string `db:"issuer" json:"issuer"`
+	Subject   string `db:"subject" json:"subject"`
+	Email     string `db:"email" json:"email,omitempty"`
+	CreatedAt string `db:"created_at" json:"created_at,omitempty"`
+}
+
+// Identities is a collection of Identity
+type Identities []Identity
+
+// FromJSON serializes data from json
+func (i *Identities) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(i)
+}
+
+// ToJSON converts the collection to json
+func (i *Identities) ToJSON() ([]byte, error) {
+	return json.Marshal(i)
+}
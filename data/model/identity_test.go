@@ -0,0 +1,46 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentitiesDeserializeFromJSON(t *testing.T) {
+	i := Identities{}
+
+	err := i.FromJSON(bytes.NewReader([]byte(identitiesData)))
+	assert.NoError(t, err)
+
+	assert.Len(t, i, 1)
+	assert.Equal(t, "https://accounts.example.com", i[0].Issuer)
+	assert.Equal(t, "1234", i[0].Subject)
+}
+
+func TestIdentitiesSerializeWithoutUserID(t *testing.T) {
+	i := Identities{{ID: 1, UserID: 2, Issuer: "https://accounts.example.com", Subject: "1234"}}
+
+	d, err := i.ToJSON()
+	assert.NoError(t, err)
+
+	id := make([]map[string]interface{}, 0)
+	err = json.Unmarshal(d, &id)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "1234", id[0]["subject"])
+	assert.NotContains(t, id[0], "user_id")
+}
+
+var identitiesData = `
+[
+	{
+		"id": 1,
+		"issuer": "https://accounts.example.com",
+		"subject": "1234",
+		"email": "nic@example.com",
+		"created_at": "2020-01-01T10:00:00Z"
+	}
+]
+`
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// Money is an amount in minor units of a currency, e.g. cents, with the
+// amount written for the language of the request
+type Money struct {
+	Amount    int    `json:"amount"`
+	Currency  string `json:"currency"`
+	Formatted string `json:"formatted"`
+}
+
+// OrderTotals are the totals of an order in the currency it is shown in
+type OrderTotals struct {
+	Subtotal Money `json:"subtotal"`
+	Discount Money `json:"discount"`
+	Total    Money `json:"total"`
+}
+
+// CoffeePrice is the price of a coffee in a currency other than the base
+// currency, it is used instead of converting the price with the exchange
+// rate
+type CoffeePrice struct {
+	CoffeeID  int    `db:"coffee_id" json:"coffee_id"`
+	Currency  string `db:"currency" json:"currency"`
+	Price     int    `db:"price" json:"price"`
+	CreatedAt string `db:"created_at" json:"-"`
+	UpdatedAt string `db:"updated_at" json:"-"`
+}
+
+// ToJSON converts the price to json
+func (p *CoffeePrice) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// CoffeePrices is a price list, a collection of CoffeePrice
+type CoffeePrices []CoffeePrice
+
+// ToJSON converts the collection to json
+func (p *CoffeePrices) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
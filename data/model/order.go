@@ -27,7 +27,32 @@ type Order struct {
 	CreatedAt string         `db:"created_at" json:"-"`
 	UpdatedAt string         `db:"updated_at" json:"-"`
 	DeletedAt sql.NullString `db:"deleted_at" json:"-"`
-	Items     []OrderItems   `json:"items,omitempty"`
+	// Status is pending until the order is paid for
+	Status string `db:"status" json:"status,omitempty"`
+	// Version is incremented each time the order changes
+	Version int          `db:"version" json:"version,omitempty"`
+	Items   []OrderItems `json:"items,omitempty"`
+	// PaidAt is when the order joined the queue, ClaimedBy is the staff
+	// member preparing it
+	PaidAt      *string       `db:"paid_at" json:"-"`
+	ClaimedBy   sql.NullInt64 `db:"claimed_by" json:"-"`
+	ClaimedAt   *string       `db:"claimed_at" json:"-"`
+	CompletedAt *string       `db:"completed_at" json:"completed_at,omitempty"`
+	// PickupAt is when the customer will collect the order, nil is as soon
+	// as possible
+	PickupAt *string `db:"pickup_at" json:"pickup_at,omitempty"`
+	// PickupSlotStart and PickupSlotEnd are the window the pickup time is
+	// counted in, which holds at most PickupCapacity orders
+	PickupSlotStart *string `db:"pickup_slot_start" json:"-"`
+	PickupSlotEnd   *string `db:"pickup_slot_end" json:"-"`
+	PickupCapacity  int     `db:"pickup_capacity" json:"-"`
+	// StoreID is the store the order is collected from, nil is the default
+	// catalog
+	StoreID *int `db:"store_id" json:"store_id,omitempty"`
+	// Discounts are the promotions applied to the order
+	Discounts []OrderDiscount `json:"discounts,omitempty"`
+	// Totals are the totals in the currency the order is shown in
+	Totals *OrderTotals `json:"totals,omitempty"`
 }
 
 // FromJSON serializes data from json
@@ -43,12 +68,36 @@ func (o *Order) ToJSON() ([]byte, error) {
 
 // OrderItems is an item/quantity in an order
 type OrderItems struct {
-	ID        int            `db:"id" json:"-"`
-	OrderID   int            `db:"order_id" json:"-"`
-	CoffeeID  int            `db:"coffee_id" json:"-"`
-	Coffee    Coffee         `json:"coffee,omitempty"`
-	Quantity  int            `db:"quantity" json:"quantity,omitempty"`
-	CreatedAt string         `db:"created_at" json:"-"`
-	UpdatedAt string         `db:"updated_at" json:"-"`
-	DeletedAt sql.NullString `db:"deleted_at" json:"-"`
+	ID       int    `db:"id" json:"id,omitempty"`
+	OrderID  int    `db:"order_id" json:"-"`
+	CoffeeID int    `db:"coffee_id" json:"-"`
+	Coffee   Coffee `json:"coffee,omitempty"`
+	Quantity int    `db:"quantity" json:"quantity,omitempty"`
+	// Price is the price of the coffee at the store of the order when the
+	// item was added, in minor units of the base currency
+	Price int `db:"price" json:"-"`
+	// PreparedAt is set when staff have made the item
+	PreparedAt *string        `db:"prepared_at" json:"prepared_at,omitempty"`
+	CreatedAt  string         `db:"created_at" json:"-"`
+	UpdatedAt  string         `db:"updated_at" json:"-"`
+	DeletedAt  sql.NullString `db:"deleted_at" json:"-"`
+}
+
+// MergeOrderItems combines items for the same coffee into a single item,
+// keeping the position of the first
+func MergeOrderItems(items []OrderItems) []OrderItems {
+	merged := []OrderItems{}
+	index := map[int]int{}
+
+	for _, i := range items {
+		if n, ok := index[i.Coffee.ID]; ok {
+			merged[n].Quantity += i.Quantity
+			continue
+		}
+
+		index[i.Coffee.ID] = len(merged)
+		merged = append(merged, i)
+	}
+
+	return merged
 }
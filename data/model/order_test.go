@@ -63,6 +63,33 @@ func TestOrdersSerializesToJSON(t *testing.T) {
 
 }
 
+func TestOrderItemsSerializeID(t *testing.T) {
+	o := Order{ID: 1, Items: []OrderItems{{ID: 7, Quantity: 1}}}
+
+	d, err := o.ToJSON()
+	assert.NoError(t, err)
+
+	od := map[string]interface{}{}
+	err = json.Unmarshal(d, &od)
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(7), od["items"].([]interface{})[0].(map[string]interface{})["id"])
+}
+
+func TestMergeOrderItemsCombinesSameCoffee(t *testing.T) {
+	items := MergeOrderItems([]OrderItems{
+		{Coffee: Coffee{ID: 2}, Quantity: 1},
+		{Coffee: Coffee{ID: 1}, Quantity: 2},
+		{Coffee: Coffee{ID: 2}, Quantity: 3},
+	})
+
+	assert.Len(t, items, 2)
+	assert.Equal(t, 2, items[0].Coffee.ID)
+	assert.Equal(t, 4, items[0].Quantity)
+	assert.Equal(t, 1, items[1].Coffee.ID)
+	assert.Equal(t, 2, items[1].Quantity)
+}
+
 var ordersData = `
 [
    {
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// Statuses of an order, paid orders wait in the queue until staff claim
+// them to prepare. Paid orders with a pickup time are scheduled until they
+// are released to the queue.
+const (
+	OrderPending   = "pending"
+	OrderScheduled = "scheduled"
+	OrderPaid      = "paid"
+	OrderPreparing = "preparing"
+	OrderCompleted = "completed"
+	OrderRefunded  = "refunded"
+)
+
+// Statuses of a payment
+const (
+	// PaymentStarted payments have been recorded but not sent to the provider
+	PaymentStarted    = "started"
+	PaymentPending    = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentDeclined   = "declined"
+	PaymentFailed     = "failed"
+	PaymentRefunded   = "refunded"
+	// PaymentRefunding payments have been claimed for a refund which has not
+	// yet been confirmed by the provider
+	PaymentRefunding = "refunding"
+)
+
+// Payment is an attempt to pay for an order, Amount is in the same units as
+// coffee prices
+type Payment struct {
+	ID            int    `db:"id" json:"id"`
+	OrderID       int    `db:"order_id" json:"order_id"`
+	Provider      string `db:"provider" json:"provider"`
+	Reference     string `db:"reference" json:"reference,omitempty"`
+	Amount        int    `db:"amount" json:"amount"`
+	Status        string `db:"status" json:"status"`
+	FailureReason string `db:"failure_reason" json:"failure_reason,omitempty"`
+	CreatedAt     string `db:"created_at" json:"created_at"`
+	UpdatedAt     string `db:"updated_at" json:"updated_at"`
+}
+
+// InProgress returns true when the result of the payment is not yet known
+func (p *Payment) InProgress() bool {
+	return p.Status == PaymentStarted || p.Status == PaymentPending || p.Status == PaymentAuthorized
+}
+
+// ToJSON converts the payment to json
+func (p *Payment) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// Payments is a collection of Payment
+type Payments []Payment
+
+// ToJSON converts the collection to json
+func (p *Payments) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
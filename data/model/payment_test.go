@@ -0,0 +1,28 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentInProgress(t *testing.T) {
+	for s, want := range map[string]bool{
+		PaymentStarted:  true,
+		PaymentPending:  true,
+		PaymentCaptured: false,
+		PaymentDeclined: false,
+	} {
+		p := Payment{Status: s}
+		assert.Equal(t, want, p.InProgress(), s)
+	}
+}
+
+func TestPaymentSerializesToJSON(t *testing.T) {
+	p := Payment{ID: 1, OrderID: 2, Provider: "fake", Amount: 200, Status: PaymentDeclined, FailureReason: "card_declined"}
+
+	d, err := p.ToJSON()
+	assert.NoError(t, err)
+
+	assert.Contains(t, string(d), `"status":"declined","failure_reason":"card_declined"`)
+}
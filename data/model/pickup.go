@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// PickupSlot is the window an order will be collected in, at most Capacity
+// orders can be collected in a window, 0 is unlimited
+type PickupSlot struct {
+	At       time.Time
+	Start    time.Time
+	End      time.Time
+	Capacity int
+}
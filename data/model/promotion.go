@@ -0,0 +1,85 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Types of promotion
+const (
+	// PromotionPercentage takes Percent off the price of the items it applies to
+	PromotionPercentage = "percentage"
+	// PromotionFixedAmount takes Amount off the price of the items it applies to
+	PromotionFixedAmount = "fixed_amount"
+	// PromotionBuyNGetOne makes one item free for every BuyQuantity items bought,
+	// the cheapest items are free
+	PromotionBuyNGetOne = "buy_n_get_one"
+)
+
+// Promotion is a discount which is applied to an order using its code.
+// Promotions with a CoffeeID or Collection only apply to matching items.
+type Promotion struct {
+	ID          int    `db:"id" json:"id"`
+	Code        string `db:"code" json:"code"`
+	Name        string `db:"name" json:"name"`
+	Type        string `db:"type" json:"type"`
+	Percent     int    `db:"percent" json:"percent,omitempty"`
+	Amount      int    `db:"amount" json:"amount,omitempty"`
+	BuyQuantity int    `db:"buy_quantity" json:"buy_quantity,omitempty"`
+	CoffeeID    *int   `db:"coffee_id" json:"coffee_id,omitempty"`
+	Collection  string `db:"collection" json:"collection,omitempty"`
+	// Stackable promotions can be used with other stackable promotions on the
+	// same order, other promotions must be used alone
+	Stackable      bool    `db:"stackable" json:"stackable"`
+	StartsAt       *string `db:"starts_at" json:"starts_at"`
+	EndsAt         *string `db:"ends_at" json:"ends_at"`
+	MaxUses        *int    `db:"max_uses" json:"max_uses"`
+	MaxUsesPerUser *int    `db:"max_uses_per_user" json:"max_uses_per_user"`
+	// Uses is the number of orders the promotion has been applied to
+	Uses int `db:"uses" json:"uses"`
+	// Active is true when the promotion has not been deleted and is within
+	// its validity window
+	Active    bool   `db:"active" json:"active"`
+	CreatedAt string `db:"created_at" json:"created_at,omitempty"`
+}
+
+// Promotions is a collection of Promotion
+type Promotions []Promotion
+
+// AppliesTo returns true when the promotion applies to an item for the coffee
+func (p *Promotion) AppliesTo(c Coffee) bool {
+	if p.CoffeeID != nil && *p.CoffeeID != c.ID {
+		return false
+	}
+
+	return p.Collection == "" || p.Collection == c.Collection
+}
+
+// FromJSON serializes data from json
+func (p *Promotion) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(p)
+}
+
+// ToJSON converts the promotion to json
+func (p *Promotion) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// ToJSON converts the collection to json
+func (p *Promotions) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// OrderDiscount is a promotion applied to an order, Amount is in the same
+// units as coffee prices
+type OrderDiscount struct {
+	ID          int    `db:"id" json:"-"`
+	OrderID     int    `db:"order_id" json:"-"`
+	PromotionID int    `db:"promotion_id" json:"promotion_id"`
+	UserID      int    `db:"user_id" json:"-"`
+	Code        string `db:"code" json:"code"`
+	Name        string `db:"name" json:"name"`
+	Amount      int    `db:"amount" json:"amount"`
+	CreatedAt   string `db:"created_at" json:"-"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromotionAppliesToMatchingCoffees(t *testing.T) {
+	id := 2
+
+	all := Promotion{}
+	coffee := Promotion{CoffeeID: &id}
+	collection := Promotion{Collection: "Origins"}
+
+	assert.True(t, all.AppliesTo(Coffee{ID: 1, Collection: "Foundations"}))
+	assert.True(t, coffee.AppliesTo(Coffee{ID: 2}))
+	assert.False(t, coffee.AppliesTo(Coffee{ID: 1}))
+	assert.True(t, collection.AppliesTo(Coffee{ID: 1, Collection: "Origins"}))
+	assert.False(t, collection.AppliesTo(Coffee{ID: 1, Collection: "Foundations"}))
+}
+
+func TestOrderSerializesDiscounts(t *testing.T) {
+	o := Order{ID: 1, Discounts: []OrderDiscount{{ID: 4, PromotionID: 2, Code: "TEN", Name: "Ten off", Amount: 90}}}
+
+	d, err := o.ToJSON()
+	assert.NoError(t, err)
+
+	assert.Contains(t, string(d), `"discounts":[{"promotion_id":2,"code":"TEN","name":"Ten off","amount":90}]`)
+}
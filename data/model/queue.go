@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// QueuedOrder is an order in the queue staff prepare orders from, with the
+// ingredients needed to make it
+type QueuedOrder struct {
+	ID          int                     `db:"id" json:"id"`
+	UserID      int                     `db:"user_id" json:"user_id"`
+	StoreID     *int                    `db:"store_id" json:"store_id,omitempty"`
+	Status      string                  `db:"status" json:"status"`
+	Version     int                     `db:"version" json:"version"`
+	CreatedAt   string                  `db:"created_at" json:"created_at"`
+	PaidAt      *string                 `db:"paid_at" json:"paid_at,omitempty"`
+	PickupAt    *string                 `db:"pickup_at" json:"pickup_at,omitempty"`
+	ClaimedBy   *int                    `db:"claimed_by" json:"claimed_by,omitempty"`
+	ClaimedAt   *string                 `db:"claimed_at" json:"claimed_at,omitempty"`
+	Items       []QueuedOrderItem       `json:"items"`
+	Ingredients []IngredientRequirement `json:"ingredients"`
+}
+
+// QueuedOrders is a collection of QueuedOrder
+type QueuedOrders []QueuedOrder
+
+// ToJSON converts the order to json
+func (q *QueuedOrder) ToJSON() ([]byte, error) {
+	return json.Marshal(q)
+}
+
+// ToJSON converts the collection to json
+func (q *QueuedOrders) ToJSON() ([]byte, error) {
+	return json.Marshal(q)
+}
+
+// QueuedOrderItem is an item staff need to make
+type QueuedOrderItem struct {
+	ID         int     `db:"id" json:"id"`
+	OrderID    int     `db:"order_id" json:"-"`
+	CoffeeID   int     `db:"coffee_id" json:"coffee_id"`
+	CoffeeName string  `db:"coffee_name" json:"coffee_name"`
+	Quantity   int     `db:"quantity" json:"quantity"`
+	PreparedAt *string `db:"prepared_at" json:"prepared_at,omitempty"`
+}
+
+// IngredientRequirement is the total amount of an ingredient needed to make
+// every item in an order
+type IngredientRequirement struct {
+	OrderID      int    `db:"order_id" json:"-"`
+	IngredientID int    `db:"ingredient_id" json:"ingredient_id"`
+	Name         string `db:"name" json:"name"`
+	Quantity     int    `db:"quantity" json:"quantity"`
+	Unit         string `db:"unit" json:"unit"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Session describes an active token issued to a user
+type Session struct {
+	ID         int     `db:"id" json:"id"`
+	CreatedAt  string  `db:"created_at" json:"created_at"`
+	LastUsedAt *string `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt  string  `db:"expires_at" json:"expires_at"`
+	IP         string  `db:"ip" json:"ip"`
+	UserAgent  string  `db:"user_agent" json:"user_agent"`
+	// Current is true for the session making the request
+	Current bool `db:"-" json:"current"`
+}
+
+// Sessions is a collection of Session
+type Sessions []Session
+
+// FromJSON serializes data from json
+func (s *Sessions) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(s)
+}
+
+// ToJSON converts the collection to json
+func (s *Sessions) ToJSON() ([]byte, error) {
+	return json.Marshal(s)
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsDeserializeFromJSON(t *testing.T) {
+	s := Sessions{}
+
+	err := s.FromJSON(bytes.NewReader([]byte(sessionData)))
+	assert.NoError(t, err)
+
+	assert.Len(t, s, 2)
+	assert.Nil(t, s[0].LastUsedAt)
+	assert.Equal(t, "2020-01-01T10:00:00Z", *s[1].LastUsedAt)
+	assert.True(t, s[1].Current)
+}
+
+func TestSessionsSerializesToJSON(t *testing.T) {
+	s := Sessions{{ID: 1, IP: "10.0.0.1", UserAgent: "curl/7.68.0"}}
+
+	d, err := s.ToJSON()
+	assert.NoError(t, err)
+
+	sd := make([]map[string]interface{}, 0)
+	err = json.Unmarshal(d, &sd)
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), sd[0]["id"])
+	assert.Equal(t, "curl/7.68.0", sd[0]["user_agent"])
+	assert.Nil(t, sd[0]["last_used_at"])
+}
+
+var sessionData = `
+[
+	{
+		"id": 1,
+		"created_at": "2020-01-01T09:00:00Z",
+		"last_used_at": null,
+		"ip": "10.0.0.1",
+		"user_agent": "curl/7.68.0"
+	},
+	{
+		"id": 2,
+		"created_at": "2020-01-01T09:30:00Z",
+		"last_used_at": "2020-01-01T10:00:00Z",
+		"ip": "10.0.0.2",
+		"user_agent": "Mozilla/5.0",
+		"current": true
+	}
+]
+`
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+)
+
+// Store is a location orders can be collected from
+type Store struct {
+	ID        int      `db:"id" json:"id"`
+	Name      string   `db:"name" json:"name"`
+	Address   string   `db:"address" json:"address"`
+	Latitude  *float64 `db:"latitude" json:"latitude,omitempty"`
+	Longitude *float64 `db:"longitude" json:"longitude,omitempty"`
+	// Hours are the opening hours in the form accepted by pickup.ParseHours,
+	// in the time zone of the store. Empty is always open.
+	Hours     string         `db:"hours" json:"hours"`
+	Timezone  string         `db:"timezone" json:"timezone"`
+	CreatedAt string         `db:"created_at" json:"-"`
+	UpdatedAt string         `db:"updated_at" json:"-"`
+	DeletedAt sql.NullString `db:"deleted_at" json:"-"`
+}
+
+// FromJSON serializes data from json
+func (s *Store) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(s)
+}
+
+// ToJSON converts the store to json
+func (s *Store) ToJSON() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// Stores is a collection of Store
+type Stores []Store
+
+// ToJSON converts the collection to json
+func (s *Stores) ToJSON() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// StoreCoffee changes a coffee on the menu of a store, a nil Price uses the
+// price of the coffee
+type StoreCoffee struct {
+	StoreID   int    `db:"store_id" json:"store_id"`
+	CoffeeID  int    `db:"coffee_id" json:"coffee_id"`
+	Price     *int   `db:"price" json:"price,omitempty"`
+	Available bool   `db:"available" json:"available"`
+	CreatedAt string `db:"created_at" json:"-"`
+	UpdatedAt string `db:"updated_at" json:"-"`
+}
+
+// ToJSON converts the override to json
+func (s *StoreCoffee) ToJSON() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// StoreCoffees is a collection of StoreCoffee
+type StoreCoffees []StoreCoffee
+
+// ToJSON converts the collection to json
+func (s *StoreCoffees) ToJSON() ([]byte, error) {
+	return json.Marshal(s)
+}
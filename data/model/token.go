@@ -9,6 +9,9 @@ import (
 type Token struct {
 	ID        int    `db:"id" json:"id"`
 	UserID    int    `db:"user_id" json:"user_id"`
+	IP        string `db:"ip" json:"-"`
+	UserAgent string `db:"user_agent" json:"-"`
+	ExpiresAt string `db:"expires_at" json:"-"`
 	CreatedAt string `db:"created_at" json:"-"`
 	DeletedAt string `db:"deleted_at" json:"-"`
 }
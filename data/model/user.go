@@ -2,21 +2,40 @@ package model
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"io"
 )
 
+// RoleAdmin is the role of users who can administer the API
+const RoleAdmin = "admin"
+
+// RoleUser is the role given to users who sign up
+const RoleUser = "user"
+
+// RoleStaff is the role of staff who prepare orders
+const RoleStaff = "staff"
+
 // User defines a user in the database
 type User struct {
-	ID        int            `db:"id" json:"id"`
-	Username  string         `db:"username" json:"username"`
-	Password  string         `db:"password" json:"-"`
-	CreatedAt string         `db:"created_at" json:"-"`
-	UpdatedAt string         `db:"updated_at" json:"-"`
-	DeletedAt sql.NullString `db:"deleted_at" json:"-"`
-	Orders    []Orders       `json:"orders"`
+	ID          int            `db:"id" json:"id"`
+	Username    string         `db:"username" json:"username"`
+	Password    string         `db:"password" json:"-"`
+	Role        string         `db:"role" json:"role,omitempty"`
+	DisplayName string         `db:"display_name" json:"display_name,omitempty"`
+	Email       string         `db:"email" json:"email,omitempty"`
+	Preferences Preferences    `db:"preferences" json:"preferences,omitempty"`
+	Disabled    bool           `db:"disabled" json:"disabled,omitempty"`
+	CreatedAt   string         `db:"created_at" json:"-"`
+	UpdatedAt   string         `db:"updated_at" json:"-"`
+	DeletedAt   sql.NullString `db:"deleted_at" json:"-"`
+	Orders      []Orders       `json:"orders"`
 }
 
+// Users is a collection of User
+type Users []User
+
 // FromJSON serializes data from json
 func (u *User) FromJSON(data io.Reader) error {
 	de := json.NewDecoder(data)
@@ -27,3 +46,60 @@ func (u *User) FromJSON(data io.Reader) error {
 func (u *User) ToJSON() ([]byte, error) {
 	return json.Marshal(u)
 }
+
+// ToJSON converts the collection to json
+func (u *Users) ToJSON() ([]byte, error) {
+	return json.Marshal(u)
+}
+
+// Preferences are settings chosen by a user, stored as a JSON object
+type Preferences map[string]interface{}
+
+// Merge applies the changes in p to the preferences, a key with a null value
+// is removed
+func (p Preferences) Merge(changes Preferences) Preferences {
+	out := Preferences{}
+	for k, v := range p {
+		out[k] = v
+	}
+
+	for k, v := range changes {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+
+		out[k] = v
+	}
+
+	return out
+}
+
+// Value implements driver.Valuer
+func (p Preferences) Value() (driver.Value, error) {
+	if p == nil {
+		return "{}", nil
+	}
+
+	d, err := json.Marshal(p)
+	return string(d), err
+}
+
+// Scan implements sql.Scanner
+func (p *Preferences) Scan(src interface{}) error {
+	var d []byte
+
+	switch v := src.(type) {
+	case nil:
+		*p = Preferences{}
+		return nil
+	case []byte:
+		d = v
+	case string:
+		d = []byte(v)
+	default:
+		return fmt.Errorf("unable to scan %T into Preferences", src)
+	}
+
+	return json.Unmarshal(d, p)
+}
@@ -38,3 +38,24 @@ var userData = `
 	"username": "testUser"
 }
 `
+
+func TestPreferencesMergeRemovesNullKeys(t *testing.T) {
+	p := Preferences{"milk": "oat", "sugar": float64(1)}
+
+	m := p.Merge(Preferences{"milk": nil, "size": "large"})
+
+	assert.Equal(t, Preferences{"sugar": float64(1), "size": "large"}, m)
+	assert.Equal(t, "oat", p["milk"])
+}
+
+func TestPreferencesScansJSON(t *testing.T) {
+	p := Preferences{}
+
+	err := p.Scan([]byte(`{"milk": "oat"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "oat", p["milk"])
+
+	v, err := p.Value()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"milk": "oat"}`, v.(string))
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KnownEventTypes lists every event a webhook can subscribe to
+var KnownEventTypes = []string{EventOrderCreated, EventOrderUpdated, EventOrderDeleted, EventCoffeeCreated, EventCoffeeUpdated}
+
+// Statuses of a webhook delivery
+const (
+	// WebhookPending deliveries are waiting to be sent or retried
+	WebhookPending = "pending"
+	// WebhookDelivered deliveries were accepted by the subscriber
+	WebhookDelivered = "delivered"
+	// WebhookDead deliveries failed too many times and are no longer retried
+	WebhookDead = "dead"
+)
+
+// WebhookSubscription sends events of the given types to a URL, bodies are
+// signed with the secret which is only returned when it is created
+type WebhookSubscription struct {
+	ID        int        `db:"id" json:"id"`
+	URL       string     `db:"url" json:"url"`
+	Secret    string     `db:"secret" json:"secret,omitempty"`
+	Events    EventTypes `db:"events" json:"events"`
+	CreatedAt string     `db:"created_at" json:"created_at,omitempty"`
+}
+
+// WebhookSubscriptions is a collection of WebhookSubscription
+type WebhookSubscriptions []WebhookSubscription
+
+// FromJSON serializes data from json
+func (w *WebhookSubscription) FromJSON(data io.Reader) error {
+	de := json.NewDecoder(data)
+	return de.Decode(w)
+}
+
+// ToJSON converts the subscription to json
+func (w *WebhookSubscription) ToJSON() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+// ToJSON converts the collection to json
+func (w *WebhookSubscriptions) ToJSON() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+// WebhookDelivery is an event being sent to a subscription
+type WebhookDelivery struct {
+	ID             int             `db:"id" json:"id"`
+	SubscriptionID int             `db:"subscription_id" json:"subscription_id"`
+	EventID        string          `db:"event_id" json:"event_id"`
+	EventType      string          `db:"event_type" json:"event_type"`
+	Payload        json.RawMessage `db:"payload" json:"payload"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	NextAttemptAt  *string         `db:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `db:"last_status_code" json:"last_status_code,omitempty"`
+	LastError      string          `db:"last_error" json:"last_error,omitempty"`
+	CreatedAt      string          `db:"created_at" json:"created_at"`
+	DeliveredAt    *string         `db:"delivered_at" json:"delivered_at,omitempty"`
+	// URL and Secret are read from the subscription when sending
+	URL    string `db:"url" json:"-"`
+	Secret string `db:"secret" json:"-"`
+}
+
+// WebhookDeliveries is a collection of WebhookDelivery
+type WebhookDeliveries []WebhookDelivery
+
+// ToJSON converts the collection to json
+func (w *WebhookDeliveries) ToJSON() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+// EventTypes are the events a webhook subscribes to, stored as a space
+// separated list
+type EventTypes []string
+
+// Has returns true when the event type is in the list
+func (e EventTypes) Has(t string) bool {
+	for _, v := range e {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate returns an error if any event type is not known
+func (e EventTypes) Validate() error {
+	if len(e) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+
+	for _, v := range e {
+		known := false
+		for _, k := range KnownEventTypes {
+			known = known || v == k
+		}
+
+		if !known {
+			return fmt.Errorf("unknown event %q, must be one of %s", v, strings.Join(KnownEventTypes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Value implements driver.Valuer
+func (e EventTypes) Value() (driver.Value, error) {
+	return strings.Join(e, " "), nil
+}
+
+// Scan implements sql.Scanner
+func (e *EventTypes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*e = EventTypes{}
+	case []byte:
+		*e = strings.Fields(string(v))
+	case string:
+		*e = strings.Fields(v)
+	default:
+		return fmt.Errorf("unable to scan %T into EventTypes", src)
+	}
+
+	return nil
+}
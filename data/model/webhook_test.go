@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTypesValidate(t *testing.T) {
+	assert.NoError(t, EventTypes{EventOrderCreated, EventOrderDeleted}.Validate())
+	assert.Error(t, EventTypes{}.Validate())
+	assert.Error(t, EventTypes{"order.eaten"}.Validate())
+}
+
+func TestEventTypesScan(t *testing.T) {
+	e := EventTypes{}
+
+	assert.NoError(t, e.Scan([]byte("order.created order.updated")))
+	assert.Equal(t, EventTypes{EventOrderCreated, EventOrderUpdated}, e)
+	assert.True(t, e.Has(EventOrderUpdated))
+	assert.False(t, e.Has(EventOrderDeleted))
+}
+
+func TestWebhookSubscriptionHidesEmptySecret(t *testing.T) {
+	w := WebhookSubscription{ID: 1, URL: "https://example.com", Events: EventTypes{EventOrderCreated}}
+
+	d, err := w.ToJSON()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, string(d), "secret")
+}
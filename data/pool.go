@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/telemetry"
+	"github.com/hashicorp/go-hclog"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// minRotationInterval limits how often new credentials are fetched when the
+// database keeps rejecting them
+const minRotationInterval = 5 * time.Second
+
+// CredentialsFunc returns the current database connection string, it is called
+// when the database rejects the credentials in use so rotated values are fetched
+type CredentialsFunc func() (string, error)
+
+// pool is a database connection pool which can be atomically replaced, when the
+// database rejects the credentials for a new connection the pool fetches fresh
+// credentials, opens a new pool, switches to it and drains the old one
+type pool struct {
+	db atomic.Value // *sqlx.DB
+
+	mu           sync.Mutex // serialises switching pools
+	connection   string
+	lastRotation time.Time
+	rotating     int32
+
+	credentials CredentialsFunc
+	connect     func(connection string, authFailed func()) (*sqlx.DB, error)
+	log         hclog.Logger
+	telemetry   *telemetry.Telemetry
+}
+
+func newPool(connection string, credentials CredentialsFunc, t *telemetry.Telemetry, l hclog.Logger) (*pool, error) {
+	if t != nil {
+		t.AddCounter("db.rotation.success")
+		t.AddCounter("db.rotation.failure")
+		t.AddMeasure("db.rotation")
+	}
+
+	p := &pool{
+		connection:  connection,
+		credentials: credentials,
+		connect:     connect,
+		log:         l,
+		telemetry:   t,
+	}
+
+	db, err := p.connect(connection, p.authFailed)
+	if err != nil {
+		return nil, err
+	}
+
+	p.db.Store(db)
+
+	return p, nil
+}
+
+// connect opens a new pool which calls authFailed when the database rejects
+// the credentials for a new connection
+func connect(connection string, authFailed func()) (*sqlx.DB, error) {
+	pc, err := pq.NewConnector(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(&authConnector{pc, authFailed}), "postgres")
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// get returns the current pool
+func (p *pool) get() *sqlx.DB {
+	return p.db.Load().(*sqlx.DB)
+}
+
+// reconnect switches to a new pool when the connection string has changed
+func (p *pool) reconnect(connection string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if connection == p.connection {
+		return nil
+	}
+
+	return p.swap(connection, "reconnect")
+}
+
+// authFailed starts a rotation in the background unless one is already running
+func (p *pool) authFailed() {
+	// failures while opening the first pool are handled by the caller of newPool
+	if p.credentials == nil || p.db.Load() == nil {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&p.rotating, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&p.rotating, 0)
+
+		if err := p.rotate(); err != nil {
+			p.log.Error("Unable to rotate database credentials", "error", err)
+		}
+	}()
+}
+
+// rotate fetches fresh credentials and switches to a pool using them
+func (p *pool) rotate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.lastRotation) < minRotationInterval {
+		return nil
+	}
+	p.lastRotation = time.Now()
+
+	p.log.Info("Database rejected credentials, fetching new credentials")
+
+	connection, err := p.credentials()
+	if err != nil {
+		p.increment("db.rotation.failure")
+		return err
+	}
+
+	return p.swap(connection, "authentication failure")
+}
+
+// swap opens a new pool, atomically switches to it and drains the old pool
+// callers must hold p.mu
+func (p *pool) swap(connection string, reason string) error {
+	st := time.Now()
+	done := func() {}
+	if p.telemetry != nil {
+		done = p.telemetry.NewTiming("db.rotation")
+	}
+
+	db, err := p.connect(connection, p.authFailed)
+	if err != nil {
+		p.increment("db.rotation.failure")
+		return err
+	}
+
+	old := p.get()
+	p.db.Store(db)
+	p.connection = connection
+
+	done()
+	p.increment("db.rotation.success")
+	p.log.Info("Switched to new database connection pool", "reason", reason, "duration", time.Since(st))
+
+	// Close waits for the queries which have already started on the old pool
+	go func() {
+		ds := time.Now()
+		old.Close()
+		p.log.Info("Drained old database connection pool", "duration", time.Since(ds))
+	}()
+
+	return nil
+}
+
+func (p *pool) increment(key string) {
+	if p.telemetry != nil {
+		p.telemetry.Increment(key)
+	}
+}
+
+// isAuthFailure returns true when the database rejected the credentials
+func isAuthFailure(err error) bool {
+	var pe *pq.Error
+	if errors.As(err, &pe) {
+		return pe.Code.Class() == "28"
+	}
+
+	var pv pq.Error
+	if errors.As(err, &pv) {
+		return pv.Code.Class() == "28"
+	}
+
+	return false
+}
+
+// authConnector wraps a driver.Connector to detect rejected credentials
+type authConnector struct {
+	driver.Connector
+	authFailed func()
+}
+
+// Connect implements driver.Connector
+func (a *authConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := a.Connector.Connect(ctx)
+	if err != nil && isAuthFailure(err) {
+		a.authFailed()
+	}
+
+	return conn, err
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConnector struct{}
+
+func (f *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+func setupPool(t *testing.T, credentials CredentialsFunc) (*pool, *[]string) {
+	mu := sync.Mutex{}
+	opened := []string{}
+
+	p := &pool{
+		connection:  "password=first",
+		credentials: credentials,
+		log:         hclog.NewNullLogger(),
+		connect: func(connection string, authFailed func()) (*sqlx.DB, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if connection == "password=bad" {
+				return nil, &pq.Error{Code: "28P01"}
+			}
+
+			opened = append(opened, connection)
+			return sqlx.NewDb(sql.OpenDB(&fakeConnector{}), "postgres"), nil
+		},
+	}
+
+	db, err := p.connect(p.connection, p.authFailed)
+	assert.NoError(t, err)
+	p.db.Store(db)
+
+	return p, &opened
+}
+
+func TestDetectsAuthFailures(t *testing.T) {
+	assert.True(t, isAuthFailure(&pq.Error{Code: "28P01"}))
+	assert.True(t, isAuthFailure(pq.Error{Code: "28000"}))
+	assert.False(t, isAuthFailure(&pq.Error{Code: "42601"}))
+	assert.False(t, isAuthFailure(errors.New("connection refused")))
+}
+
+func TestRotatesPoolOnAuthFailure(t *testing.T) {
+	p, opened := setupPool(t, func() (string, error) { return "password=second", nil })
+	old := p.get()
+
+	p.authFailed()
+
+	assert.Eventually(t, func() bool {
+		return p.get() != old
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, []string{"password=first", "password=second"}, *opened)
+
+	// the old pool is drained and closed
+	assert.Eventually(t, func() bool {
+		return old.Ping() != nil && old.Ping().Error() == "sql: database is closed"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestKeepsPoolWhenCredentialsCanNotBeFetched(t *testing.T) {
+	p, _ := setupPool(t, func() (string, error) { return "", errors.New("vault sealed") })
+	old := p.get()
+
+	err := p.rotate()
+
+	assert.Error(t, err)
+	assert.Equal(t, old, p.get())
+}
+
+func TestKeepsPoolWhenNewCredentialsAreRejected(t *testing.T) {
+	p, _ := setupPool(t, func() (string, error) { return "password=bad", nil })
+	old := p.get()
+
+	err := p.rotate()
+
+	assert.True(t, isAuthFailure(err))
+	assert.Equal(t, old, p.get())
+}
+
+func TestLimitsRotationRate(t *testing.T) {
+	calls := 0
+	p, _ := setupPool(t, func() (string, error) {
+		calls++
+		return "password=second", nil
+	})
+
+	assert.NoError(t, p.rotate())
+	assert.NoError(t, p.rotate())
+	assert.Equal(t, 1, calls)
+}
+
+func TestReconnectSkipsUnchangedConnection(t *testing.T) {
+	p, opened := setupPool(t, nil)
+
+	err := p.reconnect("password=first")
+	assert.NoError(t, err)
+	assert.Len(t, *opened, 1)
+
+	err = p.reconnect("password=second")
+	assert.NoError(t, err)
+	assert.Len(t, *opened, 2)
+}
@@ -1,6 +1,10 @@
 set time zone 'UTC';
 create extension pgcrypto;
 
+CREATE TABLE schema_migrations (
+    version int PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL
+);
 CREATE TABLE coffees (
     id serial PRIMARY KEY,
     name VARCHAR (255) NOT NULL UNIQUE,
@@ -13,6 +17,7 @@ CREATE TABLE coffees (
     image TEXT,
     created_at TIMESTAMP NOT NULL,
     updated_at TIMESTAMP NOT NULL,
+    version int NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 CREATE TABLE ingredients (
@@ -33,36 +38,247 @@ CREATE TABLE coffee_ingredients (
     deleted_at TIMESTAMP,
     CONSTRAINT unique_coffee_ingredient UNIQUE (coffee_id,ingredient_id)
 );
+CREATE TABLE coffee_prices (
+    coffee_id int NOT NULL references coffees(id),
+    currency VARCHAR (3) NOT NULL,
+    price INT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (coffee_id, currency)
+);
 CREATE TABLE users (
     id serial PRIMARY KEY,
     username VARCHAR (255) NOT NULL UNIQUE,
     password TEXT NOT NULL,
+    role VARCHAR (50) NOT NULL DEFAULT 'user',
+    display_name VARCHAR (255) NOT NULL DEFAULT '',
+    email VARCHAR (255),
+    preferences JSONB NOT NULL DEFAULT '{}',
     created_at TIMESTAMP NOT NULL,
     updated_at TIMESTAMP NOT NULL,
+    disabled_at TIMESTAMP,
     deleted_at TIMESTAMP
 );
+CREATE UNIQUE INDEX users_email ON users (lower(email)) WHERE deleted_at IS NULL;
 CREATE TABLE tokens (
     id serial PRIMARY KEY,
     user_id int references users(id),
+    ip VARCHAR (64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
     deleted_at TIMESTAMP
 );
+CREATE INDEX tokens_user_id ON tokens (user_id);
+CREATE TABLE user_identities (
+    id serial PRIMARY KEY,
+    user_id int NOT NULL references users(id),
+    issuer VARCHAR (255) NOT NULL,
+    subject VARCHAR (255) NOT NULL,
+    email VARCHAR (255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (issuer, subject)
+);
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
+CREATE TABLE idempotency_keys (
+    user_id int NOT NULL references users(id),
+    key VARCHAR (255) NOT NULL,
+    request_hash VARCHAR (64) NOT NULL,
+    status_code int NOT NULL DEFAULT 0,
+    content_type VARCHAR (255) NOT NULL DEFAULT '',
+    response_body BYTEA NOT NULL DEFAULT '',
+    locked_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at);
+CREATE TABLE api_keys (
+    id serial PRIMARY KEY,
+    name VARCHAR (255) NOT NULL,
+    prefix VARCHAR (16) NOT NULL,
+    key_hash VARCHAR (64) NOT NULL UNIQUE,
+    user_id int NOT NULL references users(id),
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+CREATE TABLE password_resets (
+    id serial PRIMARY KEY,
+    user_id int NOT NULL references users(id),
+    token_hash VARCHAR (64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE audit_events (
+    id serial PRIMARY KEY,
+    actor_id int references users(id),
+    action VARCHAR (50) NOT NULL,
+    subject VARCHAR (255) NOT NULL,
+    ip VARCHAR (64) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX audit_events_action ON audit_events (action, created_at);
+CREATE TABLE stores (
+    id serial PRIMARY KEY,
+    name VARCHAR (255) NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    hours VARCHAR (255) NOT NULL DEFAULT '',
+    timezone VARCHAR (64) NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+CREATE TABLE store_coffees (
+    store_id int NOT NULL references stores(id),
+    coffee_id int NOT NULL references coffees(id),
+    price INT,
+    available BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (store_id, coffee_id)
+);
 CREATE TABLE orders (
     id serial PRIMARY KEY,
     user_id int references users(id),
+    store_id int references stores(id),
+    status VARCHAR (50) NOT NULL DEFAULT 'pending',
     created_at TIMESTAMP NOT NULL,
     updated_at TIMESTAMP NOT NULL,
+    version int NOT NULL DEFAULT 1,
+    paid_at TIMESTAMP,
+    claimed_by int references users(id),
+    claimed_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    pickup_at TIMESTAMP,
+    pickup_slot_start TIMESTAMP,
+    pickup_slot_end TIMESTAMP,
+    pickup_capacity int NOT NULL DEFAULT 0,
     deleted_at TIMESTAMP
 );
+CREATE INDEX orders_queue ON orders (COALESCE(pickup_at, paid_at), id) WHERE status IN ('paid', 'preparing') AND deleted_at IS NULL;
+CREATE INDEX orders_pickup_at ON orders (store_id, pickup_at) WHERE pickup_at IS NOT NULL AND deleted_at IS NULL;
 CREATE TABLE order_items (
     id serial PRIMARY KEY,
     order_id int references orders(id),
     coffee_id int references coffees(id),
-    quantity int NOT NULL,
+    quantity int NOT NULL CHECK (quantity > 0),
+    price INT NOT NULL,
+    prepared_at TIMESTAMP,
     created_at TIMESTAMP NOT NULL,
     updated_at TIMESTAMP NOT NULL,
     deleted_at TIMESTAMP
 );
+CREATE UNIQUE INDEX order_items_coffee ON order_items (order_id, coffee_id) WHERE deleted_at IS NULL;
+CREATE TABLE carts (
+    id serial PRIMARY KEY,
+    user_id int NOT NULL UNIQUE references users(id),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    version int NOT NULL DEFAULT 1
+);
+CREATE TABLE cart_items (
+    id serial PRIMARY KEY,
+    cart_id int NOT NULL references carts(id),
+    coffee_id int NOT NULL references coffees(id),
+    quantity int NOT NULL CHECK (quantity > 0),
+    price INT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (cart_id, coffee_id)
+);
+CREATE TABLE promotions (
+    id serial PRIMARY KEY,
+    code VARCHAR (64) NOT NULL,
+    name VARCHAR (255) NOT NULL,
+    type VARCHAR (50) NOT NULL,
+    percent int NOT NULL DEFAULT 0,
+    amount int NOT NULL DEFAULT 0,
+    buy_quantity int NOT NULL DEFAULT 0,
+    coffee_id int references coffees(id),
+    collection VARCHAR (255) NOT NULL DEFAULT '',
+    stackable BOOLEAN NOT NULL DEFAULT false,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    max_uses int,
+    max_uses_per_user int,
+    created_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+CREATE UNIQUE INDEX promotions_code ON promotions (lower(code)) WHERE deleted_at IS NULL;
+CREATE TABLE order_discounts (
+    id serial PRIMARY KEY,
+    order_id int NOT NULL references orders(id),
+    promotion_id int NOT NULL references promotions(id),
+    user_id int NOT NULL references users(id),
+    code VARCHAR (64) NOT NULL,
+    name VARCHAR (255) NOT NULL,
+    amount int NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX order_discounts_order_id ON order_discounts (order_id);
+CREATE INDEX order_discounts_promotion_id ON order_discounts (promotion_id, user_id);
+CREATE TABLE payments (
+    id serial PRIMARY KEY,
+    order_id int NOT NULL references orders(id),
+    provider VARCHAR (50) NOT NULL,
+    reference VARCHAR (255) NOT NULL DEFAULT '',
+    amount int NOT NULL,
+    status VARCHAR (50) NOT NULL,
+    failure_reason VARCHAR (255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+CREATE INDEX payments_order_id ON payments (order_id);
+CREATE UNIQUE INDEX payments_reference ON payments (provider, reference) WHERE reference <> '';
+CREATE TABLE webhook_subscriptions (
+    id serial PRIMARY KEY,
+    url VARCHAR (2048) NOT NULL,
+    secret VARCHAR (255) NOT NULL,
+    events VARCHAR (255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP
+);
+CREATE TABLE webhook_deliveries (
+    id serial PRIMARY KEY,
+    subscription_id int NOT NULL references webhook_subscriptions(id),
+    event_id VARCHAR (255) NOT NULL,
+    event_type VARCHAR (50) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR (50) NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_status_code int NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP
+);
+CREATE INDEX webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id, id);
+CREATE UNIQUE INDEX webhook_deliveries_event_id ON webhook_deliveries (subscription_id, event_id);
+CREATE TABLE outbox_events (
+    id bigserial PRIMARY KEY,
+    event_id VARCHAR (255) NOT NULL,
+    aggregate_type VARCHAR (50) NOT NULL,
+    aggregate_id int NOT NULL,
+    event_type VARCHAR (50) NOT NULL,
+    payload TEXT NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP,
+    dead_at TIMESTAMP
+);
+CREATE INDEX outbox_events_unpublished ON outbox_events (id) WHERE published_at IS NULL AND dead_at IS NULL;
+
+INSERT INTO schema_migrations (version, applied_at) VALUES (23, CURRENT_DATE);
 
 INSERT INTO ingredients (id, name, created_at, updated_at) VALUES (1, 'Espresso', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO ingredients (id, name, created_at, updated_at) VALUES (2, 'Semi Skimmed Milk', CURRENT_DATE, CURRENT_DATE);
@@ -71,36 +287,36 @@ INSERT INTO ingredients (id, name, created_at, updated_at) VALUES (4, 'Pumpkin S
 INSERT INTO ingredients (id, name, created_at, updated_at) VALUES (5, 'Steamed Milk', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO ingredients (id, name, created_at, updated_at) VALUES (6, 'Coffee', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('HCP Aeropress', 'Automation in a cup', 'Foundations', 'Summer 2020', '#444', '', 200, '/hashicorp.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('HCP Aeropress', 'Automation in a cup', 'Foundations', 'Summer 2020', '#444', '', 20000, '/hashicorp.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (1,6, 350, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Packer Spiced Latte', 'Packed with goodness to spice up your images', 'Origins', 'Summer 2013', '#1FA7EE', '', 350, '/packer.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Packer Spiced Latte', 'Packed with goodness to spice up your images', 'Origins', 'Summer 2013', '#1FA7EE', '', 35000, '/packer.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (2,1, 40, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (2,2, 300, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (2,4, 5, 'g', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Vaulatte', 'Nothing gives you a safe and secure feeling like a Vaulatte', 'Foundations', 'Spring 2015', '#FFD814', '', 200, '/vault.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Vaulatte', 'Nothing gives you a safe and secure feeling like a Vaulatte', 'Foundations', 'Spring 2015', '#FFD814', '', 20000, '/vault.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (3,1, 40, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (3,2, 300, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Nomadicano', 'Drink one today and you will want to schedule another',  'Foundations', 'Fall 2015', '#00CA8E', '', 150, '/nomad.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Nomadicano', 'Drink one today and you will want to schedule another',  'Foundations', 'Fall 2015', '#00CA8E', '', 15000, '/nomad.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (4,1, 20, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (4,3, 100, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Terraspresso', 'Nothing kickstarts your day like a provision of Terraspresso', 'Origins', 'Summer 2014', '#894BD1', '', 150, '/terraform.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Terraspresso', 'Nothing kickstarts your day like a provision of Terraspresso', 'Origins', 'Summer 2014', '#894BD1', '', 15000, '/terraform.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (5,1, 20, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Vagrante espresso', 'Stdin is not a tty', 'Origins', '2010', '#0E67ED', '', 200, '/vagrant.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Vagrante espresso', 'Stdin is not a tty', 'Origins', '2010', '#0E67ED', '', 20000, '/vagrant.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (6,1, 40, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Connectaccino', 'Discover the wonders of our meshy service', 'Origins', 'Spring 2014', '#F44D8A', '', 250, '/consul.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Connectaccino', 'Discover the wonders of our meshy service', 'Origins', 'Spring 2014', '#F44D8A', '', 25000, '/consul.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (7,1, 40, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (7,5, 300, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Boundary Red Eye', 'Perk up and watch out for your access management', 'Discoveries', 'Fall 2020', '#F24C53', '', 200, '/boundary.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Boundary Red Eye', 'Perk up and watch out for your access management', 'Discoveries', 'Fall 2020', '#F24C53', '', 20000, '/boundary.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (8,1, 30, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (8,6, 120, 'ml', CURRENT_DATE, CURRENT_DATE);
 
-INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Waypointiato', 'Deploy with a little foam', 'Discoveries', 'Fall 2020', '#14C6CB', '', 250, '/waypoint.png', CURRENT_DATE, CURRENT_DATE);
+INSERT INTO coffees (name, teaser, collection, origin, color, description, price, image, created_at, updated_at) VALUES ('Waypointiato', 'Deploy with a little foam', 'Discoveries', 'Fall 2020', '#14C6CB', '', 25000, '/waypoint.png', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (9,1, 60, 'ml', CURRENT_DATE, CURRENT_DATE);
 INSERT INTO coffee_ingredients (coffee_id, ingredient_id, quantity, unit, created_at, updated_at) VALUES (9,2, 30, 'ml', CURRENT_DATE, CURRENT_DATE);
\ No newline at end of file
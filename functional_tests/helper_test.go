@@ -11,9 +11,11 @@ import (
 
 	"github.com/cucumber/messages-go/v10"
 	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
 	"github.com/hashicorp-demoapp/product-api-go/data"
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
 	"github.com/hashicorp-demoapp/product-api-go/handlers"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
 	"github.com/hashicorp/go-hclog"
 )
 
@@ -64,9 +66,9 @@ func (api *apiFeature) initHandlers() {
 	l := hclog.Default()
 
 	api.mc = mc
-	api.hc = handlers.NewCoffee(mc, l)
-	api.hu = handlers.NewUser(mc, l)
-	api.ho = handlers.NewOrder(mc, l)
+	api.hc = handlers.NewCoffee(mc, l, currency.Converter{Base: "USD"})
+	api.hu = handlers.NewUser(mc, l, nil, nil)
+	api.ho = handlers.NewOrder(mc, l, pickup.Policy{}, currency.Converter{Base: "USD"})
 	api.hi = handlers.NewIngredients(mc, l)
 }
 
@@ -15,7 +15,6 @@ require (
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/lib/pq v1.2.0
 	github.com/mattn/go-sqlite3 v1.11.0 // indirect
-	github.com/nicholasjackson/env v0.5.0
 	github.com/rs/cors v1.8.2
 	github.com/stretchr/testify v1.7.0
 	go.opentelemetry.io/otel v0.2.0
@@ -24,6 +23,11 @@ require (
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
 
+require (
+	github.com/hashicorp/hcl v1.0.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
+)
+
 require (
 	github.com/DataDog/sketches-go v0.0.0-20190923095040-43f19ad77ff7 // indirect
 	github.com/beorn7/perks v1.0.0 // indirect
@@ -49,5 +53,4 @@ require (
 	github.com/uber/jaeger-lib v2.4.0+incompatible // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	google.golang.org/grpc v1.24.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
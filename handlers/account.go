@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxPreferencesSize is the largest preferences object a user can store
+const maxPreferencesSize = 4096
+
+// maxListUsers is the largest page of users returned to admins
+const maxListUsers = 100
+
+// Account is a HTTP Handler for reading and changing user accounts
+type Account struct {
+	con data.Connection
+	log hclog.Logger
+}
+
+// ProfileUpdate is the body of a request to change a profile, fields which
+// are not set are not changed and preferences are merged with the existing
+// preferences, a preference set to null is removed
+type ProfileUpdate struct {
+	DisplayName *string           `json:"display_name"`
+	Email       *string           `json:"email"`
+	Preferences model.Preferences `json:"preferences"`
+}
+
+// NewAccount creates an Account handler
+func NewAccount(con data.Connection, l hclog.Logger) *Account {
+	return &Account{con, l}
+}
+
+// GetProfile returns the profile of the signed in user
+func (c *Account) GetProfile(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | get profile")
+
+	u, err := c.con.GetUser(userID)
+	if err != nil {
+		c.log.Error("Unable to get user", "error", err)
+		http.Error(rw, "Unable to get user", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := u.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert user to JSON", "error", err)
+		http.Error(rw, "Unable to get user", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// UpdateProfile changes the display name, email or preferences of the signed in user
+func (c *Account) UpdateProfile(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | update profile")
+
+	body := ProfileUpdate{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := c.con.GetUser(userID)
+	if err != nil {
+		c.log.Error("Unable to get user", "error", err)
+		http.Error(rw, "Unable to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if body.DisplayName != nil {
+		if len(*body.DisplayName) > 255 {
+			http.Error(rw, "Display name must be at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		u.DisplayName = *body.DisplayName
+	}
+
+	if body.Email != nil {
+		if *body.Email != "" {
+			a, err := mail.ParseAddress(*body.Email)
+			if err != nil || a.Address != *body.Email {
+				http.Error(rw, "Invalid email address", http.StatusBadRequest)
+				return
+			}
+		}
+
+		u.Email = *body.Email
+	}
+
+	if body.Preferences != nil {
+		u.Preferences = u.Preferences.Merge(body.Preferences)
+
+		if d, _ := json.Marshal(u.Preferences); len(d) > maxPreferencesSize {
+			http.Error(rw, fmt.Sprintf("Preferences must be at most %d bytes", maxPreferencesSize), http.StatusBadRequest)
+			return
+		}
+	}
+
+	u, err = c.con.UpdateUser(u)
+	if err != nil {
+		c.log.Error("Unable to update user", "error", err)
+
+		if errors.Is(err, data.ErrEmailInUse) {
+			http.Error(rw, "Email already in use", http.StatusConflict)
+			return
+		}
+
+		http.Error(rw, "Unable to update user", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := u.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert user to JSON", "error", err)
+		http.Error(rw, "Unable to update user", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DeleteAccount deletes the signed in user and revokes all of their tokens
+func (c *Account) DeleteAccount(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | delete")
+
+	if err := c.con.DeleteUser(userID); err != nil {
+		c.log.Error("Unable to delete user", "error", err)
+		http.Error(rw, "Unable to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  model.AuditUserDeleted,
+		Subject: strconv.Itoa(userID),
+		IP:      clientIP(r),
+	})
+
+	fmt.Fprintf(rw, "%s", "Deleted user")
+}
+
+// ListUsers returns users matching the q query parameter, it can only be
+// called by admins
+func (c *Account) ListUsers(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | list users")
+
+	q := r.URL.Query()
+
+	limit, err := queryInt(q.Get("limit"), 20)
+	if err != nil || limit < 1 || limit > maxListUsers {
+		http.Error(rw, fmt.Sprintf("limit must be between 1 and %d", maxListUsers), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(rw, "offset must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	us, err := c.con.ListUsers(q.Get("q"), limit, offset)
+	if err != nil {
+		c.log.Error("Unable to list users", "error", err)
+		http.Error(rw, "Unable to list users", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := us.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert users to JSON", "error", err)
+		http.Error(rw, "Unable to list users", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DisableUser prevents a user from signing in and revokes their tokens, it
+// can only be called by admins
+func (c *Account) DisableUser(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.setDisabled(userID, true, rw, r)
+}
+
+// EnableUser allows a disabled user to sign in again, it can only be called by admins
+func (c *Account) EnableUser(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.setDisabled(userID, false, rw, r)
+}
+
+func (c *Account) setDisabled(userID int, disabled bool, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | set disabled", "disabled", disabled)
+
+	vars := mux.Vars(r)
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		c.log.Error("User ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find user", http.StatusBadRequest)
+		return
+	}
+
+	if id == userID && disabled {
+		http.Error(rw, "Unable to disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.con.SetUserDisabled(id, disabled); err != nil {
+		c.log.Error("Unable to update user", "error", err)
+
+		if errors.Is(err, data.ErrUserNotFound) {
+			http.Error(rw, "Unable to find user", http.StatusNotFound)
+			return
+		}
+
+		http.Error(rw, "Unable to update user", http.StatusInternalServerError)
+		return
+	}
+
+	action := model.AuditUserEnabled
+	if disabled {
+		action = model.AuditUserDisabled
+	}
+
+	c.audit(model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  action,
+		Subject: strconv.Itoa(id),
+		IP:      clientIP(r),
+	})
+
+	fmt.Fprintf(rw, "%s", "Updated user")
+}
+
+// ListSessions returns the active tokens for the signed in user
+func (c *Account) ListSessions(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | list sessions")
+
+	ss, err := c.con.GetSessions(userID)
+	if err != nil {
+		c.log.Error("Unable to get sessions", "error", err)
+		http.Error(rw, "Unable to get sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current, _ := TokenID(r)
+	for i := range ss {
+		ss[i].Current = ss[i].ID == current
+	}
+
+	d, err := ss.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert sessions to JSON", "error", err)
+		http.Error(rw, "Unable to get sessions", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// RevokeSession revokes one of the signed in user's tokens
+func (c *Account) RevokeSession(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | revoke session")
+
+	vars := mux.Vars(r)
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		c.log.Error("Session ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find session", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.con.DeleteToken(id, userID); err != nil {
+		c.log.Error("Unable to revoke session", "error", err)
+
+		if errors.Is(err, data.ErrSessionNotFound) {
+			http.Error(rw, "Unable to find session", http.StatusNotFound)
+			return
+		}
+
+		http.Error(rw, "Unable to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(rw, "%s", "Revoked session")
+}
+
+// RevokeAllSessions signs the user out everywhere by revoking all of their
+// tokens, including the one used for the request
+func (c *Account) RevokeAllSessions(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Account | revoke all sessions")
+
+	if err := c.con.DeleteTokens(userID); err != nil {
+		c.log.Error("Unable to revoke sessions", "error", err)
+		http.Error(rw, "Unable to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(rw, "%s", "Revoked all sessions")
+}
+
+func (c *Account) audit(e model.AuditEvent) {
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
+
+// queryInt parses an integer query parameter, returning def when it is not set
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(s)
+}
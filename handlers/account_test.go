@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupAccountHandler(t *testing.T) (*Account, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("GetUser").Return(model.User{
+		ID:          1,
+		Username:    "User1",
+		DisplayName: "Nic",
+		Preferences: model.Preferences{"milk": "oat"},
+	}, nil)
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	return &Account{c, hclog.Default()}, c, httptest.NewRecorder()
+}
+
+func TestGetProfileReturnsUser(t *testing.T) {
+	a, _, rw := setupAccountHandler(t)
+
+	a.GetProfile(1, rw, httptest.NewRequest("GET", "/users/me", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	u := model.User{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &u))
+	assert.Equal(t, "Nic", u.DisplayName)
+	assert.NotContains(t, rw.Body.String(), "password")
+}
+
+func TestUpdateProfileChangesOnlyFieldsSet(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("UpdateUser", mock.Anything).Return(model.User{ID: 1}, nil)
+
+	r := httptest.NewRequest("PATCH", "/users/me", strings.NewReader(`{"email": "nic@example.com", "preferences": {"milk": null, "size": "large"}}`))
+	a.UpdateProfile(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "UpdateUser", mock.MatchedBy(func(u model.User) bool {
+		return u.DisplayName == "Nic" &&
+			u.Email == "nic@example.com" &&
+			len(u.Preferences) == 1 && u.Preferences["size"] == "large"
+	}))
+}
+
+func TestUpdateProfileRejectsInvalidEmail(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+
+	r := httptest.NewRequest("PATCH", "/users/me", strings.NewReader(`{"email": "Nic <nic@example.com>"}`))
+	a.UpdateProfile(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	c.AssertNotCalled(t, "UpdateUser", mock.Anything)
+}
+
+func TestUpdateProfileReturnsConflictForEmailInUse(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("UpdateUser", mock.Anything).Return(nil, data.ErrEmailInUse)
+
+	r := httptest.NewRequest("PATCH", "/users/me", strings.NewReader(`{"email": "taken@example.com"}`))
+	a.UpdateProfile(1, rw, r)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestDeleteAccountDeletesUser(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("DeleteUser", 1).Return(nil)
+
+	a.DeleteAccount(1, rw, httptest.NewRequest("DELETE", "/users/me", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditUserDeleted && e.Subject == "1"
+	}))
+}
+
+func TestListUsersPassesSearch(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("ListUsers", "nic", 10, 20).Return(model.Users{{ID: 1, Username: "nic"}}, nil)
+
+	a.ListUsers(3, rw, httptest.NewRequest("GET", "/admin/users?q=nic&limit=10&offset=20", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	us := model.Users{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &us))
+	assert.Len(t, us, 1)
+}
+
+func TestListUsersValidatesLimit(t *testing.T) {
+	a, _, rw := setupAccountHandler(t)
+
+	a.ListUsers(3, rw, httptest.NewRequest("GET", "/admin/users?limit=1000", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestDisableUser(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("SetUserDisabled", 2, true).Return(nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/users/2/disable", nil), map[string]string{"id": "2"})
+	a.DisableUser(3, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditUserDisabled && e.Subject == "2" && e.ActorID.Int64 == 3
+	}))
+}
+
+func TestUnableToDisableOwnAccount(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/users/3/disable", nil), map[string]string{"id": "3"})
+	a.DisableUser(3, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	c.AssertNotCalled(t, "SetUserDisabled", mock.Anything, mock.Anything)
+}
+
+func TestUnableToEnableUser(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("SetUserDisabled", 2, false).Return(errors.New("connection refused"))
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/users/2/enable", nil), map[string]string{"id": "2"})
+	a.EnableUser(3, rw, r)
+
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+}
+
+func TestDisableUnknownUserReturnsNotFound(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("SetUserDisabled", 2, true).Return(data.ErrUserNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/users/2/disable", nil), map[string]string{"id": "2"})
+	a.DisableUser(3, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	c.AssertNotCalled(t, "CreateAuditEvent", mock.Anything)
+}
+
+func TestListSessionsMarksCurrentSession(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("GetSessions", 1).Return(model.Sessions{{ID: 2}, {ID: 5}}, nil)
+
+	r := httptest.NewRequest("GET", "/users/me/sessions", nil)
+	r = r.WithContext(context.WithValue(r.Context(), tokenIDKey, 5))
+	a.ListSessions(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	ss := model.Sessions{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &ss))
+	assert.False(t, ss[0].Current)
+	assert.True(t, ss[1].Current)
+}
+
+func TestRevokeSessionDeletesToken(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("DeleteToken").Return(nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/users/me/sessions/2", nil), map[string]string{"id": "2"})
+	a.RevokeSession(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "DeleteToken")
+}
+
+func TestRevokeUnknownSessionReturnsNotFound(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("DeleteToken").Return(data.ErrSessionNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/users/me/sessions/2", nil), map[string]string{"id": "2"})
+	a.RevokeSession(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestRevokeAllSessionsDeletesTokens(t *testing.T) {
+	a, c, rw := setupAccountHandler(t)
+	c.On("DeleteTokens", 1).Return(nil)
+
+	a.RevokeAllSessions(1, rw, httptest.NewRequest("DELETE", "/users/me/sessions", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "DeleteTokens", 1)
+}
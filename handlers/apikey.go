@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// apiKeyPrefix starts every API key so they can be recognised, for example by
+// secret scanners
+const apiKeyPrefix = "pak_"
+
+// APIKey is a HTTP Handler for issuing and revoking API keys
+type APIKey struct {
+	con data.Connection
+	log hclog.Logger
+}
+
+// IssueAPIKeyRequest is the body of a request to issue an API key
+type IssueAPIKeyRequest struct {
+	Name   string       `json:"name"`
+	UserID int          `json:"user_id"`
+	Scopes model.Scopes `json:"scopes"`
+	// ExpiresAt is optional, keys without it do not expire
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// NewAPIKey creates an APIKey handler
+func NewAPIKey(con data.Connection, l hclog.Logger) *APIKey {
+	return &APIKey{con, l}
+}
+
+// newAPIKey returns a random API key
+func newAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueAPIKey creates an API key for a user, the key is only returned in
+// this response. It can only be called by admins.
+func (c *APIKey) IssueAPIKey(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle APIKey | issue")
+
+	body := IssueAPIKeyRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Name == "" || body.UserID == 0 {
+		http.Error(rw, "Name and user_id are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := body.Scopes.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	k := model.APIKey{Name: body.Name, UserID: body.UserID, Scopes: body.Scopes}
+
+	if body.ExpiresAt != nil {
+		if !body.ExpiresAt.After(time.Now()) {
+			http.Error(rw, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		e := body.ExpiresAt.UTC().Format(time.RFC3339)
+		k.ExpiresAt = &e
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		c.log.Error("Unable to generate API key", "error", err)
+		http.Error(rw, "Unable to issue API key", http.StatusInternalServerError)
+		return
+	}
+	k.Prefix = key[:len(apiKeyPrefix)+8]
+
+	k, err = c.con.CreateAPIKey(k, hashAPIKey(key))
+	if err != nil {
+		c.log.Error("Unable to create API key", "error", err)
+		http.Error(rw, "Unable to issue API key", http.StatusInternalServerError)
+		return
+	}
+	k.Key = key
+
+	c.audit(userID, model.AuditAPIKeyIssued, k.ID, r)
+
+	d, err := k.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert API key to JSON", "error", err)
+		http.Error(rw, "Unable to issue API key", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(d)
+}
+
+// ListAPIKeys returns every API key without the keys themselves, it can
+// only be called by admins
+func (c *APIKey) ListAPIKeys(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle APIKey | list")
+
+	ks, err := c.con.ListAPIKeys()
+	if err != nil {
+		c.log.Error("Unable to list API keys", "error", err)
+		http.Error(rw, "Unable to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ks.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert API keys to JSON", "error", err)
+		http.Error(rw, "Unable to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// RevokeAPIKey revokes an API key, it can only be called by admins
+func (c *APIKey) RevokeAPIKey(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle APIKey | revoke")
+
+	vars := mux.Vars(r)
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		c.log.Error("API key ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find API key", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.con.RevokeAPIKey(id); err != nil {
+		c.log.Error("Unable to revoke API key", "error", err)
+		http.Error(rw, "Unable to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, model.AuditAPIKeyRevoked, id, r)
+
+	fmt.Fprintf(rw, "%s", "Revoked API key")
+}
+
+func (c *APIKey) audit(userID int, action string, keyID int, r *http.Request) {
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  action,
+		Subject: strconv.Itoa(keyID),
+		IP:      clientIP(r),
+	}
+
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
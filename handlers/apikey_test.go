@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupAPIKeyHandler(t *testing.T) (*APIKey, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	return &APIKey{c, hclog.Default()}, c, httptest.NewRecorder()
+}
+
+func TestIssueAPIKeyReturnsKeyAndStoresHash(t *testing.T) {
+	h, c, rw := setupAPIKeyHandler(t)
+	c.On("CreateAPIKey", mock.Anything, mock.Anything).Return(model.APIKey{ID: 3, Name: "kiosk"}, nil)
+
+	r := httptest.NewRequest("POST", "/admin/api-keys", strings.NewReader(`{"name": "kiosk", "user_id": 2, "scopes": ["orders:write"]}`))
+	h.IssueAPIKey(1, rw, r)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	k := model.APIKey{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &k))
+	assert.True(t, strings.HasPrefix(k.Key, apiKeyPrefix))
+
+	c.AssertCalled(t, "CreateAPIKey", mock.MatchedBy(func(a model.APIKey) bool {
+		return a.UserID == 2 && a.Scopes.Has(model.ScopeOrdersWrite) && strings.HasPrefix(k.Key, a.Prefix)
+	}), hashAPIKey(k.Key))
+	c.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditAPIKeyIssued && e.Subject == "3"
+	}))
+}
+
+func TestIssueAPIKeyRejectsUnknownScopes(t *testing.T) {
+	h, c, rw := setupAPIKeyHandler(t)
+
+	r := httptest.NewRequest("POST", "/admin/api-keys", strings.NewReader(`{"name": "kiosk", "user_id": 2, "scopes": ["orders:admin"]}`))
+	h.IssueAPIKey(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	c.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+}
+
+func TestIssueAPIKeyRejectsExpiryInThePast(t *testing.T) {
+	h, c, rw := setupAPIKeyHandler(t)
+
+	r := httptest.NewRequest("POST", "/admin/api-keys", strings.NewReader(`{"name": "kiosk", "user_id": 2, "scopes": ["orders:read"], "expires_at": "2001-01-01T00:00:00Z"}`))
+	h.IssueAPIKey(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	c.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+}
+
+func TestRevokeAPIKeyRevokesKey(t *testing.T) {
+	h, c, rw := setupAPIKeyHandler(t)
+	c.On("RevokeAPIKey", 3).Return(nil)
+
+	r := httptest.NewRequest("DELETE", "/admin/api-keys/3", nil)
+	r = mux.SetURLVars(r, map[string]string{"id": "3"})
+	h.RevokeAPIKey(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "RevokeAPIKey", 3)
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
 	"github.com/hashicorp/go-hclog"
 )
 
@@ -19,45 +25,139 @@ func NewAuthMiddleware(con data.Connection, l hclog.Logger) *AuthMiddleware {
 	return &AuthMiddleware{con, l}
 }
 
+// errInvalidToken is returned when a JWT is not a token issued by SignIn
+var errInvalidToken = errors.New("Invalid token")
+
 // ExtractJWT retrieves the token and user ID from the JWT
 func ExtractJWT(authToken string) (int, int, error) {
 	token, err := jwt.Parse(authToken, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, nil
+			return nil, errInvalidToken
 		}
-		return []byte(jwtSecret), nil
+		return jwtSecret, nil
 	})
 
 	if err != nil {
 		return -1, -1, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		tokenID := int(claims["token_id"].(float64))
-		userID := int(claims["user_id"].(float64))
-		return tokenID, userID, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return -1, -1, errInvalidToken
+	}
+
+	// other JWTs signed with the secret do not have these claims
+	tokenID, ok := claims["token_id"].(float64)
+	if !ok {
+		return -1, -1, errInvalidToken
 	}
-	return -1, -1, nil
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return -1, -1, errInvalidToken
+	}
+
+	return int(tokenID), int(userID), nil
 }
 
 func (c *AuthMiddleware) VerifyJWT(authToken string) (int, error) {
+	_, userID, err := c.verifyJWT(authToken)
+	return userID, err
+}
+
+// verifyJWT returns the token ID and user ID for a token which has not been revoked
+func (c *AuthMiddleware) verifyJWT(authToken string) (int, int, error) {
 	tokenID, userID, err := ExtractJWT(authToken)
 	if err != nil {
-		return userID, err
+		return tokenID, userID, err
 	}
 	if _, err := c.con.GetToken(tokenID, userID); err != nil {
-		return userID, err
+		return tokenID, userID, err
+	}
+	return tokenID, userID, nil
+}
+
+type contextKey string
+
+const tokenIDKey = contextKey("token_id")
+const apiKeyIDKey = contextKey("api_key_id")
+
+// TokenID returns the ID of the token used to authorize the request
+func TokenID(r *http.Request) (int, bool) {
+	id, ok := r.Context().Value(tokenIDKey).(int)
+	return id, ok
+}
+
+// APIKeyID returns the ID of the API key used to authorize the request
+func APIKeyID(r *http.Request) (int, bool) {
+	id, ok := r.Context().Value(apiKeyIDKey).(int)
+	return id, ok
+}
+
+// apiKeyFromRequest returns the API key sent in the X-API-Key header or as
+// Authorization: ApiKey <key>
+func apiKeyFromRequest(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
 	}
-	return userID, nil
+
+	a := r.Header.Get("Authorization")
+	if len(a) > 7 && strings.EqualFold(a[:7], "ApiKey ") {
+		return strings.TrimSpace(a[7:])
+	}
+
+	return ""
+}
+
+// hashAPIKey returns the hash stored for an API key
+func hashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// RequireScope allows requests from signed in users, and from API keys which
+// have been granted scope. Requests made with an API key act as the user who
+// owns the key.
+func (c *AuthMiddleware) RequireScope(scope string, next func(userID int, w http.ResponseWriter, r *http.Request)) http.Handler {
+	jwt := c.IsAuthorized(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := apiKeyFromRequest(r)
+		if key == "" {
+			jwt.ServeHTTP(w, r)
+			return
+		}
+
+		k, err := c.con.GetAPIKey(hashAPIKey(key))
+		if err == data.ErrInvalidAPIKey {
+			c.log.Error("Unauthorized", "error", err)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		if err != nil {
+			c.log.Error("Unable to get API key", "error", err)
+			http.Error(w, "Unable to check API key", http.StatusInternalServerError)
+			return
+		}
+
+		if !k.Scopes.Has(scope) {
+			c.log.Error("Forbidden", "api_key_id", k.ID, "scope", scope)
+			http.Error(w, "API key does not have the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+
+		next(k.UserID, w, r.WithContext(context.WithValue(r.Context(), apiKeyIDKey, k.ID)))
+	})
 }
 
 // IsAuthorized
 func (c *AuthMiddleware) IsAuthorized(next func(userID int, w http.ResponseWriter, r *http.Request)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authToken := r.Header.Get("Authorization")
-		userID, err := c.VerifyJWT(authToken)
+		tokenID, userID, err := c.verifyJWT(authToken)
 		if err == nil {
-			next(userID, w, r)
+			next(userID, w, r.WithContext(context.WithValue(r.Context(), tokenIDKey, tokenID)))
 			return
 		}
 		c.log.Error("Unauthorized", "error", err)
@@ -65,3 +165,36 @@ func (c *AuthMiddleware) IsAuthorized(next func(userID int, w http.ResponseWrite
 		return
 	})
 }
+
+// IsAdmin only allows requests from authorized users with the admin role
+func (c *AuthMiddleware) IsAdmin(next func(userID int, w http.ResponseWriter, r *http.Request)) http.Handler {
+	return c.hasRole(next, model.RoleAdmin)
+}
+
+// IsStaff only allows requests from authorized users with the staff or admin
+// role
+func (c *AuthMiddleware) IsStaff(next func(userID int, w http.ResponseWriter, r *http.Request)) http.Handler {
+	return c.hasRole(next, model.RoleStaff, model.RoleAdmin)
+}
+
+// hasRole only allows requests from authorized users with one of the roles
+func (c *AuthMiddleware) hasRole(next func(userID int, w http.ResponseWriter, r *http.Request), roles ...string) http.Handler {
+	return c.IsAuthorized(func(userID int, w http.ResponseWriter, r *http.Request) {
+		u, err := c.con.GetUser(userID)
+		if err != nil {
+			c.log.Error("Unable to get user", "error", err)
+			http.Error(w, "Unable to get user", http.StatusInternalServerError)
+			return
+		}
+
+		for _, role := range roles {
+			if u.Role == role {
+				next(userID, w, r)
+				return
+			}
+		}
+
+		c.log.Error("Forbidden", "user_id", userID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupAuthMiddleware(t *testing.T, role string) (*AuthMiddleware, *http.Request) {
+	c := &data.MockConnection{}
+	c.On("GetToken").Return(model.Token{ID: 2, UserID: 1}, nil)
+	c.On("GetUser").Return(model.User{ID: 1, Username: "User1", Role: role}, nil)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"token_id": 2,
+		"user_id":  1,
+	}).SignedString(jwtSecret)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/admin/unlock", nil)
+	r.Header.Set("Authorization", token)
+
+	return &AuthMiddleware{c, hclog.Default()}, r
+}
+
+func TestIsAdminAllowsAdmins(t *testing.T) {
+	a, r := setupAuthMiddleware(t, model.RoleAdmin)
+
+	rw := httptest.NewRecorder()
+	a.IsAdmin(func(userID int, rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(rw, "%d", userID)
+	}).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "1", rw.Body.String())
+}
+
+func TestIsAdminRejectsUsers(t *testing.T) {
+	a, r := setupAuthMiddleware(t, model.RoleUser)
+
+	rw := httptest.NewRecorder()
+	a.IsAdmin(okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func TestIsStaffAllowsStaffAndAdmins(t *testing.T) {
+	for _, role := range []string{model.RoleStaff, model.RoleAdmin} {
+		a, r := setupAuthMiddleware(t, role)
+
+		rw := httptest.NewRecorder()
+		a.IsStaff(okUserHandler).ServeHTTP(rw, r)
+
+		assert.Equal(t, http.StatusOK, rw.Code, role)
+	}
+}
+
+func TestIsStaffRejectsUsers(t *testing.T) {
+	a, r := setupAuthMiddleware(t, model.RoleUser)
+
+	rw := httptest.NewRecorder()
+	a.IsStaff(okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func TestIsAuthorizedAddsTokenIDToRequest(t *testing.T) {
+	a, r := setupAuthMiddleware(t, model.RoleUser)
+
+	rw := httptest.NewRecorder()
+	a.IsAuthorized(func(userID int, rw http.ResponseWriter, r *http.Request) {
+		id, ok := TokenID(r)
+		assert.True(t, ok)
+		fmt.Fprintf(rw, "%d", id)
+	}).ServeHTTP(rw, r)
+
+	assert.Equal(t, "2", rw.Body.String())
+}
+
+func TestIsAuthorizedRejectsTokensWithoutClaims(t *testing.T) {
+	a, r := setupAuthMiddleware(t, model.RoleUser)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"state": "abc"}).SignedString(jwtSecret)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", token)
+
+	rw := httptest.NewRecorder()
+	a.IsAuthorized(okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestRequireScopeAllowsAPIKeyWithScope(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("GetAPIKey", hashAPIKey("pak_test")).Return(model.APIKey{ID: 3, UserID: 7, Scopes: model.Scopes{model.ScopeOrdersRead}}, nil)
+	a := &AuthMiddleware{c, hclog.Default()}
+
+	for _, h := range []string{"X-API-Key", "Authorization"} {
+		r := httptest.NewRequest("GET", "/orders", nil)
+		if h == "Authorization" {
+			r.Header.Set(h, "ApiKey pak_test")
+		} else {
+			r.Header.Set(h, "pak_test")
+		}
+
+		rw := httptest.NewRecorder()
+		a.RequireScope(model.ScopeOrdersRead, func(userID int, rw http.ResponseWriter, r *http.Request) {
+			id, ok := APIKeyID(r)
+			assert.True(t, ok)
+			fmt.Fprintf(rw, "%d:%d", userID, id)
+		}).ServeHTTP(rw, r)
+
+		assert.Equal(t, http.StatusOK, rw.Code, h)
+		assert.Equal(t, "7:3", rw.Body.String(), h)
+	}
+}
+
+func TestRequireScopeRejectsAPIKeyWithoutScope(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("GetAPIKey", mock.Anything).Return(model.APIKey{ID: 3, UserID: 7, Scopes: model.Scopes{model.ScopeOrdersRead}}, nil)
+	a := &AuthMiddleware{c, hclog.Default()}
+
+	r := httptest.NewRequest("POST", "/orders", nil)
+	r.Header.Set("X-API-Key", "pak_test")
+
+	rw := httptest.NewRecorder()
+	a.RequireScope(model.ScopeOrdersWrite, okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func TestRequireScopeRejectsInvalidAPIKey(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("GetAPIKey", mock.Anything).Return(nil, data.ErrInvalidAPIKey)
+	a := &AuthMiddleware{c, hclog.Default()}
+
+	r := httptest.NewRequest("GET", "/orders", nil)
+	r.Header.Set("X-API-Key", "pak_revoked")
+
+	rw := httptest.NewRecorder()
+	a.RequireScope(model.ScopeOrdersRead, okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestRequireScopeAcceptsJWT(t *testing.T) {
+	a, r := setupAuthMiddleware(t, model.RoleUser)
+
+	rw := httptest.NewRecorder()
+	a.RequireScope(model.ScopeOrdersWrite, okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Cart -
+type Cart struct {
+	con    data.Connection
+	log    hclog.Logger
+	pickup pickup.Policy
+	rates  currency.Converter
+}
+
+// NewCart -
+func NewCart(con data.Connection, l hclog.Logger, p pickup.Policy, rates currency.Converter) *Cart {
+	return &Cart{con, l, p, rates}
+}
+
+// CartChangedResponse is returned when a cart can not be checked out because
+// items changed since they were added
+type CartChangedResponse struct {
+	Message string            `json:"message"`
+	Changes model.CartChanges `json:"changes"`
+}
+
+// CheckoutRequest is the optional body of a request to check out a cart
+type CheckoutRequest struct {
+	PromotionCodes []string   `json:"promotion_codes"`
+	PickupAt       *time.Time `json:"pickup_at"`
+	StoreID        *int       `json:"store_id"`
+}
+
+// GetCart returns the cart of the signed in user
+func (c *Cart) GetCart(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Cart | GetCart")
+
+	cart, err := c.con.GetCart(userID)
+	if err != nil {
+		c.log.Error("Unable to get cart from database", "error", err)
+		http.Error(rw, "Unable to get cart", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := cart.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert cart to JSON", "error", err)
+		http.Error(rw, "Unable to get cart", http.StatusInternalServerError)
+		return
+	}
+
+	writeWithETag(rw, r, versionETag(cart.Version), d)
+}
+
+// AddItem adds a coffee to the cart, if the cart already contains the coffee
+// the quantities are combined
+func (c *Cart) AddItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Cart | AddItem")
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	body := model.CartItem{}
+
+	err := body.FromJSON(r.Body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Coffee.ID == 0 || body.Quantity < 1 {
+		http.Error(rw, "Item must have a coffee and a quantity of at least 1", http.StatusBadRequest)
+		return
+	}
+
+	cart, err := c.con.AddCartItem(userID, body.Coffee.ID, body.Quantity, version)
+	if err != nil {
+		c.log.Error("Unable to add cart item", "error", err)
+		c.writeError(rw, err, "Unable to add item")
+		return
+	}
+
+	c.writeCart(rw, cart, "Unable to add item")
+}
+
+// UpdateItem changes the quantity of an item in the cart
+func (c *Cart) UpdateItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Cart | UpdateItem")
+
+	itemID, err := strconv.Atoi(mux.Vars(r)["item_id"])
+	if err != nil {
+		c.log.Error("itemID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to update item", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	body := OrderItemUpdate{}
+
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Quantity < 1 {
+		http.Error(rw, "Quantity must be at least 1, delete the item to remove it", http.StatusBadRequest)
+		return
+	}
+
+	cart, err := c.con.UpdateCartItem(userID, itemID, body.Quantity, version)
+	if err != nil {
+		c.log.Error("Unable to update cart item", "error", err)
+		c.writeError(rw, err, "Unable to update item")
+		return
+	}
+
+	c.writeCart(rw, cart, "Unable to update item")
+}
+
+// DeleteItem removes an item from the cart
+func (c *Cart) DeleteItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Cart | DeleteItem")
+
+	itemID, err := strconv.Atoi(mux.Vars(r)["item_id"])
+	if err != nil {
+		c.log.Error("itemID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to delete item", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	cart, err := c.con.DeleteCartItem(userID, itemID, version)
+	if err != nil {
+		c.log.Error("Unable to delete cart item", "error", err)
+		c.writeError(rw, err, "Unable to delete item")
+		return
+	}
+
+	c.writeCart(rw, cart, "Unable to delete item")
+}
+
+// Checkout places an order for the items in the cart and empties it, applying
+// any promotion codes, the store and the pickup time in the body. When items
+// changed since they were added, or are priced differently at the store, the
+// cart is updated to match and 409 Conflict is returned with the changes,
+// checking out again places the order. Cart prices are in the base currency,
+// the order is shown in the currency of the request.
+func (c *Cart) Checkout(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Cart | Checkout")
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	body := CheckoutRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && err != io.EOF {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	slot, err := pickupSlot(c.con, c.pickup, body.StoreID, body.PickupAt)
+	if err != nil {
+		c.writeError(rw, err, "Unable to check out")
+		return
+	}
+
+	p, err := newPricing(c.con, c.rates, rw, r)
+	if err != nil {
+		c.log.Error("Unable to get prices", "error", err)
+		c.writeError(rw, err, "Unable to check out")
+		return
+	}
+
+	order, changes, err := c.con.CheckoutCart(userID, version, body.PromotionCodes, slot, body.StoreID)
+	if err == data.ErrCartChanged {
+		d, err := json.Marshal(CartChangedResponse{"Cart has changed, review the changes and check out again", changes})
+		if err != nil {
+			c.log.Error("Unable to convert cart changes to JSON", "error", err)
+			http.Error(rw, "Unable to check out", http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusConflict)
+		rw.Write(d)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to check out cart", "error", err)
+		c.writeError(rw, err, "Unable to check out")
+		return
+	}
+
+	err = p.order(&order)
+	if err != nil {
+		c.log.Error("Unable to price order", "error", err)
+		c.writeError(rw, err, "Unable to check out")
+		return
+	}
+
+	d, err := order.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert order to JSON", "error", err)
+		http.Error(rw, "Unable to check out", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// writeCart writes a changed cart with its new ETag
+func (c *Cart) writeCart(rw http.ResponseWriter, cart model.Cart, message string) {
+	d, err := cart.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert cart to JSON", "error", err)
+		http.Error(rw, message, http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("ETag", versionETag(cart.Version))
+	rw.Write(d)
+}
+
+// writeError writes the response for an error changing a cart
+func (c *Cart) writeError(rw http.ResponseWriter, err error, message string) {
+	if writePromotionError(rw, err) || writePickupError(rw, err) || writeCurrencyError(rw, err) {
+		return
+	}
+
+	switch err {
+	case data.ErrCartItemNotFound:
+		http.Error(rw, "Cart item not found", http.StatusNotFound)
+	case data.ErrCartEmpty:
+		http.Error(rw, "Cart is empty", http.StatusBadRequest)
+	case data.ErrCoffeeNotFound:
+		http.Error(rw, "Coffee not found", http.StatusBadRequest)
+	case data.ErrStoreNotFound:
+		http.Error(rw, "Store not found", http.StatusBadRequest)
+	case data.ErrVersionMismatch:
+		http.Error(rw, "Cart has been changed, get the latest version and try again", http.StatusPreconditionFailed)
+	default:
+		http.Error(rw, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupCartHandler(t *testing.T) (*Cart, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+
+	return NewCart(c, hclog.Default(), pickup.Policy{}, testRates), c, httptest.NewRecorder()
+}
+
+func TestGetCartReturnsCartWithETag(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("GetCart", 1).Return(model.Cart{Version: 4, Items: []model.CartItem{{ID: 2, Quantity: 1, Price: 200, Available: true}}}, nil)
+
+	c.GetCart(1, rw, httptest.NewRequest("GET", "/cart", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"4"`, rw.Header().Get("ETag"))
+
+	cart := model.Cart{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &cart))
+	assert.Len(t, cart.Items, 1)
+}
+
+func TestAddCartItemAddsCoffee(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("AddCartItem", 1, 3, 2, mock.Anything).Return(model.Cart{Version: 2}, nil)
+
+	r := httptest.NewRequest("POST", "/cart/items", strings.NewReader(`{"coffee":{"id":3},"quantity":2}`))
+	c.AddItem(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"2"`, rw.Header().Get("ETag"))
+}
+
+func TestAddCartItemRejectsUnknownCoffee(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("AddCartItem", 1, 99, 1, mock.Anything).Return(nil, data.ErrCoffeeNotFound)
+
+	r := httptest.NewRequest("POST", "/cart/items", strings.NewReader(`{"coffee":{"id":99},"quantity":1}`))
+	c.AddItem(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestUpdateCartItemRejectsInvalidQuantity(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("PATCH", "/cart/items/2", strings.NewReader(`{"quantity":0}`)), map[string]string{"item_id": "2"})
+	c.UpdateItem(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "UpdateCartItem", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeleteCartItemReturnsPreconditionFailedForOldVersion(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("DeleteCartItem", 1, 2, mock.Anything).Return(nil, data.ErrVersionMismatch)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/cart/items/2", nil), map[string]string{"item_id": "2"})
+	r.Header.Set("If-Match", `"1"`)
+	c.DeleteItem(1, rw, r)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+}
+
+func TestCheckoutReturnsOrder(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("CheckoutCart", 1, (*int)(nil), mock.Anything, (*model.PickupSlot)(nil), (*int)(nil)).Return(model.Order{ID: 5, Version: 1}, nil, nil)
+
+	c.Checkout(1, rw, httptest.NewRequest("POST", "/cart/checkout", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	o := model.Order{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &o))
+	assert.Equal(t, 5, o.ID)
+}
+
+func TestCheckoutReturnsConflictWithChanges(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	changes := model.CartChanges{{ItemID: 2, CoffeeID: 1, Reason: model.CartChangePrice, Price: 200, CurrentPrice: 250}}
+	con.On("CheckoutCart", 1, (*int)(nil), mock.Anything, (*model.PickupSlot)(nil), (*int)(nil)).Return(nil, changes, data.ErrCartChanged)
+
+	c.Checkout(1, rw, httptest.NewRequest("POST", "/cart/checkout", nil))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	resp := CartChangedResponse{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+	assert.Equal(t, changes, resp.Changes)
+}
+
+func TestCheckoutRejectsEmptyCart(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("CheckoutCart", 1, (*int)(nil), mock.Anything, (*model.PickupSlot)(nil), (*int)(nil)).Return(nil, nil, data.ErrCartEmpty)
+
+	c.Checkout(1, rw, httptest.NewRequest("POST", "/cart/checkout", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestCheckoutPassesPromotionCodes(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	con.On("CheckoutCart", 1, (*int)(nil), []string{"TEN"}, (*model.PickupSlot)(nil), (*int)(nil)).Return(model.Order{ID: 5}, nil, nil)
+
+	c.Checkout(1, rw, httptest.NewRequest("POST", "/cart/checkout", strings.NewReader(`{"promotion_codes":["TEN"]}`)))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestCheckoutPassesPickupSlot(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	c.pickup = pickup.Policy{Slot: 15 * time.Minute, Capacity: 5}
+	at := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	con.On("CheckoutCart", 1, (*int)(nil), mock.Anything, mock.Anything, (*int)(nil)).Return(model.Order{ID: 5}, nil, nil)
+
+	body := fmt.Sprintf(`{"pickup_at":%q}`, at.Format(time.RFC3339))
+	c.Checkout(1, rw, httptest.NewRequest("POST", "/cart/checkout", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "CheckoutCart", 1, (*int)(nil), mock.Anything, mock.MatchedBy(func(s *model.PickupSlot) bool {
+		return s != nil && s.At.Equal(at) && s.Capacity == 5 && s.End.Sub(s.Start) == 15*time.Minute
+	}), (*int)(nil))
+}
+
+func TestCheckoutRejectsPickupTooSoon(t *testing.T) {
+	c, con, rw := setupCartHandler(t)
+	c.pickup = pickup.Policy{MinNotice: time.Hour}
+
+	body := fmt.Sprintf(`{"pickup_at":%q}`, time.Now().Add(10*time.Minute).Format(time.RFC3339))
+	c.Checkout(1, rw, httptest.NewRequest("POST", "/cart/checkout", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	con.AssertNotCalled(t, "CheckoutCart", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
 	"github.com/hashicorp-demoapp/product-api-go/data"
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
 	"github.com/hashicorp/go-hclog"
@@ -14,13 +16,20 @@ import (
 
 // Coffee -
 type Coffee struct {
-	con data.Connection
-	log hclog.Logger
+	con   data.Connection
+	log   hclog.Logger
+	rates currency.Converter
 }
 
 // NewCoffee
-func NewCoffee(con data.Connection, l hclog.Logger) *Coffee {
-	return &Coffee{con, l}
+func NewCoffee(con data.Connection, l hclog.Logger, rates currency.Converter) *Coffee {
+	return &Coffee{con, l, rates}
+}
+
+// SetPriceRequest is the body of a request to set the price of a coffee in a
+// currency, in minor units of the currency
+type SetPriceRequest struct {
+	Price int `json:"price"`
 }
 
 func (c *Coffee) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -40,6 +49,13 @@ func (c *Coffee) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		coffeeID = &cId
 	}
 
+	p, err := newPricing(c.con, c.rates, rw, r)
+	if err != nil {
+		c.log.Error("Unable to get prices", "error", err)
+		c.writeError(rw, err, "Unable to list products")
+		return
+	}
+
 	cofs, err := c.con.GetCoffees(coffeeID)
 	if err != nil {
 		c.log.Error("Unable to get products from database", "error", err)
@@ -47,6 +63,13 @@ func (c *Coffee) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = p.coffees(cofs)
+	if err != nil {
+		c.log.Error("Unable to price products", "error", err)
+		c.writeError(rw, err, "Unable to list products")
+		return
+	}
+
 	d, err := cofs.ToJSON()
 	if err != nil {
 		c.log.Error("Unable to convert products to JSON", "error", err)
@@ -54,7 +77,7 @@ func (c *Coffee) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rw.Write(d)
+	writeWithETag(rw, r, bodyETag(d), d)
 }
 
 // CreateCoffee creates a new coffee
@@ -86,3 +109,150 @@ func (c *Coffee) CreateCoffee(_ int, rw http.ResponseWriter, r *http.Request) {
 
 	rw.Write(d)
 }
+
+// ListPrices returns the price list of a currency, coffees which are not on
+// it are converted from the base currency
+func (c *Coffee) ListPrices(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Coffee | ListPrices")
+
+	cur, err := c.rates.Supported(mux.Vars(r)["currency"])
+	if err != nil {
+		c.writeError(rw, err, "Unable to list prices")
+		return
+	}
+
+	ps, err := c.con.GetPriceList(cur)
+	if err != nil {
+		c.log.Error("Unable to get price list", "error", err)
+		http.Error(rw, "Unable to list prices", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ps.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert prices to JSON", "error", err)
+		http.Error(rw, "Unable to list prices", http.StatusInternalServerError)
+		return
+	}
+
+	writeWithETag(rw, r, bodyETag(d), d)
+}
+
+// SetPrice sets the price of a coffee in a currency other than the base
+// currency, replacing the converted price. It can only be called by admins.
+func (c *Coffee) SetPrice(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Coffee | SetPrice")
+
+	coffeeID, cur, ok := c.priceIDs(rw, r, "Unable to set price")
+	if !ok {
+		return
+	}
+
+	body := SetPriceRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Price < 0 {
+		http.Error(rw, "price must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	p, err := c.con.SetCoffeePrice(model.CoffeePrice{CoffeeID: coffeeID, Currency: cur, Price: body.Price})
+	if err != nil {
+		c.log.Error("Unable to set coffee price", "error", err)
+		c.writeError(rw, err, "Unable to set price")
+		return
+	}
+
+	c.audit(userID, coffeeID, cur, r)
+
+	d, err := p.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert price to JSON", "error", err)
+		http.Error(rw, "Unable to set price", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DeletePrice removes the price of a coffee in a currency, so it is converted
+// from the base currency. It can only be called by admins.
+func (c *Coffee) DeletePrice(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Coffee | DeletePrice")
+
+	coffeeID, cur, ok := c.priceIDs(rw, r, "Unable to delete price")
+	if !ok {
+		return
+	}
+
+	err := c.con.DeleteCoffeePrice(coffeeID, cur)
+	if err != nil {
+		c.log.Error("Unable to delete coffee price", "error", err)
+		http.Error(rw, "Unable to delete price", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, coffeeID, cur, r)
+
+	fmt.Fprintf(rw, "%s", "Deleted price")
+}
+
+// priceIDs returns the coffee and currency of a price from the path, prices
+// can not be set in the base currency as it is the price of the coffee
+func (c *Coffee) priceIDs(rw http.ResponseWriter, r *http.Request, message string) (int, string, bool) {
+	vars := mux.Vars(r)
+
+	coffeeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		c.log.Error("CoffeeID provided could not be converted to an integer", "error", err)
+		http.Error(rw, message, http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	cur, err := c.rates.Supported(vars["currency"])
+	if err != nil {
+		c.writeError(rw, err, message)
+		return 0, "", false
+	}
+
+	if cur == c.rates.Base {
+		http.Error(rw, "The price in the base currency is the price of the coffee", http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	return coffeeID, cur, true
+}
+
+// audit records a change to the price list of a currency
+func (c *Coffee) audit(userID int, coffeeID int, cur string, r *http.Request) {
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  model.AuditCoffeePriceChanged,
+		Subject: strconv.Itoa(coffeeID) + " " + cur,
+		IP:      clientIP(r),
+	}
+
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
+
+// writeError writes the response for an error pricing coffees
+func (c *Coffee) writeError(rw http.ResponseWriter, err error, message string) {
+	if writeCurrencyError(rw, err) {
+		return
+	}
+
+	switch err {
+	case data.ErrCoffeeNotFound:
+		http.Error(rw, "Coffee not found", http.StatusNotFound)
+	default:
+		http.Error(rw, message, http.StatusInternalServerError)
+	}
+}
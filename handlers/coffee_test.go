@@ -21,7 +21,7 @@ func setupCoffeeHandler() (*Coffee, *httptest.ResponseRecorder) {
 
 	l := hclog.Default()
 
-	return &Coffee{c, l}, httptest.NewRecorder()
+	return &Coffee{c, l, testRates}, httptest.NewRecorder()
 }
 
 func TestCoffeeReturnsProducts(t *testing.T) {
@@ -55,3 +55,20 @@ func TestCreateCoffee(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+func TestCoffeeReturnsNotModifiedForMatchingETag(t *testing.T) {
+	c, rw := setupCoffeeHandler()
+	c.ServeHTTP(rw, httptest.NewRequest("GET", "/coffees", nil))
+
+	etag := rw.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	r := httptest.NewRequest("GET", "/coffees", nil)
+	r.Header.Set("If-None-Match", "W/"+etag)
+
+	rw = httptest.NewRecorder()
+	c.ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusNotModified, rw.Code)
+	assert.Empty(t, rw.Body.String())
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp-demoapp/product-api-go/currency"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+)
+
+// pricing shows prices in the currency and language of a request, catalog
+// prices from the price list of the currency are used before converting the
+// price in the base currency with the exchange rate
+type pricing struct {
+	rates    currency.Converter
+	currency string
+	language string
+	prices   map[int]int
+}
+
+// newPricing returns the pricing for a request. The currency is set with the
+// currency query parameter or the Accept-Currency header, which can list
+// several currencies in order of preference, and is the base currency when
+// neither is set. The response varies by these headers so they are added to
+// Vary.
+func newPricing(con data.Connection, rates currency.Converter, rw http.ResponseWriter, r *http.Request) (pricing, error) {
+	rw.Header().Add("Vary", "Accept-Currency, Accept-Language")
+
+	p := pricing{
+		rates:    rates,
+		currency: rates.Base,
+		language: currency.Language(r.Header.Get("Accept-Language")),
+		prices:   map[int]int{},
+	}
+
+	if q := r.URL.Query().Get("currency"); q != "" {
+		c, err := rates.Supported(q)
+		if err != nil {
+			return p, err
+		}
+
+		p.currency = c
+	} else if h := r.Header.Get("Accept-Currency"); h != "" {
+		c, err := acceptCurrency(rates, h)
+		if err != nil {
+			return p, err
+		}
+
+		p.currency = c
+	}
+
+	if p.currency == rates.Base {
+		return p, nil
+	}
+
+	ps, err := con.GetPriceList(p.currency)
+	if err != nil {
+		return p, err
+	}
+
+	for _, cp := range ps {
+		p.prices[cp.CoffeeID] = cp.Price
+	}
+
+	return p, nil
+}
+
+// acceptCurrency returns the first supported currency in an Accept-Currency
+// header, returning currency.ErrUnsupported when none are
+func acceptCurrency(rates currency.Converter, header string) (string, error) {
+	for _, h := range strings.Split(header, ",") {
+		c, err := rates.Supported(strings.Split(h, ";")[0])
+		if err == nil {
+			return c, nil
+		}
+	}
+
+	return "", currency.ErrUnsupported
+}
+
+// price returns the price of a coffee from the price list, or base converted
+// with the exchange rate when the price list does not have it. The price list
+// only has catalog prices, so a base price which is not the catalog price,
+// e.g. a store's price or the price an order was placed at, is converted so
+// it matches the amount which is charged.
+func (p pricing) price(coffeeID int, base int, catalog int) (int, error) {
+	if v, ok := p.prices[coffeeID]; ok && base == catalog {
+		return v, nil
+	}
+
+	return p.rates.Convert(base, p.currency)
+}
+
+// money returns an amount in the currency of the request
+func (p pricing) money(amount int) model.Money {
+	return model.Money{
+		Amount:    amount,
+		Currency:  p.currency,
+		Formatted: currency.Format(amount, p.currency, p.language),
+	}
+}
+
+// coffee sets the price of a coffee in the base currency to the price in the
+// currency of the request
+func (p pricing) coffee(c *model.Coffee) error {
+	catalog := c.Price
+	if c.CatalogPrice != nil {
+		catalog = *c.CatalogPrice
+	}
+
+	v, err := p.price(c.ID, c.Price, catalog)
+	if err != nil {
+		return err
+	}
+
+	c.Price = v
+	c.Currency = p.currency
+	c.FormattedPrice = currency.Format(v, p.currency, p.language)
+
+	return nil
+}
+
+// coffees prices each coffee in the currency of the request
+func (p pricing) coffees(cs model.Coffees) error {
+	for i := range cs {
+		err := p.coffee(&cs[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// order prices the items and discounts of an order in the currency of the
+// request and sets its totals. Each item is priced before it is multiplied by
+// its quantity, so the totals add up to the prices shown.
+func (p pricing) order(o *model.Order) error {
+	subtotal := 0
+
+	for i := range o.Items {
+		it := &o.Items[i]
+
+		// items are priced at the store of the order, not the catalog
+		catalog := it.Coffee.Price
+		it.Coffee.CatalogPrice = &catalog
+		it.Coffee.Price = it.Price
+
+		err := p.coffee(&it.Coffee)
+		if err != nil {
+			return err
+		}
+
+		subtotal += it.Coffee.Price * it.Quantity
+	}
+
+	discount := 0
+
+	for i := range o.Discounts {
+		v, err := p.rates.Convert(o.Discounts[i].Amount, p.currency)
+		if err != nil {
+			return err
+		}
+
+		o.Discounts[i].Amount = v
+		discount += v
+	}
+
+	total := subtotal - discount
+	if total < 0 {
+		total = 0
+	}
+
+	o.Totals = &model.OrderTotals{
+		Subtotal: p.money(subtotal),
+		Discount: p.money(discount),
+		Total:    p.money(total),
+	}
+
+	return nil
+}
+
+// orders prices each order in the currency of the request
+func (p pricing) orders(os model.Orders) error {
+	for i := range os {
+		err := p.order(&os[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// etag returns the ETag of a version of a record priced for the request. The
+// same version is shown differently in each currency and language, so they
+// are part of the ETag and ifMatchVersion only reads the version.
+func (p pricing) etag(version int) string {
+	t := strconv.Itoa(version) + "-" + p.currency
+	if p.language != "" {
+		t += "-" + p.language
+	}
+
+	return `"` + t + `"`
+}
+
+// writeCurrencyError writes the response for a currency which prices can not
+// be shown in, returning false when err is not a currency error
+func writeCurrencyError(rw http.ResponseWriter, err error) bool {
+	if err != currency.ErrUnsupported {
+		return false
+	}
+
+	http.Error(rw, "Currency is not supported", http.StatusBadRequest)
+	return true
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testRates = currency.Converter{Base: "USD", Rates: currency.Rates{"EUR": big.NewRat(92, 100)}}
+
+func setupPricedCoffeeHandler(t *testing.T) (*Coffee, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("GetCoffees").Return(model.Coffees{{ID: 1, Name: "HCP Aeropress", Price: 200}, {ID: 2, Name: "Packer Spiced Latte", Price: 350}}, nil)
+	c.On("GetPriceList", "EUR").Return(model.CoffeePrices{{CoffeeID: 2, Currency: "EUR", Price: 300}}, nil)
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	return NewCoffee(c, hclog.Default(), testRates), c, httptest.NewRecorder()
+}
+
+func TestCoffeesArePricedInBaseCurrencyByDefault(t *testing.T) {
+	c, con, rw := setupPricedCoffeeHandler(t)
+
+	c.ServeHTTP(rw, httptest.NewRequest("GET", "/coffees", nil))
+
+	cofs := model.Coffees{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &cofs))
+
+	assert.Equal(t, 200, cofs[0].Price)
+	assert.Equal(t, "USD", cofs[0].Currency)
+	assert.Equal(t, "$2.00", cofs[0].FormattedPrice)
+	assert.Contains(t, rw.Header().Get("Vary"), "Accept-Currency")
+	con.AssertNotCalled(t, "GetPriceList", mock.Anything)
+}
+
+func TestCoffeesArePricedInRequestedCurrency(t *testing.T) {
+	c, _, rw := setupPricedCoffeeHandler(t)
+
+	r := httptest.NewRequest("GET", "/coffees?currency=eur", nil)
+	r.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	c.ServeHTTP(rw, r)
+
+	cofs := model.Coffees{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &cofs))
+
+	// converted with the exchange rate
+	assert.Equal(t, 184, cofs[0].Price)
+	assert.Equal(t, "EUR", cofs[0].Currency)
+	assert.Equal(t, "1,84\u00a0€", cofs[0].FormattedPrice)
+
+	// from the price list
+	assert.Equal(t, 300, cofs[1].Price)
+}
+
+func TestAcceptCurrencyUsesFirstSupportedCurrency(t *testing.T) {
+	c, _, rw := setupPricedCoffeeHandler(t)
+
+	r := httptest.NewRequest("GET", "/coffees", nil)
+	r.Header.Set("Accept-Currency", "JPY, EUR;q=0.8")
+	c.ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"currency":"EUR"`)
+}
+
+func TestUnsupportedCurrencyReturnsBadRequest(t *testing.T) {
+	c, con, rw := setupPricedCoffeeHandler(t)
+
+	c.ServeHTTP(rw, httptest.NewRequest("GET", "/coffees?currency=GBP", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "GetCoffees")
+}
+
+func TestSetPriceSetsPriceInCurrency(t *testing.T) {
+	c, con, rw := setupPricedCoffeeHandler(t)
+	con.On("SetCoffeePrice", model.CoffeePrice{CoffeeID: 1, Currency: "EUR", Price: 180}).Return(model.CoffeePrice{CoffeeID: 1, Currency: "EUR", Price: 180}, nil)
+
+	r := httptest.NewRequest("PUT", "/admin/coffees/1/prices/eur", strings.NewReader(`{"price":180}`))
+	r = mux.SetURLVars(r, map[string]string{"id": "1", "currency": "eur"})
+	c.SetPrice(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditCoffeePriceChanged && e.Subject == "1 EUR"
+	}))
+}
+
+func TestSetPriceRejectsBaseCurrency(t *testing.T) {
+	c, con, rw := setupPricedCoffeeHandler(t)
+
+	r := httptest.NewRequest("PUT", "/admin/coffees/1/prices/USD", strings.NewReader(`{"price":180}`))
+	r = mux.SetURLVars(r, map[string]string{"id": "1", "currency": "USD"})
+	c.SetPrice(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "SetCoffeePrice", mock.Anything)
+}
+
+func TestOrderTotalsAreComputedInRequestedCurrency(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("GetPriceList", "EUR").Return(model.CoffeePrices{}, nil)
+	con.On("GetOrders").Return(model.Orders{{
+		ID:        1,
+		Version:   2,
+		Items:     []model.OrderItems{{ID: 1, CoffeeID: 1, Coffee: model.Coffee{ID: 1, Price: 200}, Price: 250, Quantity: 3}},
+		Discounts: []model.OrderDiscount{{Code: "TEN", Amount: 75}},
+	}}, nil)
+
+	c := &Order{con, hclog.Default(), pickup.Policy{}, testRates}
+	rw := httptest.NewRecorder()
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/orders/1?currency=EUR", nil), map[string]string{"id": "1"})
+	c.GetUserOrder(1, rw, r)
+
+	o := model.Order{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &o))
+
+	// each item is priced at the store price of 2.50 USD, 2.30 EUR
+	assert.Equal(t, 230, o.Items[0].Coffee.Price)
+	assert.Equal(t, model.Money{Amount: 690, Currency: "EUR", Formatted: "€6.90"}, o.Totals.Subtotal)
+	assert.Equal(t, 69, o.Totals.Discount.Amount)
+	assert.Equal(t, 621, o.Totals.Total.Amount)
+}
+
+func TestOrderItemsUseThePriceListOnlyAtTheCatalogPrice(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("GetPriceList", "EUR").Return(model.CoffeePrices{
+		{CoffeeID: 1, Currency: "EUR", Price: 180},
+		{CoffeeID: 2, Currency: "EUR", Price: 300},
+	}, nil)
+	con.On("GetOrders").Return(model.Orders{{
+		ID:      1,
+		Version: 2,
+		Items: []model.OrderItems{
+			{ID: 1, CoffeeID: 1, Coffee: model.Coffee{ID: 1, Price: 200}, Price: 250, Quantity: 2},
+			{ID: 2, CoffeeID: 2, Coffee: model.Coffee{ID: 2, Price: 400}, Price: 400, Quantity: 1},
+		},
+	}}, nil)
+
+	c := &Order{con, hclog.Default(), pickup.Policy{}, testRates}
+	rw := httptest.NewRecorder()
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/orders/1?currency=EUR", nil), map[string]string{"id": "1"})
+	c.GetUserOrder(1, rw, r)
+
+	o := model.Order{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &o))
+
+	// the first item is at a store price of 2.50 USD which is converted to
+	// match the amount charged, the second is at the catalog price
+	assert.Equal(t, 230, o.Items[0].Coffee.Price)
+	assert.Equal(t, 300, o.Items[1].Coffee.Price)
+	assert.Equal(t, 760, o.Totals.Subtotal.Amount)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// requireIfMatch rejects changes without an If-Match header, it is set using
+// SetRequireIfMatch
+var requireIfMatch = false
+
+// SetRequireIfMatch sets whether changes to versioned records must send an
+// If-Match header
+func SetRequireIfMatch(require bool) {
+	requireIfMatch = require
+}
+
+// versionETag returns the ETag for a version of a record
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// bodyETag returns the ETag for a response body, used for collections which
+// do not have a single version
+func bodyETag(body []byte) string {
+	h := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+// writeWithETag writes body with its ETag, or 304 Not Modified when the
+// client already has it
+func writeWithETag(rw http.ResponseWriter, r *http.Request, etag string, body []byte) {
+	rw.Header().Set("ETag", etag)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rw.Write(body)
+}
+
+// etagListMatches returns true when the list of ETags in an If-None-Match
+// header contains etag, weak ETags match their strong equivalent
+func etagListMatches(list, etag string) bool {
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion returns the version sent in the If-Match header, nil when
+// any version can be changed. When the header is missing but required, or
+// can not be read, an error is written to rw and false returned.
+func ifMatchVersion(rw http.ResponseWriter, r *http.Request) (*int, bool) {
+	im := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if im == "" {
+		if requireIfMatch {
+			http.Error(rw, "If-Match header is required, send the ETag of the latest version", http.StatusPreconditionRequired)
+			return nil, false
+		}
+
+		return nil, true
+	}
+
+	if im == "*" {
+		return nil, true
+	}
+
+	// weak ETags can not be used with If-Match, the currency and language
+	// of priced records follow the version
+	v, err := strconv.Atoi(strings.SplitN(strings.Trim(im, `"`), "-", 2)[0])
+	if err != nil || !strings.HasPrefix(im, `"`) || !strings.HasSuffix(im, `"`) {
+		http.Error(rw, "If-Match must contain a single ETag", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &v, true
+}
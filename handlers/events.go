@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/stream"
+	"github.com/hashicorp/go-hclog"
+)
+
+// replayPageSize is the number of missed events read at a time when a stream
+// resumes
+const replayPageSize = 100
+
+// OrderEvents is a HTTP Handler which streams changes to orders as
+// Server-Sent Events
+type OrderEvents struct {
+	con       data.Connection
+	log       hclog.Logger
+	hub       *stream.Hub
+	heartbeat time.Duration
+}
+
+// NewOrderEvents creates an OrderEvents handler, a comment is sent every
+// heartbeat so idle connections are not closed by proxies
+func NewOrderEvents(con data.Connection, l hclog.Logger, hub *stream.Hub, heartbeat time.Duration) *OrderEvents {
+	return &OrderEvents{con, l, hub, heartbeat}
+}
+
+// StreamOrder streams the events for one of the user's orders
+func (c *OrderEvents) StreamOrder(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle OrderEvents | StreamOrder")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("orderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to stream order", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := c.con.GetOrders(userID, &orderID)
+	if err != nil {
+		c.log.Error("Unable to get order from database", "error", err)
+		http.Error(rw, "Unable to stream order", http.StatusInternalServerError)
+		return
+	}
+
+	if len(orders) == 0 {
+		http.Error(rw, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	c.stream(userID, &orderID, rw, r)
+}
+
+// StreamOrders streams the events for all of the user's orders
+func (c *OrderEvents) StreamOrders(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle OrderEvents | StreamOrders")
+
+	c.stream(userID, nil, rw, r)
+}
+
+// stream sends events until the client disconnects. When the client sends
+// Last-Event-ID the events it missed are sent first.
+func (c *OrderEvents) stream(userID int, orderID *int, rw http.ResponseWriter, r *http.Request) {
+	f, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	last := int64(0)
+	if h := r.Header.Get("Last-Event-ID"); h != "" {
+		id, err := strconv.ParseInt(h, 10, 64)
+		if err != nil || id < 0 {
+			http.Error(rw, "Last-Event-ID must be an event ID", http.StatusBadRequest)
+			return
+		}
+
+		last = id
+	}
+
+	// subscribe before reading missed events so none are lost in between
+	filter := 0
+	if orderID != nil {
+		filter = *orderID
+	}
+
+	sub := c.hub.Subscribe(userID, filter)
+	defer c.hub.Unsubscribe(sub)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprint(rw, ": connected\n\n")
+
+	// events sent while resuming may also be received from the hub
+	replayed := map[int64]bool{}
+
+	for last > 0 {
+		es, err := c.con.GetOrderEvents(userID, orderID, last, replayPageSize)
+		if err != nil {
+			c.log.Error("Unable to get missed order events", "error", err)
+			return
+		}
+
+		for _, e := range es {
+			writeEvent(rw, e)
+			replayed[e.ID] = true
+			last = e.ID
+		}
+
+		if len(es) < replayPageSize {
+			break
+		}
+	}
+	f.Flush()
+
+	t := time.NewTicker(c.heartbeat)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+			fmt.Fprint(rw, ": heartbeat\n\n")
+			f.Flush()
+		case e, ok := <-sub.Events():
+			// the hub closes streams which fall behind, the client
+			// reconnects with Last-Event-ID
+			if !ok {
+				return
+			}
+
+			if replayed[e.ID] {
+				continue
+			}
+
+			writeEvent(rw, e)
+			f.Flush()
+		}
+	}
+}
+
+// writeEvent writes an event in the Server-Sent Events format
+func writeEvent(w io.Writer, e model.OutboxEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\n", e.ID, e.EventType)
+
+	for _, line := range bytes.Split(e.Payload, []byte("\n")) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+
+	fmt.Fprint(w, "\n")
+}
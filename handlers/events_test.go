@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/stream"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupOrderEventsHandler(t *testing.T) (*OrderEvents, *data.MockConnection, *stream.Hub) {
+	c := &data.MockConnection{}
+	hub := stream.NewHub(&data.LocalBroker{}, hclog.NewNullLogger())
+
+	return NewOrderEvents(c, hclog.Default(), hub, time.Hour), c, hub
+}
+
+func orderUpdatedEvent(id int64, orderID int) model.OutboxEvent {
+	return model.OutboxEvent{
+		ID:            id,
+		AggregateType: model.AggregateOrder,
+		AggregateID:   orderID,
+		EventType:     model.EventOrderUpdated,
+		Payload:       []byte(`{"type":"order.updated","data":{"user_id":1}}`),
+	}
+}
+
+// runStream runs a stream until publish has been called and its events sent,
+// then returns what was written
+func runStream(t *testing.T, handler func(int, http.ResponseWriter, *http.Request), r *http.Request, publish func()) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithCancel(r.Context())
+	rw := httptest.NewRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		handler(1, rw, r.WithContext(ctx))
+		close(done)
+	}()
+
+	// wait for the stream to subscribe
+	time.Sleep(20 * time.Millisecond)
+	publish()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	<-done
+
+	return rw
+}
+
+func TestStreamOrdersSendsEvents(t *testing.T) {
+	c, _, hub := setupOrderEventsHandler(t)
+
+	rw := runStream(t, c.StreamOrders, httptest.NewRequest("GET", "/orders/events", nil), func() {
+		hub.Publish(context.Background(), orderUpdatedEvent(7, 3))
+	})
+
+	assert.Equal(t, "text/event-stream", rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Body.String(), "id: 7\nevent: order.updated\ndata: {\"type\":\"order.updated\",\"data\":{\"user_id\":1}}\n\n")
+}
+
+func TestStreamOrderResumesFromLastEventID(t *testing.T) {
+	c, con, hub := setupOrderEventsHandler(t)
+
+	orderID := 3
+	con.On("GetOrders").Return(model.Orders{{ID: 3}}, nil)
+	con.On("GetOrderEvents", 1, &orderID, int64(5), replayPageSize).Return([]model.OutboxEvent{orderUpdatedEvent(6, 3)}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/orders/3/events", nil), map[string]string{"id": "3"})
+	r.Header.Set("Last-Event-ID", "5")
+
+	rw := runStream(t, c.StreamOrder, r, func() {
+		hub.Publish(context.Background(), orderUpdatedEvent(6, 3))
+		hub.Publish(context.Background(), orderUpdatedEvent(8, 4))
+		hub.Publish(context.Background(), orderUpdatedEvent(9, 3))
+	})
+
+	body := rw.Body.String()
+	assert.Equal(t, 1, countOf(body, "id: 6\n"))
+	assert.NotContains(t, body, "id: 8\n")
+	assert.Contains(t, body, "id: 9\n")
+}
+
+func TestStreamOrderReturnsNotFound(t *testing.T) {
+	c, con, _ := setupOrderEventsHandler(t)
+	con.On("GetOrders").Return(model.Orders{}, nil)
+
+	rw := httptest.NewRecorder()
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/orders/3/events", nil), map[string]string{"id": "3"})
+	c.StreamOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func countOf(s string, sub string) int {
+	n := 0
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if s[i:i+len(sub)] == sub {
+			n++
+		}
+	}
+
+	return n
+}
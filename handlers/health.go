@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
-	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/health"
 	"github.com/hashicorp-demoapp/product-api-go/telemetry"
 	"github.com/hashicorp/go-hclog"
 )
@@ -13,28 +15,37 @@ import (
 type Health struct {
 	logger    hclog.Logger
 	telemetry *telemetry.Telemetry
-	db        data.Connection
+	registry  *health.Registry
 }
 
-// NewHealth creates a new Health handler
-func NewHealth(t *telemetry.Telemetry, l hclog.Logger, db data.Connection) *Health {
+// NewHealth creates a new Health handler which reports the checks in the registry
+func NewHealth(t *telemetry.Telemetry, l hclog.Logger, r *health.Registry) *Health {
 	t.AddMeasure("health.call")
 	t.AddMeasure("health.livez")
 	t.AddMeasure("health.readyz")
+	t.AddMeasure("health.startupz")
 
-	return &Health{l, t, db}
+	return &Health{l, t, r}
 }
 
 // ServeHTTP implements the handler interface
-// Deprecated: Use Liveness and Readiness handlers instead
+// Deprecated: Use Liveness, Readiness and Startup handlers instead
 func (h *Health) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	done := h.telemetry.NewTiming("health.call")
 	defer done()
 
-	_, err := h.db.IsConnected()
-	if err != nil {
+	rep := h.registry.Run(r.Context(), health.Readiness)
+	if !rep.OK() {
+		errs := []string{}
+		for _, c := range rep.Checks {
+			if c.Error != "" {
+				errs = append(errs, fmt.Sprintf("%s: %s", c.Name, c.Error))
+			}
+		}
+
 		rw.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(rw, "error %s", err)
+		fmt.Fprintf(rw, "error %s", strings.Join(errs, ", "))
+		return
 	}
 
 	fmt.Fprintf(rw, "%s", "ok")
@@ -53,11 +64,33 @@ func (h *Health) Readiness(rw http.ResponseWriter, r *http.Request) {
 	done := h.telemetry.NewTiming("health.readyz")
 	defer done()
 
-	_, err := h.db.IsConnected()
+	h.writeReport(rw, h.registry.Run(r.Context(), health.Readiness))
+}
+
+// Startup endpoint for health checks indicates the server has finished starting
+func (h *Health) Startup(rw http.ResponseWriter, r *http.Request) {
+	done := h.telemetry.NewTiming("health.startupz")
+	defer done()
+
+	h.writeReport(rw, h.registry.Run(r.Context(), health.Startup))
+}
+
+func (h *Health) writeReport(rw http.ResponseWriter, rep health.Report) {
+	d, err := json.Marshal(rep)
 	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(rw, "error %s", err)
+		h.logger.Error("Unable to convert health report to JSON", "error", err)
+		http.Error(rw, "Unable to check health", http.StatusInternalServerError)
+		return
 	}
 
-	fmt.Fprintf(rw, "%s", "ok")
+	if !rep.OK() {
+		h.logger.Error("Health check failed", "report", string(d))
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write(d)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(d)
 }
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/health"
+	"github.com/hashicorp-demoapp/product-api-go/telemetry"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupHealthHandler(t *testing.T, dbErr error) (*Health, *httptest.ResponseRecorder) {
+	r := health.NewRegistry(time.Second, 0)
+	r.Register("database", func(ctx context.Context) error { return dbErr }, health.Readiness, health.Startup)
+
+	return NewHealth(telemetry.New("localhost:0"), hclog.Default(), r), httptest.NewRecorder()
+}
+
+func TestReadinessReturnsChecks(t *testing.T) {
+	h, rw := setupHealthHandler(t, nil)
+
+	h.Readiness(rw, httptest.NewRequest("GET", "/health/readyz", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rep := health.Report{}
+	err := json.Unmarshal(rw.Body.Bytes(), &rep)
+	assert.NoError(t, err)
+	assert.Equal(t, health.StatusOK, rep.Status)
+	assert.Equal(t, "database", rep.Checks[0].Name)
+}
+
+func TestReadinessReturnsUnavailableOnFailedCheck(t *testing.T) {
+	h, rw := setupHealthHandler(t, errors.New("connection refused"))
+
+	h.Readiness(rw, httptest.NewRequest("GET", "/health/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+
+	rep := health.Report{}
+	err := json.Unmarshal(rw.Body.Bytes(), &rep)
+	assert.NoError(t, err)
+	assert.Equal(t, "connection refused", rep.Checks[0].Error)
+}
+
+func TestStartupReturnsChecks(t *testing.T) {
+	h, rw := setupHealthHandler(t, nil)
+
+	h.Startup(rw, httptest.NewRequest("GET", "/health/startupz", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestLegacyHealthReturnsOK(t *testing.T) {
+	h, rw := setupHealthHandler(t, nil)
+
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/health", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "ok", rw.Body.String())
+}
+
+func TestLegacyHealthReturnsOnlyErrorOnFailure(t *testing.T) {
+	h, rw := setupHealthHandler(t, errors.New("connection refused"))
+
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/health", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+	assert.Equal(t, "error database: connection refused", rw.Body.String())
+}
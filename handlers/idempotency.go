@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxIdempotencyKey is the longest Idempotency-Key accepted
+const maxIdempotencyKey = 255
+
+// maxIdempotentBody is the largest request body accepted with an
+// Idempotency-Key
+const maxIdempotentBody = 1 << 20
+
+// idempotencyLockTimeout is how long a request can run before a retry with
+// the same key is allowed to run it again, in case the first request never
+// finished
+const idempotencyLockTimeout = time.Minute
+
+// idempotencyPollInterval is how often a retry checks whether the first
+// request with its key has finished
+const idempotencyPollInterval = 100 * time.Millisecond
+
+// Idempotency is middleware which stores the response to requests sent with an
+// Idempotency-Key header. Retrying a request with the same key returns the
+// stored response rather than running the request again.
+type Idempotency struct {
+	con  data.Connection
+	log  hclog.Logger
+	ttl  time.Duration
+	wait time.Duration
+}
+
+// NewIdempotency creates idempotency middleware, keys expire after ttl and a
+// retry waits up to wait for the first request with its key to finish
+func NewIdempotency(con data.Connection, l hclog.Logger, ttl, wait time.Duration) *Idempotency {
+	return &Idempotency{con, l, ttl, wait}
+}
+
+// ByUser stores responses by the user and key, requests without a key are
+// passed to next unchanged
+func (c *Idempotency) ByUser(next func(userID int, rw http.ResponseWriter, r *http.Request)) func(userID int, rw http.ResponseWriter, r *http.Request) {
+	return func(userID int, rw http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(userID, rw, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			http.Error(rw, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxIdempotentBody))
+		if err != nil {
+			c.log.Error("Unable to read request body", "error", err)
+			http.Error(rw, "Unable to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		k := model.IdempotencyKey{UserID: userID, Key: key, RequestHash: requestHash(r, body)}
+
+		stored, claimed, err := c.claim(k)
+		if err != nil {
+			c.log.Error("Unable to claim idempotency key", "error", err)
+			http.Error(rw, "Unable to process request", http.StatusInternalServerError)
+			return
+		}
+
+		if !claimed {
+			c.replay(stored, k, rw)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: rw}
+		next(userID, rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// failed requests are not stored so they can be retried
+		if rec.status >= http.StatusInternalServerError {
+			if err := c.con.ReleaseIdempotencyKey(userID, key); err != nil {
+				c.log.Error("Unable to release idempotency key", "error", err)
+			}
+			return
+		}
+
+		k.StatusCode = rec.status
+		k.ContentType = rec.Header().Get("Content-Type")
+		k.ResponseBody = rec.body.Bytes()
+
+		if err := c.con.CompleteIdempotencyKey(k); err != nil {
+			c.log.Error("Unable to store idempotent response", "error", err)
+		}
+	}
+}
+
+// claim claims the key, when another request holds it claim waits for that
+// request to finish
+func (c *Idempotency) claim(k model.IdempotencyKey) (model.IdempotencyKey, bool, error) {
+	deadline := time.Now().Add(c.wait)
+
+	for {
+		stored, claimed, err := c.con.ClaimIdempotencyKey(k, c.ttl, idempotencyLockTimeout)
+		if err != nil || claimed || stored.Completed() || stored.RequestHash != k.RequestHash {
+			return stored, claimed, err
+		}
+
+		if time.Now().After(deadline) {
+			return stored, false, nil
+		}
+
+		time.Sleep(idempotencyPollInterval)
+	}
+}
+
+// replay writes the stored response for a key
+func (c *Idempotency) replay(stored, k model.IdempotencyKey, rw http.ResponseWriter) {
+	if stored.RequestHash != k.RequestHash {
+		c.log.Info("Idempotency key reused with a different request", "user_id", k.UserID)
+		http.Error(rw, "Idempotency-Key has already been used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !stored.Completed() {
+		rw.Header().Set("Retry-After", "1")
+		http.Error(rw, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+
+	if stored.ContentType != "" {
+		rw.Header().Set("Content-Type", stored.ContentType)
+	}
+	rw.Header().Set("Idempotent-Replayed", "true")
+	rw.WriteHeader(stored.StatusCode)
+	rw.Write(stored.ResponseBody)
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response to the client and keeps a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
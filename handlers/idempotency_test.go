@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupIdempotency(t *testing.T) (*Idempotency, *data.MockConnection, *int) {
+	c := &data.MockConnection{}
+	calls := 0
+
+	return &Idempotency{c, hclog.Default(), 24 * time.Hour, 50 * time.Millisecond}, c, &calls
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	r := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+
+	return r
+}
+
+func countingHandler(calls *int, status int) func(int, http.ResponseWriter, *http.Request) {
+	return func(userID int, rw http.ResponseWriter, r *http.Request) {
+		*calls++
+		b, _ := ioutil.ReadAll(r.Body)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+		fmt.Fprintf(rw, `{"id": %d, "body": %q}`, *calls, b)
+	}
+}
+
+func TestIdempotencyPassesRequestsWithoutKey(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusOK))(1, rw, idempotentRequest("", "[]"))
+
+	assert.Equal(t, 1, *calls)
+	c.AssertNotCalled(t, "ClaimIdempotencyKey", mock.Anything)
+}
+
+func TestIdempotencyStoresFirstResponse(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{}, true, nil)
+	c.On("CompleteIdempotencyKey", mock.Anything).Return(nil)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusOK))(1, rw, idempotentRequest("abc", "[]"))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, 1, *calls)
+	c.AssertCalled(t, "CompleteIdempotencyKey", mock.MatchedBy(func(k model.IdempotencyKey) bool {
+		return k.UserID == 1 && k.Key == "abc" && k.StatusCode == http.StatusOK &&
+			k.ContentType == "application/json" && string(k.ResponseBody) == rw.Body.String()
+	}))
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+	r := idempotentRequest("abc", "[]")
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{
+		RequestHash:  requestHash(r, []byte("[]")),
+		StatusCode:   http.StatusCreated,
+		ContentType:  "application/json",
+		ResponseBody: []byte(`{"id": 1}`),
+	}, false, nil)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusOK))(1, rw, r)
+
+	assert.Equal(t, 0, *calls)
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, `{"id": 1}`, rw.Body.String())
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rw.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyRejectsDifferentRequestWithSameKey(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{
+		RequestHash: requestHash(idempotentRequest("abc", ""), []byte(`[{"coffee": {"id": 1}}]`)),
+		StatusCode:  http.StatusOK,
+	}, false, nil)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusOK))(1, rw, idempotentRequest("abc", "[]"))
+
+	assert.Equal(t, 0, *calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+}
+
+func TestIdempotencyReturnsConflictWhileFirstRequestRuns(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+	r := idempotentRequest("abc", "[]")
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{RequestHash: requestHash(r, []byte("[]"))}, false, nil)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusOK))(1, rw, r)
+
+	assert.Equal(t, 0, *calls)
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Equal(t, "1", rw.Header().Get("Retry-After"))
+	assert.Greater(t, len(c.Calls), 1, "should poll until the wait expires")
+}
+
+func TestIdempotencyWaitsForFirstRequest(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+	r := idempotentRequest("abc", "[]")
+	hash := requestHash(r, []byte("[]"))
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{RequestHash: hash}, false, nil).Once()
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{RequestHash: hash, StatusCode: http.StatusOK, ResponseBody: []byte("done")}, false, nil)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusOK))(1, rw, r)
+
+	assert.Equal(t, 0, *calls)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "done", rw.Body.String())
+}
+
+func TestIdempotencyReleasesKeyWhenRequestFails(t *testing.T) {
+	i, c, calls := setupIdempotency(t)
+	c.On("ClaimIdempotencyKey", mock.Anything).Return(model.IdempotencyKey{}, true, nil)
+	c.On("ReleaseIdempotencyKey", 1, "abc").Return(nil)
+
+	rw := httptest.NewRecorder()
+	i.ByUser(countingHandler(calls, http.StatusInternalServerError))(1, rw, idempotentRequest("abc", "[]"))
+
+	c.AssertCalled(t, "ReleaseIdempotencyKey", 1, "abc")
+	c.AssertNotCalled(t, "CompleteIdempotencyKey", mock.Anything)
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/oidc"
+	"github.com/hashicorp/go-hclog"
+)
+
+// oidcCookie holds the state of a sign in between the redirect to the
+// provider and the callback
+const oidcCookie = "oidc_login"
+
+// oidcLoginAudience is the audience of the sign in cookie, it is checked as
+// well as the signature so the cookie is only accepted as sign in state
+const oidcLoginAudience = "oidc_login"
+
+// oidcLoginTTL is how long a user has to sign in with the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// maxUsernameLength is the longest username given to a provisioned user
+const maxUsernameLength = 64
+
+// usernameAttempts is how many numbered usernames are tried before a random
+// suffix is used when provisioning a user
+const usernameAttempts = 5
+
+// OIDC is a HTTP Handler which signs users in with an external OpenID Connect
+// provider. Users are created the first time they sign in, signed in users can
+// link the provider to their existing account instead.
+type OIDC struct {
+	con      data.Connection
+	log      hclog.Logger
+	provider *oidc.Provider
+	user     *User
+}
+
+// oidcLogin are the claims of the signed cookie which holds the state of a
+// sign in
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// LinkUserID is set when a signed in user is linking the provider to
+	// their account
+	LinkUserID int `json:"link_user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AuthorizationResponse contains the URL users are sent to to link an
+// identity
+type AuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// NewOIDC creates an OIDC handler, tokens are issued in the same way as the
+// User handler
+func NewOIDC(con data.Connection, l hclog.Logger, p *oidc.Provider, u *User) *OIDC {
+	return &OIDC{con, l, p, u}
+}
+
+// Login redirects the user to sign in with the provider
+func (c *OIDC) Login(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle OIDC | login")
+
+	u, err := c.startLogin(rw, r, 0)
+	if err != nil {
+		c.log.Error("Unable to start OIDC sign in", "error", err)
+		http.Error(rw, "Unable to sign in with provider", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(rw, r, u, http.StatusFound)
+}
+
+// LinkIdentity returns the URL the signed in user is sent to to link the
+// provider to their account
+func (c *OIDC) LinkIdentity(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle OIDC | link")
+
+	u, err := c.startLogin(rw, r, userID)
+	if err != nil {
+		c.log.Error("Unable to start OIDC sign in", "error", err)
+		http.Error(rw, "Unable to link identity", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(AuthorizationResponse{AuthorizationURL: u})
+}
+
+// ListIdentities returns the external identities linked to the signed in user
+func (c *OIDC) ListIdentities(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle OIDC | identities")
+
+	is, err := c.con.GetIdentities(userID)
+	if err != nil {
+		c.log.Error("Unable to get identities", "error", err)
+		http.Error(rw, "Unable to list identities", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := is.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert identities to JSON", "error", err)
+		http.Error(rw, "Unable to list identities", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// Callback completes a sign in after the provider redirects back. New users
+// are created, or the identity is linked when the sign in was started by
+// LinkIdentity, then a JWT token is returned.
+func (c *OIDC) Callback(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle OIDC | callback")
+
+	login, err := c.finishLogin(rw, r)
+	if err != nil {
+		c.log.Error("Invalid OIDC callback", "error", err)
+		http.Error(rw, "Sign in has expired or is invalid, try again", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		c.log.Error("Provider did not sign in user", "error", e, "description", q.Get("error_description"))
+		http.Error(rw, "Sign in with provider was not completed", http.StatusUnauthorized)
+		return
+	}
+
+	raw, err := c.provider.Exchange(r.Context(), q.Get("code"), login.Verifier)
+	if err != nil {
+		c.log.Error("Unable to exchange authorization code", "error", err)
+		http.Error(rw, "Unable to sign in with provider", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := c.provider.Verify(r.Context(), raw, login.Nonce)
+	if err != nil {
+		c.log.Error("Unable to verify ID token", "error", err)
+		http.Error(rw, "Unable to sign in with provider", http.StatusUnauthorized)
+		return
+	}
+
+	id := model.Identity{Issuer: c.provider.Issuer(), Subject: claims.Subject, Email: claims.Email}
+
+	if login.LinkUserID != 0 {
+		c.link(login.LinkUserID, id, rw, r)
+		return
+	}
+
+	u, err := c.con.GetUserByIdentity(id.Issuer, id.Subject)
+	if errors.Is(err, data.ErrUnknownIdentity) {
+		u, err = c.provision(claims, id)
+	}
+
+	if errors.Is(err, data.ErrEmailInUse) {
+		c.log.Error("Unable to create user", "error", err)
+		http.Error(rw, "An account already uses this email, sign in to it and link the identity", http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to get user for identity", "error", err)
+		http.Error(rw, "Unable to sign in with provider", http.StatusInternalServerError)
+		return
+	}
+
+	if u.Disabled {
+		c.log.Error("Unable to sign in disabled user", "user_id", u.ID)
+		http.Error(rw, "Invalid Credentials", http.StatusUnauthorized)
+		return
+	}
+
+	tokenString, err := c.user.generateJWTToken(u.ID, u.Username, r)
+	if err != nil {
+		c.log.Error("Unable to generate JWT token", "error", err)
+		http.Error(rw, "Unable to generate JWT token", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(AuthResponse{
+		UserID:   u.ID,
+		Username: u.Username,
+		Token:    tokenString,
+	})
+}
+
+func (c *OIDC) link(userID int, id model.Identity, rw http.ResponseWriter, r *http.Request) {
+	err := c.con.LinkIdentity(userID, id)
+	if errors.Is(err, data.ErrIdentityInUse) {
+		c.log.Error("Unable to link identity", "error", err)
+		http.Error(rw, "Identity is already linked to an account", http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to link identity", "error", err)
+		http.Error(rw, "Unable to link identity", http.StatusInternalServerError)
+		return
+	}
+
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  model.AuditIdentityLinked,
+		Subject: id.Issuer + " " + id.Subject,
+		IP:      clientIP(r),
+	}
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+
+	fmt.Fprintf(rw, "%s", "Linked identity")
+}
+
+// provision creates a user for an identity which has not signed in before,
+// the email is only used when the provider has verified it
+func (c *OIDC) provision(claims oidc.Claims, id model.Identity) (model.User, error) {
+	u := model.User{DisplayName: claims.Name}
+	if claims.EmailVerified {
+		u.Email = claims.Email
+	}
+
+	base := provisionedUsername(claims)
+
+	for i := 1; ; i++ {
+		switch {
+		case i == 1:
+			u.Username = base
+		case i <= usernameAttempts:
+			u.Username = base + "-" + strconv.Itoa(i)
+		default:
+			s, err := oidc.NewRandom()
+			if err != nil {
+				return model.User{}, err
+			}
+			u.Username = base + "-" + s[:8]
+		}
+
+		nu, err := c.con.CreateUserWithIdentity(u, id)
+		if errors.Is(err, data.ErrUsernameInUse) && i <= usernameAttempts {
+			continue
+		}
+
+		return nu, err
+	}
+}
+
+// provisionedUsername picks a username from the claims of an ID token
+func provisionedUsername(claims oidc.Claims) string {
+	n := strings.TrimSpace(claims.PreferredUsername)
+	if n == "" && claims.EmailVerified {
+		n = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	if n == "" {
+		n = "user"
+	}
+
+	if len(n) > maxUsernameLength {
+		n = n[:maxUsernameLength]
+	}
+
+	return n
+}
+
+// startLogin sets the cookie for a new sign in and returns the provider's
+// authorization URL
+func (c *OIDC) startLogin(rw http.ResponseWriter, r *http.Request, linkUserID int) (string, error) {
+	l := oidcLogin{LinkUserID: linkUserID}
+
+	for _, v := range []*string{&l.State, &l.Nonce, &l.Verifier} {
+		s, err := oidc.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		*v = s
+	}
+
+	expires := time.Now().Add(oidcLoginTTL)
+	l.ExpiresAt = jwt.NewNumericDate(expires)
+	l.Audience = jwt.ClaimStrings{oidcLoginAudience}
+
+	v, err := jwt.NewWithClaims(jwt.SigningMethodHS256, l).SignedString(oidcLoginKey())
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    v,
+		Path:     "/auth/oidc",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.provider.AuthCodeURL(l.State, l.Nonce, l.Verifier), nil
+}
+
+// oidcLoginKey returns the key the sign in cookie is signed with, it is
+// derived from the JWT secret so the cookie can not be used as an access token
+func oidcLoginKey() []byte {
+	m := hmac.New(sha256.New, jwtSecret)
+	m.Write([]byte(oidcLoginAudience))
+	return m.Sum(nil)
+}
+
+// finishLogin reads and clears the sign in cookie, the state returned by the
+// provider must match it
+func (c *OIDC) finishLogin(rw http.ResponseWriter, r *http.Request) (oidcLogin, error) {
+	l := oidcLogin{}
+
+	ck, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return l, err
+	}
+
+	http.SetCookie(rw, &http.Cookie{Name: oidcCookie, Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+	_, err = parser.ParseWithClaims(ck.Value, &l, func(t *jwt.Token) (interface{}, error) {
+		return oidcLoginKey(), nil
+	})
+	if err != nil {
+		return l, err
+	}
+
+	if !l.VerifyAudience(oidcLoginAudience, true) {
+		return l, errors.New("Cookie is not sign in state")
+	}
+
+	state := r.URL.Query().Get("state")
+	if l.State == "" || subtle.ConstantTimeCompare([]byte(state), []byte(l.State)) != 1 {
+		return l, errors.New("State does not match")
+	}
+
+	return l, nil
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/oidc"
+	"github.com/hashicorp-demoapp/product-api-go/oidc/oidctest"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupOIDCHandler(t *testing.T) (*OIDC, *data.MockConnection, *oidctest.Issuer) {
+	i, err := oidctest.NewIssuer("product-api")
+	assert.NoError(t, err)
+	t.Cleanup(i.Close)
+
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      i.URL,
+		ClientID:    "product-api",
+		RedirectURL: "http://localhost:9090/auth/oidc/callback",
+	}, nil)
+	assert.NoError(t, err)
+
+	c := &data.MockConnection{}
+	c.On("CreateToken").Return(model.Token{ID: 1, UserID: 1}, nil)
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	l := hclog.Default()
+	return &OIDC{c, l, p, &User{c, l, nil, nil}}, c, i
+}
+
+// signInWithIssuer follows the sign in started by start, signs in to the issuer
+// and returns the callback request made by the user's browser
+func signInWithIssuer(t *testing.T, start *httptest.ResponseRecorder, i *oidctest.Issuer) *http.Request {
+	authURL := start.Header().Get("Location")
+	if authURL == "" {
+		a := AuthorizationResponse{}
+		assert.NoError(t, json.Unmarshal(start.Body.Bytes(), &a))
+		authURL = a.AuthorizationURL
+	}
+
+	callback, err := i.Authorize(authURL)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest("GET", callback.String(), nil)
+	for _, c := range start.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	return r
+}
+
+func TestOIDCLoginRedirectsToProvider(t *testing.T) {
+	h, _, i := setupOIDCHandler(t)
+
+	rw := httptest.NewRecorder()
+	h.Login(rw, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	assert.Equal(t, http.StatusFound, rw.Code)
+	assert.Contains(t, rw.Header().Get("Location"), i.URL+"/authorize")
+	assert.Equal(t, oidcCookie, rw.Result().Cookies()[0].Name)
+}
+
+func TestOIDCCallbackProvisionsNewUsers(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	c.On("GetUserByIdentity", i.URL, "1234").Return(nil, data.ErrUnknownIdentity)
+	c.On("CreateUserWithIdentity", mock.MatchedBy(func(u model.User) bool { return u.Username == "nic" }), mock.Anything).Return(nil, data.ErrUsernameInUse)
+	c.On("CreateUserWithIdentity", mock.Anything, mock.Anything).Return(model.User{ID: 5, Username: "nic-2"}, nil)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	a := AuthResponse{}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &a))
+	assert.Equal(t, 5, a.UserID)
+	assert.NotEmpty(t, a.Token)
+
+	c.AssertCalled(t, "CreateUserWithIdentity", mock.MatchedBy(func(u model.User) bool {
+		return u.Username == "nic-2" && u.Email == "nic@example.com" && u.DisplayName == "Nic"
+	}), model.Identity{Issuer: i.URL, Subject: "1234", Email: "nic@example.com"})
+}
+
+func TestOIDCCallbackDoesNotUseUnverifiedEmail(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	i.SetUser(oidctest.User{Subject: "1234", Email: "nic@example.com"})
+	c.On("GetUserByIdentity", i.URL, "1234").Return(nil, data.ErrUnknownIdentity)
+	c.On("CreateUserWithIdentity", mock.Anything, mock.Anything).Return(model.User{ID: 5, Username: "user"}, nil)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "CreateUserWithIdentity", model.User{Username: "user"}, mock.Anything)
+}
+
+func TestOIDCCallbackSignsInLinkedUsers(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	c.On("GetUserByIdentity", i.URL, "1234").Return(model.User{ID: 2, Username: "User2"}, nil)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"user_id":2`)
+	c.AssertNotCalled(t, "CreateUserWithIdentity", mock.Anything, mock.Anything)
+}
+
+func TestOIDCCallbackRejectsDisabledUsers(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	c.On("GetUserByIdentity", i.URL, "1234").Return(model.User{ID: 2, Username: "User2", Disabled: true}, nil)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	c.AssertNotCalled(t, "CreateToken")
+}
+
+func TestOIDCCallbackReturnsConflictWhenEmailIsInUse(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	c.On("GetUserByIdentity", i.URL, "1234").Return(nil, data.ErrUnknownIdentity)
+	c.On("CreateUserWithIdentity", mock.Anything, mock.Anything).Return(nil, data.ErrEmailInUse)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestOIDCCallbackRejectsMismatchedState(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	r := signInWithIssuer(t, start, i)
+	q := r.URL.Query()
+	q.Set("state", "other")
+	r.URL.RawQuery = q.Encode()
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	c.AssertNotCalled(t, "CreateToken")
+}
+
+func TestOIDCCallbackRequiresCookie(t *testing.T) {
+	h, _, i := setupOIDCHandler(t)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	r := signInWithIssuer(t, start, i)
+	r.Header.Del("Cookie")
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestOIDCLoginCookieIsRejectedAsBearerToken(t *testing.T) {
+	h, c, _ := setupOIDCHandler(t)
+	c.On("GetToken").Return(model.Token{ID: 1, UserID: 1}, nil)
+
+	start := httptest.NewRecorder()
+	h.Login(start, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+
+	cks := start.Result().Cookies()
+	assert.Len(t, cks, 1)
+
+	r := httptest.NewRequest("GET", "/users/me", nil)
+	r.Header.Set("Authorization", cks[0].Value)
+
+	rw := httptest.NewRecorder()
+	NewAuthMiddleware(c, hclog.Default()).IsAuthorized(okUserHandler).ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	c.AssertNotCalled(t, "GetToken")
+}
+
+func TestOIDCLinkIdentityLinksToSignedInUser(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	c.On("LinkIdentity", 3, mock.Anything).Return(nil)
+
+	start := httptest.NewRecorder()
+	h.LinkIdentity(3, start, httptest.NewRequest("POST", "/users/me/identities", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "LinkIdentity", 3, model.Identity{Issuer: i.URL, Subject: "1234", Email: "nic@example.com"})
+	c.AssertNotCalled(t, "GetUserByIdentity", mock.Anything, mock.Anything)
+}
+
+func TestOIDCLinkIdentityReturnsConflictWhenLinked(t *testing.T) {
+	h, c, i := setupOIDCHandler(t)
+	c.On("LinkIdentity", 3, mock.Anything).Return(data.ErrIdentityInUse)
+
+	start := httptest.NewRecorder()
+	h.LinkIdentity(3, start, httptest.NewRequest("POST", "/users/me/identities", nil))
+
+	rw := httptest.NewRecorder()
+	h.Callback(rw, signInWithIssuer(t, start, i))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
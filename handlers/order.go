@@ -1,26 +1,32 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
 	"github.com/hashicorp-demoapp/product-api-go/data"
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
 	"github.com/hashicorp/go-hclog"
 )
 
 // Order -
 type Order struct {
-	con data.Connection
-	log hclog.Logger
+	con    data.Connection
+	log    hclog.Logger
+	pickup pickup.Policy
+	rates  currency.Converter
 }
 
 // NewOrder -
-func NewOrder(con data.Connection, l hclog.Logger) *Order {
-	return &Order{con, l}
+func NewOrder(con data.Connection, l hclog.Logger, p pickup.Policy, rates currency.Converter) *Order {
+	return &Order{con, l, p, rates}
 }
 
 func (c *Order) ServeHTTP(userID int, rw http.ResponseWriter, r *http.Request) {
@@ -32,6 +38,11 @@ func (c *Order) ServeHTTP(userID int, rw http.ResponseWriter, r *http.Request) {
 func (c *Order) GetUserOrders(userID int, rw http.ResponseWriter, r *http.Request) {
 	c.log.Info("Handle Orders | GetUserOrders")
 
+	p, ok := c.pricing(rw, r, "Unable to list orders")
+	if !ok {
+		return
+	}
+
 	orders, err := c.con.GetOrders(userID, nil)
 	if err != nil {
 		c.log.Error("Unable to get order from database", "error", err)
@@ -39,6 +50,13 @@ func (c *Order) GetUserOrders(userID int, rw http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	err = p.orders(orders)
+	if err != nil {
+		c.log.Error("Unable to price orders", "error", err)
+		c.writeError(rw, err, "Unable to list orders")
+		return
+	}
+
 	d, err := orders.ToJSON()
 	if err != nil {
 		c.log.Error("Unable to convert orders to JSON", "error", err)
@@ -46,14 +64,35 @@ func (c *Order) GetUserOrders(userID int, rw http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	rw.Write(d)
+	writeWithETag(rw, r, bodyETag(d), d)
+}
+
+// CreateOrderRequest is the body of a request to create an order, a JSON array
+// of items is also accepted for orders without promotion codes or a pickup
+// time
+type CreateOrderRequest struct {
+	Items          []model.OrderItems `json:"items"`
+	PromotionCodes []string           `json:"promotion_codes"`
+	PickupAt       *time.Time         `json:"pickup_at"`
+	StoreID        *int               `json:"store_id"`
+}
+
+// UnmarshalJSON decodes either a request object or an array of items
+func (o *CreateOrderRequest) UnmarshalJSON(d []byte) error {
+	if t := bytes.TrimSpace(d); len(t) > 0 && t[0] == '[' {
+		return json.Unmarshal(d, &o.Items)
+	}
+
+	type request CreateOrderRequest
+	return json.Unmarshal(d, (*request)(o))
 }
 
-// CreateOrder creates a new order
+// CreateOrder creates a new order, to be collected from store_id at pickup_at
+// when they are set or as soon as possible
 func (c *Order) CreateOrder(userID int, rw http.ResponseWriter, r *http.Request) {
 	c.log.Info("Handle Orders | CreateOrder")
 
-	body := []model.OrderItems{}
+	body := CreateOrderRequest{}
 
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
@@ -62,10 +101,33 @@ func (c *Order) CreateOrder(userID int, rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	order, err := c.con.CreateOrder(userID, body)
+	items, ok := mergeOrderItems(rw, body.Items)
+	if !ok {
+		return
+	}
+
+	slot, err := pickupSlot(c.con, c.pickup, body.StoreID, body.PickupAt)
+	if err != nil {
+		c.writeError(rw, err, "Unable to create new order")
+		return
+	}
+
+	p, ok := c.pricing(rw, r, "Unable to create new order")
+	if !ok {
+		return
+	}
+
+	order, err := c.con.CreateOrder(userID, items, body.PromotionCodes, slot, body.StoreID)
 	if err != nil {
 		c.log.Error("Unable to create new order", "error", err)
-		http.Error(rw, "Unable to create new order", http.StatusInternalServerError)
+		c.writeError(rw, err, "Unable to create new order")
+		return
+	}
+
+	err = p.order(&order)
+	if err != nil {
+		c.log.Error("Unable to price order", "error", err)
+		c.writeError(rw, err, "Unable to create new order")
 		return
 	}
 
@@ -91,6 +153,11 @@ func (c *Order) GetUserOrder(userID int, rw http.ResponseWriter, r *http.Request
 		return
 	}
 
+	p, ok := c.pricing(rw, r, "Unable to list order")
+	if !ok {
+		return
+	}
+
 	orders, err := c.con.GetOrders(userID, &orderID)
 	if err != nil {
 		c.log.Error("Unable to get order from database", "error", err)
@@ -102,6 +169,13 @@ func (c *Order) GetUserOrder(userID int, rw http.ResponseWriter, r *http.Request
 
 	if len(orders) > 0 {
 		order = orders[0]
+
+		err = p.order(&order)
+		if err != nil {
+			c.log.Error("Unable to price order", "error", err)
+			c.writeError(rw, err, "Unable to list order")
+			return
+		}
 	}
 
 	d, err := order.ToJSON()
@@ -111,7 +185,12 @@ func (c *Order) GetUserOrder(userID int, rw http.ResponseWriter, r *http.Request
 		return
 	}
 
-	rw.Write(d)
+	if order.Version == 0 {
+		rw.Write(d)
+		return
+	}
+
+	writeWithETag(rw, r, p.etag(order.Version), d)
 }
 
 // UpdateOrder updates an order
@@ -127,6 +206,16 @@ func (c *Order) UpdateOrder(userID int, rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	p, ok := c.pricing(rw, r, "Unable to update order")
+	if !ok {
+		return
+	}
+
 	body := []model.OrderItems{}
 
 	err = json.NewDecoder(r.Body).Decode(&body)
@@ -136,20 +225,44 @@ func (c *Order) UpdateOrder(userID int, rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	order, err := c.con.UpdateOrder(userID, orderID, body)
+	items, ok := mergeOrderItems(rw, body)
+	if !ok {
+		return
+	}
+
+	order, err := c.con.UpdateOrder(userID, orderID, items, version)
 	if err != nil {
 		c.log.Error("Unable to create new order", "error", err)
-		http.Error(rw, "Unable to update order", http.StatusInternalServerError)
+		c.writeError(rw, err, "Unable to update order")
 		return
 	}
 
-	d, err := order.ToJSON()
-	if err != nil {
-		c.log.Error("Unable to convert order to JSON", "error", err)
-		http.Error(rw, "Unable to update order", http.StatusInternalServerError)
+	c.writeOrder(rw, p, order, "Unable to update order")
+}
+
+// mergeOrderItems merges the items for the same coffee, writing a bad request
+// and returning false when an item does not have a coffee and a quantity of
+// at least 1. Merged quantities are checked again as large quantities can
+// overflow when they are added together.
+func mergeOrderItems(rw http.ResponseWriter, items []model.OrderItems) ([]model.OrderItems, bool) {
+	valid := func(is []model.OrderItems) bool {
+		for _, i := range is {
+			if i.Coffee.ID == 0 || i.Quantity < 1 {
+				return false
+			}
+		}
+
+		return true
 	}
 
-	rw.Write(d)
+	merged := model.MergeOrderItems(items)
+
+	if !valid(items) || !valid(merged) {
+		http.Error(rw, "Item must have a coffee and a quantity of at least 1", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return merged, true
 }
 
 // DeleteOrder deletes a user order
@@ -165,12 +278,225 @@ func (c *Order) DeleteOrder(userID int, rw http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = c.con.DeleteOrder(userID, orderID)
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	err = c.con.DeleteOrder(userID, orderID, version)
 	if err != nil {
 		c.log.Error("Unable to delete order from database", "error", err)
-		http.Error(rw, "Unable to delete order", http.StatusInternalServerError)
+		c.writeError(rw, err, "Unable to delete order")
 		return
 	}
 
 	fmt.Fprintf(rw, "%s", "Deleted order")
 }
+
+// OrderItemUpdate is the body of a request to change an item in an order
+type OrderItemUpdate struct {
+	Quantity int `json:"quantity"`
+}
+
+// AddOrderItem adds an item to an order, if the order already contains the
+// coffee the quantities are combined
+func (c *Order) AddOrderItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Orders | AddOrderItem")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("orderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to add item", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	p, ok := c.pricing(rw, r, "Unable to add item")
+	if !ok {
+		return
+	}
+
+	body := model.OrderItems{}
+
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Coffee.ID == 0 || body.Quantity < 1 {
+		http.Error(rw, "Item must have a coffee and a quantity of at least 1", http.StatusBadRequest)
+		return
+	}
+
+	order, err := c.con.AddOrderItem(userID, orderID, body, version)
+	if err != nil {
+		c.log.Error("Unable to add order item", "error", err)
+		c.writeError(rw, err, "Unable to add item")
+		return
+	}
+
+	c.writeOrder(rw, p, order, "Unable to add item")
+}
+
+// UpdateOrderItem changes the quantity of an item in an order
+func (c *Order) UpdateOrderItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Orders | UpdateOrderItem")
+
+	orderID, itemID, err := orderItemIDs(r)
+	if err != nil {
+		c.log.Error("IDs provided could not be converted to integers", "error", err)
+		http.Error(rw, "Unable to update item", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	p, ok := c.pricing(rw, r, "Unable to update item")
+	if !ok {
+		return
+	}
+
+	body := OrderItemUpdate{}
+
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Quantity < 1 {
+		http.Error(rw, "Quantity must be at least 1, delete the item to remove it", http.StatusBadRequest)
+		return
+	}
+
+	order, err := c.con.UpdateOrderItem(userID, orderID, itemID, body.Quantity, version)
+	if err != nil {
+		c.log.Error("Unable to update order item", "error", err)
+		c.writeError(rw, err, "Unable to update item")
+		return
+	}
+
+	c.writeOrder(rw, p, order, "Unable to update item")
+}
+
+// DeleteOrderItem removes an item from an order
+func (c *Order) DeleteOrderItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Orders | DeleteOrderItem")
+
+	orderID, itemID, err := orderItemIDs(r)
+	if err != nil {
+		c.log.Error("IDs provided could not be converted to integers", "error", err)
+		http.Error(rw, "Unable to delete item", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := ifMatchVersion(rw, r)
+	if !ok {
+		return
+	}
+
+	p, ok := c.pricing(rw, r, "Unable to delete item")
+	if !ok {
+		return
+	}
+
+	order, err := c.con.DeleteOrderItem(userID, orderID, itemID, version)
+	if err != nil {
+		c.log.Error("Unable to delete order item", "error", err)
+		c.writeError(rw, err, "Unable to delete item")
+		return
+	}
+
+	c.writeOrder(rw, p, order, "Unable to delete item")
+}
+
+// orderItemIDs returns the order and item IDs from the path
+func orderItemIDs(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+
+	orderID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	itemID, err := strconv.Atoi(vars["item_id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return orderID, itemID, nil
+}
+
+// pricing returns the pricing for the currency of the request, writing the
+// error response when it can not be used
+func (c *Order) pricing(rw http.ResponseWriter, r *http.Request, message string) (pricing, bool) {
+	p, err := newPricing(c.con, c.rates, rw, r)
+	if err != nil {
+		c.log.Error("Unable to get prices", "error", err)
+		c.writeError(rw, err, message)
+		return p, false
+	}
+
+	return p, true
+}
+
+// writeOrder writes a changed order with its new ETag, priced in the currency
+// of the request
+func (c *Order) writeOrder(rw http.ResponseWriter, p pricing, order model.Order, message string) {
+	err := p.order(&order)
+	if err != nil {
+		c.log.Error("Unable to price order", "error", err)
+		c.writeError(rw, err, message)
+		return
+	}
+
+	d, err := order.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert order to JSON", "error", err)
+		http.Error(rw, message, http.StatusInternalServerError)
+		return
+	}
+
+	if order.Version != 0 {
+		rw.Header().Set("ETag", p.etag(order.Version))
+	}
+	rw.Write(d)
+}
+
+// writeError writes the response for an error changing an order
+func (c *Order) writeError(rw http.ResponseWriter, err error, message string) {
+	if writePromotionError(rw, err) || writePickupError(rw, err) || writeCurrencyError(rw, err) {
+		return
+	}
+
+	switch err {
+	case data.ErrOrderNotFound:
+		http.Error(rw, "Order not found", http.StatusNotFound)
+	case data.ErrOrderItemNotFound:
+		http.Error(rw, "Order item not found", http.StatusNotFound)
+	case data.ErrCoffeeNotFound:
+		http.Error(rw, "Coffee not found", http.StatusBadRequest)
+	case data.ErrCoffeeUnavailable:
+		http.Error(rw, "Coffee is not available at this store", http.StatusBadRequest)
+	case data.ErrStoreNotFound:
+		http.Error(rw, "Store not found", http.StatusBadRequest)
+	case data.ErrVersionMismatch:
+		http.Error(rw, "Order has been changed, get the latest version and try again", http.StatusPreconditionFailed)
+	case data.ErrOrderPaid:
+		http.Error(rw, "Order has been paid for and can not be changed", http.StatusConflict)
+	case data.ErrPaymentInProgress:
+		http.Error(rw, "Order is being paid for and can not be changed", http.StatusConflict)
+	default:
+		http.Error(rw, message, http.StatusInternalServerError)
+	}
+}
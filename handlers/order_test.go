@@ -8,12 +8,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hashicorp-demoapp/product-api-go/data"
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func setupOrderHandler(t *testing.T) (*Order, *httptest.ResponseRecorder) {
@@ -46,7 +49,7 @@ func setupOrderHandler(t *testing.T) (*Order, *httptest.ResponseRecorder) {
 
 	l := hclog.Default()
 
-	return &Order{c, l}, httptest.NewRecorder()
+	return &Order{c, l, pickup.Policy{}, testRates}, httptest.NewRecorder()
 }
 
 func setupFailedOrderHandler(t *testing.T) (*Order, *httptest.ResponseRecorder) {
@@ -59,7 +62,7 @@ func setupFailedOrderHandler(t *testing.T) (*Order, *httptest.ResponseRecorder)
 
 	l := hclog.Default()
 
-	return &Order{c, l}, httptest.NewRecorder()
+	return &Order{c, l, pickup.Policy{}, testRates}, httptest.NewRecorder()
 }
 
 // TestReturnsOrders - Tests success criteria
@@ -263,3 +266,232 @@ func TestUnableToDelete(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rw.Code)
 	assert.Equal(t, "Unable to delete order\n", string(rw.Body.Bytes()))
 }
+
+func setupVersionedOrderHandler(t *testing.T) (*Order, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("GetOrders").Return(model.Orders{{ID: 1, Version: 3}}, nil)
+
+	return &Order{c, hclog.Default(), pickup.Policy{}, testRates}, c, httptest.NewRecorder()
+}
+
+func TestGetUserOrderReturnsVersionETag(t *testing.T) {
+	c, _, rw := setupVersionedOrderHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/orders/1", nil), map[string]string{"id": "1"})
+	c.GetUserOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"3-USD"`, rw.Header().Get("ETag"))
+}
+
+func TestGetUserOrderETagDependsOnCurrencyAndLanguage(t *testing.T) {
+	c, _, rw := setupVersionedOrderHandler(t)
+	c.con.(*data.MockConnection).On("GetPriceList", "EUR").Return(model.CoffeePrices{}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/orders/1?currency=EUR", nil), map[string]string{"id": "1"})
+	r.Header.Set("Accept-Language", "de-DE")
+	r.Header.Set("If-None-Match", `"3-USD"`)
+	c.GetUserOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"3-EUR-de"`, rw.Header().Get("ETag"))
+}
+
+func TestUpdateOrderAcceptsPricedETag(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("UpdateOrder").Return(model.Order{ID: 1, Version: 4}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/orders/1", strings.NewReader(`[]`)), map[string]string{"id": "1"})
+	r.Header.Set("If-Match", `"3-EUR-de"`)
+	c.UpdateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "UpdateOrder")
+}
+
+func TestUpdateOrderReturnsPreconditionFailedForOldVersion(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("UpdateOrder").Return(nil, data.ErrVersionMismatch)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/orders/1", strings.NewReader(`[]`)), map[string]string{"id": "1"})
+	r.Header.Set("If-Match", `"2"`)
+	c.UpdateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+}
+
+func TestUpdateOrderRejectsWeakIfMatch(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/orders/1", strings.NewReader(`[]`)), map[string]string{"id": "1"})
+	r.Header.Set("If-Match", `W/"3"`)
+	c.UpdateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "UpdateOrder")
+}
+
+func TestUpdateOrderRequiresIfMatchWhenConfigured(t *testing.T) {
+	SetRequireIfMatch(true)
+	defer SetRequireIfMatch(false)
+
+	c, con, rw := setupVersionedOrderHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/orders/1", strings.NewReader(`[]`)), map[string]string{"id": "1"})
+	c.UpdateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusPreconditionRequired, rw.Code)
+	con.AssertNotCalled(t, "UpdateOrder")
+}
+
+func TestUpdateOrderReturnsNewETag(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("UpdateOrder").Return(model.Order{ID: 1, Version: 4}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/orders/1", strings.NewReader(`[]`)), map[string]string{"id": "1"})
+	r.Header.Set("If-Match", `"3"`)
+	c.UpdateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"4-USD"`, rw.Header().Get("ETag"))
+}
+
+func TestDeleteOrderReturnsNotFoundForMissingOrder(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("DeleteOrder").Return(data.ErrOrderNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/orders/9", nil), map[string]string{"id": "9"})
+	c.DeleteOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestAddOrderItemAddsItem(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("AddOrderItem", 1, 5, mock.Anything, mock.Anything).Return(model.Order{ID: 5, Version: 2, Items: []model.OrderItems{{ID: 9, Quantity: 2}}}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/orders/5/items", strings.NewReader(`{"coffee":{"id":3},"quantity":2}`)), map[string]string{"id": "5"})
+	c.AddOrderItem(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"2-USD"`, rw.Header().Get("ETag"))
+	assert.Contains(t, rw.Body.String(), `"id":9`)
+	con.AssertCalled(t, "AddOrderItem", 1, 5, mock.MatchedBy(func(i model.OrderItems) bool {
+		return i.Coffee.ID == 3 && i.Quantity == 2
+	}), (*int)(nil))
+}
+
+func TestAddOrderItemRejectsInvalidQuantity(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/orders/5/items", strings.NewReader(`{"coffee":{"id":3},"quantity":0}`)), map[string]string{"id": "5"})
+	c.AddOrderItem(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "AddOrderItem", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateOrderItemChangesQuantity(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("UpdateOrderItem", 1, 5, 9, 4, mock.Anything).Return(model.Order{ID: 5, Version: 3}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("PATCH", "/orders/5/items/9", strings.NewReader(`{"quantity":4}`)), map[string]string{"id": "5", "item_id": "9"})
+	r.Header.Set("If-Match", `"2"`)
+	c.UpdateOrderItem(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "UpdateOrderItem", 1, 5, 9, 4, mock.MatchedBy(func(v *int) bool { return v != nil && *v == 2 }))
+}
+
+func TestDeleteOrderItemReturnsNotFoundForMissingItem(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("DeleteOrderItem", 1, 5, 9, mock.Anything).Return(nil, data.ErrOrderItemNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/orders/5/items/9", nil), map[string]string{"id": "5", "item_id": "9"})
+	c.DeleteOrderItem(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestCreateOrderRequestAcceptsItemsOrObject(t *testing.T) {
+	a := CreateOrderRequest{}
+	assert.NoError(t, json.Unmarshal([]byte(` [{"coffee":{"id":1},"quantity":2}]`), &a))
+	assert.Len(t, a.Items, 1)
+	assert.Empty(t, a.PromotionCodes)
+
+	o := CreateOrderRequest{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"items":[{"coffee":{"id":1},"quantity":2}],"promotion_codes":["TEN"]}`), &o))
+	assert.Len(t, o.Items, 1)
+	assert.Equal(t, []string{"TEN"}, o.PromotionCodes)
+}
+
+func TestCreateOrderRejectsPickupWhenClosed(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	c.pickup = pickup.Policy{Hours: pickup.Hours{}}
+
+	at := time.Now().Add(time.Hour).Format(time.RFC3339)
+	c.CreateOrder(1, rw, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"items":[],"pickup_at":"`+at+`"}`)))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	con.AssertNotCalled(t, "CreateOrder")
+}
+
+func TestCreateOrderReturnsConflictWhenPickupSlotFull(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("CreateOrder").Return(nil, data.ErrPickupSlotFull)
+
+	at := time.Now().Add(time.Hour).Format(time.RFC3339)
+	c.CreateOrder(1, rw, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"items":[],"pickup_at":"`+at+`"}`)))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestCreateOrderUsesStoreOpeningHours(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("GetStore", 2).Return(model.Store{ID: 2, Hours: "", Timezone: "UTC"}, nil)
+	con.On("CreateOrder").Return(model.Order{ID: 5}, nil)
+
+	// the default policy is always closed but the store is always open
+	c.pickup = pickup.Policy{Hours: pickup.Hours{}}
+
+	at := time.Now().Add(time.Hour).Format(time.RFC3339)
+	c.CreateOrder(1, rw, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"items":[],"store_id":2,"pickup_at":"`+at+`"}`)))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestCreateOrderRejectsUnknownStore(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("GetStore", 9).Return(nil, data.ErrStoreNotFound)
+
+	c.CreateOrder(1, rw, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"items":[],"store_id":9}`)))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "CreateOrder")
+}
+
+func TestCreateOrderRejectsInvalidQuantities(t *testing.T) {
+	for _, items := range []string{
+		`[{"coffee":{"id":1},"quantity":0}]`,
+		`[{"coffee":{"id":1},"quantity":-1},{"coffee":{"id":2},"quantity":3}]`,
+		`[{"coffee":{"id":0},"quantity":1}]`,
+		`[{"coffee":{"id":1},"quantity":9223372036854775807},{"coffee":{"id":1},"quantity":1}]`,
+	} {
+		c, rw := setupOrderHandler(t)
+
+		c.CreateOrder(1, rw, httptest.NewRequest("POST", "/orders", strings.NewReader(items)))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code, items)
+		c.con.(*data.MockConnection).AssertNotCalled(t, "CreateOrder")
+	}
+}
+
+func TestUpdateOrderRejectsInvalidQuantities(t *testing.T) {
+	c, rw := setupOrderHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/orders/1", strings.NewReader(`[{"coffee":{"id":1},"quantity":2},{"coffee":{"id":1},"quantity":-2}]`)), map[string]string{"id": "1"})
+	c.UpdateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	c.con.(*data.MockConnection).AssertNotCalled(t, "UpdateOrder")
+}
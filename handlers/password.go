@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/lockout"
+	"github.com/hashicorp-demoapp/product-api-go/notify"
+	"github.com/hashicorp-demoapp/product-api-go/password"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Password is a HTTP Handler for changing and resetting passwords
+type Password struct {
+	con      data.Connection
+	log      hclog.Logger
+	guard    *lockout.Guard
+	policy   *password.Policy
+	notifier notify.Notifier
+	resetTTL time.Duration
+	// resets are the usernames waiting for a reset token, they are sent one
+	// at a time by sendResets
+	resets  chan string
+	sending sync.WaitGroup
+}
+
+// resetQueueSize is the number of reset requests which can wait to be sent,
+// requests are dropped when the queue is full
+const resetQueueSize = 100
+
+// ChangePasswordRequest is the body of a request to change a password
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// ResetRequest is the body of a request for a password reset token
+type ResetRequest struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest is the body of a request to reset a password using a token
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// NewPassword creates a Password handler, old passwords are checked with the
+// sign in guard and new passwords against the policy when they are not nil.
+// Reset tokens are sent using the notifier in the background until Close is
+// called and expire after resetTTL.
+func NewPassword(con data.Connection, l hclog.Logger, guard *lockout.Guard, p *password.Policy, n notify.Notifier, resetTTL time.Duration) *Password {
+	c := &Password{con: con, log: l, guard: guard, policy: p, notifier: n, resetTTL: resetTTL, resets: make(chan string, resetQueueSize)}
+
+	c.sending.Add(1)
+	go c.sendResets()
+
+	return c
+}
+
+// Close stops sending reset tokens once the requests which are waiting have
+// been sent, the handler must not be used after it is closed
+func (c *Password) Close() {
+	close(c.resets)
+	c.sending.Wait()
+}
+
+func (c *Password) sendResets() {
+	defer c.sending.Done()
+
+	for username := range c.resets {
+		if err := c.sendReset(username); err != nil {
+			c.log.Error("Unable to send password reset", "error", err)
+		}
+	}
+}
+
+// ChangePassword changes the password of the signed in user, the old password
+// must be given and all other tokens for the user are revoked
+func (c *Password) ChangePassword(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Password | change")
+
+	body := ChangePasswordRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := c.con.GetUser(userID)
+	if err != nil {
+		c.log.Error("Unable to get user", "error", err)
+		http.Error(rw, "Unable to change password", http.StatusInternalServerError)
+		return
+	}
+
+	// the old password is limited the same way as sign in so a stolen token
+	// can not be used to guess it
+	ip := clientIP(r)
+	if !signInAllowed(c.log, c.guard, u.Username, ip, rw) {
+		return
+	}
+
+	if _, err := c.con.AuthUser(u.Username, body.OldPassword); err != nil {
+		c.log.Error("Unable to verify old password", "error", err)
+
+		if errors.Is(err, data.ErrInvalidCredentials) {
+			signInFailed(c.con, c.log, c.guard, u.Username, ip)
+		}
+
+		http.Error(rw, "Invalid Credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if c.guard != nil {
+		if err := c.guard.Success(u.Username); err != nil {
+			c.log.Error("Unable to clear failed sign in attempts", "error", err)
+		}
+	}
+
+	if c.policy != nil {
+		if err := c.policy.Validate(u.Username, body.NewPassword); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tokenID, _ := TokenID(r)
+	if err := c.con.ChangePassword(userID, tokenID, body.NewPassword); err != nil {
+		c.log.Error("Unable to change password", "error", err)
+		http.Error(rw, "Unable to change password", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(rw, "%s", "Password changed")
+}
+
+// RequestReset sends a password reset token to the user, the response is the
+// same whether or not the user exists so usernames can not be discovered. The
+// token is sent after responding so the response time does not depend on
+// whether there was a user to send it to.
+func (c *Password) RequestReset(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Password | request reset")
+
+	body := ResetRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case c.resets <- body.Username:
+	default:
+		c.log.Error("Unable to send password reset, too many resets are waiting")
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(rw, "%s", "If the account exists a password reset token has been sent")
+}
+
+func (c *Password) sendReset(username string) error {
+	u, err := c.con.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	token, hash, err := password.NewResetToken()
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(c.resetTTL)
+	if err := c.con.CreatePasswordReset(u.ID, hash, expires); err != nil {
+		return err
+	}
+
+	return c.notifier.Send(notify.Message{
+		To:      u.Username,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Use the token %s to reset your password, it can be used once and expires at %s. If you did not request a reset you can ignore this message.",
+			token, expires.UTC().Format(time.RFC3339),
+		),
+	})
+}
+
+// ResetPassword sets a new password using a reset token, the token can only
+// be used once and all tokens for the user are revoked
+func (c *Password) ResetPassword(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Password | reset")
+
+	body := ResetPasswordRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	// the username is not known until the token is used so it is not checked
+	if c.policy != nil {
+		if err := c.policy.Validate("", body.NewPassword); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, err = c.con.ResetPassword(password.HashResetToken(body.Token), body.NewPassword)
+	if err != nil {
+		c.log.Error("Unable to reset password", "error", err)
+
+		if errors.Is(err, data.ErrInvalidResetToken) {
+			http.Error(rw, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+
+		http.Error(rw, "Unable to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(rw, "%s", "Password reset")
+}
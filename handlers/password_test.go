@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/lockout"
+	"github.com/hashicorp-demoapp/product-api-go/notify"
+	"github.com/hashicorp-demoapp/product-api-go/password"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testNotifier struct {
+	messages []notify.Message
+}
+
+func (n *testNotifier) Send(m notify.Message) error {
+	n.messages = append(n.messages, m)
+	return nil
+}
+
+func setupPasswordHandler(t *testing.T) (*Password, *data.MockConnection, *testNotifier) {
+	c := &data.MockConnection{}
+	n := &testNotifier{}
+
+	g := lockout.NewGuard(
+		lockout.NewMemoryStore(),
+		lockout.Policy{MaxAttempts: 2, Lockout: time.Minute},
+		lockout.Policy{MaxAttempts: 5, Lockout: time.Minute},
+	)
+
+	return NewPassword(c, hclog.Default(), g, password.NewPolicy(8, 72), n, time.Hour), c, n
+}
+
+func TestChangePasswordRevokesOtherTokens(t *testing.T) {
+	p, c, _ := setupPasswordHandler(t)
+	c.On("GetUser").Return(model.User{ID: 1, Username: "User1"}, nil)
+	c.On("AuthUser").Return(model.User{ID: 1, Username: "User1"}, nil)
+	c.On("ChangePassword", 1, 2, "new password").Return(nil)
+
+	r := httptest.NewRequest("PUT", "/users/me/password", strings.NewReader(`{"old_password": "old password", "new_password": "new password"}`))
+	r = r.WithContext(context.WithValue(r.Context(), tokenIDKey, 2))
+	rw := httptest.NewRecorder()
+
+	p.ChangePassword(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	c.AssertCalled(t, "ChangePassword", 1, 2, "new password")
+}
+
+func TestChangePasswordRequiresOldPassword(t *testing.T) {
+	p, c, _ := setupPasswordHandler(t)
+	c.On("GetUser").Return(model.User{ID: 1, Username: "User1"}, nil)
+	c.On("AuthUser").Return(nil, data.ErrInvalidCredentials)
+
+	r := httptest.NewRequest("PUT", "/users/me/password", strings.NewReader(`{"old_password": "wrong", "new_password": "new password"}`))
+	rw := httptest.NewRecorder()
+
+	p.ChangePassword(1, rw, r)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	c.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestChangePasswordLocksAfterFailedAttempts(t *testing.T) {
+	p, c, _ := setupPasswordHandler(t)
+	c.On("GetUser").Return(model.User{ID: 1, Username: "User1"}, nil)
+	c.On("AuthUser").Return(nil, data.ErrInvalidCredentials)
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	for i := 0; i < 2; i++ {
+		rw := httptest.NewRecorder()
+		p.ChangePassword(1, rw, httptest.NewRequest("PUT", "/users/me/password", strings.NewReader(`{"old_password": "wrong", "new_password": "new password"}`)))
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	}
+
+	rw := httptest.NewRecorder()
+	p.ChangePassword(1, rw, httptest.NewRequest("PUT", "/users/me/password", strings.NewReader(`{"old_password": "old password", "new_password": "new password"}`)))
+
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	c.AssertNumberOfCalls(t, "AuthUser", 2)
+	c.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditUserLocked && e.Subject == "User1"
+	}))
+}
+
+func TestChangePasswordValidatesPolicy(t *testing.T) {
+	p, c, _ := setupPasswordHandler(t)
+	c.On("GetUser").Return(model.User{ID: 1, Username: "User1"}, nil)
+	c.On("AuthUser").Return(model.User{ID: 1, Username: "User1"}, nil)
+
+	r := httptest.NewRequest("PUT", "/users/me/password", strings.NewReader(`{"old_password": "old password", "new_password": "short"}`))
+	rw := httptest.NewRecorder()
+
+	p.ChangePassword(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestRequestResetSendsToken(t *testing.T) {
+	p, c, n := setupPasswordHandler(t)
+	c.On("GetUserByUsername").Return(model.User{ID: 1, Username: "User1"}, nil)
+	c.On("CreatePasswordReset", 1, mock.Anything).Return(nil)
+
+	rw := httptest.NewRecorder()
+	p.RequestReset(rw, httptest.NewRequest("POST", "/password/reset", strings.NewReader(`{"username": "User1"}`)))
+	p.Close()
+
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+	assert.Len(t, n.messages, 1)
+	assert.Equal(t, "User1", n.messages[0].To)
+
+	// only the hash of the token sent to the user is stored
+	hash := c.Calls[1].Arguments.String(1)
+	assert.NotContains(t, n.messages[0].Body, hash)
+}
+
+func TestRequestResetHidesUnknownUsers(t *testing.T) {
+	p, c, n := setupPasswordHandler(t)
+	c.On("GetUserByUsername").Return(nil, errors.New("User does not exist"))
+
+	rw := httptest.NewRecorder()
+	p.RequestReset(rw, httptest.NewRequest("POST", "/password/reset", strings.NewReader(`{"username": "nobody"}`)))
+	p.Close()
+
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+	assert.Len(t, n.messages, 0)
+}
+
+func TestResetPasswordUsesHashedToken(t *testing.T) {
+	p, c, _ := setupPasswordHandler(t)
+	c.On("ResetPassword", password.HashResetToken("abc"), "new password").Return(1, nil)
+
+	rw := httptest.NewRecorder()
+	p.ResetPassword(rw, httptest.NewRequest("POST", "/password/reset/confirm", strings.NewReader(`{"token": "abc", "new_password": "new password"}`)))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestResetPasswordRejectsInvalidToken(t *testing.T) {
+	p, c, _ := setupPasswordHandler(t)
+	c.On("ResetPassword", mock.Anything, mock.Anything).Return(nil, data.ErrInvalidResetToken)
+
+	rw := httptest.NewRecorder()
+	p.ResetPassword(rw, httptest.NewRequest("POST", "/password/reset/confirm", strings.NewReader(`{"token": "used", "new_password": "new password"}`)))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Invalid or expired reset token\n", rw.Body.String())
+}
+
+func TestResetPasswordWithoutPolicy(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("ResetPassword", password.HashResetToken("abc"), "short").Return(1, nil)
+
+	p := NewPassword(c, hclog.Default(), nil, nil, &testNotifier{}, time.Hour)
+	defer p.Close()
+
+	rw := httptest.NewRecorder()
+	p.ResetPassword(rw, httptest.NewRequest("POST", "/password/reset/confirm", strings.NewReader(`{"token": "abc", "new_password": "short"}`)))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
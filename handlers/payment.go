@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/payments"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxWebhookSize is the largest webhook body which is read
+const maxWebhookSize = 1 << 20
+
+// Payment is a HTTP Handler for paying for orders
+type Payment struct {
+	con      data.Connection
+	log      hclog.Logger
+	provider payments.Provider
+}
+
+// PayOrderRequest is the body of a request to pay for an order
+type PayOrderRequest struct {
+	// PaymentMethod is the provider's token for how the customer is paying
+	PaymentMethod string `json:"payment_method"`
+}
+
+// NewPayment creates a Payment handler which takes payments with the provider
+func NewPayment(con data.Connection, l hclog.Logger, p payments.Provider) *Payment {
+	return &Payment{con, l, p}
+}
+
+// PayOrder pays for an order. Payments the provider approves straight away
+// are captured and return 200, payments which need more time return 202 and
+// are completed by a webhook. Declined payments return 402 and can be retried
+// with another payment method.
+func (c *Payment) PayOrder(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Payment | PayOrder")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("orderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to pay for order", http.StatusBadRequest)
+		return
+	}
+
+	body := PayOrderRequest{}
+
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.PaymentMethod == "" {
+		http.Error(rw, "payment_method is required", http.StatusBadRequest)
+		return
+	}
+
+	p, err := c.con.CreatePayment(userID, orderID, c.provider.Name())
+	if err != nil {
+		c.log.Error("Unable to create payment", "error", err)
+		c.writeError(rw, err, "Unable to pay for order")
+		return
+	}
+
+	res, err := c.provider.Authorize(r.Context(), payments.Request{ID: strconv.Itoa(p.ID), Amount: p.Amount, Method: body.PaymentMethod})
+	if err == nil && res.Status == payments.StatusAuthorized {
+		res, err = c.provider.Capture(r.Context(), res.Reference, p.Amount)
+	}
+
+	de := &payments.DeclineError{}
+
+	switch {
+	case errors.As(err, &de):
+		p.Status = model.PaymentDeclined
+		p.FailureReason = de.Reason
+		c.update(rw, p, model.PaymentStarted, http.StatusPaymentRequired)
+	case err != nil:
+		c.log.Error("Unable to take payment", "provider", c.provider.Name(), "error", err)
+		p.Status = model.PaymentFailed
+		p.FailureReason = "provider_error"
+		c.update(rw, p, model.PaymentStarted, http.StatusBadGateway)
+	case res.Status == payments.StatusPending:
+		p.Status = model.PaymentPending
+		p.Reference = res.Reference
+		c.update(rw, p, model.PaymentStarted, http.StatusAccepted)
+	default:
+		p.Status = model.PaymentCaptured
+		p.Reference = res.Reference
+		c.update(rw, p, model.PaymentStarted, http.StatusOK)
+	}
+}
+
+// ListPayments returns the payments for an order of the signed in user
+func (c *Payment) ListPayments(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Payment | ListPayments")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("orderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to list payments", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := c.con.GetOrders(userID, &orderID)
+	if err != nil {
+		c.log.Error("Unable to get order from database", "error", err)
+		http.Error(rw, "Unable to list payments", http.StatusInternalServerError)
+		return
+	}
+
+	if len(orders) < 1 {
+		http.Error(rw, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	ps, err := c.con.GetPayments(orderID)
+	if err != nil {
+		c.log.Error("Unable to list payments", "error", err)
+		http.Error(rw, "Unable to list payments", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ps.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert payments to JSON", "error", err)
+		http.Error(rw, "Unable to list payments", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// RefundOrder refunds the payment for an order, it can only be called by
+// admins
+func (c *Payment) RefundOrder(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Payment | RefundOrder")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("orderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to refund order", http.StatusBadRequest)
+		return
+	}
+
+	ps, err := c.con.GetPayments(orderID)
+	if err != nil {
+		c.log.Error("Unable to list payments", "error", err)
+		http.Error(rw, "Unable to refund order", http.StatusInternalServerError)
+		return
+	}
+
+	var p *model.Payment
+	for i := range ps {
+		if ps[i].Status == model.PaymentCaptured {
+			p = &ps[i]
+		}
+	}
+
+	if p == nil {
+		http.Error(rw, "Order has not been paid for", http.StatusConflict)
+		return
+	}
+
+	// the payment is claimed before the provider is called so concurrent
+	// refunds only refund it once
+	claim := *p
+	claim.Status = model.PaymentRefunding
+
+	_, err = c.con.UpdatePayment(claim, model.PaymentCaptured)
+	if err == data.ErrPaymentChanged {
+		http.Error(rw, "Payment has changed", http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to update payment", "error", err)
+		http.Error(rw, "Unable to refund order", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = c.provider.Refund(r.Context(), p.Reference, p.Amount)
+	if err != nil {
+		c.log.Error("Unable to refund payment", "provider", c.provider.Name(), "error", err)
+
+		if _, err := c.con.UpdatePayment(*p, model.PaymentRefunding); err != nil {
+			c.log.Error("Unable to release payment after failed refund", "payment_id", p.ID, "error", err)
+		}
+
+		http.Error(rw, "Unable to refund order", http.StatusBadGateway)
+		return
+	}
+
+	p.Status = model.PaymentRefunded
+	c.update(rw, *p, model.PaymentRefunding, http.StatusOK)
+
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  model.AuditPaymentRefunded,
+		Subject: strconv.Itoa(p.ID),
+		IP:      clientIP(r),
+	}
+
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
+
+// Webhook receives changes to payments from the provider, requests which are
+// not signed by the provider are rejected
+func (c *Payment) Webhook(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Payment | Webhook")
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(rw, "Unable to read request body", http.StatusBadRequest)
+		return
+	}
+
+	e, err := c.provider.VerifyWebhook(r.Header, body)
+	if err == payments.ErrInvalidSignature {
+		http.Error(rw, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to parse webhook", "error", err)
+		http.Error(rw, "Unable to parse webhook", http.StatusBadRequest)
+		return
+	}
+
+	p, err := c.con.GetPaymentByReference(c.provider.Name(), e.Reference)
+	if err == data.ErrPaymentNotFound {
+		http.Error(rw, "Payment not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to get payment", "error", err)
+		http.Error(rw, "Unable to handle webhook", http.StatusInternalServerError)
+		return
+	}
+
+	// webhooks can arrive more than once and out of order, only payments
+	// which are in progress can succeed or fail
+	from := p.Status
+
+	switch {
+	case e.Type == payments.EventRefunded && (p.Status == model.PaymentCaptured || p.Status == model.PaymentRefunding):
+		p.Status = model.PaymentRefunded
+	case e.Type == payments.EventCaptured && p.InProgress():
+		p.Status = model.PaymentCaptured
+	case e.Type == payments.EventAuthorized && p.InProgress():
+		_, err = c.provider.Capture(r.Context(), p.Reference, p.Amount)
+		if err != nil {
+			c.log.Error("Unable to capture payment", "provider", c.provider.Name(), "error", err)
+			http.Error(rw, "Unable to capture payment", http.StatusBadGateway)
+			return
+		}
+
+		p.Status = model.PaymentCaptured
+	case e.Type == payments.EventFailed && p.InProgress():
+		p.Status = model.PaymentDeclined
+		p.FailureReason = e.Reason
+	default:
+		c.log.Info("Ignoring webhook", "type", e.Type, "status", p.Status)
+		return
+	}
+
+	// the payment may have changed since it was read, e.g. by a refund
+	_, err = c.con.UpdatePayment(p, from)
+	if err == data.ErrPaymentChanged {
+		c.log.Info("Ignoring webhook for changed payment", "type", e.Type, "status", from)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to update payment", "error", err)
+		http.Error(rw, "Unable to handle webhook", http.StatusInternalServerError)
+		return
+	}
+}
+
+// update saves the result of a payment which had the status from and writes
+// it with the status code. When the payment has changed since then it is only
+// written if it already has the new status.
+func (c *Payment) update(rw http.ResponseWriter, p model.Payment, from string, code int) {
+	status := p.Status
+
+	p, err := c.con.UpdatePayment(p, from)
+	if err == data.ErrPaymentChanged && p.Status != status {
+		c.log.Error("Unable to update changed payment", "payment_id", p.ID, "status", p.Status, "result", status)
+		http.Error(rw, "Payment has changed", http.StatusConflict)
+		return
+	}
+
+	if err != nil && err != data.ErrPaymentChanged {
+		c.log.Error("Unable to update payment", "error", err)
+		http.Error(rw, "Unable to update payment", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := p.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert payment to JSON", "error", err)
+		http.Error(rw, "Unable to update payment", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	rw.Write(d)
+}
+
+// writeError writes the response for an error starting a payment
+func (c *Payment) writeError(rw http.ResponseWriter, err error, message string) {
+	switch err {
+	case data.ErrOrderNotFound:
+		http.Error(rw, "Order not found", http.StatusNotFound)
+	case data.ErrOrderPaid:
+		http.Error(rw, "Order has already been paid for", http.StatusConflict)
+	case data.ErrPaymentInProgress:
+		http.Error(rw, "Order is already being paid for", http.StatusConflict)
+	case data.ErrPickupSlotFull:
+		http.Error(rw, "Pickup slot is full, choose another time", http.StatusConflict)
+	default:
+		http.Error(rw, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/payments"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupPaymentHandler(t *testing.T) (*Payment, *data.MockConnection, chan []byte, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("CreatePayment", 1, 5, "fake").Return(model.Payment{ID: 9, OrderID: 5, Provider: "fake", Amount: 550, Status: model.PaymentStarted}, nil)
+	c.On("UpdatePayment", mock.Anything, mock.Anything).Return(model.Payment{ID: 9, OrderID: 5}, nil)
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	sent := make(chan []byte, 1)
+	p := payments.NewFake("secret", time.Millisecond, func(h http.Header, body []byte) {
+		sent <- append([]byte(h.Get(payments.FakeSignatureHeader)+"\n"), body...)
+	})
+
+	return NewPayment(c, hclog.Default(), p), c, sent, httptest.NewRecorder()
+}
+
+func payRequest(method string) *http.Request {
+	r := httptest.NewRequest("POST", "/orders/5/pay", strings.NewReader(`{"payment_method":"`+method+`"}`))
+	return mux.SetURLVars(r, map[string]string{"id": "5"})
+}
+
+func TestPayOrderCapturesPayment(t *testing.T) {
+	c, con, _, rw := setupPaymentHandler(t)
+
+	c.PayOrder(1, rw, payRequest(payments.FakeMethodOK))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "UpdatePayment", mock.MatchedBy(func(p model.Payment) bool {
+		return p.ID == 9 && p.Status == model.PaymentCaptured && p.Reference == "fake_pay_1"
+	}), model.PaymentStarted)
+}
+
+func TestPayOrderReturnsPaymentRequiredWhenDeclined(t *testing.T) {
+	c, con, _, rw := setupPaymentHandler(t)
+
+	c.PayOrder(1, rw, payRequest(payments.FakeMethodDeclined))
+
+	assert.Equal(t, http.StatusPaymentRequired, rw.Code)
+	con.AssertCalled(t, "UpdatePayment", mock.MatchedBy(func(p model.Payment) bool {
+		return p.Status == model.PaymentDeclined && p.FailureReason == "card_declined"
+	}), model.PaymentStarted)
+}
+
+func TestPayOrderReturnsConflictWhenPaid(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("CreatePayment", 1, 5, "fake").Return(nil, data.ErrOrderPaid)
+	c := NewPayment(con, hclog.Default(), payments.NewFake("secret", time.Millisecond, nil))
+	rw := httptest.NewRecorder()
+
+	c.PayOrder(1, rw, payRequest(payments.FakeMethodOK))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestPayOrderReturnsConflictWhenPickupSlotIsFull(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("CreatePayment", 1, 5, "fake").Return(nil, data.ErrPickupSlotFull)
+	c := NewPayment(con, hclog.Default(), payments.NewFake("secret", time.Millisecond, nil))
+	rw := httptest.NewRecorder()
+
+	c.PayOrder(1, rw, payRequest(payments.FakeMethodOK))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Equal(t, "Pickup slot is full, choose another time\n", rw.Body.String())
+}
+
+func TestDelayedPaymentIsCompletedByWebhook(t *testing.T) {
+	c, con, sent, rw := setupPaymentHandler(t)
+
+	c.PayOrder(1, rw, payRequest(payments.FakeMethodDelayed))
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+
+	var w []byte
+	select {
+	case w = <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not sent")
+	}
+
+	parts := strings.SplitN(string(w), "\n", 2)
+	con.On("GetPaymentByReference", "fake", "fake_pay_1").Return(model.Payment{ID: 9, Reference: "fake_pay_1", Amount: 550, Status: model.PaymentPending}, nil)
+
+	r := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(parts[1]))
+	r.Header.Set(payments.FakeSignatureHeader, parts[0])
+	rw = httptest.NewRecorder()
+	c.Webhook(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "UpdatePayment", mock.MatchedBy(func(p model.Payment) bool {
+		return p.ID == 9 && p.Status == model.PaymentCaptured
+	}), model.PaymentPending)
+}
+
+func TestWebhookIgnoresPaymentChangedSinceRead(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("GetPaymentByReference", "fake", "fake_pay_1").Return(model.Payment{ID: 9, Reference: "fake_pay_1", Status: model.PaymentPending}, nil)
+	con.On("UpdatePayment", mock.Anything, model.PaymentPending).Return(model.Payment{ID: 9, Status: model.PaymentRefunded}, data.ErrPaymentChanged)
+
+	sent := make(chan []byte, 1)
+	p := payments.NewFake("secret", time.Millisecond, func(h http.Header, body []byte) {
+		sent <- append([]byte(h.Get(payments.FakeSignatureHeader)+"\n"), body...)
+	})
+	c := NewPayment(con, hclog.Default(), p)
+
+	_, err := p.Authorize(context.Background(), payments.Request{ID: "9", Amount: 550, Method: payments.FakeMethodDelayed})
+	assert.NoError(t, err)
+
+	var w []byte
+	select {
+	case w = <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not sent")
+	}
+
+	parts := strings.SplitN(string(w), "\n", 2)
+	r := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(parts[1]))
+	r.Header.Set(payments.FakeSignatureHeader, parts[0])
+	rw := httptest.NewRecorder()
+	c.Webhook(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestPayOrderReturnsConflictWhenPaymentChanged(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("CreatePayment", 1, 5, "fake").Return(model.Payment{ID: 9, OrderID: 5, Amount: 550, Status: model.PaymentStarted}, nil)
+	con.On("UpdatePayment", mock.Anything, model.PaymentStarted).Return(model.Payment{ID: 9, Status: model.PaymentFailed}, data.ErrPaymentChanged)
+	c := NewPayment(con, hclog.Default(), payments.NewFake("secret", time.Millisecond, nil))
+	rw := httptest.NewRecorder()
+
+	c.PayOrder(1, rw, payRequest(payments.FakeMethodOK))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	c, _, _, rw := setupPaymentHandler(t)
+
+	r := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(`{"type":"payment.captured","reference":"fake_pay_1"}`))
+	r.Header.Set(payments.FakeSignatureHeader, hex.EncodeToString([]byte("forged")))
+	c.Webhook(rw, r)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestRefundOrderRequiresCapturedPayment(t *testing.T) {
+	c, con, _, rw := setupPaymentHandler(t)
+	con.On("GetPayments", 5).Return(model.Payments{{ID: 9, Status: model.PaymentDeclined}}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/orders/5/refund", nil), map[string]string{"id": "5"})
+	c.RefundOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestRefundOrderDoesNotCallProviderWhenPaymentAlreadyClaimed(t *testing.T) {
+	con := &data.MockConnection{}
+	con.On("GetPayments", 5).Return(model.Payments{{ID: 9, Reference: "fake_pay_1", Amount: 550, Status: model.PaymentCaptured}}, nil)
+	con.On("UpdatePayment", mock.Anything, model.PaymentCaptured).Return(model.Payment{ID: 9, Status: model.PaymentRefunding}, data.ErrPaymentChanged)
+	c := NewPayment(con, hclog.Default(), payments.NewFake("secret", time.Millisecond, nil))
+	rw := httptest.NewRecorder()
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/orders/5/refund", nil), map[string]string{"id": "5"})
+	c.RefundOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	con.AssertNumberOfCalls(t, "UpdatePayment", 1)
+}
+
+func TestRefundOrderReleasesClaimWhenProviderFails(t *testing.T) {
+	c, con, _, rw := setupPaymentHandler(t)
+	con.On("GetPayments", 5).Return(model.Payments{{ID: 9, Reference: "fake_pay_unknown", Amount: 550, Status: model.PaymentCaptured}}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/orders/5/refund", nil), map[string]string{"id": "5"})
+	c.RefundOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusBadGateway, rw.Code)
+	con.AssertCalled(t, "UpdatePayment", mock.MatchedBy(func(p model.Payment) bool {
+		return p.Status == model.PaymentRefunding
+	}), model.PaymentCaptured)
+	con.AssertCalled(t, "UpdatePayment", mock.MatchedBy(func(p model.Payment) bool {
+		return p.Status == model.PaymentCaptured
+	}), model.PaymentRefunding)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
+)
+
+// pickupSlot checks a requested pickup time against the policy, using the
+// opening hours of the store when the order is for one. Orders without a
+// pickup time are prepared as soon as possible and have no slot.
+func pickupSlot(con data.Connection, p pickup.Policy, storeID *int, at *time.Time) (*model.PickupSlot, error) {
+	if storeID != nil {
+		st, err := con.GetStore(*storeID)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err = storePolicy(p, st)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if at == nil {
+		return nil, nil
+	}
+
+	s, err := p.Check(*at, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// storePolicy returns the policy with the opening hours and time zone of a
+// store
+func storePolicy(p pickup.Policy, st model.Store) (pickup.Policy, error) {
+	h, err := pickup.ParseHours(st.Hours)
+	if err != nil {
+		return p, err
+	}
+
+	loc, err := time.LoadLocation(st.Timezone)
+	if err != nil {
+		return p, err
+	}
+
+	p.Hours = h
+	p.Location = loc
+
+	return p, nil
+}
+
+// writePickupError writes the response for an invalid pickup time, returning
+// false when err is not a pickup error
+func writePickupError(rw http.ResponseWriter, err error) bool {
+	switch err {
+	case pickup.ErrTooSoon, pickup.ErrTooFarAhead, pickup.ErrClosed:
+		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
+	case data.ErrPickupSlotFull:
+		http.Error(rw, "Pickup slot is full, choose another time", http.StatusConflict)
+	default:
+		return false
+	}
+
+	return true
+}
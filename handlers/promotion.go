@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/promotions"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Promotion is a HTTP Handler for managing promotions
+type Promotion struct {
+	con data.Connection
+	log hclog.Logger
+}
+
+// CreatePromotionRequest is the body of a request to create a promotion, the
+// validity window is optional
+type CreatePromotionRequest struct {
+	model.Promotion
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// NewPromotion creates a Promotion handler
+func NewPromotion(con data.Connection, l hclog.Logger) *Promotion {
+	return &Promotion{con, l}
+}
+
+// CreatePromotion creates a promotion, it can only be called by admins
+func (c *Promotion) CreatePromotion(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Promotion | create")
+
+	body := CreatePromotionRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	p := body.Promotion
+
+	if err := promotions.Validate(p); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.StartsAt != nil && body.EndsAt != nil && !body.EndsAt.After(*body.StartsAt) {
+		http.Error(rw, "ends_at must be after starts_at", http.StatusBadRequest)
+		return
+	}
+
+	if body.StartsAt != nil {
+		s := body.StartsAt.UTC().Format(time.RFC3339)
+		p.StartsAt = &s
+	}
+
+	if body.EndsAt != nil {
+		e := body.EndsAt.UTC().Format(time.RFC3339)
+		p.EndsAt = &e
+	}
+
+	p, err = c.con.CreatePromotion(p)
+	if err == data.ErrPromotionCodeInUse {
+		http.Error(rw, "Promotion code is already in use", http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to create promotion", "error", err)
+		http.Error(rw, "Unable to create promotion", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, model.AuditPromotionCreated, p.ID, r)
+
+	d, err := p.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert promotion to JSON", "error", err)
+		http.Error(rw, "Unable to create promotion", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(d)
+}
+
+// ListPromotions returns every promotion with how many times it has been
+// used, it can only be called by admins
+func (c *Promotion) ListPromotions(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Promotion | list")
+
+	ps, err := c.con.ListPromotions()
+	if err != nil {
+		c.log.Error("Unable to list promotions", "error", err)
+		http.Error(rw, "Unable to list promotions", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ps.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert promotions to JSON", "error", err)
+		http.Error(rw, "Unable to list promotions", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DeletePromotion deletes a promotion so its code can no longer be used, it
+// can only be called by admins
+func (c *Promotion) DeletePromotion(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Promotion | delete")
+
+	vars := mux.Vars(r)
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		c.log.Error("Promotion ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find promotion", http.StatusBadRequest)
+		return
+	}
+
+	err = c.con.DeletePromotion(id)
+	if err == data.ErrPromotionNotFound {
+		http.Error(rw, "Promotion not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to delete promotion", "error", err)
+		http.Error(rw, "Unable to delete promotion", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, model.AuditPromotionDeleted, id, r)
+
+	fmt.Fprintf(rw, "%s", "Deleted promotion")
+}
+
+func (c *Promotion) audit(userID int, action string, promotionID int, r *http.Request) {
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  action,
+		Subject: strconv.Itoa(promotionID),
+		IP:      clientIP(r),
+	}
+
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
+
+// writePromotionError writes 422 Unprocessable Entity when err is because a
+// promotion code can not be used, returning false for other errors
+func writePromotionError(rw http.ResponseWriter, err error) bool {
+	pe := &promotions.Error{}
+	if !errors.As(err, &pe) {
+		return false
+	}
+
+	http.Error(rw, pe.Error(), http.StatusUnprocessableEntity)
+	return true
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/promotions"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupPromotionHandler(t *testing.T) (*Promotion, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	return NewPromotion(c, hclog.Default()), c, httptest.NewRecorder()
+}
+
+func TestCreatePromotionCreatesPromotion(t *testing.T) {
+	c, con, rw := setupPromotionHandler(t)
+	con.On("CreatePromotion", mock.Anything).Return(model.Promotion{ID: 3, Code: "TEN"}, nil)
+
+	r := httptest.NewRequest("POST", "/admin/promotions", strings.NewReader(
+		`{"code":"TEN","name":"Ten percent off","type":"percentage","percent":10,"starts_at":"2026-01-01T10:00:00+02:00"}`))
+	c.CreatePromotion(1, rw, r)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	con.AssertCalled(t, "CreatePromotion", mock.MatchedBy(func(p model.Promotion) bool {
+		return p.Percent == 10 && p.StartsAt != nil && *p.StartsAt == "2026-01-01T08:00:00Z" && p.EndsAt == nil
+	}))
+	con.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditPromotionCreated && e.Subject == "3"
+	}))
+}
+
+func TestCreatePromotionRejectsInvalidPromotion(t *testing.T) {
+	c, con, rw := setupPromotionHandler(t)
+
+	r := httptest.NewRequest("POST", "/admin/promotions", strings.NewReader(`{"code":"TEN","name":"Ten","type":"percentage","percent":0}`))
+	c.CreatePromotion(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "CreatePromotion", mock.Anything)
+}
+
+func TestCreatePromotionRejectsEndBeforeStart(t *testing.T) {
+	c, _, rw := setupPromotionHandler(t)
+
+	r := httptest.NewRequest("POST", "/admin/promotions", strings.NewReader(
+		`{"code":"TEN","name":"Ten","type":"fixed_amount","amount":10,"starts_at":"2026-02-01T00:00:00Z","ends_at":"2026-01-01T00:00:00Z"}`))
+	c.CreatePromotion(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestCreatePromotionReturnsConflictForUsedCode(t *testing.T) {
+	c, con, rw := setupPromotionHandler(t)
+	con.On("CreatePromotion", mock.Anything).Return(nil, data.ErrPromotionCodeInUse)
+
+	r := httptest.NewRequest("POST", "/admin/promotions", strings.NewReader(`{"code":"TEN","name":"Ten","type":"fixed_amount","amount":10}`))
+	c.CreatePromotion(1, rw, r)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestDeletePromotionReturnsNotFound(t *testing.T) {
+	c, con, rw := setupPromotionHandler(t)
+	con.On("DeletePromotion", 4).Return(data.ErrPromotionNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/admin/promotions/4", nil), map[string]string{"id": "4"})
+	c.DeletePromotion(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestCreateOrderReturnsUnprocessableEntityForPromotionError(t *testing.T) {
+	c, con, rw := setupVersionedOrderHandler(t)
+	con.On("CreateOrder").Return(nil, &promotions.Error{Code: "OLD", Err: promotions.ErrNotActive})
+
+	r := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"items":[{"coffee":{"id":1},"quantity":1}],"promotion_codes":["OLD"]}`))
+	c.CreateOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"OLD"`)
+}
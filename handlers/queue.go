@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxListQueue is the largest page of queued orders returned
+const maxListQueue = 100
+
+// Queue is a HTTP Handler for staff preparing the orders of every user
+type Queue struct {
+	con data.Connection
+	log hclog.Logger
+}
+
+// NewQueue creates a Queue handler
+func NewQueue(con data.Connection, l hclog.Logger) *Queue {
+	return &Queue{con, l}
+}
+
+// ListOrders returns the orders waiting to be or being prepared, the order
+// paid for first is first. The store_id query parameter only returns the
+// orders for a store. It can only be called by staff.
+func (c *Queue) ListOrders(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Queue | list orders")
+
+	q := r.URL.Query()
+
+	var storeID *int
+
+	if s := q.Get("store_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(rw, "store_id must be a number", http.StatusBadRequest)
+			return
+		}
+
+		storeID = &id
+	}
+
+	limit, err := queryInt(q.Get("limit"), 20)
+	if err != nil || limit < 1 || limit > maxListQueue {
+		http.Error(rw, fmt.Sprintf("limit must be between 1 and %d", maxListQueue), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(rw, "offset must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	os, err := c.con.GetOrderQueue(storeID, limit, offset)
+	if err != nil {
+		c.log.Error("Unable to get order queue", "error", err)
+		http.Error(rw, "Unable to list orders", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := os.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert orders to JSON", "error", err)
+		http.Error(rw, "Unable to list orders", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// ClaimOrder marks an order as being prepared by the member of staff calling
+func (c *Queue) ClaimOrder(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Queue | claim order")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("OrderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find order", http.StatusBadRequest)
+		return
+	}
+
+	o, err := c.con.ClaimOrder(userID, orderID)
+	if err != nil {
+		c.log.Error("Unable to claim order", "error", err)
+		c.writeError(rw, err, "Unable to claim order")
+		return
+	}
+
+	c.writeOrder(rw, o)
+}
+
+// PrepareItem marks an item of an order as prepared, claiming the order when
+// nobody has claimed it
+func (c *Queue) PrepareItem(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Queue | prepare item")
+
+	vars := mux.Vars(r)
+
+	orderID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		c.log.Error("OrderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find order", http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := strconv.Atoi(vars["item_id"])
+	if err != nil {
+		c.log.Error("ItemID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find order item", http.StatusBadRequest)
+		return
+	}
+
+	o, err := c.con.PrepareOrderItem(userID, orderID, itemID)
+	if err != nil {
+		c.log.Error("Unable to prepare order item", "error", err)
+		c.writeError(rw, err, "Unable to prepare order item")
+		return
+	}
+
+	c.writeOrder(rw, o)
+}
+
+// CompleteOrder removes an order from the queue once every item has been
+// prepared
+func (c *Queue) CompleteOrder(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Queue | complete order")
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("OrderID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find order", http.StatusBadRequest)
+		return
+	}
+
+	o, err := c.con.CompleteOrder(userID, orderID)
+	if err != nil {
+		c.log.Error("Unable to complete order", "error", err)
+		c.writeError(rw, err, "Unable to complete order")
+		return
+	}
+
+	c.writeOrder(rw, o)
+}
+
+func (c *Queue) writeOrder(rw http.ResponseWriter, o model.QueuedOrder) {
+	d, err := o.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert order to JSON", "error", err)
+		http.Error(rw, "Unable to convert order to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// writeError writes the response for an error preparing an order
+func (c *Queue) writeError(rw http.ResponseWriter, err error, message string) {
+	switch err {
+	case data.ErrOrderNotFound:
+		http.Error(rw, "Order not found", http.StatusNotFound)
+	case data.ErrOrderItemNotFound:
+		http.Error(rw, "Order item not found", http.StatusNotFound)
+	case data.ErrOrderNotQueued:
+		http.Error(rw, "Order is not waiting to be prepared", http.StatusConflict)
+	case data.ErrOrderClaimed:
+		http.Error(rw, "Order has been claimed by someone else", http.StatusConflict)
+	case data.ErrOrderItemsNotPrepared:
+		http.Error(rw, "Order items have not all been prepared", http.StatusConflict)
+	default:
+		http.Error(rw, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupQueueHandler(t *testing.T) (*Queue, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+
+	return NewQueue(c, hclog.Default()), c, httptest.NewRecorder()
+}
+
+func TestListQueuedOrdersReturnsIngredients(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+	con.On("GetOrderQueue", (*int)(nil), 20, 0).Return(model.QueuedOrders{
+		model.QueuedOrder{
+			ID:     3,
+			UserID: 2,
+			Status: model.OrderPaid,
+			Items:  []model.QueuedOrderItem{{ID: 5, CoffeeID: 1, CoffeeName: "Packer Spiced Latte", Quantity: 2}},
+			Ingredients: []model.IngredientRequirement{
+				{IngredientID: 1, Name: "Espresso", Quantity: 80, Unit: "ml"},
+			},
+		},
+	}, nil)
+
+	c.ListOrders(1, rw, httptest.NewRequest("GET", "/staff/orders", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"coffee_name":"Packer Spiced Latte"`)
+	assert.Contains(t, rw.Body.String(), `{"ingredient_id":1,"name":"Espresso","quantity":80,"unit":"ml"}`)
+}
+
+func TestListQueuedOrdersRejectsLargeLimit(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+
+	c.ListOrders(1, rw, httptest.NewRequest("GET", "/staff/orders?limit=1000", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	con.AssertNotCalled(t, "GetOrderQueue", (*int)(nil), 1000, 0)
+}
+
+func TestListQueuedOrdersFiltersByStore(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+	storeID := 2
+	con.On("GetOrderQueue", &storeID, 20, 0).Return(model.QueuedOrders{}, nil)
+
+	c.ListOrders(1, rw, httptest.NewRequest("GET", "/staff/orders?store_id=2", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "GetOrderQueue", &storeID, 20, 0)
+}
+
+func TestClaimOrderClaimedBySomeoneElseReturnsConflict(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+	con.On("ClaimOrder", 1, 3).Return(nil, data.ErrOrderClaimed)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/staff/orders/3/claim", nil), map[string]string{"id": "3"})
+	c.ClaimOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
+
+func TestPrepareItemReturnsOrder(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+	con.On("PrepareOrderItem", 1, 3, 5).Return(model.QueuedOrder{ID: 3, Status: model.OrderPreparing}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/staff/orders/3/items/5/prepared", nil), map[string]string{"id": "3", "item_id": "5"})
+	c.PrepareItem(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"status":"preparing"`)
+}
+
+func TestPrepareItemNotInOrderReturnsNotFound(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+	con.On("PrepareOrderItem", 1, 3, 9).Return(nil, data.ErrOrderItemNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/staff/orders/3/items/9/prepared", nil), map[string]string{"id": "3", "item_id": "9"})
+	c.PrepareItem(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestCompleteOrderWithUnpreparedItemsReturnsConflict(t *testing.T) {
+	c, con, rw := setupQueueHandler(t)
+	con.On("CompleteOrder", 1, 3).Return(nil, data.ErrOrderItemsNotPrepared)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/staff/orders/3/complete", nil), map[string]string{"id": "3"})
+	c.CompleteOrder(1, rw, r)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/ratelimit"
+	"github.com/hashicorp/go-hclog"
+)
+
+// trustForwardedFor reads the client address from X-Forwarded-For, only
+// enable when the service is behind a proxy which sets the header
+var trustForwardedFor = false
+
+// SetTrustForwardedFor sets whether the client address is read from X-Forwarded-For
+func SetTrustForwardedFor(trust bool) {
+	trustForwardedFor = trust
+}
+
+// clientIP returns the address of the client which made the request
+func clientIP(r *http.Request) string {
+	if trustForwardedFor {
+		if f := r.Header.Get("X-Forwarded-For"); f != "" {
+			return strings.TrimSpace(strings.Split(f, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RateLimit is middleware which limits the requests made to a route
+type RateLimit struct {
+	store ratelimit.Store
+	log   hclog.Logger
+}
+
+// NewRateLimit creates rate limit middleware using the given store
+func NewRateLimit(s ratelimit.Store, l hclog.Logger) *RateLimit {
+	return &RateLimit{s, l}
+}
+
+// ByClient limits anonymous requests to a route by client IP address
+func (rl *RateLimit) ByClient(route string, l ratelimit.Limit, next http.HandlerFunc) http.HandlerFunc {
+	if !l.Enabled() {
+		return next
+	}
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if rl.allow(fmt.Sprintf("%s:ip:%s", route, clientIP(r)), l, rw) {
+			next(rw, r)
+		}
+	}
+}
+
+// ByUser limits authenticated requests to a route by user ID, it is used
+// inside IsAuthorized
+func (rl *RateLimit) ByUser(route string, l ratelimit.Limit, next func(userID int, w http.ResponseWriter, r *http.Request)) func(userID int, w http.ResponseWriter, r *http.Request) {
+	if !l.Enabled() {
+		return next
+	}
+
+	return func(userID int, rw http.ResponseWriter, r *http.Request) {
+		if rl.allow(fmt.Sprintf("%s:user:%d", route, userID), l, rw) {
+			next(userID, rw, r)
+		}
+	}
+}
+
+// allow takes a token for key and writes the rate limit headers, returning
+// false after writing a 429 response when the limit has been exceeded
+func (rl *RateLimit) allow(key string, l ratelimit.Limit, rw http.ResponseWriter) bool {
+	res, err := rl.store.Take(key, l)
+	if err != nil {
+		// do not turn a store outage into an outage of the service
+		rl.log.Error("Unable to check rate limit", "key", key, "error", err)
+		return true
+	}
+
+	rw.Header().Set("RateLimit-Limit", fmt.Sprintf("%d", res.Limit))
+	rw.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d", res.Remaining))
+	rw.Header().Set("RateLimit-Reset", fmt.Sprintf("%d", ceilSeconds(res.Reset)))
+
+	if !res.Allowed {
+		rl.log.Info("Rate limit exceeded", "key", key)
+		rw.Header().Set("Retry-After", fmt.Sprintf("%d", ceilSeconds(res.RetryAfter)))
+		http.Error(rw, "Too many requests", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/ratelimit"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct{}
+
+func (f *failingStore) Take(key string, l ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+func okHandler(rw http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(rw, "ok")
+}
+
+func okUserHandler(userID int, rw http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(rw, "ok")
+}
+
+func TestRateLimitByClientReturns429WhenExceeded(t *testing.T) {
+	rl := NewRateLimit(ratelimit.NewMemoryStore(), hclog.Default())
+	h := rl.ByClient("signin", ratelimit.Limit{Requests: 1, Per: time.Minute}, okHandler)
+
+	r := httptest.NewRequest("POST", "/signin", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	rw := httptest.NewRecorder()
+	h(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "1", rw.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rw.Header().Get("RateLimit-Remaining"))
+
+	rw = httptest.NewRecorder()
+	h(rw, r)
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "60", rw.Header().Get("Retry-After"))
+	assert.Equal(t, "60", rw.Header().Get("RateLimit-Reset"))
+
+	// other clients have their own bucket
+	r.RemoteAddr = "10.0.0.2:1234"
+	rw = httptest.NewRecorder()
+	h(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestRateLimitByClientUsesForwardedForWhenTrusted(t *testing.T) {
+	SetTrustForwardedFor(true)
+	defer SetTrustForwardedFor(false)
+
+	r := httptest.NewRequest("POST", "/signin", nil)
+	r.Header.Set("X-Forwarded-For", "192.168.1.1, 10.0.0.1")
+
+	assert.Equal(t, "192.168.1.1", clientIP(r))
+}
+
+func TestRateLimitByUserKeysOnUserID(t *testing.T) {
+	rl := NewRateLimit(ratelimit.NewMemoryStore(), hclog.Default())
+	h := rl.ByUser("create_order", ratelimit.Limit{Requests: 1, Per: time.Minute}, okUserHandler)
+
+	r := httptest.NewRequest("POST", "/orders", nil)
+
+	rw := httptest.NewRecorder()
+	h(1, rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = httptest.NewRecorder()
+	h(1, rw, r)
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+
+	rw = httptest.NewRecorder()
+	h(2, rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestRateLimitAllowsRequestsWhenStoreFails(t *testing.T) {
+	rl := NewRateLimit(&failingStore{}, hclog.Default())
+	h := rl.ByClient("signin", ratelimit.Limit{Requests: 1, Per: time.Minute}, okHandler)
+
+	rw := httptest.NewRecorder()
+	h(rw, httptest.NewRequest("POST", "/signin", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Store is a HTTP Handler for stores and their menus
+type Store struct {
+	con   data.Connection
+	log   hclog.Logger
+	rates currency.Converter
+}
+
+// NewStore creates a Store handler
+func NewStore(con data.Connection, l hclog.Logger, rates currency.Converter) *Store {
+	return &Store{con, l, rates}
+}
+
+// SetStoreCoffeeRequest is the body of a request to change a coffee at a
+// store, a nil price uses the price of the coffee and a nil available leaves
+// it on the menu
+type SetStoreCoffeeRequest struct {
+	Price     *int  `json:"price"`
+	Available *bool `json:"available"`
+}
+
+// ListStores returns the stores
+func (c *Store) ListStores(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | list")
+
+	ss, err := c.con.ListStores()
+	if err != nil {
+		c.log.Error("Unable to list stores", "error", err)
+		http.Error(rw, "Unable to list stores", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ss.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert stores to JSON", "error", err)
+		http.Error(rw, "Unable to list stores", http.StatusInternalServerError)
+		return
+	}
+
+	writeWithETag(rw, r, bodyETag(d), d)
+}
+
+// GetStore returns a store
+func (c *Store) GetStore(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | get")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	st, err := c.con.GetStore(id)
+	if err != nil {
+		c.log.Error("Unable to get store", "error", err)
+		c.writeError(rw, err, "Unable to get store")
+		return
+	}
+
+	d, err := st.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert store to JSON", "error", err)
+		http.Error(rw, "Unable to get store", http.StatusInternalServerError)
+		return
+	}
+
+	writeWithETag(rw, r, bodyETag(d), d)
+}
+
+// GetMenu returns the coffees a store sells at the store's prices
+func (c *Store) GetMenu(rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | menu")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	p, err := newPricing(c.con, c.rates, rw, r)
+	if err != nil {
+		c.log.Error("Unable to get prices", "error", err)
+		c.writeError(rw, err, "Unable to list products")
+		return
+	}
+
+	cofs, err := c.con.GetStoreCoffees(id)
+	if err != nil {
+		c.log.Error("Unable to get store menu", "error", err)
+		c.writeError(rw, err, "Unable to list products")
+		return
+	}
+
+	err = p.coffees(cofs)
+	if err != nil {
+		c.log.Error("Unable to price store menu", "error", err)
+		c.writeError(rw, err, "Unable to list products")
+		return
+	}
+
+	d, err := cofs.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert products to JSON", "error", err)
+		http.Error(rw, "Unable to list products", http.StatusInternalServerError)
+		return
+	}
+
+	writeWithETag(rw, r, bodyETag(d), d)
+}
+
+// CreateStore creates a store, it can only be called by admins
+func (c *Store) CreateStore(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | create")
+
+	st, ok := c.decodeStore(rw, r)
+	if !ok {
+		return
+	}
+
+	st, err := c.con.CreateStore(st)
+	if err != nil {
+		c.log.Error("Unable to create store", "error", err)
+		http.Error(rw, "Unable to create store", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, model.AuditStoreCreated, st.ID, r)
+
+	d, err := st.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert store to JSON", "error", err)
+		http.Error(rw, "Unable to create store", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(d)
+}
+
+// UpdateStore replaces the details of a store, it can only be called by
+// admins
+func (c *Store) UpdateStore(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | update")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	st, ok := c.decodeStore(rw, r)
+	if !ok {
+		return
+	}
+
+	st.ID = id
+
+	st, err := c.con.UpdateStore(st)
+	if err != nil {
+		c.log.Error("Unable to update store", "error", err)
+		c.writeError(rw, err, "Unable to update store")
+		return
+	}
+
+	c.audit(userID, model.AuditStoreUpdated, st.ID, r)
+
+	d, err := st.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert store to JSON", "error", err)
+		http.Error(rw, "Unable to update store", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DeleteStore deletes a store, it can only be called by admins
+func (c *Store) DeleteStore(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | delete")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	err := c.con.DeleteStore(id)
+	if err != nil {
+		c.log.Error("Unable to delete store", "error", err)
+		c.writeError(rw, err, "Unable to delete store")
+		return
+	}
+
+	c.audit(userID, model.AuditStoreDeleted, id, r)
+
+	fmt.Fprintf(rw, "%s", "Deleted store")
+}
+
+// ListStoreCoffees returns the prices and availability a store changes from
+// the default catalog, it can only be called by admins
+func (c *Store) ListStoreCoffees(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | list coffees")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	scs, err := c.con.ListStoreCoffees(id)
+	if err != nil {
+		c.log.Error("Unable to list store coffees", "error", err)
+		c.writeError(rw, err, "Unable to list store coffees")
+		return
+	}
+
+	d, err := scs.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert store coffees to JSON", "error", err)
+		http.Error(rw, "Unable to list store coffees", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// SetStoreCoffee sets the price and availability of a coffee at a store, it
+// can only be called by admins
+func (c *Store) SetStoreCoffee(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | set coffee")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	coffeeID, err := strconv.Atoi(mux.Vars(r)["coffee_id"])
+	if err != nil {
+		c.log.Error("CoffeeID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find coffee", http.StatusBadRequest)
+		return
+	}
+
+	body := SetStoreCoffeeRequest{}
+
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Price != nil && *body.Price < 0 {
+		http.Error(rw, "price must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	sc := model.StoreCoffee{StoreID: id, CoffeeID: coffeeID, Price: body.Price, Available: true}
+	if body.Available != nil {
+		sc.Available = *body.Available
+	}
+
+	sc, err = c.con.SetStoreCoffee(sc)
+	if err != nil {
+		c.log.Error("Unable to set store coffee", "error", err)
+		c.writeError(rw, err, "Unable to set store coffee")
+		return
+	}
+
+	c.audit(userID, model.AuditStoreMenuChanged, id, r)
+
+	d, err := sc.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert store coffee to JSON", "error", err)
+		http.Error(rw, "Unable to set store coffee", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DeleteStoreCoffee returns a coffee to its default price and availability
+// at a store, it can only be called by admins
+func (c *Store) DeleteStoreCoffee(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Store | delete coffee")
+
+	id, ok := c.storeID(rw, r)
+	if !ok {
+		return
+	}
+
+	coffeeID, err := strconv.Atoi(mux.Vars(r)["coffee_id"])
+	if err != nil {
+		c.log.Error("CoffeeID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find coffee", http.StatusBadRequest)
+		return
+	}
+
+	err = c.con.DeleteStoreCoffee(id, coffeeID)
+	if err != nil {
+		c.log.Error("Unable to delete store coffee", "error", err)
+		c.writeError(rw, err, "Unable to delete store coffee")
+		return
+	}
+
+	c.audit(userID, model.AuditStoreMenuChanged, id, r)
+
+	fmt.Fprintf(rw, "%s", "Deleted store coffee")
+}
+
+// storeID reads the ID of the store from the path, writing 400 Bad Request
+// when it is not a number
+func (c *Store) storeID(rw http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("StoreID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find store", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// decodeStore reads and validates a store from the request body, the time
+// zone defaults to UTC
+func (c *Store) decodeStore(rw http.ResponseWriter, r *http.Request) (model.Store, bool) {
+	st := model.Store{}
+
+	err := st.FromJSON(r.Body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return st, false
+	}
+
+	if strings.TrimSpace(st.Name) == "" {
+		http.Error(rw, "name is required", http.StatusBadRequest)
+		return st, false
+	}
+
+	if st.Timezone == "" {
+		st.Timezone = "UTC"
+	}
+
+	if _, err := time.LoadLocation(st.Timezone); err != nil {
+		http.Error(rw, fmt.Sprintf("timezone is not a valid time zone: %s", err), http.StatusBadRequest)
+		return st, false
+	}
+
+	if _, err := pickup.ParseHours(st.Hours); err != nil {
+		http.Error(rw, fmt.Sprintf("hours are not valid: %s", err), http.StatusBadRequest)
+		return st, false
+	}
+
+	return st, true
+}
+
+// writeError writes the response for an error reading or changing a store
+func (c *Store) writeError(rw http.ResponseWriter, err error, message string) {
+	if writeCurrencyError(rw, err) {
+		return
+	}
+
+	switch err {
+	case data.ErrStoreNotFound:
+		http.Error(rw, "Store not found", http.StatusNotFound)
+	case data.ErrCoffeeNotFound:
+		http.Error(rw, "Coffee not found", http.StatusNotFound)
+	default:
+		http.Error(rw, message, http.StatusInternalServerError)
+	}
+}
+
+func (c *Store) audit(userID int, action string, storeID int, r *http.Request) {
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  action,
+		Subject: strconv.Itoa(storeID),
+		IP:      clientIP(r),
+	}
+
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
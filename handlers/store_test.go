@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupStoreHandler(t *testing.T) (*Store, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	return NewStore(c, hclog.Default(), testRates), c, httptest.NewRecorder()
+}
+
+func TestGetMenuReturnsStorePrices(t *testing.T) {
+	c, con, rw := setupStoreHandler(t)
+	con.On("GetStoreCoffees", 2).Return(model.Coffees{{ID: 1, Name: "Packer Spiced Latte", Price: 250}}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/stores/2/coffees", nil), map[string]string{"id": "2"})
+	c.GetMenu(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"price":250`)
+	assert.NotEmpty(t, rw.Header().Get("ETag"))
+}
+
+func TestGetMenuConvertsStorePricesInsteadOfThePriceList(t *testing.T) {
+	c, con, rw := setupStoreHandler(t)
+	catalog := 200
+	con.On("GetPriceList", "EUR").Return(model.CoffeePrices{{CoffeeID: 1, Currency: "EUR", Price: 180}}, nil)
+	con.On("GetStoreCoffees", 2).Return(model.Coffees{{ID: 1, Name: "Packer Spiced Latte", Price: 250, CatalogPrice: &catalog}}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/stores/2/coffees?currency=EUR", nil), map[string]string{"id": "2"})
+	c.GetMenu(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"price":230`)
+}
+
+func TestGetMenuReturnsNotFoundForUnknownStore(t *testing.T) {
+	c, con, rw := setupStoreHandler(t)
+	con.On("GetStoreCoffees", 9).Return(nil, data.ErrStoreNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/stores/9/coffees", nil), map[string]string{"id": "9"})
+	c.GetMenu(rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestCreateStoreDefaultsTimezone(t *testing.T) {
+	c, con, rw := setupStoreHandler(t)
+	con.On("CreateStore", mock.Anything).Return(model.Store{ID: 3, Name: "Downtown", Timezone: "UTC"}, nil)
+
+	r := httptest.NewRequest("POST", "/admin/stores", strings.NewReader(`{"name":"Downtown","hours":"mon-fri 07:00-19:00"}`))
+	c.CreateStore(1, rw, r)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	con.AssertCalled(t, "CreateStore", mock.MatchedBy(func(s model.Store) bool {
+		return s.Name == "Downtown" && s.Timezone == "UTC" && s.Hours == "mon-fri 07:00-19:00"
+	}))
+	con.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditStoreCreated && e.Subject == "3"
+	}))
+}
+
+func TestCreateStoreRejectsInvalidStore(t *testing.T) {
+	for _, body := range []string{
+		`{"name":""}`,
+		`{"name":"Downtown","timezone":"Mars/Olympus_Mons"}`,
+		`{"name":"Downtown","hours":"mon 19:00-07:00"}`,
+	} {
+		c, con, rw := setupStoreHandler(t)
+
+		c.CreateStore(1, rw, httptest.NewRequest("POST", "/admin/stores", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code, body)
+		con.AssertNotCalled(t, "CreateStore", mock.Anything)
+	}
+}
+
+func TestSetStoreCoffeeDefaultsToAvailable(t *testing.T) {
+	c, con, rw := setupStoreHandler(t)
+	con.On("SetStoreCoffee", mock.Anything).Return(model.StoreCoffee{StoreID: 2, CoffeeID: 1, Available: true}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/admin/stores/2/coffees/1", strings.NewReader(`{"price":300}`)), map[string]string{"id": "2", "coffee_id": "1"})
+	c.SetStoreCoffee(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	con.AssertCalled(t, "SetStoreCoffee", mock.MatchedBy(func(sc model.StoreCoffee) bool {
+		return sc.StoreID == 2 && sc.CoffeeID == 1 && sc.Price != nil && *sc.Price == 300 && sc.Available
+	}))
+}
+
+func TestSetStoreCoffeeReturnsNotFoundForUnknownCoffee(t *testing.T) {
+	c, con, rw := setupStoreHandler(t)
+	con.On("SetStoreCoffee", mock.Anything).Return(nil, data.ErrCoffeeNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("PUT", "/admin/stores/2/coffees/99", strings.NewReader(`{"available":false}`)), map[string]string{"id": "2", "coffee_id": "99"})
+	c.SetStoreCoffee(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
@@ -1,22 +1,46 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/lockout"
+	"github.com/hashicorp-demoapp/product-api-go/password"
 	"github.com/hashicorp/go-hclog"
 )
 
-const jwtSecret = "test"
+// jwtSecret is used to sign and verify JWT tokens, it is set using SetJWTSecret
+var jwtSecret = []byte("test")
+
+// SetJWTSecret sets the secret used to sign and verify JWT tokens
+func SetJWTSecret(secret string) {
+	jwtSecret = []byte(secret)
+}
+
+// maxUserAgent is the longest user agent recorded for a token
+const maxUserAgent = 512
+
+// tokenTTL is how long a JWT token is valid, it is set using SetTokenTTL
+var tokenTTL = 24 * time.Hour
+
+// SetTokenTTL sets how long JWT tokens are valid
+func SetTokenTTL(ttl time.Duration) {
+	tokenTTL = ttl
+}
 
 // User -
 type User struct {
-	con data.Connection
-	log hclog.Logger
+	con    data.Connection
+	log    hclog.Logger
+	guard  *lockout.Guard
+	policy *password.Policy
 }
 
 // AuthStruct -
@@ -27,14 +51,21 @@ type AuthStruct struct {
 
 // AuthResponse -
 type AuthResponse struct {
-	UserID   int    `json:"user_id,omitempty`
-	Username string `json:"username,omitempty`
+	UserID   int    `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
 	Token    string `json:"token,omitempty"`
 }
 
-// NewUser -
-func NewUser(con data.Connection, l hclog.Logger) *User {
-	return &User{con, l}
+// UnlockRequest is the body of a request to clear failed sign in attempts
+type UnlockRequest struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
+
+// NewUser creates a User handler, failed sign in attempts are limited by
+// guard and new passwords are checked against policy when they are not nil
+func NewUser(con data.Connection, l hclog.Logger, guard *lockout.Guard, policy *password.Policy) *User {
+	return &User{con, l, guard, policy}
 }
 
 func (c *User) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -56,6 +87,13 @@ func (c *User) SignUp(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if c.policy != nil {
+		if err := c.policy.Validate(body.Username, body.Password); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	u, err := c.con.CreateUser(body.Username, body.Password)
 	if err != nil {
 		c.log.Error("Unable to create new user", "error", err)
@@ -67,7 +105,7 @@ func (c *User) SignUp(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := c.generateJWTToken(u.ID, u.Username)
+	tokenString, err := c.generateJWTToken(u.ID, u.Username, r)
 	if err != nil {
 		c.log.Error("Unable to generate JWT token", "error", err)
 		http.Error(rw, "Unable to generate JWT token", http.StatusInternalServerError)
@@ -94,14 +132,32 @@ func (c *User) SignIn(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := clientIP(r)
+
+	if !signInAllowed(c.log, c.guard, body.Username, ip, rw) {
+		return
+	}
+
 	u, err := c.con.AuthUser(body.Username, body.Password)
 	if err != nil {
 		c.log.Error("Unable to sign in user", "error", err)
+
+		// database errors are not counted as failed attempts
+		if errors.Is(err, data.ErrInvalidCredentials) {
+			signInFailed(c.con, c.log, c.guard, body.Username, ip)
+		}
+
 		http.Error(rw, "Invalid Credentials", http.StatusUnauthorized)
 		return
 	}
 
-	tokenString, err := c.generateJWTToken(u.ID, u.Username)
+	if c.guard != nil {
+		if err := c.guard.Success(body.Username); err != nil {
+			c.log.Error("Unable to clear failed sign in attempts", "error", err)
+		}
+	}
+
+	tokenString, err := c.generateJWTToken(u.ID, u.Username, r)
 	if err != nil {
 		c.log.Error("Unable to generate JWT token", "error", err)
 		http.Error(rw, "Unable to generate JWT token", http.StatusInternalServerError)
@@ -115,8 +171,128 @@ func (c *User) SignIn(rw http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (c *User) generateJWTToken(userID int, username string) (string, error) {
-	t, err := c.con.CreateToken(userID)
+// signInAllowed returns false and writes the response when failed attempts
+// for username or the client IP mean the caller must wait. The same response
+// is returned for every username so locked accounts do not reveal which
+// usernames exist.
+func signInAllowed(l hclog.Logger, g *lockout.Guard, username, ip string, rw http.ResponseWriter) bool {
+	if g == nil {
+		return true
+	}
+
+	wait, err := g.Check(username, ip)
+	if err != nil {
+		l.Error("Unable to check failed sign in attempts", "error", err)
+	}
+
+	if wait > 0 {
+		l.Info("Sign in blocked after failed attempts", "ip", ip)
+		rw.Header().Set("Retry-After", fmt.Sprintf("%d", ceilSeconds(wait)))
+		http.Error(rw, "Too many failed sign in attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+// signInFailed records a failed attempt and audits any resulting lockout
+func signInFailed(con data.Connection, l hclog.Logger, g *lockout.Guard, username, ip string) {
+	if g == nil {
+		return
+	}
+
+	res, err := g.Failure(username, ip)
+	if err != nil {
+		l.Error("Unable to record failed sign in attempt", "error", err)
+		return
+	}
+
+	audit := func(e model.AuditEvent) {
+		if err := con.CreateAuditEvent(e); err != nil {
+			l.Error("Unable to create audit event", "action", e.Action, "error", err)
+		}
+	}
+
+	if res.UserLocked {
+		l.Warn("Username locked after failed sign in attempts", "username", username, "ip", ip)
+		audit(model.AuditEvent{Action: model.AuditUserLocked, Subject: username, IP: ip})
+	}
+
+	if res.IPLocked {
+		l.Warn("Client IP locked after failed sign in attempts", "ip", ip)
+		audit(model.AuditEvent{Action: model.AuditIPLocked, Subject: ip, IP: ip})
+	}
+}
+
+func (c *User) audit(e model.AuditEvent) {
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
+
+// Unlock clears the failed sign in attempts for a username or client IP
+// it can only be called by admins
+func (c *User) Unlock(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle User | unlock")
+
+	body := UnlockRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Username == "" && body.IP == "" {
+		http.Error(rw, "Username or IP is required", http.StatusBadRequest)
+		return
+	}
+
+	if c.guard == nil {
+		http.Error(rw, "Sign in lockout is not enabled", http.StatusNotFound)
+		return
+	}
+
+	actor := sql.NullInt64{Int64: int64(userID), Valid: true}
+
+	if body.Username != "" {
+		if err := c.guard.UnlockUser(body.Username); err != nil {
+			c.log.Error("Unable to unlock user", "error", err)
+			http.Error(rw, "Unable to unlock user", http.StatusInternalServerError)
+			return
+		}
+
+		c.audit(model.AuditEvent{ActorID: actor, Action: model.AuditUserUnlocked, Subject: body.Username, IP: clientIP(r)})
+	}
+
+	if body.IP != "" {
+		if err := c.guard.UnlockIP(body.IP); err != nil {
+			c.log.Error("Unable to unlock IP", "error", err)
+			http.Error(rw, "Unable to unlock IP", http.StatusInternalServerError)
+			return
+		}
+
+		c.audit(model.AuditEvent{ActorID: actor, Action: model.AuditIPUnlocked, Subject: body.IP, IP: clientIP(r)})
+	}
+
+	fmt.Fprintf(rw, "%s", "Unlocked")
+}
+
+func (c *User) generateJWTToken(userID int, username string, r *http.Request) (string, error) {
+	expires := time.Now().Add(tokenTTL)
+
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+
+	t, err := c.con.CreateToken(model.Token{
+		UserID:    userID,
+		IP:        clientIP(r),
+		UserAgent: ua,
+		ExpiresAt: expires.UTC().Format(time.RFC3339),
+	})
 	if err != nil {
 		return "", err
 	}
@@ -124,10 +300,10 @@ func (c *User) generateJWTToken(userID int, username string) (string, error) {
 		"token_id": t.ID,
 		"user_id":  userID,
 		"username": username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+		"exp":      expires.Unix(),
 	})
 
-	return token.SignedString([]byte(jwtSecret))
+	return token.SignedString(jwtSecret)
 }
 
 func (c *User) invalidateJWTToken(authToken string) error {
@@ -135,7 +311,8 @@ func (c *User) invalidateJWTToken(authToken string) error {
 	if err != nil {
 		return err
 	}
-	if err = c.con.DeleteToken(tokenID, userID); err != nil {
+	// a token which has already been revoked is signed out
+	if err = c.con.DeleteToken(tokenID, userID); err != nil && !errors.Is(err, data.ErrSessionNotFound) {
 		return err
 	}
 	return nil
@@ -9,11 +9,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp-demoapp/product-api-go/data"
 	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/lockout"
+	"github.com/hashicorp-demoapp/product-api-go/password"
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func setupUserHandler(t *testing.T) (*User, *httptest.ResponseRecorder) {
@@ -26,7 +30,7 @@ func setupUserHandler(t *testing.T) (*User, *httptest.ResponseRecorder) {
 
 	l := hclog.Default()
 
-	return &User{c, l}, httptest.NewRecorder()
+	return &User{c, l, nil, nil}, httptest.NewRecorder()
 }
 
 func setupFailedUserHandler(t *testing.T) (*User, *httptest.ResponseRecorder) {
@@ -39,7 +43,7 @@ func setupFailedUserHandler(t *testing.T) (*User, *httptest.ResponseRecorder) {
 
 	l := hclog.Default()
 
-	return &User{c, l}, httptest.NewRecorder()
+	return &User{c, l, nil, nil}, httptest.NewRecorder()
 }
 
 func TestCreateNewUser(t *testing.T) {
@@ -79,7 +83,7 @@ func TestAuthNewUser(t *testing.T) {
 func TestSignOutUser(t *testing.T) {
 	c, rw := setupUserHandler(t)
 
-	token, err := c.generateJWTToken(1, "User1")
+	token, err := c.generateJWTToken(1, "User1", httptest.NewRequest("POST", "/signin", nil))
 	assert.NoError(t, err)
 
 	r := httptest.NewRequest("POST", "/signout", nil)
@@ -159,3 +163,95 @@ func TestUnableToSignOutUser(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rw.Code)
 	assert.Equal(t, fmt.Sprintf("Unable to sign out user\n"), string(rw.Body.Bytes()))
 }
+
+func setupLockoutUserHandler(t *testing.T) (*User, *data.MockConnection) {
+	c := &data.MockConnection{}
+
+	c.On("AuthUser").Return(nil, data.ErrInvalidCredentials)
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	g := lockout.NewGuard(
+		lockout.NewMemoryStore(),
+		lockout.Policy{MaxAttempts: 2, Lockout: time.Minute},
+		lockout.Policy{MaxAttempts: 5, Lockout: time.Minute},
+	)
+
+	return &User{c, hclog.Default(), g, nil}, c
+}
+
+func signIn(u *User, username string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/signin", strings.NewReader(fmt.Sprintf(`{"username": "%s", "password": "wrong"}`, username)))
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	u.SignIn(rw, r)
+
+	return rw
+}
+
+func TestSignInLocksUsernameAfterFailedAttempts(t *testing.T) {
+	u, c := setupLockoutUserHandler(t)
+
+	assert.Equal(t, http.StatusUnauthorized, signIn(u, "User1").Code)
+	assert.Equal(t, http.StatusUnauthorized, signIn(u, "User1").Code)
+
+	rw := signIn(u, "User1")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "60", rw.Header().Get("Retry-After"))
+
+	c.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditUserLocked && e.Subject == "User1" && e.IP == "10.0.0.1"
+	}))
+	c.AssertNumberOfCalls(t, "AuthUser", 2)
+}
+
+func TestSignInDoesNotCountDatabaseErrors(t *testing.T) {
+	u, _ := setupLockoutUserHandler(t)
+	c := &data.MockConnection{}
+	c.On("AuthUser").Return(nil, errors.New("connection refused"))
+	u.con = c
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signIn(u, "User1").Code)
+	}
+}
+
+func TestUnlockClearsLockedUsername(t *testing.T) {
+	u, c := setupLockoutUserHandler(t)
+
+	signIn(u, "User1")
+	signIn(u, "User1")
+	assert.Equal(t, http.StatusTooManyRequests, signIn(u, "User1").Code)
+
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/admin/unlock", strings.NewReader(`{"username": "User1"}`))
+	u.Unlock(3, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, http.StatusUnauthorized, signIn(u, "User1").Code)
+
+	c.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditUserUnlocked && e.Subject == "User1" && e.ActorID.Int64 == 3
+	}))
+}
+
+func TestUnlockRequiresUsernameOrIP(t *testing.T) {
+	u, _ := setupLockoutUserHandler(t)
+
+	rw := httptest.NewRecorder()
+	u.Unlock(3, rw, httptest.NewRequest("POST", "/admin/unlock", strings.NewReader(`{}`)))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestSignUpRejectsPasswordWhichFailsPolicy(t *testing.T) {
+	c, rw := setupUserHandler(t)
+	c.policy = password.NewPolicy(8, 72)
+
+	r := httptest.NewRequest("POST", "/signup", strings.NewReader(`{"username": "User1", "password": ""}`))
+
+	c.SignUp(rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Password must be at least 8 characters\n", rw.Body.String())
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/webhooks"
+	"github.com/hashicorp/go-hclog"
+)
+
+// maxListDeliveries is the largest page of webhook deliveries returned
+const maxListDeliveries = 100
+
+// Webhooks is a HTTP Handler for managing webhook subscriptions and their
+// deliveries
+type Webhooks struct {
+	con data.Connection
+	log hclog.Logger
+}
+
+// NewWebhooks creates a Webhooks handler
+func NewWebhooks(con data.Connection, l hclog.Logger) *Webhooks {
+	return &Webhooks{con, l}
+}
+
+// CreateSubscription subscribes a URL to order events, the secret used to
+// sign webhooks is only returned in the response. It can only be called by
+// admins.
+func (c *Webhooks) CreateSubscription(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Webhooks | create subscription")
+
+	s := model.WebhookSubscription{}
+
+	err := json.NewDecoder(r.Body).Decode(&s)
+	if err != nil {
+		c.log.Error("Unable to decode JSON", "error", err)
+		http.Error(rw, "Unable to parse request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(rw, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Events.Validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		c.log.Error("Unable to generate webhook secret", "error", err)
+		http.Error(rw, "Unable to create webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	s, err = c.con.CreateWebhookSubscription(s)
+	if err != nil {
+		c.log.Error("Unable to create webhook subscription", "error", err)
+		http.Error(rw, "Unable to create webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, model.AuditWebhookCreated, s.ID, r)
+
+	d, err := s.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert webhook subscription to JSON", "error", err)
+		http.Error(rw, "Unable to create webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(d)
+}
+
+// ListSubscriptions returns the webhook subscriptions without their secrets,
+// it can only be called by admins
+func (c *Webhooks) ListSubscriptions(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Webhooks | list subscriptions")
+
+	ss, err := c.con.ListWebhookSubscriptions()
+	if err != nil {
+		c.log.Error("Unable to list webhook subscriptions", "error", err)
+		http.Error(rw, "Unable to list webhook subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ss.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert webhook subscriptions to JSON", "error", err)
+		http.Error(rw, "Unable to list webhook subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// DeleteSubscription stops sending webhooks to a subscription, it can only be
+// called by admins
+func (c *Webhooks) DeleteSubscription(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Webhooks | delete subscription")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("Webhook ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find webhook subscription", http.StatusBadRequest)
+		return
+	}
+
+	err = c.con.DeleteWebhookSubscription(id)
+	if err == data.ErrWebhookSubscriptionNotFound {
+		http.Error(rw, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to delete webhook subscription", "error", err)
+		http.Error(rw, "Unable to delete webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(userID, model.AuditWebhookDeleted, id, r)
+
+	fmt.Fprintf(rw, "%s", "Deleted webhook subscription")
+}
+
+// ListDeliveries returns the delivery log of a subscription, newest first.
+// The status query parameter filters deliveries by status. It can only be
+// called by admins.
+func (c *Webhooks) ListDeliveries(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Webhooks | list deliveries")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("Webhook ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find webhook subscription", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+
+	status := q.Get("status")
+	if status != "" && status != model.WebhookPending && status != model.WebhookDelivered && status != model.WebhookDead {
+		http.Error(rw, "status must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(q.Get("limit"), 20)
+	if err != nil || limit < 1 || limit > maxListDeliveries {
+		http.Error(rw, fmt.Sprintf("limit must be between 1 and %d", maxListDeliveries), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(rw, "offset must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	ds, err := c.con.ListWebhookDeliveries(id, status, limit, offset)
+	if err == data.ErrWebhookSubscriptionNotFound {
+		http.Error(rw, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to list webhook deliveries", "error", err)
+		http.Error(rw, "Unable to list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	d, err := ds.ToJSON()
+	if err != nil {
+		c.log.Error("Unable to convert webhook deliveries to JSON", "error", err)
+		http.Error(rw, "Unable to list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(d)
+}
+
+// RetryDelivery sends a delivery again on the next run of the delivery job,
+// including deliveries which are dead. It can only be called by admins.
+func (c *Webhooks) RetryDelivery(userID int, rw http.ResponseWriter, r *http.Request) {
+	c.log.Info("Handle Webhooks | retry delivery")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.log.Error("Delivery ID provided could not be converted to an integer", "error", err)
+		http.Error(rw, "Unable to find webhook delivery", http.StatusBadRequest)
+		return
+	}
+
+	err = c.con.RetryWebhookDelivery(id)
+	if err == data.ErrWebhookDeliveryNotFound {
+		http.Error(rw, "Webhook delivery not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		c.log.Error("Unable to retry webhook delivery", "error", err)
+		http.Error(rw, "Unable to retry webhook delivery", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(rw, "%s", "Webhook delivery queued")
+}
+
+func (c *Webhooks) audit(userID int, action string, subscriptionID int, r *http.Request) {
+	e := model.AuditEvent{
+		ActorID: sql.NullInt64{Int64: int64(userID), Valid: true},
+		Action:  action,
+		Subject: strconv.Itoa(subscriptionID),
+		IP:      clientIP(r),
+	}
+
+	if err := c.con.CreateAuditEvent(e); err != nil {
+		c.log.Error("Unable to create audit event", "action", e.Action, "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupWebhooksHandler(t *testing.T) (*Webhooks, *data.MockConnection, *httptest.ResponseRecorder) {
+	c := &data.MockConnection{}
+	c.On("CreateAuditEvent", mock.Anything).Return(nil)
+
+	return NewWebhooks(c, hclog.Default()), c, httptest.NewRecorder()
+}
+
+func TestCreateSubscriptionGeneratesSecret(t *testing.T) {
+	c, con, rw := setupWebhooksHandler(t)
+	con.On("CreateWebhookSubscription", mock.Anything).Return(model.WebhookSubscription{ID: 2, Secret: "whsec_abc"}, nil)
+
+	r := httptest.NewRequest("POST", "/admin/webhooks", strings.NewReader(
+		`{"url":"https://example.com/hooks","events":["order.created"],"secret":"mine"}`))
+	c.CreateSubscription(1, rw, r)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Contains(t, rw.Body.String(), "whsec_abc")
+	con.AssertCalled(t, "CreateWebhookSubscription", mock.MatchedBy(func(s model.WebhookSubscription) bool {
+		return s.URL == "https://example.com/hooks" && strings.HasPrefix(s.Secret, "whsec_") && len(s.Secret) > 20
+	}))
+	con.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e model.AuditEvent) bool {
+		return e.Action == model.AuditWebhookCreated && e.Subject == "2"
+	}))
+}
+
+func TestCreateSubscriptionRejectsInvalidSubscription(t *testing.T) {
+	for _, body := range []string{
+		`{"url":"ftp://example.com","events":["order.created"]}`,
+		`{"url":"/hooks","events":["order.created"]}`,
+		`{"url":"https://example.com","events":[]}`,
+		`{"url":"https://example.com","events":["order.eaten"]}`,
+	} {
+		c, con, rw := setupWebhooksHandler(t)
+
+		c.CreateSubscription(1, rw, httptest.NewRequest("POST", "/admin/webhooks", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code, body)
+		con.AssertNotCalled(t, "CreateWebhookSubscription", mock.Anything)
+	}
+}
+
+func TestDeleteSubscriptionReturnsNotFound(t *testing.T) {
+	c, con, rw := setupWebhooksHandler(t)
+	con.On("DeleteWebhookSubscription", 4).Return(data.ErrWebhookSubscriptionNotFound)
+
+	r := mux.SetURLVars(httptest.NewRequest("DELETE", "/admin/webhooks/4", nil), map[string]string{"id": "4"})
+	c.DeleteSubscription(1, rw, r)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestListDeliveriesFiltersByStatus(t *testing.T) {
+	c, con, rw := setupWebhooksHandler(t)
+	con.On("ListWebhookDeliveries", 4, model.WebhookDead, 20, 0).Return(model.WebhookDeliveries{{ID: 7, Status: model.WebhookDead}}, nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/admin/webhooks/4/deliveries?status=dead", nil), map[string]string{"id": "4"})
+	c.ListDeliveries(1, rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"id":7`)
+}
+
+func TestListDeliveriesRejectsUnknownStatus(t *testing.T) {
+	c, _, rw := setupWebhooksHandler(t)
+
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/admin/webhooks/4/deliveries?status=lost", nil), map[string]string{"id": "4"})
+	c.ListDeliveries(1, rw, r)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestRetryDeliveryQueuesDelivery(t *testing.T) {
+	c, con, rw := setupWebhooksHandler(t)
+	con.On("RetryWebhookDelivery", 7).Return(nil)
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/admin/webhooks/deliveries/7/retry", nil), map[string]string{"id": "7"})
+	c.RetryDelivery(1, rw, r)
+
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+}
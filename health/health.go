@@ -0,0 +1,232 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Probe is a type of health check request made by a scheduler
+type Probe string
+
+const (
+	// Readiness checks must pass for the service to receive traffic
+	Readiness Probe = "readiness"
+	// Startup checks must pass once before the service is considered started
+	Startup Probe = "startup"
+)
+
+const (
+	// StatusOK is reported when a check passes
+	StatusOK = "ok"
+	// StatusError is reported when a check fails or times out
+	StatusError = "error"
+)
+
+// Check returns an error when a component is unhealthy
+type Check func(ctx context.Context) error
+
+// Result is the outcome of running a single check
+type Result struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of running all the checks for a probe
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK returns true when every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Registry holds the checks registered by the components of the service.
+// Results are cached and each check only runs once at a time, callers which
+// arrive while a check is running wait for its result, so probes can not pile
+// up behind a dependency which has stopped responding.
+type Registry struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.RWMutex
+	checks []*registered
+	// startup is the report from when the startup checks first passed, it is
+	// returned for every startup probe after that
+	startup *Report
+}
+
+type registered struct {
+	name   string
+	check  Check
+	probes map[Probe]bool
+
+	mu       sync.Mutex
+	result   Result
+	expires  time.Time
+	running  chan struct{}
+	checking bool
+}
+
+// NewRegistry creates a Registry, checks which take longer than timeout fail
+// and results are reused for cacheTTL
+func NewRegistry(timeout, cacheTTL time.Duration) *Registry {
+	return &Registry{timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Register a check which runs for the given probes
+func (r *Registry) Register(name string, c Check, probes ...Probe) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := map[Probe]bool{}
+	for _, pr := range probes {
+		p[pr] = true
+	}
+
+	r.checks = append(r.checks, &registered{name: name, check: c, probes: p})
+}
+
+// Run the checks registered for the probe. Once every startup check has passed
+// the startup probe always reports success, as a startup probe is only used
+// until the service first starts.
+func (r *Registry) Run(ctx context.Context, p Probe) Report {
+	r.mu.RLock()
+	checks := []*registered{}
+	for _, c := range r.checks {
+		if c.probes[p] {
+			checks = append(checks, c)
+		}
+	}
+	startup := r.startup
+	r.mu.RUnlock()
+
+	// the cached results are shared with readiness, so they are not used once
+	// the service has started
+	if p == Startup && startup != nil {
+		return Report{Status: startup.Status, Checks: append([]Result{}, startup.Checks...)}
+	}
+
+	rep := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *registered) {
+			defer wg.Done()
+			rep.Checks[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, res := range rep.Checks {
+		if res.Status != StatusOK {
+			rep.Status = StatusError
+		}
+	}
+
+	if p == Startup && rep.OK() {
+		r.mu.Lock()
+		if r.startup == nil {
+			r.startup = &Report{Status: rep.Status, Checks: append([]Result{}, rep.Checks...)}
+		}
+		r.mu.Unlock()
+	}
+
+	return rep
+}
+
+// run returns the cached result for a check, starting the check if the result
+// has expired and waiting for a check which is already running
+func (r *Registry) run(ctx context.Context, c *registered) Result {
+	c.mu.Lock()
+	if time.Now().Before(c.expires) {
+		defer c.mu.Unlock()
+		return c.result
+	}
+
+	running := c.running
+	if running == nil {
+		running = make(chan struct{})
+		c.running = running
+		go r.execute(c, running)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-running:
+		return c.last()
+	case <-ctx.Done():
+		return Result{Name: c.name, Status: StatusError, Error: ctx.Err().Error(), CheckedAt: time.Now()}
+	}
+}
+
+// execute a check and cache the result, checks which do not return within the
+// timeout fail but are left to finish in the background
+func (r *Registry) execute(c *registered, running chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	st := time.Now()
+
+	// a check which is still blocked from an earlier run is not started again
+	c.mu.Lock()
+	blocked := c.checking
+	c.checking = true
+	c.mu.Unlock()
+
+	var err error
+	if blocked {
+		err = fmt.Errorf("previous check has not returned")
+	} else {
+		done := make(chan error, 1)
+		go func() {
+			err := c.check(ctx)
+
+			c.mu.Lock()
+			c.checking = false
+			c.mu.Unlock()
+
+			done <- err
+		}()
+
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = fmt.Errorf("check timed out after %s", r.timeout)
+		}
+	}
+
+	res := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(st).Microseconds()) / 1000,
+		CheckedAt: st,
+	}
+
+	if err != nil {
+		res.Status = StatusError
+		res.Error = err.Error()
+	}
+
+	c.mu.Lock()
+	c.result = res
+	c.expires = time.Now().Add(r.cacheTTL)
+	c.running = nil
+	c.mu.Unlock()
+
+	close(running)
+}
+
+func (c *registered) last() Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.result
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportsEachCheck(t *testing.T) {
+	r := NewRegistry(time.Second, 0)
+	r.Register("database", func(ctx context.Context) error { return nil }, Readiness, Startup)
+	r.Register("telemetry", func(ctx context.Context) error { return errors.New("stopped") }, Readiness)
+
+	rep := r.Run(context.Background(), Readiness)
+
+	assert.False(t, rep.OK())
+	assert.Len(t, rep.Checks, 2)
+	assert.Equal(t, "database", rep.Checks[0].Name)
+	assert.Equal(t, StatusOK, rep.Checks[0].Status)
+	assert.Equal(t, "telemetry", rep.Checks[1].Name)
+	assert.Equal(t, StatusError, rep.Checks[1].Status)
+	assert.Equal(t, "stopped", rep.Checks[1].Error)
+}
+
+func TestOnlyRunsChecksForProbe(t *testing.T) {
+	r := NewRegistry(time.Second, 0)
+	r.Register("database", func(ctx context.Context) error { return nil }, Readiness, Startup)
+	r.Register("telemetry", func(ctx context.Context) error { return errors.New("stopped") }, Readiness)
+
+	rep := r.Run(context.Background(), Startup)
+
+	assert.True(t, rep.OK())
+	assert.Len(t, rep.Checks, 1)
+}
+
+func TestCachesResults(t *testing.T) {
+	var calls int32
+	r := NewRegistry(time.Second, time.Minute)
+	r.Register("database", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, Readiness)
+
+	r.Run(context.Background(), Readiness)
+	r.Run(context.Background(), Readiness)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFailsChecksWhichTimeOut(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	r := NewRegistry(50*time.Millisecond, 0)
+	r.Register("database", func(ctx context.Context) error {
+		<-block
+		return nil
+	}, Readiness)
+
+	rep := r.Run(context.Background(), Readiness)
+
+	assert.False(t, rep.OK())
+	assert.Contains(t, rep.Checks[0].Error, "timed out")
+}
+
+func TestDoesNotPileUpOnStuckCheck(t *testing.T) {
+	var calls int32
+	block := make(chan struct{})
+	defer close(block)
+
+	r := NewRegistry(50*time.Millisecond, 0)
+	r.Register("database", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-block
+		return nil
+	}, Readiness)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Run(context.Background(), Readiness)
+		}()
+	}
+	wg.Wait()
+
+	rep := r.Run(context.Background(), Readiness)
+
+	assert.False(t, rep.OK())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestStartupSucceedsOnceStarted(t *testing.T) {
+	var fail int32
+	r := NewRegistry(time.Second, 0)
+	r.Register("database", func(ctx context.Context) error {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("down")
+		}
+		return nil
+	}, Readiness, Startup)
+
+	assert.True(t, r.Run(context.Background(), Startup).OK())
+
+	atomic.StoreInt32(&fail, 1)
+
+	assert.True(t, r.Run(context.Background(), Startup).OK())
+	assert.False(t, r.Run(context.Background(), Readiness).OK())
+}
+
+func TestStartupSucceedsAfterReadinessFails(t *testing.T) {
+	var fail int32
+	r := NewRegistry(time.Second, 0)
+	r.Register("database", func(ctx context.Context) error {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("down")
+		}
+		return nil
+	}, Readiness, Startup)
+
+	assert.True(t, r.Run(context.Background(), Startup).OK())
+
+	atomic.StoreInt32(&fail, 1)
+
+	// the failed result is cached for the check, which both probes share
+	assert.False(t, r.Run(context.Background(), Readiness).OK())
+	assert.True(t, r.Run(context.Background(), Startup).OK())
+}
@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Job is a unit of background work, it should return when ctx is cancelled
+type Job func(ctx context.Context) error
+
+type entry struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// Scheduler runs jobs in the background at a fixed interval. Each job runs at
+// most once at a time, a run which takes longer than the interval delays the
+// next run rather than overlapping it.
+type Scheduler struct {
+	log  hclog.Logger
+	jobs []entry
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a Scheduler
+func NewScheduler(l hclog.Logger) *Scheduler {
+	return &Scheduler{log: l}
+}
+
+// Every registers a job which runs every interval, jobs must be registered
+// before Start is called
+func (s *Scheduler) Every(name string, interval time.Duration, j Job) {
+	s.jobs = append(s.jobs, entry{name, interval, j})
+}
+
+// Start runs each job once and then at its interval until Stop is called
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, e := range s.jobs {
+		if e.interval <= 0 {
+			s.log.Info("Job disabled", "job", e.name)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(e entry) {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+}
+
+// Stop cancels running jobs and waits for them to return
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e entry) {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	for {
+		s.run(ctx, e)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, e entry) {
+	st := time.Now()
+
+	if err := e.job(ctx); err != nil {
+		s.log.Error("Job failed", "job", e.name, "error", err, "duration", time.Since(st))
+		return
+	}
+
+	s.log.Debug("Job finished", "job", e.name, "duration", time.Since(st))
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunsJobsAtInterval(t *testing.T) {
+	s := NewScheduler(hclog.NewNullLogger())
+
+	var runs int32
+	s.Every("count", 10*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	s.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, time.Millisecond)
+	s.Stop()
+
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&runs), "jobs should not run after Stop")
+}
+
+func TestKeepsRunningAfterJobFails(t *testing.T) {
+	s := NewScheduler(hclog.NewNullLogger())
+
+	var runs int32
+	s.Every("fail", 10*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("boom")
+	})
+
+	s.Start()
+	defer s.Stop()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, time.Millisecond)
+}
+
+func TestStopCancelsRunningJob(t *testing.T) {
+	s := NewScheduler(hclog.NewNullLogger())
+
+	started := make(chan struct{})
+	s.Every("block", time.Hour, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	s.Start()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for Stop")
+	}
+}
+
+func TestSkipsDisabledJobs(t *testing.T) {
+	s := NewScheduler(hclog.NewNullLogger())
+
+	s.Every("disabled", 0, func(ctx context.Context) error {
+		t.Fatal("disabled job should not run")
+		return nil
+	})
+
+	s.Start()
+	s.Stop()
+}
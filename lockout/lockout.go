@@ -0,0 +1,239 @@
+package lockout
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy defines how failed attempts for a key are limited
+type Policy struct {
+	// FreeAttempts is the number of failures allowed before delays start
+	FreeAttempts int
+	// MaxAttempts is the number of failures after which the key is locked
+	MaxAttempts int
+	// Delay is the wait after the first failure over FreeAttempts, it doubles
+	// with each further failure up to MaxDelay
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Lockout is how long a key is locked, failures are also forgotten once
+	// Lockout has passed since the last failure
+	Lockout time.Duration
+}
+
+// wait returns how long after the last failure the next attempt is allowed
+func (p Policy) wait(failures int) time.Duration {
+	if p.MaxAttempts > 0 && failures >= p.MaxAttempts {
+		return p.Lockout
+	}
+
+	n := failures - p.FreeAttempts
+	if n <= 0 || p.Delay <= 0 {
+		return 0
+	}
+
+	d := p.Delay
+	for i := 1; i < n && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return d
+}
+
+// State is the failure history for a key
+type State struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store holds the failure history. The in memory store tracks failures for
+// each replica separately, a shared store can be used to track across replicas.
+type Store interface {
+	// Get returns the state for key, the zero State if there have been no failures
+	Get(key string) (State, error)
+	// Increment records a failure at the given time, failures older than
+	// window are discarded first
+	Increment(key string, at time.Time, window time.Duration) (State, error)
+	// Delete removes the failure history for key
+	Delete(key string) error
+}
+
+// Guard protects sign in by tracking failed attempts per username and per
+// client IP. Usernames which do not exist are tracked the same way as those
+// which do so the responses do not reveal which accounts exist.
+type Guard struct {
+	store Store
+	user  Policy
+	ip    Policy
+	now   func() time.Time
+}
+
+// NewGuard creates a Guard using the policies for usernames and client IPs
+func NewGuard(s Store, user, ip Policy) *Guard {
+	return &Guard{store: s, user: user, ip: ip, now: time.Now}
+}
+
+// Result is the outcome of recording a failure
+type Result struct {
+	// UserLocked is true when the failure locked the username
+	UserLocked bool
+	// IPLocked is true when the failure locked the client IP
+	IPLocked bool
+}
+
+// Check returns how long the caller must wait before attempting to sign in
+// with username from ip, zero when an attempt is allowed now
+func (g *Guard) Check(username, ip string) (time.Duration, error) {
+	uw, err := g.remaining(userKey(username), g.user)
+	if err != nil {
+		return 0, err
+	}
+
+	iw, err := g.remaining(ipKey(ip), g.ip)
+	if err != nil {
+		return 0, err
+	}
+
+	if iw > uw {
+		return iw, nil
+	}
+
+	return uw, nil
+}
+
+// Failure records a failed attempt for username from ip
+func (g *Guard) Failure(username, ip string) (Result, error) {
+	now := g.now()
+
+	us, err := g.store.Increment(userKey(username), now, g.user.Lockout)
+	if err != nil {
+		return Result{}, err
+	}
+
+	is, err := g.store.Increment(ipKey(ip), now, g.ip.Lockout)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		UserLocked: g.user.MaxAttempts > 0 && us.Failures == g.user.MaxAttempts,
+		IPLocked:   g.ip.MaxAttempts > 0 && is.Failures == g.ip.MaxAttempts,
+	}, nil
+}
+
+// Success clears the failures for username, failures for the client IP are
+// kept so an attacker can not reset them by signing in to their own account
+func (g *Guard) Success(username string) error {
+	return g.store.Delete(userKey(username))
+}
+
+// UnlockUser clears the failures for username
+func (g *Guard) UnlockUser(username string) error {
+	return g.store.Delete(userKey(username))
+}
+
+// UnlockIP clears the failures for a client IP
+func (g *Guard) UnlockIP(ip string) error {
+	return g.store.Delete(ipKey(ip))
+}
+
+func (g *Guard) remaining(key string, p Policy) (time.Duration, error) {
+	s, err := g.store.Get(key)
+	if err != nil || s.Failures == 0 {
+		return 0, err
+	}
+
+	w := p.wait(s.Failures) - g.now().Sub(s.LastFailure)
+	if w < 0 {
+		return 0, nil
+	}
+
+	return w, nil
+}
+
+func userKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MemoryStore is an in process Store
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	calls   int
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// sweepEvery is the number of increments between removing expired entries
+const sweepEvery = 1000
+
+// NewMemoryStore creates a new in memory Store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+// Get implements Store
+func (m *MemoryStore) Get(key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		return e.state, nil
+	}
+
+	return State{}, nil
+}
+
+// Increment implements Store
+func (m *MemoryStore) Increment(key string, at time.Time, window time.Duration) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(at)
+
+	e, ok := m.entries[key]
+	if !ok || at.After(e.expires) {
+		e = &memoryEntry{}
+		m.entries[key] = e
+	}
+
+	e.state.Failures++
+	e.state.LastFailure = at
+	e.expires = at.Add(window)
+
+	return e.state, nil
+}
+
+// Delete implements Store
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	m.calls++
+	if m.calls < sweepEvery {
+		return
+	}
+	m.calls = 0
+
+	for k, e := range m.entries {
+		if now.After(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+}
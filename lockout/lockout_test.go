@@ -0,0 +1,123 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPolicy = Policy{FreeAttempts: 2, MaxAttempts: 5, Delay: time.Second, MaxDelay: 4 * time.Second, Lockout: time.Minute}
+
+func setupGuard() (*Guard, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewGuard(NewMemoryStore(), testPolicy, Policy{MaxAttempts: 8, Lockout: time.Hour})
+	g.now = func() time.Time { return now }
+
+	return g, &now
+}
+
+func TestAllowsFreeAttemptsWithoutDelay(t *testing.T) {
+	g, _ := setupGuard()
+
+	for i := 0; i < 2; i++ {
+		_, err := g.Failure("nic", "10.0.0.1")
+		assert.NoError(t, err)
+	}
+
+	w, err := g.Check("nic", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), w)
+}
+
+func TestDelaysDoubleAfterFreeAttempts(t *testing.T) {
+	g, now := setupGuard()
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second, time.Minute}
+	for i, e := range expected {
+		g.Failure("nic", "10.0.0.1")
+
+		w, _ := g.Check("nic", "10.0.0.1")
+		assert.Equal(t, e, w, "failure %d", i+1)
+	}
+
+	*now = now.Add(30 * time.Second)
+
+	w, _ := g.Check("nic", "10.0.0.1")
+	assert.Equal(t, 30*time.Second, w)
+}
+
+func TestReportsLockoutOnce(t *testing.T) {
+	g, _ := setupGuard()
+
+	for i := 0; i < 4; i++ {
+		r, _ := g.Failure("nic", "10.0.0.1")
+		assert.False(t, r.UserLocked)
+	}
+
+	r, _ := g.Failure("nic", "10.0.0.1")
+	assert.True(t, r.UserLocked)
+
+	r, _ = g.Failure("nic", "10.0.0.1")
+	assert.False(t, r.UserLocked)
+}
+
+func TestUsernamesAreCaseInsensitive(t *testing.T) {
+	g, _ := setupGuard()
+
+	for i := 0; i < 5; i++ {
+		g.Failure("Nic", "10.0.0.1")
+	}
+
+	w, _ := g.Check("nic ", "10.0.0.2")
+	assert.Equal(t, time.Minute, w)
+}
+
+func TestLocksClientIPAcrossUsernames(t *testing.T) {
+	g, _ := setupGuard()
+
+	var r Result
+	for i := 0; i < 8; i++ {
+		r, _ = g.Failure("user"+string(rune('a'+i)), "10.0.0.1")
+	}
+	assert.True(t, r.IPLocked)
+
+	w, _ := g.Check("someone", "10.0.0.1")
+	assert.Equal(t, time.Hour, w)
+
+	w, _ = g.Check("someone", "10.0.0.2")
+	assert.Equal(t, time.Duration(0), w)
+}
+
+func TestForgetsFailuresAfterLockout(t *testing.T) {
+	g, now := setupGuard()
+
+	for i := 0; i < 5; i++ {
+		g.Failure("nic", "10.0.0.1")
+	}
+
+	*now = now.Add(2 * time.Hour)
+	g.Failure("nic", "10.0.0.1")
+
+	w, _ := g.Check("nic", "10.0.0.1")
+	assert.Equal(t, time.Duration(0), w)
+}
+
+func TestSuccessAndUnlockClearFailures(t *testing.T) {
+	g, _ := setupGuard()
+
+	for i := 0; i < 8; i++ {
+		g.Failure("nic", "10.0.0.1")
+	}
+
+	assert.NoError(t, g.Success("nic"))
+	w, _ := g.Check("nic", "10.0.0.2")
+	assert.Equal(t, time.Duration(0), w)
+
+	w, _ = g.Check("nic", "10.0.0.1")
+	assert.Equal(t, time.Hour, w)
+
+	assert.NoError(t, g.UnlockIP("10.0.0.1"))
+	w, _ = g.Check("nic", "10.0.0.1")
+	assert.Equal(t, time.Duration(0), w)
+}
@@ -1,125 +1,431 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/hashicorp-demoapp/go-hckit"
-	"github.com/nicholasjackson/env"
 	"github.com/rs/cors"
 
 	"github.com/gorilla/mux"
 	"github.com/hashicorp-demoapp/product-api-go/config"
+	"github.com/hashicorp-demoapp/product-api-go/currency"
 	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
 	"github.com/hashicorp-demoapp/product-api-go/handlers"
+	"github.com/hashicorp-demoapp/product-api-go/health"
+	"github.com/hashicorp-demoapp/product-api-go/jobs"
+	"github.com/hashicorp-demoapp/product-api-go/lockout"
+	"github.com/hashicorp-demoapp/product-api-go/notify"
+	"github.com/hashicorp-demoapp/product-api-go/oidc"
+	"github.com/hashicorp-demoapp/product-api-go/outbox"
+	"github.com/hashicorp-demoapp/product-api-go/password"
+	"github.com/hashicorp-demoapp/product-api-go/payments"
+	"github.com/hashicorp-demoapp/product-api-go/pickup"
+	"github.com/hashicorp-demoapp/product-api-go/ratelimit"
+	"github.com/hashicorp-demoapp/product-api-go/stream"
 	"github.com/hashicorp-demoapp/product-api-go/telemetry"
+	"github.com/hashicorp-demoapp/product-api-go/webhooks"
 	"github.com/hashicorp/go-hclog"
 )
 
 // Config format for application
+// values are loaded from the config file, then the environment and finally flags
 type Config struct {
-	DBConnection           string  `json:"db_connection"`
-	BindAddress            string  `json:"bind_address"`
-	MetricsAddress         string  `json:"metrics_address"`
-	MaxRetries             int     `json:"max_retries"`
-	BackoffExponentialBase float64 `json:"backoff_exponential_base"`
+	DBConnection           string  `json:"db_connection" env:"DB_CONNECTION" secret:"true" validate:"required" help:"db connection string"`
+	BindAddress            string  `json:"bind_address" env:"BIND_ADDRESS" validate:"required" help:"Bind address"`
+	MetricsAddress         string  `json:"metrics_address" env:"METRICS_ADDRESS" default:"localhost:9102" help:"Metrics address"`
+	MaxRetries             int     `json:"max_retries" env:"MAX_RETRIES" default:"60" help:"Maximum number of connection retries"`
+	BackoffExponentialBase float64 `json:"backoff_exponential_base" env:"BACKOFF_EXPONENTIAL_BASE" default:"1" help:"Exponential base number to calculate the backoff"`
+	PrintConfig            bool    `json:"-" flag:"print-config" help:"Print the effective config with secrets redacted and exit"`
+
+	// values can reference secrets e.g. file:///run/secrets/jwt or vault://secret/data/product-api#jwt
+	JWTSecret             string          `json:"jwt_secret" env:"JWT_SECRET" secret:"true" default:"test" help:"Secret used to sign JWT tokens"`
+	VaultAddress          string          `json:"vault_address" env:"VAULT_ADDR" help:"Address of the Vault server used to resolve vault:// secrets"`
+	VaultToken            string          `json:"vault_token" env:"VAULT_TOKEN" secret:"true" help:"Token used to authenticate with Vault"`
+	SecretRefreshInterval config.Duration `json:"secret_refresh_interval" env:"SECRET_REFRESH_INTERVAL" help:"How often to re-read secrets which do not have a lease, e.g. 5m"`
+
+	HealthCheckTimeout config.Duration `json:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s" help:"Time after which a health check fails"`
+	HealthCacheTTL     config.Duration `json:"health_cache_ttl" env:"HEALTH_CACHE_TTL" default:"1s" help:"How long health check results are reused"`
+
+	// limits are in the form <requests>/<per>[:<burst>], 0 disables the limit
+	SignInRateLimit      ratelimit.Limit `json:"signin_rate_limit" env:"SIGNIN_RATE_LIMIT" default:"5/1m:10" help:"Sign in requests allowed per client IP"`
+	SignUpRateLimit      ratelimit.Limit `json:"signup_rate_limit" env:"SIGNUP_RATE_LIMIT" default:"5/1h" help:"Sign up requests allowed per client IP"`
+	CreateOrderRateLimit ratelimit.Limit `json:"create_order_rate_limit" env:"CREATE_ORDER_RATE_LIMIT" default:"30/1m" help:"Orders each user can create"`
+	TrustForwardedFor    bool            `json:"trust_forwarded_for" env:"TRUST_FORWARDED_FOR" help:"Read the client IP from X-Forwarded-For, only enable behind a trusted proxy"`
+
+	SignInFreeAttempts    int             `json:"signin_free_attempts" env:"SIGNIN_FREE_ATTEMPTS" default:"3" help:"Failed sign in attempts allowed before delays start"`
+	SignInDelay           config.Duration `json:"signin_delay" env:"SIGNIN_DELAY" default:"1s" help:"Delay after the first failed attempt over the free attempts, doubled for each further failure"`
+	SignInMaxDelay        config.Duration `json:"signin_max_delay" env:"SIGNIN_MAX_DELAY" default:"30s" help:"Longest delay between failed sign in attempts"`
+	SignInMaxAttempts     int             `json:"signin_max_attempts" env:"SIGNIN_MAX_ATTEMPTS" default:"10" help:"Failed sign in attempts for a username before it is locked, 0 disables lockout"`
+	SignInIPMaxAttempts   int             `json:"signin_ip_max_attempts" env:"SIGNIN_IP_MAX_ATTEMPTS" default:"50" help:"Failed sign in attempts from a client IP before it is locked, 0 disables lockout"`
+	SignInLockoutDuration config.Duration `json:"signin_lockout_duration" env:"SIGNIN_LOCKOUT_DURATION" default:"15m" help:"How long a username or client IP is locked"`
+
+	PasswordMinLength      int             `json:"password_min_length" env:"PASSWORD_MIN_LENGTH" default:"8" help:"Minimum number of characters in a password"`
+	PasswordMaxLength      int             `json:"password_max_length" env:"PASSWORD_MAX_LENGTH" default:"72" help:"Maximum number of bytes in a password"`
+	BreachedPasswordsFile  string          `json:"breached_passwords_file" env:"BREACHED_PASSWORDS_FILE" help:"File of breached passwords or SHA-1 hashes which are not allowed"`
+	PasswordResetTTL       config.Duration `json:"password_reset_ttl" env:"PASSWORD_RESET_TTL" default:"1h" help:"How long a password reset token is valid"`
+	PasswordResetRateLimit ratelimit.Limit `json:"password_reset_rate_limit" env:"PASSWORD_RESET_RATE_LIMIT" default:"5/1h" help:"Password reset requests allowed per client IP"`
+	Notifier               string          `json:"notifier" env:"NOTIFIER" default:"log" help:"How messages are sent to users, log or file"`
+	NotifierFile           string          `json:"notifier_file" env:"NOTIFIER_FILE" default:"./notifications.jsonl" help:"File messages are appended to when notifier is file"`
+
+	TokenTTL           config.Duration `json:"token_ttl" env:"TOKEN_TTL" default:"24h" help:"How long a JWT token is valid"`
+	TokenPurgeInterval config.Duration `json:"token_purge_interval" env:"TOKEN_PURGE_INTERVAL" default:"1h" help:"How often revoked and expired tokens are deleted, 0 disables purging"`
+
+	TokenCacheSize         int             `json:"token_cache_size" env:"TOKEN_CACHE_SIZE" default:"10000" help:"Maximum number of validated tokens cached"`
+	TokenCacheTTL          config.Duration `json:"token_cache_ttl" env:"TOKEN_CACHE_TTL" default:"30s" help:"How long a validated token is cached, 0 disables the cache"`
+	TokenCacheInvalidation string          `json:"token_cache_invalidation" env:"TOKEN_CACHE_INVALIDATION" default:"local" help:"How revoked tokens are removed from the caches of other replicas, local or postgres"`
+
+	RequireIfMatch bool `json:"require_if_match" env:"REQUIRE_IF_MATCH" help:"Reject changes to orders which do not send an If-Match header"`
+
+	IdempotencyKeyTTL        config.Duration `json:"idempotency_key_ttl" env:"IDEMPOTENCY_KEY_TTL" default:"24h" help:"How long responses to requests with an Idempotency-Key are kept"`
+	IdempotencyWait          config.Duration `json:"idempotency_wait" env:"IDEMPOTENCY_WAIT" default:"5s" help:"How long a retry waits for the first request with its Idempotency-Key to finish before returning 409"`
+	IdempotencyPurgeInterval config.Duration `json:"idempotency_purge_interval" env:"IDEMPOTENCY_PURGE_INTERVAL" default:"1h" help:"How often expired idempotency keys are deleted, 0 disables purging"`
+
+	// sign in with OpenID Connect is enabled when the issuer is set
+	OIDCIssuer       string `json:"oidc_issuer" env:"OIDC_ISSUER" help:"Issuer URL of the OpenID Connect provider users can sign in with"`
+	OIDCClientID     string `json:"oidc_client_id" env:"OIDC_CLIENT_ID" help:"Client ID registered with the OpenID Connect provider"`
+	OIDCClientSecret string `json:"oidc_client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" help:"Client secret registered with the OpenID Connect provider, not needed for public clients"`
+	OIDCRedirectURL  string `json:"oidc_redirect_url" env:"OIDC_REDIRECT_URL" help:"URL of /auth/oidc/callback registered with the OpenID Connect provider"`
+	OIDCScopes       string `json:"oidc_scopes" env:"OIDC_SCOPES" default:"openid profile email" help:"Space separated scopes requested from the OpenID Connect provider"`
+
+	PaymentProvider         string          `json:"payment_provider" env:"PAYMENT_PROVIDER" default:"fake" help:"Provider used to take payments, only fake is available"`
+	FakePaymentSecret       string          `json:"fake_payment_secret" env:"FAKE_PAYMENT_SECRET" secret:"true" default:"fake" help:"Secret the fake payment provider signs webhooks with"`
+	FakePaymentWebhookURL   string          `json:"fake_payment_webhook_url" env:"FAKE_PAYMENT_WEBHOOK_URL" default:"http://localhost:9090/payments/webhook" help:"URL the fake payment provider sends webhooks to"`
+	FakePaymentWebhookDelay config.Duration `json:"fake_payment_webhook_delay" env:"FAKE_PAYMENT_WEBHOOK_DELAY" default:"5s" help:"How long the fake payment provider takes to send the webhook for a delayed payment"`
+
+	WebhookDeliveryInterval config.Duration `json:"webhook_delivery_interval" env:"WEBHOOK_DELIVERY_INTERVAL" default:"5s" help:"How often webhooks which are due are sent, 0 disables delivery"`
+	WebhookTimeout          config.Duration `json:"webhook_timeout" env:"WEBHOOK_TIMEOUT" default:"10s" help:"How long a subscriber has to respond to a webhook"`
+	WebhookMaxAttempts      int             `json:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"10" help:"Attempts made to deliver a webhook before it is marked dead"`
+	WebhookRetryDelay       config.Duration `json:"webhook_retry_delay" env:"WEBHOOK_RETRY_DELAY" default:"30s" help:"Delay before the first retry of a failed webhook, doubled for each retry"`
+	WebhookMaxRetryDelay    config.Duration `json:"webhook_max_retry_delay" env:"WEBHOOK_MAX_RETRY_DELAY" default:"1h" help:"Longest delay between retries of a failed webhook"`
+
+	OutboxSink          string          `json:"outbox_sink" env:"OUTBOX_SINK" help:"Where events are published as well as webhooks, log, file or http, empty for webhooks only"`
+	OutboxFile          string          `json:"outbox_file" env:"OUTBOX_FILE" default:"./events.jsonl" help:"File events are appended to when outbox_sink is file"`
+	OutboxHTTPURL       string          `json:"outbox_http_url" env:"OUTBOX_HTTP_URL" help:"URL events are posted to when outbox_sink is http"`
+	OutboxRelayInterval config.Duration `json:"outbox_relay_interval" env:"OUTBOX_RELAY_INTERVAL" default:"1s" help:"How often events are published from the outbox, 0 disables publishing"`
+	OutboxBatchSize     int             `json:"outbox_batch_size" env:"OUTBOX_BATCH_SIZE" default:"100" help:"Maximum number of events published in one transaction"`
+	OutboxMaxAttempts   int             `json:"outbox_max_attempts" env:"OUTBOX_MAX_ATTEMPTS" default:"10" help:"Attempts made to publish an event before it is marked dead"`
+	OutboxRetention     config.Duration `json:"outbox_retention" env:"OUTBOX_RETENTION" default:"24h" help:"How long published events are kept in the outbox"`
+	OutboxPurgeInterval config.Duration `json:"outbox_purge_interval" env:"OUTBOX_PURGE_INTERVAL" default:"1h" help:"How often published events older than outbox_retention are deleted, 0 disables purging"`
+
+	EventBroker          string          `json:"event_broker" env:"EVENT_BROKER" default:"local" help:"How order events reach the streams connected to other replicas, local or postgres"`
+	EventStreamHeartbeat config.Duration `json:"event_stream_heartbeat" env:"EVENT_STREAM_HEARTBEAT" default:"15s" help:"How often a heartbeat is sent on idle order event streams"`
+
+	// hours are in the form <days> <open>-<close>, e.g. mon-fri 07:00-19:00; sat-sun 08:00-16:00
+	PickupHours           pickup.Hours    `json:"pickup_hours" env:"PICKUP_HOURS" help:"Opening hours orders can be collected in, empty is always open"`
+	PickupTimezone        string          `json:"pickup_timezone" env:"PICKUP_TIMEZONE" default:"UTC" help:"Time zone of the opening hours, e.g. America/New_York"`
+	PickupSlot            config.Duration `json:"pickup_slot" env:"PICKUP_SLOT" default:"15m" help:"Length of the windows pickup capacity is counted in"`
+	PickupSlotCapacity    int             `json:"pickup_slot_capacity" env:"PICKUP_SLOT_CAPACITY" default:"10" help:"Orders which can be collected in each pickup window, 0 is unlimited"`
+	PickupMinNotice       config.Duration `json:"pickup_min_notice" env:"PICKUP_MIN_NOTICE" default:"15m" help:"Shortest time between placing an order and its pickup time"`
+	PickupMaxAdvance      config.Duration `json:"pickup_max_advance" env:"PICKUP_MAX_ADVANCE" default:"168h" help:"How far ahead orders can be placed for pickup, 0 is unlimited"`
+	PickupLeadTime        config.Duration `json:"pickup_lead_time" env:"PICKUP_LEAD_TIME" default:"10m" help:"How long before their pickup time scheduled orders are released to the queue"`
+	PickupReleaseInterval config.Duration `json:"pickup_release_interval" env:"PICKUP_RELEASE_INTERVAL" default:"30s" help:"How often scheduled orders which are due are released to the queue, 0 disables releasing"`
+
+	// rates are in the form <currency>=<rate>, e.g. EUR=0.92,GBP=0.79
+	Currency      string         `json:"currency" env:"CURRENCY" default:"USD" help:"ISO 4217 code of the currency coffee prices are stored and paid in"`
+	ExchangeRates currency.Rates `json:"exchange_rates" env:"EXCHANGE_RATES" help:"Amount of each other currency prices can be shown in that one unit of currency buys"`
 }
 
-var conf *Config
-var logger hclog.Logger
+// Validate implements config.Validator
+func (c *Config) Validate() error {
+	if c.Notifier != "log" && c.Notifier != "file" {
+		return fmt.Errorf("notifier must be log or file, got %q", c.Notifier)
+	}
+
+	if c.TokenCacheInvalidation != "local" && c.TokenCacheInvalidation != "postgres" {
+		return fmt.Errorf("token_cache_invalidation must be local or postgres, got %q", c.TokenCacheInvalidation)
+	}
 
-var configFile = env.String("CONFIG_FILE", false, "./conf.json", "Path to JSON encoded config file")
-var dbConnection = env.String("DB_CONNECTION", false, "", "db connection string")
-var bindAddress = env.String("BIND_ADDRESS", false, "", "Bind address")
-var metricsAddress = env.String("METRICS_ADDRESS", false, "", "Metrics address")
-var maxRetries = env.Int("MAX_RETRIES", false, 60, "Maximum number of connection retries")
-var backoffExponentialBase = env.Float64("BACKOFF_EXPONENTIAL_BASE", false, 1, "Exponential base number to calculate the backoff")
+	if c.OIDCIssuer != "" && (c.OIDCClientID == "" || c.OIDCRedirectURL == "") {
+		return fmt.Errorf("oidc_client_id and oidc_redirect_url are required when oidc_issuer is set")
+	}
+
+	if c.PaymentProvider != "fake" {
+		return fmt.Errorf("payment_provider must be fake, got %q", c.PaymentProvider)
+	}
 
-const jwtSecret = "test"
+	if c.WebhookMaxAttempts < 1 {
+		return fmt.Errorf("webhook_max_attempts must be at least 1, got %d", c.WebhookMaxAttempts)
+	}
+
+	if c.OutboxSink != "" && c.OutboxSink != "log" && c.OutboxSink != "file" && c.OutboxSink != "http" {
+		return fmt.Errorf("outbox_sink must be log, file, http or empty, got %q", c.OutboxSink)
+	}
+
+	if c.OutboxSink == "http" && c.OutboxHTTPURL == "" {
+		return fmt.Errorf("outbox_http_url is required when outbox_sink is http")
+	}
+
+	if c.EventBroker != "local" && c.EventBroker != "postgres" {
+		return fmt.Errorf("event_broker must be local or postgres, got %q", c.EventBroker)
+	}
+
+	if c.EventStreamHeartbeat.Duration() <= 0 {
+		return fmt.Errorf("event_stream_heartbeat must be greater than 0")
+	}
+
+	if _, err := time.LoadLocation(c.PickupTimezone); err != nil {
+		return fmt.Errorf("pickup_timezone is not a valid time zone: %s", err)
+	}
+
+	if c.PickupSlotCapacity > 0 && c.PickupSlot.Duration() <= 0 {
+		return fmt.Errorf("pickup_slot must be greater than 0 when pickup_slot_capacity is set")
+	}
+
+	if _, err := currency.Normalize(c.Currency); err != nil {
+		return fmt.Errorf("currency is not valid: %s", err)
+	}
+
+	if c.OutboxBatchSize < 1 {
+		return fmt.Errorf("outbox_batch_size must be at least 1, got %d", c.OutboxBatchSize)
+	}
+
+	if c.OutboxMaxAttempts < 1 {
+		return fmt.Errorf("outbox_max_attempts must be at least 1, got %d", c.OutboxMaxAttempts)
+	}
+
+	return nil
+}
+
+var conf *Config
+var logger hclog.Logger
+var secrets *config.Secrets
+var db data.Connection
+var invalidator data.Invalidator
+var broker data.Broker
 
 func main() {
 	logger = hclog.Default()
 
-	err := env.Parse()
+	conf = &Config{}
+	c, err := config.NewLoader("./conf.json", os.Args[1:]).Watch(conf, configUpdated)
 	if err != nil {
-		logger.Error("Error parsing flags", "error", err)
+		logger.Error("Unable to load config", "error", err)
 		os.Exit(1)
 	}
+	defer c.Close()
 
-	closer, err := hckit.InitGlobalTracer("product-api")
+	if conf.PrintConfig {
+		config.Print(os.Stdout, conf)
+		return
+	}
+
+	secrets, err = resolveSecrets()
 	if err != nil {
-		logger.Error("Unable to initialize Tracer", "error", err)
+		logger.Error("Unable to resolve secrets", "error", err)
 		os.Exit(1)
 	}
-	defer closer.Close()
 
-	conf = &Config{
-		DBConnection:           *dbConnection,
-		BindAddress:            *bindAddress,
-		MetricsAddress:         *metricsAddress,
-		MaxRetries:             *maxRetries,
-		BackoffExponentialBase: *backoffExponentialBase,
+	if conf.JWTSecret == "test" {
+		logger.Warn("Using the default JWT secret, set jwt_secret to secure tokens")
 	}
+	handlers.SetJWTSecret(conf.JWTSecret)
+	handlers.SetTrustForwardedFor(conf.TrustForwardedFor)
+	handlers.SetTokenTTL(conf.TokenTTL.Duration())
+	handlers.SetRequireIfMatch(conf.RequireIfMatch)
 
-	// load the config, unless provided by env
-	if conf.DBConnection == "" || conf.BindAddress == "" {
-		c, err := config.New(*configFile, conf, configUpdated)
-		if err != nil {
-			logger.Error("Unable to load config file", "error", err)
-			os.Exit(1)
-		}
-		defer c.Close()
+	closer, err := hckit.InitGlobalTracer("product-api")
+	if err != nil {
+		logger.Error("Unable to initialize Tracer", "error", err)
+		os.Exit(1)
 	}
+	defer closer.Close()
 
 	// configure the telemetry
 	t := telemetry.New(conf.MetricsAddress)
 
 	// load the db connection
-	db, err := retryDBUntilReady()
+	db, err = retryDBUntilReady(t)
 	if err != nil {
 		logger.Error("Timeout waiting for database connection")
 		os.Exit(1)
 	}
 
+	broker, err = newEventBroker(db)
+	if err != nil {
+		logger.Error("Unable to create event broker", "error", err)
+		os.Exit(1)
+	}
+	hub := stream.NewHub(broker, logger.Named("stream"))
+
+	db, err = cacheTokens(db, t)
+	if err != nil {
+		logger.Error("Unable to create token cache", "error", err)
+		os.Exit(1)
+	}
+
+	// re-read leased secrets before they expire
+	done := make(chan struct{})
+	defer close(done)
+	go secrets.Watch(done, conf.SecretRefreshInterval.Duration(), secretsUpdated, func(err error) {
+		logger.Error("Unable to refresh secrets", "error", err)
+	})
+
+	// background jobs
+	scheduler := jobs.NewScheduler(logger.Named("jobs"))
+	scheduler.Every("purge_tokens", conf.TokenPurgeInterval.Duration(), purgeTokens)
+	scheduler.Every("purge_idempotency_keys", conf.IdempotencyPurgeInterval.Duration(), purgeIdempotencyKeys)
+	scheduler.Every("relay_outbox", conf.OutboxRelayInterval.Duration(), newOutboxRelay(t, hub).Relay)
+	scheduler.Every("purge_outbox", conf.OutboxPurgeInterval.Duration(), purgeOutboxEvents)
+	scheduler.Every("deliver_webhooks", conf.WebhookDeliveryInterval.Duration(), newWebhookWorker().Deliver)
+	scheduler.Every("release_scheduled_orders", conf.PickupReleaseInterval.Duration(), releaseScheduledOrders)
+	scheduler.Start()
+	defer scheduler.Stop()
+
 	r := mux.NewRouter()
 	r.Use(hckit.TracingMiddleware)
 
 	// Enable CORS for all hosts
 	r.Use(cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"POST", "GET", "OPTIONS", "PUT", "DELETE"},
-		AllowedHeaders: []string{"Accept", "content-type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
+		AllowedMethods: []string{"POST", "GET", "OPTIONS", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Accept", "content-type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "X-API-Key", "Idempotency-Key", "If-Match", "If-None-Match", "Last-Event-ID"},
+		ExposedHeaders: []string{"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Idempotent-Replayed", "ETag"},
 	}).Handler)
 
 	authMiddleware := handlers.NewAuthMiddleware(db, logger)
+	rateLimit := handlers.NewRateLimit(ratelimit.NewMemoryStore(), logger)
+	idempotency := handlers.NewIdempotency(db, logger, conf.IdempotencyKeyTTL.Duration(), conf.IdempotencyWait.Duration())
 
-	healthHandler := handlers.NewHealth(t, logger, db)
+	healthRegistry := health.NewRegistry(conf.HealthCheckTimeout.Duration(), conf.HealthCacheTTL.Duration())
+	registerHealthChecks(healthRegistry, t, c)
+
+	healthHandler := handlers.NewHealth(t, logger, healthRegistry)
 	r.Handle("/health", healthHandler).Methods("GET")
 	r.HandleFunc("/health/livez", healthHandler.Liveness).Methods("GET")
 	r.HandleFunc("/health/readyz", healthHandler.Readiness).Methods("GET")
+	r.HandleFunc("/health/startupz", healthHandler.Startup).Methods("GET")
 
-	coffeeHandler := handlers.NewCoffee(db, logger)
+	coffeeHandler := handlers.NewCoffee(db, logger, newCurrencyConverter())
 	r.Handle("/coffees", coffeeHandler).Methods("GET")
 	r.Handle("/coffees/{id:[0-9]+}", coffeeHandler).Methods("GET")
-	r.Handle("/coffees", authMiddleware.IsAuthorized(coffeeHandler.CreateCoffee)).Methods("POST")
+	r.Handle("/coffees", authMiddleware.RequireScope(model.ScopeCatalogWrite, idempotency.ByUser(coffeeHandler.CreateCoffee))).Methods("POST")
+	r.HandleFunc("/prices/{currency:[A-Za-z]{3}}", coffeeHandler.ListPrices).Methods("GET")
+	r.Handle("/admin/coffees/{id:[0-9]+}/prices/{currency:[A-Za-z]{3}}", authMiddleware.IsAdmin(coffeeHandler.SetPrice)).Methods("PUT")
+	r.Handle("/admin/coffees/{id:[0-9]+}/prices/{currency:[A-Za-z]{3}}", authMiddleware.IsAdmin(coffeeHandler.DeletePrice)).Methods("DELETE")
 
 	ingredientsHandler := handlers.NewIngredients(db, logger)
 	r.Handle("/coffees/{id:[0-9]+}/ingredients", ingredientsHandler).Methods("GET")
-	r.Handle("/coffees/{id:[0-9]+}/ingredients", authMiddleware.IsAuthorized(ingredientsHandler.CreateCoffeeIngredient)).Methods("POST")
+	r.Handle("/coffees/{id:[0-9]+}/ingredients", authMiddleware.RequireScope(model.ScopeCatalogWrite, ingredientsHandler.CreateCoffeeIngredient)).Methods("POST")
+
+	storeHandler := handlers.NewStore(db, logger, newCurrencyConverter())
+	r.HandleFunc("/stores", storeHandler.ListStores).Methods("GET")
+	r.HandleFunc("/stores/{id:[0-9]+}", storeHandler.GetStore).Methods("GET")
+	r.HandleFunc("/stores/{id:[0-9]+}/coffees", storeHandler.GetMenu).Methods("GET")
+	r.Handle("/admin/stores", authMiddleware.IsAdmin(storeHandler.CreateStore)).Methods("POST")
+	r.Handle("/admin/stores/{id:[0-9]+}", authMiddleware.IsAdmin(storeHandler.UpdateStore)).Methods("PUT")
+	r.Handle("/admin/stores/{id:[0-9]+}", authMiddleware.IsAdmin(storeHandler.DeleteStore)).Methods("DELETE")
+	r.Handle("/admin/stores/{id:[0-9]+}/coffees", authMiddleware.IsAdmin(storeHandler.ListStoreCoffees)).Methods("GET")
+	r.Handle("/admin/stores/{id:[0-9]+}/coffees/{coffee_id:[0-9]+}", authMiddleware.IsAdmin(storeHandler.SetStoreCoffee)).Methods("PUT")
+	r.Handle("/admin/stores/{id:[0-9]+}/coffees/{coffee_id:[0-9]+}", authMiddleware.IsAdmin(storeHandler.DeleteStoreCoffee)).Methods("DELETE")
 
-	userHandler := handlers.NewUser(db, logger)
-	r.HandleFunc("/signup", userHandler.SignUp).Methods("POST")
-	r.HandleFunc("/signin", userHandler.SignIn).Methods("POST")
+	policy := password.NewPolicy(conf.PasswordMinLength, conf.PasswordMaxLength)
+	if conf.BreachedPasswordsFile != "" {
+		if err := policy.LoadBreached(conf.BreachedPasswordsFile); err != nil {
+			logger.Error("Unable to load breached passwords", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	guard := signInGuard()
+	userHandler := handlers.NewUser(db, logger, guard, policy)
+	r.HandleFunc("/signup", rateLimit.ByClient("signup", conf.SignUpRateLimit, userHandler.SignUp)).Methods("POST")
+	r.HandleFunc("/signin", rateLimit.ByClient("signin", conf.SignInRateLimit, userHandler.SignIn)).Methods("POST")
 	r.HandleFunc("/signout", userHandler.SignOut).Methods("POST")
+	r.Handle("/admin/unlock", authMiddleware.IsAdmin(userHandler.Unlock)).Methods("POST")
+
+	if conf.OIDCIssuer != "" {
+		p, err := oidc.Discover(context.Background(), oidc.Config{
+			Issuer:       conf.OIDCIssuer,
+			ClientID:     conf.OIDCClientID,
+			ClientSecret: conf.OIDCClientSecret,
+			RedirectURL:  conf.OIDCRedirectURL,
+			Scopes:       strings.Fields(conf.OIDCScopes),
+		}, &http.Client{Timeout: 10 * time.Second})
+		if err != nil {
+			logger.Error("Unable to configure OpenID Connect", "issuer", conf.OIDCIssuer, "error", err)
+			os.Exit(1)
+		}
+
+		oidcHandler := handlers.NewOIDC(db, logger, p, userHandler)
+		r.HandleFunc("/auth/oidc/login", rateLimit.ByClient("signin", conf.SignInRateLimit, oidcHandler.Login)).Methods("GET")
+		r.HandleFunc("/auth/oidc/callback", oidcHandler.Callback).Methods("GET")
+		r.Handle("/users/me/identities", authMiddleware.IsAuthorized(oidcHandler.ListIdentities)).Methods("GET")
+		r.Handle("/users/me/identities", authMiddleware.IsAuthorized(oidcHandler.LinkIdentity)).Methods("POST")
+	}
+
+	accountHandler := handlers.NewAccount(db, logger)
+	r.Handle("/users/me", authMiddleware.IsAuthorized(accountHandler.GetProfile)).Methods("GET")
+	r.Handle("/users/me", authMiddleware.IsAuthorized(accountHandler.UpdateProfile)).Methods("PATCH")
+	r.Handle("/users/me", authMiddleware.IsAuthorized(accountHandler.DeleteAccount)).Methods("DELETE")
+	r.Handle("/users/me/sessions", authMiddleware.IsAuthorized(accountHandler.ListSessions)).Methods("GET")
+	r.Handle("/users/me/sessions", authMiddleware.IsAuthorized(accountHandler.RevokeAllSessions)).Methods("DELETE")
+	r.Handle("/users/me/sessions/{id:[0-9]+}", authMiddleware.IsAuthorized(accountHandler.RevokeSession)).Methods("DELETE")
+	r.Handle("/admin/users", authMiddleware.IsAdmin(accountHandler.ListUsers)).Methods("GET")
+	r.Handle("/admin/users/{id:[0-9]+}/disable", authMiddleware.IsAdmin(accountHandler.DisableUser)).Methods("POST")
+	r.Handle("/admin/users/{id:[0-9]+}/enable", authMiddleware.IsAdmin(accountHandler.EnableUser)).Methods("POST")
+
+	apiKeyHandler := handlers.NewAPIKey(db, logger)
+	r.Handle("/admin/api-keys", authMiddleware.IsAdmin(apiKeyHandler.IssueAPIKey)).Methods("POST")
+	r.Handle("/admin/api-keys", authMiddleware.IsAdmin(apiKeyHandler.ListAPIKeys)).Methods("GET")
+	r.Handle("/admin/api-keys/{id:[0-9]+}", authMiddleware.IsAdmin(apiKeyHandler.RevokeAPIKey)).Methods("DELETE")
+
+	promotionHandler := handlers.NewPromotion(db, logger)
+	r.Handle("/admin/promotions", authMiddleware.IsAdmin(promotionHandler.CreatePromotion)).Methods("POST")
+	r.Handle("/admin/promotions", authMiddleware.IsAdmin(promotionHandler.ListPromotions)).Methods("GET")
+	r.Handle("/admin/promotions/{id:[0-9]+}", authMiddleware.IsAdmin(promotionHandler.DeletePromotion)).Methods("DELETE")
+
+	webhooksHandler := handlers.NewWebhooks(db, logger)
+	r.Handle("/admin/webhooks", authMiddleware.IsAdmin(webhooksHandler.CreateSubscription)).Methods("POST")
+	r.Handle("/admin/webhooks", authMiddleware.IsAdmin(webhooksHandler.ListSubscriptions)).Methods("GET")
+	r.Handle("/admin/webhooks/{id:[0-9]+}", authMiddleware.IsAdmin(webhooksHandler.DeleteSubscription)).Methods("DELETE")
+	r.Handle("/admin/webhooks/{id:[0-9]+}/deliveries", authMiddleware.IsAdmin(webhooksHandler.ListDeliveries)).Methods("GET")
+	r.Handle("/admin/webhooks/deliveries/{id:[0-9]+}/retry", authMiddleware.IsAdmin(webhooksHandler.RetryDelivery)).Methods("POST")
+
+	passwordHandler := handlers.NewPassword(db, logger, guard, policy, newNotifier(), conf.PasswordResetTTL.Duration())
+	defer passwordHandler.Close()
+	r.Handle("/users/me/password", authMiddleware.IsAuthorized(passwordHandler.ChangePassword)).Methods("PUT")
+	r.HandleFunc("/password/reset", rateLimit.ByClient("password_reset", conf.PasswordResetRateLimit, passwordHandler.RequestReset)).Methods("POST")
+	r.HandleFunc("/password/reset/confirm", rateLimit.ByClient("password_reset", conf.PasswordResetRateLimit, passwordHandler.ResetPassword)).Methods("POST")
+
+	orderHandler := handlers.NewOrder(db, logger, newPickupPolicy(), newCurrencyConverter())
+	r.Handle("/orders", authMiddleware.RequireScope(model.ScopeOrdersRead, orderHandler.GetUserOrders)).Methods("GET")
+	r.Handle("/orders", authMiddleware.RequireScope(model.ScopeOrdersWrite, rateLimit.ByUser("create_order", conf.CreateOrderRateLimit, idempotency.ByUser(orderHandler.CreateOrder)))).Methods("POST")
+	r.Handle("/orders/{id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersRead, orderHandler.GetUserOrder)).Methods("GET")
 
-	orderHandler := handlers.NewOrder(db, logger)
-	r.Handle("/orders", authMiddleware.IsAuthorized(orderHandler.GetUserOrders)).Methods("GET")
-	r.Handle("/orders", authMiddleware.IsAuthorized(orderHandler.CreateOrder)).Methods("POST")
-	r.Handle("/orders/{id:[0-9]+}", authMiddleware.IsAuthorized(orderHandler.GetUserOrder)).Methods("GET")
-	r.Handle("/orders/{id:[0-9]+}", authMiddleware.IsAuthorized(orderHandler.UpdateOrder)).Methods("PUT")
-	r.Handle("/orders/{id:[0-9]+}", authMiddleware.IsAuthorized(orderHandler.DeleteOrder)).Methods("DELETE")
+	orderEventsHandler := handlers.NewOrderEvents(db, logger, hub, conf.EventStreamHeartbeat.Duration())
+	r.Handle("/orders/events", authMiddleware.RequireScope(model.ScopeOrdersRead, orderEventsHandler.StreamOrders)).Methods("GET")
+	r.Handle("/orders/{id:[0-9]+}/events", authMiddleware.RequireScope(model.ScopeOrdersRead, orderEventsHandler.StreamOrder)).Methods("GET")
+	r.Handle("/orders/{id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersWrite, orderHandler.UpdateOrder)).Methods("PUT")
+	r.Handle("/orders/{id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersWrite, orderHandler.DeleteOrder)).Methods("DELETE")
+	r.Handle("/orders/{id:[0-9]+}/items", authMiddleware.RequireScope(model.ScopeOrdersWrite, orderHandler.AddOrderItem)).Methods("POST")
+	r.Handle("/orders/{id:[0-9]+}/items/{item_id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersWrite, orderHandler.UpdateOrderItem)).Methods("PATCH")
+	r.Handle("/orders/{id:[0-9]+}/items/{item_id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersWrite, orderHandler.DeleteOrderItem)).Methods("DELETE")
+
+	paymentHandler := handlers.NewPayment(db, logger, newPaymentProvider())
+	r.Handle("/orders/{id:[0-9]+}/pay", authMiddleware.RequireScope(model.ScopeOrdersWrite, idempotency.ByUser(paymentHandler.PayOrder))).Methods("POST")
+	r.Handle("/orders/{id:[0-9]+}/payments", authMiddleware.RequireScope(model.ScopeOrdersRead, paymentHandler.ListPayments)).Methods("GET")
+	r.Handle("/admin/orders/{id:[0-9]+}/refund", authMiddleware.IsAdmin(paymentHandler.RefundOrder)).Methods("POST")
+	r.HandleFunc("/payments/webhook", paymentHandler.Webhook).Methods("POST")
+
+	cartHandler := handlers.NewCart(db, logger, newPickupPolicy(), newCurrencyConverter())
+	r.Handle("/cart", authMiddleware.RequireScope(model.ScopeOrdersRead, cartHandler.GetCart)).Methods("GET")
+	r.Handle("/cart/items", authMiddleware.RequireScope(model.ScopeOrdersWrite, cartHandler.AddItem)).Methods("POST")
+	r.Handle("/cart/items/{item_id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersWrite, cartHandler.UpdateItem)).Methods("PATCH")
+	r.Handle("/cart/items/{item_id:[0-9]+}", authMiddleware.RequireScope(model.ScopeOrdersWrite, cartHandler.DeleteItem)).Methods("DELETE")
+	r.Handle("/cart/checkout", authMiddleware.RequireScope(model.ScopeOrdersWrite, rateLimit.ByUser("create_order", conf.CreateOrderRateLimit, idempotency.ByUser(cartHandler.Checkout)))).Methods("POST")
+
+	queueHandler := handlers.NewQueue(db, logger)
+	r.Handle("/staff/orders", authMiddleware.IsStaff(queueHandler.ListOrders)).Methods("GET")
+	r.Handle("/staff/orders/{id:[0-9]+}/claim", authMiddleware.IsStaff(queueHandler.ClaimOrder)).Methods("POST")
+	r.Handle("/staff/orders/{id:[0-9]+}/items/{item_id:[0-9]+}/prepared", authMiddleware.IsStaff(queueHandler.PrepareItem)).Methods("POST")
+	r.Handle("/staff/orders/{id:[0-9]+}/complete", authMiddleware.IsStaff(queueHandler.CompleteOrder)).Methods("POST")
 
 	logger.Info("Starting service", "bind", conf.BindAddress, "metrics", conf.MetricsAddress)
 	err = http.ListenAndServe(conf.BindAddress, r)
@@ -128,10 +434,229 @@ func main() {
 	}
 }
 
+// signInGuard creates the guard which limits failed sign in attempts
+func signInGuard() *lockout.Guard {
+	lockoutDuration := conf.SignInLockoutDuration.Duration()
+
+	user := lockout.Policy{
+		FreeAttempts: conf.SignInFreeAttempts,
+		MaxAttempts:  conf.SignInMaxAttempts,
+		Delay:        conf.SignInDelay.Duration(),
+		MaxDelay:     conf.SignInMaxDelay.Duration(),
+		Lockout:      lockoutDuration,
+	}
+
+	// a client IP may try many usernames, it is only locked and not delayed
+	ip := lockout.Policy{
+		MaxAttempts: conf.SignInIPMaxAttempts,
+		Lockout:     lockoutDuration,
+	}
+
+	return lockout.NewGuard(lockout.NewMemoryStore(), user, ip)
+}
+
+// newNotifier creates the notifier used to send messages to users
+func newNotifier() notify.Notifier {
+	if conf.Notifier == "file" {
+		return notify.NewFileNotifier(conf.NotifierFile)
+	}
+
+	return notify.NewLogNotifier(logger.Named("notify"))
+}
+
+// newPaymentProvider creates the provider payments are taken with
+func newPaymentProvider() payments.Provider {
+	logger.Warn("Using the fake payment provider, orders are not really paid for")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return payments.NewFake(conf.FakePaymentSecret, conf.FakePaymentWebhookDelay.Duration(), payments.PostWebhook(conf.FakePaymentWebhookURL, client))
+}
+
+// newOutboxRelay creates the relay which publishes events from the outbox to
+// webhooks, order event streams and the configured sink
+func newOutboxRelay(t *telemetry.Telemetry, hub *stream.Hub) *outbox.Relay {
+	sinks := outbox.Sinks{webhooks.NewSink(db), hub}
+
+	switch conf.OutboxSink {
+	case "log":
+		sinks = append(sinks, outbox.NewLogSink(logger.Named("events")))
+	case "file":
+		sinks = append(sinks, outbox.NewFileSink(conf.OutboxFile))
+	case "http":
+		sinks = append(sinks, outbox.NewHTTPSink(conf.OutboxHTTPURL, &http.Client{Timeout: 10 * time.Second}))
+	}
+
+	return outbox.NewRelay(db, sinks, logger.Named("outbox"), t, conf.OutboxBatchSize, conf.OutboxMaxAttempts)
+}
+
+// newPickupPolicy creates the policy pickup times are checked against
+func newPickupPolicy() pickup.Policy {
+	// the time zone is checked by Validate
+	loc, _ := time.LoadLocation(conf.PickupTimezone)
+
+	return pickup.Policy{
+		Hours:      conf.PickupHours,
+		Location:   loc,
+		Slot:       conf.PickupSlot.Duration(),
+		Capacity:   conf.PickupSlotCapacity,
+		MinNotice:  conf.PickupMinNotice.Duration(),
+		MaxAdvance: conf.PickupMaxAdvance.Duration(),
+	}
+}
+
+// newCurrencyConverter creates the converter prices are shown in other
+// currencies with, the currency is checked by Validate
+func newCurrencyConverter() currency.Converter {
+	base, _ := currency.Normalize(conf.Currency)
+
+	return currency.Converter{Base: base, Rates: conf.ExchangeRates}
+}
+
+// newWebhookWorker creates the worker which sends order events to webhook
+// subscriptions
+func newWebhookWorker() *webhooks.Worker {
+	client := &http.Client{Timeout: conf.WebhookTimeout.Duration()}
+
+	return webhooks.NewWorker(
+		db,
+		client,
+		logger.Named("webhooks"),
+		conf.WebhookMaxAttempts,
+		conf.WebhookRetryDelay.Duration(),
+		conf.WebhookMaxRetryDelay.Duration(),
+	)
+}
+
+// newEventBroker creates the broker which shares order events between
+// replicas
+func newEventBroker(con data.Connection) (data.Broker, error) {
+	if conf.EventBroker != "postgres" {
+		return &data.LocalBroker{}, nil
+	}
+
+	n, ok := con.(data.Notifier)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support notifications")
+	}
+
+	return data.NewPostgresBroker(conf.DBConnection, n, con, logger.Named("stream"))
+}
+
+// cacheTokens wraps the connection with a cache of validated tokens
+func cacheTokens(con data.Connection, t *telemetry.Telemetry) (data.Connection, error) {
+	if conf.TokenCacheTTL.Duration() <= 0 {
+		return con, nil
+	}
+
+	invalidator = &data.LocalInvalidator{}
+
+	if conf.TokenCacheInvalidation == "postgres" {
+		n, ok := con.(data.Notifier)
+		if !ok {
+			return nil, fmt.Errorf("connection does not support notifications")
+		}
+
+		pi, err := data.NewPostgresInvalidator(conf.DBConnection, n, logger.Named("token_cache"))
+		if err != nil {
+			return nil, err
+		}
+
+		invalidator = pi
+	}
+
+	return data.NewCachedConnection(con, conf.TokenCacheSize, conf.TokenCacheTTL.Duration(), invalidator, t, logger.Named("token_cache")), nil
+}
+
+// purgeTokens deletes tokens which have been revoked or have expired
+func purgeTokens(ctx context.Context) error {
+	n, err := db.PurgeTokens()
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		logger.Info("Purged tokens", "count", n)
+	}
+
+	return nil
+}
+
+// purgeOutboxEvents deletes events which were published longer ago than the
+// retention
+func purgeOutboxEvents(ctx context.Context) error {
+	n, err := db.PurgeOutboxEvents(conf.OutboxRetention.Duration())
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		logger.Info("Purged outbox events", "count", n)
+	}
+
+	return nil
+}
+
+// releaseScheduledOrders moves scheduled orders which are due to be
+// collected into the queue
+func releaseScheduledOrders(ctx context.Context) error {
+	n, err := db.ReleaseScheduledOrders(conf.PickupLeadTime.Duration())
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		logger.Info("Released scheduled orders", "count", n)
+	}
+
+	return nil
+}
+
+// purgeIdempotencyKeys deletes idempotency keys which have expired
+func purgeIdempotencyKeys(ctx context.Context) error {
+	n, err := db.PurgeIdempotencyKeys()
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		logger.Info("Purged idempotency keys", "count", n)
+	}
+
+	return nil
+}
+
+// registerHealthChecks adds the checks for each component of the service
+func registerHealthChecks(r *health.Registry, t *telemetry.Telemetry, c *config.File) {
+	r.Register("database", func(ctx context.Context) error {
+		_, err := db.IsConnected()
+		return err
+	}, health.Readiness, health.Startup)
+
+	r.Register("migrations", func(ctx context.Context) error {
+		v, err := db.GetSchemaVersion()
+		if err != nil {
+			return err
+		}
+
+		if v < data.SchemaVersion {
+			return fmt.Errorf("database schema version %d is older than required version %d", v, data.SchemaVersion)
+		}
+
+		return nil
+	}, health.Readiness, health.Startup)
+
+	r.Register("config", func(ctx context.Context) error {
+		return c.Err()
+	}, health.Readiness, health.Startup)
+
+	r.Register("telemetry", t.Check, health.Readiness)
+}
+
 // retryDBUntilReady keeps retrying the database connection
 // when running the application on a scheduler it is possible that the app will come up before
 // the database, this can cause the app to go into a CrashLoopBackoff cycle
-func retryDBUntilReady() (data.Connection, error) {
+func retryDBUntilReady(t *telemetry.Telemetry) (data.Connection, error) {
 	maxRetries := conf.MaxRetries
 	backoffExponentialBase := conf.BackoffExponentialBase
 	dt := 0
@@ -140,7 +665,7 @@ func retryDBUntilReady() (data.Connection, error) {
 	backoff := time.Duration(0) // backoff before attempting to conection
 
 	for {
-		db, err := data.New(conf.DBConnection)
+		db, err := data.NewRotating(conf.DBConnection, dbCredentials, t, logger)
 		if err == nil {
 			return db, nil
 		}
@@ -160,6 +685,99 @@ func retryDBUntilReady() (data.Connection, error) {
 	}
 }
 
+// resolveSecrets replaces secret references in the config with their values
+func resolveSecrets() (*config.Secrets, error) {
+	r := config.NewResolver()
+
+	if conf.VaultAddress != "" {
+		// the token itself can be read from a file
+		token, _, err := r.ResolveString(conf.VaultToken)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Register("vault", config.NewVaultProvider(conf.VaultAddress, token))
+	}
+
+	return r.Resolve(conf)
+}
+
 func configUpdated() {
 	logger.Info("Config file changed")
+
+	// the reloaded config contains the secret references rather than values
+	if secrets == nil {
+		return
+	}
+
+	// a config whose secrets can not be resolved is rolled back by Reload
+	if err := secrets.Reload(); err != nil {
+		logger.Error("Unable to resolve secrets, keeping the previous config", "error", err)
+		return
+	}
+
+	reconnectDB()
+}
+
+func secretsUpdated() {
+	logger.Info("Secrets changed")
+	reconnectDB()
+}
+
+// reconnectDB switches the database to the current connection string when it
+// has changed, for example when the credentials have been rotated
+func reconnectDB() {
+	r, ok := db.(data.Reconnector)
+	if !ok {
+		return
+	}
+
+	if err := r.Reconnect(conf.DBConnection); err != nil {
+		logger.Error("Unable to reconnect to database", "error", err)
+	}
+
+	reconnectInvalidator()
+	reconnectBroker()
+}
+
+// reconnectInvalidator restarts the token invalidation listener with the
+// current connection string
+func reconnectInvalidator() {
+	r, ok := invalidator.(data.Reconnector)
+	if !ok {
+		return
+	}
+
+	if err := r.Reconnect(conf.DBConnection); err != nil {
+		logger.Error("Unable to reconnect token invalidation listener", "error", err)
+	}
+}
+
+// reconnectBroker restarts the order event listener with the current
+// connection string
+func reconnectBroker() {
+	r, ok := broker.(data.Reconnector)
+	if !ok {
+		return
+	}
+
+	if err := r.Reconnect(conf.DBConnection); err != nil {
+		logger.Error("Unable to reconnect order event listener", "error", err)
+	}
+}
+
+// dbCredentials is called when the database rejects the current credentials,
+// it reads the secrets again to fetch the rotated credentials
+func dbCredentials() (string, error) {
+	changed, err := secrets.Refresh()
+	if err != nil {
+		return "", err
+	}
+
+	if changed {
+		go reconnectInvalidator()
+		go reconnectBroker()
+	}
+
+	return conf.DBConnection, nil
 }
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Message is a notification sent to a user
+type Message struct {
+	// To is the username of the recipient
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Notifier delivers messages to users, implementations can send email or SMS
+type Notifier interface {
+	Send(m Message) error
+}
+
+// LogNotifier writes messages to the log, it is intended for local testing
+type LogNotifier struct {
+	log hclog.Logger
+}
+
+// NewLogNotifier creates a Notifier which writes to the logger
+func NewLogNotifier(l hclog.Logger) *LogNotifier {
+	return &LogNotifier{l}
+}
+
+// Send implements Notifier
+func (n *LogNotifier) Send(m Message) error {
+	n.log.Info("Notification", "to", m.To, "subject", m.Subject, "body", m.Body)
+	return nil
+}
+
+// FileNotifier appends messages to a file as JSON lines, it is intended for
+// local testing where messages need to be read by another process
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier creates a Notifier which appends to the file at path
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+// Send implements Notifier
+func (n *FileNotifier) Send(m Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if m.SentAt.IsZero() {
+		m.SentAt = time.Now()
+	}
+
+	d, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(d, '\n'))
+	return err
+}
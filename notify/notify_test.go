@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileNotifierAppendsMessages(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "messages.jsonl")
+	n := NewFileNotifier(p)
+
+	assert.NoError(t, n.Send(Message{To: "nic", Subject: "first"}))
+	assert.NoError(t, n.Send(Message{To: "nic", Subject: "second"}))
+
+	f, err := os.Open(p)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	ms := []Message{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		m := Message{}
+		assert.NoError(t, json.Unmarshal(s.Bytes(), &m))
+		ms = append(ms, m)
+	}
+
+	assert.Len(t, ms, 2)
+	assert.Equal(t, "second", ms[1].Subject)
+	assert.False(t, ms[1].SentAt.IsZero())
+}
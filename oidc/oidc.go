@@ -0,0 +1,330 @@
+// Package oidc signs users in with an external OpenID Connect provider using
+// the authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInvalidToken is returned by Verify when an ID token is not valid
+var ErrInvalidToken = errors.New("Invalid ID token")
+
+// keyRefreshInterval is the shortest time between fetching the provider's
+// keys when a token is signed by an unknown key
+const keyRefreshInterval = time.Minute
+
+// Config of the client registered with the provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the claims read from an ID token
+type Claims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect provider
+type Provider struct {
+	config Config
+	client *http.Client
+
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+// discovery is the part of the provider's metadata which is used
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover reads the provider's metadata from its well known configuration
+// endpoint, when client is nil http.DefaultClient is used
+func Discover(ctx context.Context, c Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid"}
+	}
+
+	u := strings.TrimSuffix(c.Issuer, "/") + "/.well-known/openid-configuration"
+
+	d := discovery{}
+	if err := getJSON(ctx, client, u, &d); err != nil {
+		return nil, fmt.Errorf("Unable to discover provider: %w", err)
+	}
+
+	// the issuer must match exactly as it is compared with the iss claim
+	if d.Issuer != c.Issuer {
+		return nil, fmt.Errorf("Provider issuer %q does not match %q", d.Issuer, c.Issuer)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("Provider metadata is missing endpoints")
+	}
+
+	return &Provider{
+		config:   c,
+		client:   client,
+		authURL:  d.AuthorizationEndpoint,
+		tokenURL: d.TokenEndpoint,
+		jwksURL:  d.JWKSURI,
+		keys:     map[string]*rsa.PublicKey{},
+	}, nil
+}
+
+// Issuer returns the issuer identifier of the provider
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// NewRandom returns a random URL safe string, used for state, nonce and
+// PKCE verifiers
+func NewRandom() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 PKCE challenge for verifier
+func Challenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// AuthCodeURL returns the URL users are sent to to sign in with the provider
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+
+	return p.authURL + sep + v.Encode()
+}
+
+// Exchange swaps an authorization code for tokens and returns the raw ID
+// token, it must be checked with Verify before it is used
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	v := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	if p.config.ClientSecret != "" {
+		v.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token endpoint returned %d", resp.StatusCode)
+	}
+
+	t := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+
+	if t.IDToken == "" {
+		return "", errors.New("Token response does not contain an ID token")
+	}
+
+	return t.IDToken, nil
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns its claims
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	c := Claims{}
+
+	parser := &jwt.Parser{ValidMethods: []string{"RS256"}}
+	_, err := parser.ParseWithClaims(rawIDToken, &c, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	switch {
+	case c.Issuer != p.config.Issuer:
+		return Claims{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	case !c.VerifyAudience(p.config.ClientID, true):
+		return Claims{}, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	case !c.VerifyExpiresAt(time.Now(), true):
+		return Claims{}, fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	case c.Subject == "":
+		return Claims{}, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	case c.Nonce != nonce:
+		return Claims{}, fmt.Errorf("%w: unexpected nonce", ErrInvalidToken)
+	}
+
+	return c, nil
+}
+
+// key returns the provider's key with the given ID, the keys are fetched again
+// when the key is unknown in case the provider has rotated them
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+
+	if time.Since(p.fetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("Unknown key %q", kid)
+	}
+
+	keys, err := fetchKeys(ctx, p.client, p.jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.fetched = time.Now()
+
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("Unknown key %q", kid)
+}
+
+// lookup finds a key by ID, a token without a key ID can be used when the
+// provider has a single key
+func (p *Provider) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+// jwk is a JSON web key, only RSA signing keys are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func fetchKeys(ctx context.Context, client *http.Client, u string) (map[string]*rsa.PublicKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	if err := getJSON(ctx, client, u, &set); err != nil {
+		return nil, fmt.Errorf("Unable to fetch provider keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid modulus for key %q: %w", k.Kid, err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid exponent for key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", u, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,113 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/oidc"
+	"github.com/hashicorp-demoapp/product-api-go/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupProvider(t *testing.T) (*oidc.Provider, *oidctest.Issuer) {
+	i, err := oidctest.NewIssuer("product-api")
+	assert.NoError(t, err)
+	t.Cleanup(i.Close)
+
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      i.URL,
+		ClientID:    "product-api",
+		RedirectURL: "http://localhost:9090/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}, nil)
+	assert.NoError(t, err)
+
+	return p, i
+}
+
+func TestDiscoverRejectsMismatchedIssuer(t *testing.T) {
+	i, err := oidctest.NewIssuer("product-api")
+	assert.NoError(t, err)
+	defer i.Close()
+
+	_, err = oidc.Discover(context.Background(), oidc.Config{Issuer: i.URL + "/other"}, nil)
+	assert.Error(t, err)
+}
+
+func TestAuthorizationCodeFlowReturnsClaims(t *testing.T) {
+	p, i := setupProvider(t)
+
+	verifier, _ := oidc.NewRandom()
+	callback, err := i.Authorize(p.AuthCodeURL("state1", "nonce1", verifier))
+	assert.NoError(t, err)
+	assert.Equal(t, "state1", callback.Query().Get("state"))
+
+	raw, err := p.Exchange(context.Background(), callback.Query().Get("code"), verifier)
+	assert.NoError(t, err)
+
+	c, err := p.Verify(context.Background(), raw, "nonce1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", c.Subject)
+	assert.Equal(t, "nic@example.com", c.Email)
+	assert.True(t, c.EmailVerified)
+}
+
+func TestExchangeRequiresMatchingVerifier(t *testing.T) {
+	p, i := setupProvider(t)
+
+	verifier, _ := oidc.NewRandom()
+	callback, err := i.Authorize(p.AuthCodeURL("state1", "nonce1", verifier))
+	assert.NoError(t, err)
+
+	_, err = p.Exchange(context.Background(), callback.Query().Get("code"), "wrong")
+	assert.Error(t, err)
+}
+
+func TestAuthCodeURLSendsS256Challenge(t *testing.T) {
+	p, _ := setupProvider(t)
+
+	u, err := url.Parse(p.AuthCodeURL("state1", "nonce1", "verifier"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, oidc.Challenge("verifier"), u.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.Equal(t, "openid email", u.Query().Get("scope"))
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	p, i := setupProvider(t)
+	u := oidctest.User{Subject: "1234"}
+
+	tt := map[string]map[string]interface{}{
+		"wrong audience": {"aud": "other"},
+		"wrong issuer":   {"iss": "https://example.com"},
+		"expired":        {"exp": time.Now().Add(-time.Minute).Unix()},
+		"wrong nonce":    {"nonce": "other"},
+		"no subject":     {"sub": ""},
+	}
+
+	for name, claims := range tt {
+		raw, err := i.IDToken(u, "nonce1", claims)
+		assert.NoError(t, err)
+
+		_, err = p.Verify(context.Background(), raw, "nonce1")
+		assert.True(t, errors.Is(err, oidc.ErrInvalidToken), name)
+	}
+}
+
+func TestVerifyRejectsTokensFromAnotherIssuer(t *testing.T) {
+	p, i := setupProvider(t)
+
+	other, err := oidctest.NewIssuer("product-api")
+	assert.NoError(t, err)
+	defer other.Close()
+
+	raw, err := other.IDToken(oidctest.User{Subject: "1234"}, "nonce1", map[string]interface{}{"iss": i.URL})
+	assert.NoError(t, err)
+
+	_, err = p.Verify(context.Background(), raw, "nonce1")
+	assert.True(t, errors.Is(err, oidc.ErrInvalidToken))
+}
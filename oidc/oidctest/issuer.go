@@ -0,0 +1,261 @@
+// Package oidctest provides a fake OpenID Connect provider for tests and
+// local development
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp-demoapp/product-api-go/oidc"
+)
+
+// keyID is the ID of the key the issuer signs tokens with
+const keyID = "oidctest"
+
+// User is the account which signs in to the issuer
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// grant is an authorization code which has not been exchanged yet
+type grant struct {
+	user        User
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// Issuer is a fake OpenID Connect provider which signs every authorization
+// request in as User without asking
+type Issuer struct {
+	URL      string
+	ClientID string
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	user   User
+	grants map[string]grant
+}
+
+// NewIssuer starts an issuer for the client, it must be closed with Close
+func NewIssuer(clientID string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Issuer{
+		ClientID: clientID,
+		key:      key,
+		user:     User{Subject: "1234", Email: "nic@example.com", EmailVerified: true, Name: "Nic", PreferredUsername: "nic"},
+		grants:   map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/authorize", i.authorize)
+	mux.HandleFunc("/token", i.token)
+	mux.HandleFunc("/jwks", i.jwks)
+
+	i.server = httptest.NewServer(mux)
+	i.URL = i.server.URL
+
+	return i, nil
+}
+
+// Close stops the issuer
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// SetUser sets the account which is signed in by later authorization requests
+func (i *Issuer) SetUser(u User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.user = u
+}
+
+// Authorize follows an authorization URL as a user's browser would and
+// returns the URL the issuer redirects back to
+func (i *Issuer) Authorize(authURL string) (*url.URL, error) {
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := c.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("Authorization returned %d", resp.StatusCode)
+	}
+
+	return resp.Location()
+}
+
+// IDToken returns an ID token for u signed by the issuer, claims are added
+// to or replace the standard claims
+func (i *Issuer) IDToken(u User, nonce string, claims map[string]interface{}) (string, error) {
+	c := jwt.MapClaims{
+		"iss":            i.URL,
+		"sub":            u.Subject,
+		"aud":            i.ClientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          u.Email,
+		"email_verified": u.EmailVerified,
+		"name":           u.Name,
+	}
+
+	if u.PreferredUsername != "" {
+		c["preferred_username"] = u.PreferredUsername
+	}
+
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	t.Header["kid"] = keyID
+
+	return t.SignedString(i.key)
+}
+
+func (i *Issuer) discovery(rw http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) authorize(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != i.ClientID || q.Get("response_type") != "code" {
+		http.Error(rw, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(rw, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(rw, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.NewRandom()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	i.mu.Lock()
+	i.grants[code] = grant{
+		user:        i.user,
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	v := redirect.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	redirect.RawQuery = v.Encode()
+
+	http.Redirect(rw, r, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(rw, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.grants[r.PostForm.Get("code")]
+	delete(i.grants, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	err := errors.New("invalid_grant")
+	switch {
+	case !ok:
+	case r.PostForm.Get("grant_type") != "authorization_code":
+	case r.PostForm.Get("client_id") != g.clientID:
+	case r.PostForm.Get("redirect_uri") != g.redirectURI:
+	case oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge:
+	default:
+		err = nil
+	}
+
+	if err != nil {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	t, err := i.IDToken(g.user, g.nonce, nil)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"access_token": "oidctest",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     t,
+	})
+}
+
+func (i *Issuer) jwks(rw http.ResponseWriter, r *http.Request) {
+	pub := i.key.PublicKey
+
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp-demoapp/product-api-go/telemetry"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Sink receives events published from the outbox. Events are published at
+// least once, a sink must accept an event it has already seen.
+type Sink interface {
+	Publish(ctx context.Context, e model.OutboxEvent) error
+}
+
+// Sinks publishes each event to every sink in turn, when one fails the event
+// is published to all of them again on the next run
+type Sinks []Sink
+
+// Publish implements Sink
+func (s Sinks) Publish(ctx context.Context, e model.OutboxEvent) error {
+	for _, sink := range s {
+		err := sink.Publish(ctx, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Store relays events from the outbox, it is implemented by data.Connection
+type Store interface {
+	RelayOutboxEvents(limit int, maxAttempts int, publish func(model.OutboxEvent) error) (int, int, error)
+	GetOutboxLag() (int, time.Duration, error)
+}
+
+// Relay publishes events from the outbox to a sink. Events which fail are
+// retried on later runs until maxAttempts have been made, then they are marked
+// dead.
+type Relay struct {
+	store       Store
+	sink        Sink
+	log         hclog.Logger
+	telemetry   *telemetry.Telemetry
+	batchSize   int
+	maxAttempts int
+}
+
+// NewRelay creates a Relay which publishes up to batchSize events at a time,
+// t can be nil when metrics are not needed
+func NewRelay(s Store, sink Sink, l hclog.Logger, t *telemetry.Telemetry, batchSize int, maxAttempts int) *Relay {
+	if t != nil {
+		t.AddCounter("outbox.published")
+		t.AddCounter("outbox.failed")
+		t.AddCounter("outbox.dead")
+		t.AddMeasure("outbox.pending")
+		t.AddMeasure("outbox.lag_seconds")
+	}
+
+	return &Relay{s, sink, l, t, batchSize, maxAttempts}
+}
+
+// Relay publishes events until the outbox is empty, an event fails or ctx is
+// cancelled, then records how far behind the relay is. It is run as a
+// background job.
+func (r *Relay) Relay(ctx context.Context) error {
+	for ctx.Err() == nil {
+		published, failed, err := r.store.RelayOutboxEvents(r.batchSize, r.maxAttempts, func(e model.OutboxEvent) error {
+			err := r.sink.Publish(ctx, e)
+			switch {
+			case err == nil:
+			case e.Attempts+1 >= r.maxAttempts:
+				r.log.Error("Unable to publish event, giving up", "event_id", e.EventID, "type", e.EventType, "attempts", e.Attempts+1, "error", err)
+				r.count("outbox.dead", 1)
+			default:
+				r.log.Warn("Unable to publish event", "event_id", e.EventID, "type", e.EventType, "attempts", e.Attempts+1, "error", err)
+			}
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		r.count("outbox.published", published)
+		r.count("outbox.failed", failed)
+
+		// failed events are retried on the next run rather than straight away
+		if failed > 0 || published < r.batchSize {
+			break
+		}
+	}
+
+	pending, lag, err := r.store.GetOutboxLag()
+	if err != nil {
+		return err
+	}
+
+	if r.telemetry != nil {
+		r.telemetry.Record("outbox.pending", float64(pending))
+		r.telemetry.Record("outbox.lag_seconds", lag.Seconds())
+	}
+
+	return nil
+}
+
+func (r *Relay) count(key string, n int) {
+	if r.telemetry == nil {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		r.telemetry.Increment(key)
+	}
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	events []model.OutboxEvent
+	fail   map[string]bool
+}
+
+func (s *recordingSink) Publish(ctx context.Context, e model.OutboxEvent) error {
+	if s.fail[e.EventID] {
+		return errors.New("unavailable")
+	}
+
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestRelayPublishesEvents(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("RelayOutboxEvents", 10, 3).Return([]model.OutboxEvent{{EventID: "evt_1"}, {EventID: "evt_2"}}, nil)
+	c.On("GetOutboxLag").Return(0, time.Duration(0), nil)
+
+	s := &recordingSink{}
+
+	err := NewRelay(c, s, hclog.NewNullLogger(), nil, 10, 3).Relay(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, s.events, 2)
+	c.AssertNumberOfCalls(t, "RelayOutboxEvents", 1)
+	c.AssertCalled(t, "GetOutboxLag")
+}
+
+func TestRelayStopsAfterFailure(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("RelayOutboxEvents", 2, 3).Return([]model.OutboxEvent{{EventID: "evt_1"}, {EventID: "evt_2", AggregateID: 2}}, nil)
+	c.On("GetOutboxLag").Return(1, time.Second, nil)
+
+	s := &recordingSink{fail: map[string]bool{"evt_1": true}}
+
+	err := NewRelay(c, s, hclog.NewNullLogger(), nil, 2, 3).Relay(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, s.events, 1)
+	c.AssertNumberOfCalls(t, "RelayOutboxEvents", 1)
+}
+
+func TestRelayReturnsStoreError(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("RelayOutboxEvents", 10, 3).Return(nil, errors.New("db gone"))
+
+	err := NewRelay(c, &recordingSink{}, hclog.NewNullLogger(), nil, 10, 3).Relay(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSinksStopAtFirstFailure(t *testing.T) {
+	a := &recordingSink{fail: map[string]bool{"evt_1": true}}
+	b := &recordingSink{}
+
+	err := Sinks{a, b}.Publish(context.Background(), model.OutboxEvent{EventID: "evt_1"})
+	assert.Error(t, err)
+	assert.Empty(t, b.events)
+}
@@ -0,0 +1,123 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// LogSink writes events to the log, it is intended for local testing
+type LogSink struct {
+	log hclog.Logger
+}
+
+// NewLogSink creates a Sink which writes to the logger
+func NewLogSink(l hclog.Logger) *LogSink {
+	return &LogSink{l}
+}
+
+// Publish implements Sink
+func (s *LogSink) Publish(ctx context.Context, e model.OutboxEvent) error {
+	s.log.Info("Event", "id", e.EventID, "type", e.EventType, "aggregate", e.AggregateType, "aggregate_id", e.AggregateID, "payload", string(e.Payload))
+	return nil
+}
+
+// FileSink appends the payload of each event to a file as a JSON line, it is
+// intended for local testing where events need to be read by another process
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSink creates a Sink which appends to the file at path
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// Publish implements Sink
+func (s *FileSink) Publish(ctx context.Context, e model.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := bytes.Buffer{}
+	err = json.Compact(&b, e.Payload)
+	if err != nil {
+		return err
+	}
+	b.WriteByte('\n')
+
+	_, err = f.Write(b.Bytes())
+	return err
+}
+
+// HTTPSink posts the payload of each event to a URL, any response other than
+// 2xx is an error and the event is published again on the next run
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink creates a Sink which posts to url
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	return &HTTPSink{url, client}
+}
+
+// Publish implements Sink
+func (s *HTTPSink) Publish(ctx context.Context, e model.OutboxEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(e.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Event-ID", e.EventID)
+	req.Header.Set("Event-Type", e.EventType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Publisher sends a message to a subject, it is the interface of message
+// brokers such as NATS so their clients can be used as a sink
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// PublisherSink publishes the payload of each event to a Publisher, with the
+// subject <prefix>.<event type>
+type PublisherSink struct {
+	publisher Publisher
+	prefix    string
+}
+
+// NewPublisherSink creates a Sink which publishes to p
+func NewPublisherSink(p Publisher, prefix string) *PublisherSink {
+	return &PublisherSink{p, prefix}
+}
+
+// Publish implements Sink
+func (s *PublisherSink) Publish(ctx context.Context, e model.OutboxEvent) error {
+	return s.publisher.Publish(s.prefix+"."+e.EventType, e.Payload)
+}
@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var event = model.OutboxEvent{
+	EventID:       "evt_1",
+	AggregateType: model.AggregateOrder,
+	AggregateID:   1,
+	EventType:     model.EventOrderCreated,
+	Payload:       []byte(`{"id": "evt_1", "type": "order.created"}`),
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	s := NewFileSink(path)
+
+	assert.NoError(t, s.Publish(context.Background(), event))
+	assert.NoError(t, s.Publish(context.Background(), event))
+
+	d, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"id\":\"evt_1\",\"type\":\"order.created\"}\n{\"id\":\"evt_1\",\"type\":\"order.created\"}\n", string(d))
+}
+
+func TestHTTPSinkPostsPayload(t *testing.T) {
+	var got *http.Request
+	var body []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, NewHTTPSink(srv.URL, srv.Client()).Publish(context.Background(), event))
+	assert.Equal(t, "order.created", got.Header.Get("Event-Type"))
+	assert.Equal(t, "evt_1", got.Header.Get("Event-ID"))
+	assert.Equal(t, string(event.Payload), string(body))
+}
+
+func TestHTTPSinkFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	assert.Error(t, NewHTTPSink(srv.URL, srv.Client()).Publish(context.Background(), event))
+}
+
+type publisher struct {
+	subject string
+	data    []byte
+}
+
+func (p *publisher) Publish(subject string, data []byte) error {
+	p.subject = subject
+	p.data = data
+	return nil
+}
+
+func TestPublisherSinkUsesEventTypeSubject(t *testing.T) {
+	p := &publisher{}
+
+	assert.NoError(t, NewPublisherSink(p, "product-api").Publish(context.Background(), event))
+	assert.Equal(t, "product-api.order.created", p.subject)
+}
@@ -0,0 +1,109 @@
+package password
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy defines the rules a new password must meet
+type Policy struct {
+	MinLength int
+	// MaxLength is limited to 72 bytes by bcrypt which ignores the remainder
+	MaxLength int
+
+	breached     map[string]bool
+	breachedSHA1 map[string]bool
+}
+
+// NewPolicy creates a policy requiring passwords between min and max characters
+func NewPolicy(min, max int) *Policy {
+	return &Policy{MinLength: min, MaxLength: max, breached: map[string]bool{}, breachedSHA1: map[string]bool{}}
+}
+
+// LoadBreached reads a list of breached passwords which are not allowed, the
+// file has one password per line, or the upper case SHA-1 hash of a password
+// optionally followed by :<count> as in the Have I Been Pwned downloads
+func (p *Policy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+
+		if h := strings.SplitN(l, ":", 2)[0]; isSHA1(h) {
+			p.breachedSHA1[strings.ToUpper(h)] = true
+			continue
+		}
+
+		p.breached[l] = true
+	}
+
+	return s.Err()
+}
+
+// Validate returns an error describing why password does not meet the policy
+func (p *Policy) Validate(username, password string) error {
+	n := utf8.RuneCountInString(password)
+
+	if n < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("Password must be at most %d bytes", p.MaxLength)
+	}
+
+	if username != "" && strings.EqualFold(password, username) {
+		return fmt.Errorf("Password must not be the same as the username")
+	}
+
+	h := sha1.Sum([]byte(password))
+	if p.breached[password] || p.breachedSHA1[strings.ToUpper(hex.EncodeToString(h[:]))] {
+		return fmt.Errorf("Password has appeared in a data breach, choose a different password")
+	}
+
+	return nil
+}
+
+func isSHA1(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// NewResetToken returns a random token to send to the user and the hash of
+// the token to store, so a leaked database can not be used to reset passwords
+func NewResetToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	t := base64.RawURLEncoding.EncodeToString(b)
+
+	return t, HashResetToken(t), nil
+}
+
+// HashResetToken returns the hash stored for a reset token
+func HashResetToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
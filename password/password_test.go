@@ -0,0 +1,54 @@
+package password
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatesLength(t *testing.T) {
+	p := NewPolicy(8, 72)
+
+	assert.Error(t, p.Validate("nic", ""))
+	assert.Error(t, p.Validate("nic", "short"))
+	assert.Error(t, p.Validate("nic", string(make([]byte, 73))))
+	assert.NoError(t, p.Validate("nic", "long enough"))
+}
+
+func TestRejectsUsernameAsPassword(t *testing.T) {
+	p := NewPolicy(3, 72)
+
+	assert.Error(t, p.Validate("nicjackson", "NicJackson"))
+}
+
+func TestRejectsBreachedPasswords(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "breached.txt")
+	// the second line is the SHA-1 of "password1" as in the HIBP downloads
+	err := ioutil.WriteFile(f, []byte("letmein123\nE38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D:2413945\n\n"), 0644)
+	assert.NoError(t, err)
+
+	p := NewPolicy(8, 72)
+	assert.NoError(t, p.LoadBreached(f))
+
+	assert.Error(t, p.Validate("nic", "letmein123"))
+	assert.Error(t, p.Validate("nic", "password1"))
+	assert.NoError(t, p.Validate("nic", "correct horse"))
+}
+
+func TestReturnsErrorForMissingBreachedFile(t *testing.T) {
+	assert.Error(t, NewPolicy(8, 72).LoadBreached("/does/not/exist"))
+}
+
+func TestResetTokensAreRandomAndHashed(t *testing.T) {
+	t1, h1, err := NewResetToken()
+	assert.NoError(t, err)
+
+	t2, _, err := NewResetToken()
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, t1, t2)
+	assert.NotEqual(t, t1, h1)
+	assert.Equal(t, h1, HashResetToken(t1))
+}
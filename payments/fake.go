@@ -0,0 +1,207 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Payment methods understood by Fake, any other method is declined
+const (
+	FakeMethodOK                = "fake_ok"
+	FakeMethodDeclined          = "fake_declined"
+	FakeMethodInsufficientFunds = "fake_insufficient_funds"
+	// FakeMethodDelayed payments are pending until a webhook captures them
+	FakeMethodDelayed = "fake_delayed"
+	// FakeMethodDelayedDeclined payments are pending until a webhook fails them
+	FakeMethodDelayedDeclined = "fake_delayed_declined"
+)
+
+// FakeSignatureHeader is the header Fake signs webhooks in
+const FakeSignatureHeader = "Fake-Signature"
+
+// Fake is a Provider which does not take real payments. The result depends
+// only on the payment method so tests can simulate declines and delayed
+// webhooks, references are numbered in order.
+type Fake struct {
+	secret []byte
+	delay  time.Duration
+	send   func(h http.Header, body []byte)
+
+	mu       sync.Mutex
+	next     int
+	payments map[string]*fakePayment
+}
+
+type fakePayment struct {
+	id     string
+	amount int
+	status string
+}
+
+// NewFake creates a Fake which signs webhooks with secret and calls send with
+// them delay after a delayed payment is authorized
+func NewFake(secret string, delay time.Duration, send func(h http.Header, body []byte)) *Fake {
+	return &Fake{secret: []byte(secret), delay: delay, send: send, payments: map[string]*fakePayment{}}
+}
+
+// PostWebhook returns a function for NewFake which posts webhooks to url
+func PostWebhook(url string, client *http.Client) func(h http.Header, body []byte) {
+	return func(h http.Header, body []byte) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header = h
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+	}
+}
+
+// Name implements Provider
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Authorize implements Provider
+func (f *Fake) Authorize(ctx context.Context, r Request) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// a retry of the same payment returns the first result
+	for ref, p := range f.payments {
+		if p.id == r.ID && r.ID != "" {
+			return Result{ref, p.status}, nil
+		}
+	}
+
+	var event Event
+
+	switch r.Method {
+	case FakeMethodOK:
+	case FakeMethodDelayed:
+		event = Event{Type: EventCaptured}
+	case FakeMethodDelayedDeclined:
+		event = Event{Type: EventFailed, Reason: "card_declined"}
+	case FakeMethodDeclined:
+		return Result{}, &DeclineError{"card_declined"}
+	case FakeMethodInsufficientFunds:
+		return Result{}, &DeclineError{"insufficient_funds"}
+	default:
+		return Result{}, &DeclineError{"invalid_payment_method"}
+	}
+
+	f.next++
+	ref := fmt.Sprintf("fake_pay_%d", f.next)
+	p := &fakePayment{id: r.ID, amount: r.Amount, status: StatusAuthorized}
+	f.payments[ref] = p
+
+	if event.Type == "" {
+		return Result{ref, StatusAuthorized}, nil
+	}
+
+	p.status = StatusPending
+	event.Reference = ref
+
+	time.AfterFunc(f.delay, func() {
+		f.mu.Lock()
+		if event.Type == EventCaptured {
+			p.status = StatusCaptured
+		} else {
+			delete(f.payments, ref)
+		}
+		f.mu.Unlock()
+
+		f.sendEvent(event)
+	})
+
+	return Result{ref, StatusPending}, nil
+}
+
+// Capture implements Provider
+func (f *Fake) Capture(ctx context.Context, reference string, amount int) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+
+	if p.status == StatusCaptured {
+		return Result{reference, StatusCaptured}, nil
+	}
+
+	if p.status != StatusAuthorized || amount > p.amount {
+		return Result{}, fmt.Errorf("unable to capture %d from %s payment of %d", amount, p.status, p.amount)
+	}
+
+	p.status = StatusCaptured
+
+	return Result{reference, StatusCaptured}, nil
+}
+
+// Refund implements Provider
+func (f *Fake) Refund(ctx context.Context, reference string, amount int) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+
+	if p.status != StatusCaptured || amount > p.amount {
+		return Result{}, fmt.Errorf("unable to refund %d from %s payment of %d", amount, p.status, p.amount)
+	}
+
+	p.status = StatusRefunded
+
+	return Result{reference, StatusRefunded}, nil
+}
+
+// VerifyWebhook implements Provider
+func (f *Fake) VerifyWebhook(h http.Header, body []byte) (Event, error) {
+	sig, err := hex.DecodeString(h.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(sig, f.sign(body)) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	e := Event{}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return Event{}, err
+	}
+
+	return e, nil
+}
+
+// sendEvent signs and sends a webhook
+func (f *Fake) sendEvent(e Event) {
+	body, err := json.Marshal(e)
+	if err != nil || f.send == nil {
+		return
+	}
+
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set(FakeSignatureHeader, hex.EncodeToString(f.sign(body)))
+
+	f.send(h, body)
+}
+
+func (f *Fake) sign(body []byte) []byte {
+	m := hmac.New(sha256.New, f.secret)
+	m.Write(body)
+	return m.Sum(nil)
+}
@@ -0,0 +1,98 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type webhook struct {
+	header http.Header
+	body   []byte
+}
+
+func setupFake(t *testing.T) (*Fake, chan webhook) {
+	sent := make(chan webhook, 1)
+
+	f := NewFake("secret", 10*time.Millisecond, func(h http.Header, body []byte) {
+		sent <- webhook{h, body}
+	})
+
+	return f, sent
+}
+
+func TestFakeAuthorizesAndCaptures(t *testing.T) {
+	f, _ := setupFake(t)
+
+	r, err := f.Authorize(context.Background(), Request{ID: "1", Amount: 200, Method: FakeMethodOK})
+	assert.NoError(t, err)
+	assert.Equal(t, Result{"fake_pay_1", StatusAuthorized}, r)
+
+	r, err = f.Capture(context.Background(), r.Reference, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCaptured, r.Status)
+
+	r, err = f.Refund(context.Background(), r.Reference, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRefunded, r.Status)
+}
+
+func TestFakeReturnsSameResultForRetry(t *testing.T) {
+	f, _ := setupFake(t)
+
+	a, _ := f.Authorize(context.Background(), Request{ID: "1", Amount: 200, Method: FakeMethodOK})
+	b, _ := f.Authorize(context.Background(), Request{ID: "1", Amount: 200, Method: FakeMethodOK})
+
+	assert.Equal(t, a, b)
+}
+
+func TestFakeDeclines(t *testing.T) {
+	f, _ := setupFake(t)
+
+	_, err := f.Authorize(context.Background(), Request{ID: "1", Amount: 200, Method: FakeMethodInsufficientFunds})
+
+	de := &DeclineError{}
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, "insufficient_funds", de.Reason)
+}
+
+func TestFakeRefusesCaptureOfMoreThanAuthorized(t *testing.T) {
+	f, _ := setupFake(t)
+
+	r, _ := f.Authorize(context.Background(), Request{ID: "1", Amount: 200, Method: FakeMethodOK})
+	_, err := f.Capture(context.Background(), r.Reference, 300)
+
+	assert.Error(t, err)
+}
+
+func TestFakeSendsSignedWebhookForDelayedPayment(t *testing.T) {
+	f, sent := setupFake(t)
+
+	r, err := f.Authorize(context.Background(), Request{ID: "1", Amount: 200, Method: FakeMethodDelayedDeclined})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, r.Status)
+
+	select {
+	case w := <-sent:
+		e, err := f.VerifyWebhook(w.header, w.body)
+		assert.NoError(t, err)
+		assert.Equal(t, Event{Type: EventFailed, Reference: r.Reference, Reason: "card_declined"}, e)
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not sent")
+	}
+}
+
+func TestFakeRejectsWebhookWithBadSignature(t *testing.T) {
+	f, _ := setupFake(t)
+
+	h := http.Header{}
+	h.Set(FakeSignatureHeader, "00")
+
+	_, err := f.VerifyWebhook(h, []byte(`{"type":"payment.captured","reference":"fake_pay_1"}`))
+
+	assert.Equal(t, ErrInvalidSignature, err)
+}
@@ -0,0 +1,83 @@
+// Package payments takes payment for orders through a payment provider.
+// Providers implement Provider, a deterministic Fake is included for tests
+// and local runs.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Statuses of a payment returned by a provider
+const (
+	// StatusAuthorized payments have been approved and can be captured
+	StatusAuthorized = "authorized"
+	// StatusPending payments are being processed, the result is sent in a
+	// webhook
+	StatusPending = "pending"
+	// StatusCaptured payments have been taken
+	StatusCaptured = "captured"
+	// StatusRefunded payments have been returned
+	StatusRefunded = "refunded"
+)
+
+// Types of webhook event
+const (
+	EventAuthorized = "payment.authorized"
+	EventCaptured   = "payment.captured"
+	EventFailed     = "payment.failed"
+	EventRefunded   = "payment.refunded"
+)
+
+// ErrInvalidSignature is returned when a webhook was not sent by the provider
+var ErrInvalidSignature = errors.New("webhook signature is not valid")
+
+// ErrUnknownPayment is returned when a provider does not have a payment with
+// the reference
+var ErrUnknownPayment = errors.New("payment does not exist")
+
+// DeclineError is returned when a provider refuses a payment
+type DeclineError struct {
+	Reason string
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("payment declined: %s", e.Reason)
+}
+
+// Request is a payment to authorize
+type Request struct {
+	// ID identifies the payment to the provider so retries are not charged
+	// twice
+	ID     string
+	Amount int
+	// Method is the provider's token for how the customer is paying, such as
+	// a tokenized card
+	Method string
+}
+
+// Result is the state of a payment at the provider
+type Result struct {
+	Reference string
+	Status    string
+}
+
+// Event is a change to a payment sent by the provider in a webhook
+type Event struct {
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Provider takes payments. Authorize returns a DeclineError when the payment
+// is refused and may return StatusPending, in which case the result is sent
+// later in a webhook.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, r Request) (Result, error)
+	Capture(ctx context.Context, reference string, amount int) (Result, error)
+	Refund(ctx context.Context, reference string, amount int) (Result, error)
+	VerifyWebhook(h http.Header, body []byte) (Event, error)
+}
@@ -0,0 +1,260 @@
+package pickup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+)
+
+// ErrTooSoon is returned when a pickup time does not leave enough time to
+// prepare the order
+var ErrTooSoon = errors.New("Pickup time is too soon")
+
+// ErrTooFarAhead is returned when a pickup time is further ahead than orders
+// can be placed
+var ErrTooFarAhead = errors.New("Pickup time is too far ahead")
+
+// ErrClosed is returned when a pickup time is outside of the opening hours
+var ErrClosed = errors.New("Store is closed at the pickup time")
+
+var days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Window is a period of a day the store is open, as the time since midnight
+type Window struct {
+	Open  time.Duration
+	Close time.Duration
+}
+
+// Hours are the opening hours of a store for each day of the week, a nil
+// Hours is always open
+type Hours map[time.Weekday][]Window
+
+// ParseHours parses opening hours in the form <days> <open>-<close>, with
+// groups of days separated by semicolons, e.g.
+// "mon-fri 07:00-19:00; sat,sun 08:00-12:00 13:00-16:00". Days which are not
+// listed are closed. An empty string is always open.
+func ParseHours(s string) (Hours, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	h := Hours{}
+
+	for _, g := range strings.Split(s, ";") {
+		fs := strings.Fields(g)
+		if len(fs) < 2 {
+			return nil, fmt.Errorf("invalid opening hours %q, expected <days> <open>-<close> e.g. mon-fri 07:00-19:00", g)
+		}
+
+		ds, err := parseDays(fs[0])
+		if err != nil {
+			return nil, err
+		}
+
+		ws := []Window{}
+		for _, f := range fs[1:] {
+			w, err := parseWindow(f)
+			if err != nil {
+				return nil, err
+			}
+
+			ws = append(ws, w)
+		}
+
+		for _, d := range ds {
+			h[d] = append(h[d], ws...)
+		}
+	}
+
+	return h, nil
+}
+
+// parseDays parses a comma separated list of days or ranges of days
+func parseDays(s string) ([]time.Weekday, error) {
+	ds := []time.Weekday{}
+
+	for _, p := range strings.Split(strings.ToLower(s), ",") {
+		r := strings.SplitN(p, "-", 2)
+
+		from, err := parseDay(r[0])
+		if err != nil {
+			return nil, err
+		}
+
+		to := from
+		if len(r) == 2 {
+			to, err = parseDay(r[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// ranges can wrap around the end of the week, e.g. sat-mon
+		for d := from; ; d = (d + 1) % 7 {
+			ds = append(ds, d)
+			if d == to {
+				break
+			}
+		}
+	}
+
+	return ds, nil
+}
+
+func parseDay(s string) (time.Weekday, error) {
+	for i, d := range days {
+		if s == d {
+			return time.Weekday(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid day %q, expected one of %s", s, strings.Join(days, ", "))
+}
+
+// parseWindow parses a window in the form 07:00-19:00, the store can close
+// at 24:00
+func parseWindow(s string) (Window, error) {
+	r := strings.SplitN(s, "-", 2)
+	if len(r) != 2 {
+		return Window{}, fmt.Errorf("invalid opening hours %q, expected <open>-<close> e.g. 07:00-19:00", s)
+	}
+
+	open, err := parseClock(r[0])
+	if err != nil {
+		return Window{}, err
+	}
+
+	close, err := parseClock(r[1])
+	if err != nil {
+		return Window{}, err
+	}
+
+	if close <= open {
+		return Window{}, fmt.Errorf("invalid opening hours %q, the store must close after it opens", s)
+	}
+
+	return Window{open, close}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	hour, min := 0, 0
+
+	_, err := fmt.Sscanf(s, "%d:%d", &hour, &min)
+	if err != nil || len(s) != 5 || hour < 0 || min < 0 || min > 59 || hour > 24 || (hour == 24 && min > 0) {
+		return 0, fmt.Errorf("invalid time %q, expected hh:mm", s)
+	}
+
+	return time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute, nil
+}
+
+// UnmarshalText allows Hours to be set from config
+func (h *Hours) UnmarshalText(text []byte) error {
+	p, err := ParseHours(string(text))
+	if err != nil {
+		return err
+	}
+
+	*h = p
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (h Hours) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// String returns the hours in the form accepted by ParseHours
+func (h Hours) String() string {
+	gs := []string{}
+
+	for i, d := range days {
+		ws := h[time.Weekday(i)]
+		if len(ws) < 1 {
+			continue
+		}
+
+		g := d
+		for _, w := range ws {
+			g += " " + clock(w.Open) + "-" + clock(w.Close)
+		}
+
+		gs = append(gs, g)
+	}
+
+	return strings.Join(gs, "; ")
+}
+
+func clock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// IsOpen returns true when t is within the opening hours, using the time
+// zone of t
+func (h Hours) IsOpen(t time.Time) bool {
+	if h == nil {
+		return true
+	}
+
+	y, m, d := t.Date()
+	since := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+
+	for _, w := range h[t.Weekday()] {
+		if since >= w.Open && since < w.Close {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Policy decides when orders can be collected
+type Policy struct {
+	Hours    Hours
+	Location *time.Location
+	// Slot is the length of the windows pickups are grouped in, at most
+	// Capacity orders can be collected in each window, 0 is unlimited
+	Slot     time.Duration
+	Capacity int
+	// MinNotice is the time needed to prepare an order, MaxAdvance how far
+	// ahead orders can be placed
+	MinNotice  time.Duration
+	MaxAdvance time.Duration
+}
+
+// Check validates a pickup time placed at now and returns the slot it is in
+func (p Policy) Check(at time.Time, now time.Time) (model.PickupSlot, error) {
+	if at.Before(now.Add(p.MinNotice)) {
+		return model.PickupSlot{}, ErrTooSoon
+	}
+
+	if p.MaxAdvance > 0 && at.After(now.Add(p.MaxAdvance)) {
+		return model.PickupSlot{}, ErrTooFarAhead
+	}
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	at = at.In(loc)
+	if !p.Hours.IsOpen(at) {
+		return model.PickupSlot{}, ErrClosed
+	}
+
+	s := model.PickupSlot{At: at.UTC(), Start: at.UTC(), End: at.UTC(), Capacity: p.Capacity}
+
+	if p.Slot > 0 {
+		y, m, d := at.Date()
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		start := midnight.Add(at.Sub(midnight) / p.Slot * p.Slot)
+
+		s.Start = start.UTC()
+		s.End = start.Add(p.Slot).UTC()
+	}
+
+	return s, nil
+}
@@ -0,0 +1,89 @@
+package pickup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHours(t *testing.T) {
+	h, err := ParseHours("mon-fri 07:00-19:00; sat,sun 08:00-12:00 13:00-24:00")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Window{{7 * time.Hour, 19 * time.Hour}}, h[time.Wednesday])
+	assert.Equal(t, []Window{{8 * time.Hour, 12 * time.Hour}, {13 * time.Hour, 24 * time.Hour}}, h[time.Sunday])
+	assert.Equal(t, "sun 08:00-12:00 13:00-24:00; mon 07:00-19:00; tue 07:00-19:00; wed 07:00-19:00; thu 07:00-19:00; fri 07:00-19:00; sat 08:00-12:00 13:00-24:00", h.String())
+}
+
+func TestParseHoursWrapsAroundTheWeek(t *testing.T) {
+	h, err := ParseHours("fri-mon 09:00-17:00")
+	assert.NoError(t, err)
+
+	assert.Len(t, h, 4)
+	assert.Empty(t, h[time.Tuesday])
+}
+
+func TestParseHoursEmptyIsAlwaysOpen(t *testing.T) {
+	h, err := ParseHours("")
+	assert.NoError(t, err)
+
+	assert.True(t, h.IsOpen(time.Date(2021, 1, 3, 3, 0, 0, 0, time.UTC)))
+}
+
+func TestParseHoursRejectsInvalidHours(t *testing.T) {
+	for _, s := range []string{"mon", "funday 07:00-19:00", "mon 19:00-07:00", "mon 7:00-19:00", "mon 07:00-24:30", "mon 07:00"} {
+		_, err := ParseHours(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestIsOpen(t *testing.T) {
+	h, _ := ParseHours("mon-fri 07:00-19:00")
+
+	// 4 January 2021 was a Monday
+	assert.False(t, h.IsOpen(time.Date(2021, 1, 4, 6, 59, 0, 0, time.UTC)))
+	assert.True(t, h.IsOpen(time.Date(2021, 1, 4, 7, 0, 0, 0, time.UTC)))
+	assert.False(t, h.IsOpen(time.Date(2021, 1, 4, 19, 0, 0, 0, time.UTC)))
+	assert.False(t, h.IsOpen(time.Date(2021, 1, 9, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestCheckReturnsSlot(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	h, _ := ParseHours("mon-fri 07:00-19:00")
+	p := Policy{Hours: h, Location: loc, Slot: 15 * time.Minute, Capacity: 3, MinNotice: 10 * time.Minute}
+
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+	at := time.Date(2021, 1, 4, 14, 37, 0, 0, time.UTC)
+
+	s, err := p.Check(at, now)
+	assert.NoError(t, err)
+
+	assert.Equal(t, time.Date(2021, 1, 4, 14, 30, 0, 0, time.UTC), s.Start)
+	assert.Equal(t, time.Date(2021, 1, 4, 14, 45, 0, 0, time.UTC), s.End)
+	assert.Equal(t, at, s.At)
+	assert.Equal(t, 3, s.Capacity)
+}
+
+func TestCheckUsesLocationForOpeningHours(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	h, _ := ParseHours("mon-fri 07:00-19:00")
+	p := Policy{Hours: h, Location: loc}
+
+	now := time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+
+	// 08:00 UTC is 03:00 in the store
+	_, err := p.Check(time.Date(2021, 1, 4, 8, 0, 0, 0, time.UTC), now)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestCheckRejectsTimesOutsideNotice(t *testing.T) {
+	p := Policy{MinNotice: 15 * time.Minute, MaxAdvance: 24 * time.Hour}
+	now := time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	_, err := p.Check(now.Add(5*time.Minute), now)
+	assert.Equal(t, ErrTooSoon, err)
+
+	_, err = p.Check(now.Add(48*time.Hour), now)
+	assert.Equal(t, ErrTooFarAhead, err)
+}
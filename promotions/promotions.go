@@ -0,0 +1,229 @@
+// Package promotions calculates the discounts promotion codes give an order.
+// Amounts are integers in the same units as coffee prices so discounts never
+// suffer from rounding errors.
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+)
+
+// Reasons a promotion code can not be used
+var (
+	ErrUnknownCode   = errors.New("code does not exist")
+	ErrNotActive     = errors.New("promotion is not active")
+	ErrUsageLimit    = errors.New("promotion has been used the maximum number of times")
+	ErrNotStackable  = errors.New("promotion can not be combined with other promotions")
+	ErrNotApplicable = errors.New("promotion does not apply to any items in the order")
+)
+
+// Error is returned when a promotion code can not be applied to an order
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("promotion code %q can not be used, %s", e.Code, e.Err)
+}
+
+// Unwrap returns the reason the code can not be used
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Line is an item in an order being discounted
+type Line struct {
+	CoffeeID   int
+	Collection string
+	// Price is the price of a single item
+	Price    int
+	Quantity int
+}
+
+// Usage is the number of orders a promotion has been applied to
+type Usage struct {
+	Total int
+	User  int
+}
+
+// Check returns an error when a promotion can not be used, either because it
+// is not active or it has reached a usage limit
+func Check(p model.Promotion, u Usage) error {
+	if !p.Active {
+		return &Error{p.Code, ErrNotActive}
+	}
+
+	if p.MaxUses != nil && u.Total >= *p.MaxUses {
+		return &Error{p.Code, ErrUsageLimit}
+	}
+
+	if p.MaxUsesPerUser != nil && u.User >= *p.MaxUsesPerUser {
+		return &Error{p.Code, ErrUsageLimit}
+	}
+
+	return nil
+}
+
+// Apply returns the discounts for promotions used together on an order. It
+// returns an error when the promotions can not be stacked or one of them does
+// not discount any item.
+func Apply(lines []Line, ps []model.Promotion) ([]model.OrderDiscount, error) {
+	if len(ps) > 1 {
+		for _, p := range ps {
+			if !p.Stackable {
+				return nil, &Error{p.Code, ErrNotStackable}
+			}
+		}
+	}
+
+	ds := Calculate(lines, ps)
+
+	for i, d := range ds {
+		if d.Amount == 0 {
+			return nil, &Error{ps[i].Code, ErrNotApplicable}
+		}
+	}
+
+	return ds, nil
+}
+
+// Calculate returns the discount each promotion gives the lines, in the same
+// order as ps. Buy N get one promotions are applied first, then percentages,
+// then fixed amounts, each to the price left by the ones before so the total
+// discount is never more than the price of the order.
+func Calculate(lines []Line, ps []model.Promotion) []model.OrderDiscount {
+	// remaining is the undiscounted price of each line
+	remaining := make([]int, len(lines))
+	for i, l := range lines {
+		remaining[i] = l.Price * l.Quantity
+	}
+
+	ds := make([]model.OrderDiscount, len(ps))
+
+	for _, t := range []string{model.PromotionBuyNGetOne, model.PromotionPercentage, model.PromotionFixedAmount} {
+		for i, p := range ps {
+			if p.Type != t {
+				continue
+			}
+
+			ds[i] = model.OrderDiscount{
+				PromotionID: p.ID,
+				Code:        p.Code,
+				Name:        p.Name,
+				Amount:      discount(p, lines, remaining),
+			}
+		}
+	}
+
+	return ds
+}
+
+// discount returns the amount p takes off lines and subtracts it from
+// remaining
+func discount(p model.Promotion, lines []Line, remaining []int) int {
+	eligible := []int{}
+	for i, l := range lines {
+		if p.AppliesTo(model.Coffee{ID: l.CoffeeID, Collection: l.Collection}) {
+			eligible = append(eligible, i)
+		}
+	}
+
+	total := 0
+
+	switch p.Type {
+	case model.PromotionPercentage:
+		for _, i := range eligible {
+			d := (remaining[i]*p.Percent + 50) / 100
+			remaining[i] -= d
+			total += d
+		}
+
+	case model.PromotionFixedAmount:
+		for _, i := range eligible {
+			d := min(p.Amount-total, remaining[i])
+			remaining[i] -= d
+			total += d
+		}
+
+	case model.PromotionBuyNGetOne:
+		if p.BuyQuantity < 1 {
+			return 0
+		}
+
+		// the cheapest items are free
+		sort.SliceStable(eligible, func(a, b int) bool {
+			return lines[eligible[a]].Price < lines[eligible[b]].Price
+		})
+
+		units := 0
+		for _, i := range eligible {
+			units += lines[i].Quantity
+		}
+
+		free := units / (p.BuyQuantity + 1)
+		for _, i := range eligible {
+			n := min(free, lines[i].Quantity)
+			d := min(n*lines[i].Price, remaining[i])
+			remaining[i] -= d
+			total += d
+			free -= n
+		}
+	}
+
+	return total
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// Validate returns an error describing the first problem with a promotion
+// being created
+func Validate(p model.Promotion) error {
+	if p.Code == "" || len(p.Code) > 64 {
+		return errors.New("code is required and must be at most 64 characters")
+	}
+
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+
+	switch p.Type {
+	case model.PromotionPercentage:
+		if p.Percent < 1 || p.Percent > 100 {
+			return errors.New("percent must be between 1 and 100")
+		}
+	case model.PromotionFixedAmount:
+		if p.Amount < 1 {
+			return errors.New("amount must be at least 1")
+		}
+	case model.PromotionBuyNGetOne:
+		if p.BuyQuantity < 1 {
+			return errors.New("buy_quantity must be at least 1")
+		}
+
+		if p.CoffeeID == nil && p.Collection == "" {
+			return errors.New("buy_n_get_one promotions must have a coffee_id or collection")
+		}
+	default:
+		return fmt.Errorf("type must be one of %s, %s or %s", model.PromotionPercentage, model.PromotionFixedAmount, model.PromotionBuyNGetOne)
+	}
+
+	if p.MaxUses != nil && *p.MaxUses < 1 {
+		return errors.New("max_uses must be at least 1")
+	}
+
+	if p.MaxUsesPerUser != nil && *p.MaxUsesPerUser < 1 {
+		return errors.New("max_uses_per_user must be at least 1")
+	}
+
+	return nil
+}
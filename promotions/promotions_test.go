@@ -0,0 +1,107 @@
+package promotions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var lines = []Line{
+	{CoffeeID: 1, Collection: "Foundations", Price: 200, Quantity: 2},
+	{CoffeeID: 2, Collection: "Origins", Price: 350, Quantity: 1},
+	{CoffeeID: 3, Collection: "Foundations", Price: 150, Quantity: 1},
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestCalculatesPercentage(t *testing.T) {
+	ds := Calculate(lines, []model.Promotion{{ID: 1, Code: "TEN", Type: model.PromotionPercentage, Percent: 10}})
+
+	assert.Equal(t, 90, ds[0].Amount)
+	assert.Equal(t, "TEN", ds[0].Code)
+}
+
+func TestCalculatesPercentageForCollection(t *testing.T) {
+	ds := Calculate(lines, []model.Promotion{{Type: model.PromotionPercentage, Percent: 50, Collection: "Origins"}})
+
+	assert.Equal(t, 175, ds[0].Amount)
+}
+
+func TestFixedAmountIsLimitedToPrice(t *testing.T) {
+	ds := Calculate(lines, []model.Promotion{{Type: model.PromotionFixedAmount, Amount: 1000, CoffeeID: intPtr(3)}})
+
+	assert.Equal(t, 150, ds[0].Amount)
+}
+
+func TestBuyNGetOneMakesCheapestItemsFree(t *testing.T) {
+	ds := Calculate(lines, []model.Promotion{{Type: model.PromotionBuyNGetOne, BuyQuantity: 2, Collection: "Foundations"}})
+
+	assert.Equal(t, 150, ds[0].Amount)
+}
+
+func TestBuyNGetOneForCoffee(t *testing.T) {
+	ds := Calculate(lines, []model.Promotion{{Type: model.PromotionBuyNGetOne, BuyQuantity: 1, CoffeeID: intPtr(1)}})
+
+	assert.Equal(t, 200, ds[0].Amount)
+}
+
+func TestStackedPromotionsApplyInOrder(t *testing.T) {
+	ps := []model.Promotion{
+		{Code: "FIVE", Type: model.PromotionFixedAmount, Amount: 500, Stackable: true},
+		{Code: "HALF", Type: model.PromotionPercentage, Percent: 50, Stackable: true},
+		{Code: "FREE", Type: model.PromotionBuyNGetOne, BuyQuantity: 1, CoffeeID: intPtr(1), Stackable: true},
+	}
+
+	ds, err := Apply(lines, ps)
+	assert.NoError(t, err)
+
+	// 900 total, 200 free, half of 700, then the remaining 350 of the fixed amount
+	assert.Equal(t, 350, ds[0].Amount)
+	assert.Equal(t, 350, ds[1].Amount)
+	assert.Equal(t, 200, ds[2].Amount)
+}
+
+func TestApplyRejectsPromotionsWhichDoNotStack(t *testing.T) {
+	ps := []model.Promotion{
+		{Code: "TEN", Type: model.PromotionPercentage, Percent: 10, Stackable: true},
+		{Code: "ALONE", Type: model.PromotionFixedAmount, Amount: 100},
+	}
+
+	_, err := Apply(lines, ps)
+
+	pe := &Error{}
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "ALONE", pe.Code)
+	assert.True(t, errors.Is(err, ErrNotStackable))
+}
+
+func TestApplyRejectsPromotionWhichDoesNotApply(t *testing.T) {
+	_, err := Apply(lines, []model.Promotion{{Code: "NONE", Type: model.PromotionPercentage, Percent: 10, Collection: "Other"}})
+
+	assert.True(t, errors.Is(err, ErrNotApplicable))
+}
+
+func TestCheckRejectsInactivePromotion(t *testing.T) {
+	err := Check(model.Promotion{Code: "OLD"}, Usage{})
+
+	assert.True(t, errors.Is(err, ErrNotActive))
+}
+
+func TestCheckEnforcesUsageLimits(t *testing.T) {
+	p := model.Promotion{Active: true, MaxUses: intPtr(10), MaxUsesPerUser: intPtr(1)}
+
+	assert.NoError(t, Check(p, Usage{Total: 9, User: 0}))
+	assert.True(t, errors.Is(Check(p, Usage{Total: 10}), ErrUsageLimit))
+	assert.True(t, errors.Is(Check(p, Usage{Total: 1, User: 1}), ErrUsageLimit))
+}
+
+func TestValidateRequiresTypeSettings(t *testing.T) {
+	assert.NoError(t, Validate(model.Promotion{Code: "TEN", Name: "Ten off", Type: model.PromotionPercentage, Percent: 10}))
+	assert.Error(t, Validate(model.Promotion{Code: "TEN", Name: "Ten off", Type: model.PromotionPercentage, Percent: 110}))
+	assert.Error(t, Validate(model.Promotion{Code: "FREE", Name: "Free", Type: model.PromotionBuyNGetOne, BuyQuantity: 2}))
+	assert.Error(t, Validate(model.Promotion{Code: "X", Name: "X", Type: "other"}))
+}
@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit defines a token bucket, Requests tokens are added every Per up to a
+// maximum of Burst tokens, each request takes one token
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// ParseLimit parses a limit in the form <requests>/<per>[:<burst>], e.g. 5/1m
+// allows five requests a minute and 10/s:20 allows bursts of up to 20 requests.
+// An empty string or "0" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	l := Limit{}
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) == 2 {
+		b, err := strconv.Atoi(parts[1])
+		if err != nil || b < 1 {
+			return Limit{}, fmt.Errorf("invalid burst in rate limit %q", s)
+		}
+		l.Burst = b
+	}
+
+	rp := strings.SplitN(parts[0], "/", 2)
+	if len(rp) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<per> e.g. 5/1m", s)
+	}
+
+	r, err := strconv.Atoi(rp[0])
+	if err != nil || r < 1 {
+		return Limit{}, fmt.Errorf("invalid requests in rate limit %q", s)
+	}
+	l.Requests = r
+
+	// allow the unit on its own, e.g. 10/s
+	per := rp[1]
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+
+	l.Per, err = time.ParseDuration(per)
+	if err != nil || l.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in rate limit %q", s)
+	}
+
+	return l, nil
+}
+
+// UnmarshalText allows a Limit to be set from config
+func (l *Limit) UnmarshalText(text []byte) error {
+	p, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+
+	*l = p
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// String returns the limit in the form accepted by ParseLimit
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "0"
+	}
+
+	// drop the zero units time.Duration adds, 1h0m0s becomes 1h
+	per := l.Per.String()
+	if strings.HasSuffix(per, "m0s") {
+		per = strings.TrimSuffix(per, "0s")
+	}
+	if strings.HasSuffix(per, "h0m") {
+		per = strings.TrimSuffix(per, "0m")
+	}
+
+	s := fmt.Sprintf("%d/%s", l.Requests, per)
+	if l.Burst > 0 {
+		s += fmt.Sprintf(":%d", l.Burst)
+	}
+
+	return s
+}
+
+// Enabled returns true when the limit should be applied
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// capacity returns the size of the bucket, which defaults to Requests
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return float64(l.Requests)
+}
+
+// rate returns the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket
+	Limit int
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until a token is available when not Allowed
+	RetryAfter time.Duration
+}
+
+// Store holds the state of the token buckets. The in memory store limits each
+// replica separately, a shared store can be used to limit across replicas.
+type Store interface {
+	// Take a token from the bucket for key, creating a full bucket if needed
+	Take(key string, l Limit) (Result, error)
+}
+
+// sweepEvery is the number of calls to Take between removing full buckets
+const sweepEvery = 1000
+
+// MemoryStore is an in process Store
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemoryStore creates a new in memory Store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Take implements Store
+func (m *MemoryStore) Take(key string, l Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	capacity := l.capacity()
+	rate := l.rate()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = seconds((capacity - b.tokens) / rate)
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+// sweep removes buckets which have refilled as they are the same as a new bucket
+func (m *MemoryStore) sweep(now time.Time) {
+	m.calls++
+	if m.calls < sweepEvery {
+		return
+	}
+	m.calls = 0
+
+	for k, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
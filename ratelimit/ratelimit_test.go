@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	return s, &now
+}
+
+func TestAllowsRequestsUpToBurst(t *testing.T) {
+	s, _ := setupStore()
+	l := Limit{Requests: 2, Per: time.Minute, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		res, err := s.Take("user:1", l)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+
+	res, err := s.Take("user:1", l)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 30*time.Second, res.RetryAfter)
+	assert.Equal(t, 90*time.Second, res.Reset)
+}
+
+func TestRefillsTokensOverTime(t *testing.T) {
+	s, now := setupStore()
+	l := Limit{Requests: 1, Per: time.Second}
+
+	res, _ := s.Take("ip:10.0.0.1", l)
+	assert.True(t, res.Allowed)
+
+	res, _ = s.Take("ip:10.0.0.1", l)
+	assert.False(t, res.Allowed)
+
+	*now = now.Add(time.Second)
+
+	res, _ = s.Take("ip:10.0.0.1", l)
+	assert.True(t, res.Allowed)
+}
+
+func TestBucketsAreKeyedSeparately(t *testing.T) {
+	s, _ := setupStore()
+	l := Limit{Requests: 1, Per: time.Minute}
+
+	res, _ := s.Take("user:1", l)
+	assert.True(t, res.Allowed)
+
+	res, _ = s.Take("user:2", l)
+	assert.True(t, res.Allowed)
+}
+
+func TestSweepsFullBuckets(t *testing.T) {
+	s, now := setupStore()
+	l := Limit{Requests: 1, Per: time.Second}
+
+	s.Take("user:1", l)
+	*now = now.Add(time.Minute)
+
+	for i := 0; i < sweepEvery; i++ {
+		s.Take("user:2", l)
+	}
+
+	assert.NotContains(t, s.buckets, "user:1")
+}
+
+func TestParsesLimit(t *testing.T) {
+	l, err := ParseLimit("5/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 5, Per: time.Minute}, l)
+
+	l, err = ParseLimit("10/s:20")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 10, Per: time.Second, Burst: 20}, l)
+	assert.Equal(t, "10/1s:20", l.String())
+
+	l, err = ParseLimit("5/1h")
+	assert.NoError(t, err)
+	assert.Equal(t, "5/1h", l.String())
+
+	l, err = ParseLimit("0")
+	assert.NoError(t, err)
+	assert.False(t, l.Enabled())
+}
+
+func TestReturnsErrorForInvalidLimit(t *testing.T) {
+	for _, s := range []string{"5", "a/1m", "5/forever", "5/1m:x", "-1/1m"} {
+		_, err := ParseLimit(s)
+		assert.Error(t, err, s)
+	}
+}
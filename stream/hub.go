@@ -0,0 +1,125 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// bufferSize is the number of events held for a subscription which is not
+// reading fast enough, it is closed when the buffer is full
+const bufferSize = 64
+
+// Subscription receives the events for a user's orders
+type Subscription struct {
+	userID  int
+	orderID int
+	events  chan model.OutboxEvent
+}
+
+// Events returns the channel events are sent on, it is closed when the
+// subscription falls behind or events may have been missed. The subscriber
+// should then resume from the last event it received.
+func (s *Subscription) Events() <-chan model.OutboxEvent {
+	return s.events
+}
+
+// Hub fans out order events to the streams connected to this replica. Events
+// are published through a broker so every replica receives them.
+type Hub struct {
+	broker data.Broker
+	log    hclog.Logger
+
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// NewHub creates a Hub which receives events from b
+func NewHub(b data.Broker, l hclog.Logger) *Hub {
+	h := &Hub{broker: b, log: l, subs: map[*Subscription]struct{}{}}
+	b.Subscribe(h.dispatch)
+
+	return h
+}
+
+// Publish implements outbox.Sink, the event is sent to every replica
+func (h *Hub) Publish(ctx context.Context, e model.OutboxEvent) error {
+	return h.broker.Publish(e)
+}
+
+// Subscribe returns a subscription to the events for a user's orders, when
+// orderID is not zero only events for that order are received
+func (h *Hub) Subscribe(userID int, orderID int) *Subscription {
+	s := &Subscription{userID, orderID, make(chan model.OutboxEvent, bufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+// Unsubscribe stops sending events to a subscription
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(s)
+}
+
+// remove closes a subscription, h.mu must be held
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.events)
+	}
+}
+
+// orderPayload is the part of an order event's payload needed to route it
+type orderPayload struct {
+	Data struct {
+		UserID int `json:"user_id"`
+	} `json:"data"`
+}
+
+func (h *Hub) dispatch(e model.OutboxEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// events may have been missed, close every subscription so they resume
+	if e.ID == 0 {
+		for s := range h.subs {
+			h.remove(s)
+		}
+
+		return
+	}
+
+	if e.AggregateType != model.AggregateOrder {
+		return
+	}
+
+	p := orderPayload{}
+	if err := json.Unmarshal(e.Payload, &p); err != nil {
+		h.log.Error("Unable to decode order event", "event_id", e.EventID, "error", err)
+		return
+	}
+
+	for s := range h.subs {
+		if s.userID != p.Data.UserID || (s.orderID != 0 && s.orderID != e.AggregateID) {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			h.log.Warn("Order event stream is too slow, closing it", "user_id", s.userID)
+			h.remove(s)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func orderEvent(id int64, userID string, orderID int) model.OutboxEvent {
+	return model.OutboxEvent{
+		ID:            id,
+		AggregateType: model.AggregateOrder,
+		AggregateID:   orderID,
+		EventType:     model.EventOrderUpdated,
+		Payload:       []byte(`{"type":"order.updated","data":{"id":1,"user_id":` + userID + `}}`),
+	}
+}
+
+func TestHubSendsEventsToUsersStreams(t *testing.T) {
+	h := NewHub(&data.LocalBroker{}, hclog.NewNullLogger())
+
+	all := h.Subscribe(1, 0)
+	order := h.Subscribe(1, 5)
+	other := h.Subscribe(2, 0)
+
+	assert.NoError(t, h.Publish(context.Background(), orderEvent(1, "1", 4)))
+
+	assert.Equal(t, int64(1), (<-all.Events()).ID)
+	assert.Len(t, order.Events(), 0)
+	assert.Len(t, other.Events(), 0)
+}
+
+func TestHubIgnoresCatalogEvents(t *testing.T) {
+	h := NewHub(&data.LocalBroker{}, hclog.NewNullLogger())
+	s := h.Subscribe(1, 0)
+
+	h.Publish(context.Background(), model.OutboxEvent{ID: 1, AggregateType: model.AggregateCoffee, Payload: []byte(`{}`)})
+
+	assert.Len(t, s.Events(), 0)
+}
+
+func TestHubClosesSlowSubscriptions(t *testing.T) {
+	h := NewHub(&data.LocalBroker{}, hclog.NewNullLogger())
+	s := h.Subscribe(1, 0)
+
+	for i := 0; i <= bufferSize; i++ {
+		h.Publish(context.Background(), orderEvent(int64(i+1), "1", 4))
+	}
+
+	n := 0
+	for range s.Events() {
+		n++
+	}
+
+	assert.Equal(t, bufferSize, n)
+	h.Unsubscribe(s)
+}
+
+func TestHubClosesSubscriptionsWhenEventsMissed(t *testing.T) {
+	b := &data.LocalBroker{}
+	h := NewHub(b, hclog.NewNullLogger())
+	s := h.Subscribe(1, 0)
+
+	b.Publish(model.OutboxEvent{})
+
+	_, ok := <-s.Events()
+	assert.False(t, ok)
+}
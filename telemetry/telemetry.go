@@ -2,8 +2,10 @@ package telemetry
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel/api/global"
@@ -20,6 +22,9 @@ type Telemetry struct {
 	meter    api.Meter
 	measures map[string]*api.Float64Measure
 	counters map[string]*api.Float64Counter
+
+	mu        sync.Mutex
+	serverErr error
 }
 
 func New(bind_address string) *Telemetry {
@@ -34,10 +39,6 @@ func New(bind_address string) *Telemetry {
 	pusher := push.New(batcher, exporter, time.Second)
 	pusher.Start()
 
-	go func() {
-		_ = http.ListenAndServe(bind_address, exporter)
-	}()
-
 	global.SetMeterProvider(pusher)
 
 	meter := global.MeterProvider().Meter("ex.com/basic")
@@ -45,7 +46,29 @@ func New(bind_address string) *Telemetry {
 	m := make(map[string]*api.Float64Measure)
 	c := make(map[string]*api.Float64Counter)
 
-	return &Telemetry{pusher, meter, m, c}
+	t := &Telemetry{pusher: pusher, meter: meter, measures: m, counters: c}
+
+	go func() {
+		err := http.ListenAndServe(bind_address, exporter)
+
+		t.mu.Lock()
+		t.serverErr = err
+		t.mu.Unlock()
+	}()
+
+	return t
+}
+
+// Check returns an error if the metrics exporter has stopped serving
+func (t *Telemetry) Check(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.serverErr != nil {
+		return fmt.Errorf("metrics exporter stopped: %w", t.serverErr)
+	}
+
+	return nil
 }
 
 // AddMeasure to metrics
@@ -77,3 +100,21 @@ func (t *Telemetry) NewTiming(key string) func() {
 		)
 	}
 }
+
+// Increment adds one to a counter added with AddCounter
+func (t *Telemetry) Increment(key string) {
+	t.meter.RecordBatch(
+		context.Background(),
+		nil,
+		t.counters[key].Measurement(1),
+	)
+}
+
+// Record adds a value to a measure added with AddMeasure
+func (t *Telemetry) Record(key string, value float64) {
+	t.meter.RecordBatch(
+		context.Background(),
+		nil,
+		t.measures[key].Measurement(value),
+	)
+}
@@ -0,0 +1,258 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Headers sent with each webhook
+const (
+	// SignatureHeader holds the time the webhook was sent and the signature
+	// of its body, t=<unix seconds>,v1=<hex HMAC-SHA256 of "t.body">
+	SignatureHeader = "Webhook-Signature"
+	// IDHeader holds the ID of the event, it is the same for every attempt
+	IDHeader = "Webhook-ID"
+	// EventHeader holds the type of the event
+	EventHeader = "Webhook-Event"
+)
+
+// batchSize is the number of deliveries claimed at once
+const batchSize = 20
+
+// ErrInvalidSignature is returned by Verify when a signature does not match
+// the body or was made too long ago
+var ErrInvalidSignature = errors.New("Invalid webhook signature")
+
+// NewSecret returns a random secret for signing a subscription's webhooks
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the value of the signature header for a body sent at t
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, body))
+}
+
+// Verify checks the signature header of a webhook, subscribers can use it to
+// check a webhook was sent by the API. Signatures made more than tolerance
+// before now are rejected so captured webhooks can not be replayed.
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts := ""
+	sigs := []string{}
+
+	for _, p := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sigs = append(sigs, kv[1])
+		}
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	d := now.Sub(time.Unix(sec, 0))
+	if d > tolerance || d < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := signature(secret, ts, body)
+	for _, s := range sigs {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func signature(secret string, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Backoff returns the delay before retrying a delivery which has failed
+// attempts times, doubling from base up to max
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
+
+// Queue queues deliveries of an event to the subscriptions for its type, it
+// is implemented by data.Connection
+type Queue interface {
+	QueueWebhookDeliveries(e model.OutboxEvent) error
+}
+
+// Sink queues a delivery of each event published from the outbox for every
+// webhook subscribed to it
+type Sink struct {
+	queue Queue
+}
+
+// NewSink creates a Sink
+func NewSink(q Queue) *Sink {
+	return &Sink{q}
+}
+
+// Publish implements outbox.Sink
+func (s *Sink) Publish(ctx context.Context, e model.OutboxEvent) error {
+	return s.queue.QueueWebhookDeliveries(e)
+}
+
+// Store claims deliveries which are due and records the result of sending
+// them, it is implemented by data.Connection
+type Store interface {
+	ClaimWebhookDeliveries(limit int, lease time.Duration) (model.WebhookDeliveries, error)
+	UpdateWebhookDelivery(d model.WebhookDelivery, retryIn time.Duration) error
+}
+
+// Worker sends webhook deliveries to their subscribers. Failed deliveries are
+// retried with exponential backoff until maxAttempts have been made, then they
+// are marked dead.
+type Worker struct {
+	store       Store
+	client      *http.Client
+	log         hclog.Logger
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// NewWorker creates a Worker, the timeout of client limits how long a
+// subscriber has to respond
+func NewWorker(s Store, client *http.Client, l hclog.Logger, maxAttempts int, baseDelay time.Duration, maxDelay time.Duration) *Worker {
+	return &Worker{s, client, l, maxAttempts, baseDelay, maxDelay}
+}
+
+// Deliver sends deliveries which are due until there are none left or ctx is
+// cancelled, it is run as a background job
+func (w *Worker) Deliver(ctx context.Context) error {
+	// deliveries are claimed for longer than a request can take so they are
+	// not sent twice, but are retried if the process stops while sending
+	lease := w.client.Timeout + time.Minute
+
+	for ctx.Err() == nil {
+		ds, err := w.store.ClaimWebhookDeliveries(batchSize, lease)
+		if err != nil {
+			return err
+		}
+
+		wg := sync.WaitGroup{}
+		for _, d := range ds {
+			wg.Add(1)
+			go func(d model.WebhookDelivery) {
+				defer wg.Done()
+				w.deliver(ctx, d)
+			}(d)
+		}
+		wg.Wait()
+
+		if len(ds) < batchSize {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// deliver sends a delivery and records the result
+func (w *Worker) deliver(ctx context.Context, d model.WebhookDelivery) {
+	code, err := w.send(ctx, d)
+
+	d.Attempts++
+	d.LastStatusCode = code
+	d.LastError = ""
+	retryIn := time.Duration(0)
+
+	switch {
+	case err == nil:
+		d.Status = model.WebhookDelivered
+	case d.Attempts >= w.maxAttempts:
+		d.Status = model.WebhookDead
+		d.LastError = err.Error()
+		w.log.Error("Webhook delivery failed, giving up", "id", d.ID, "event_id", d.EventID, "attempts", d.Attempts, "error", err)
+	default:
+		d.Status = model.WebhookPending
+		d.LastError = err.Error()
+		retryIn = Backoff(d.Attempts, w.baseDelay, w.maxDelay)
+		w.log.Warn("Webhook delivery failed, retrying", "id", d.ID, "event_id", d.EventID, "attempts", d.Attempts, "retry_in", retryIn, "error", err)
+	}
+
+	err = w.store.UpdateWebhookDelivery(d, retryIn)
+	if err != nil {
+		w.log.Error("Unable to update webhook delivery", "id", d.ID, "error", err)
+	}
+}
+
+// send posts the payload of a delivery, any response other than 2xx is an
+// error
+func (w *Worker) send(ctx context.Context, d model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, strings.NewReader(string(d.Payload)))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, d.EventID)
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(SignatureHeader, Sign(d.Secret, time.Now(), d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// read a little of the body so the subscriber's error can be recorded
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	return resp.StatusCode, nil
+}
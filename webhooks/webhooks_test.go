@@ -0,0 +1,137 @@
+package webhooks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp-demoapp/product-api-go/data"
+	"github.com/hashicorp-demoapp/product-api-go/data/model"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVerifyAcceptsSignature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"evt_1"}`)
+
+	h := Sign("secret", now, body)
+
+	assert.NoError(t, Verify("secret", h, body, time.Minute, now.Add(30*time.Second)))
+}
+
+func TestVerifyRejectsChangedBody(t *testing.T) {
+	now := time.Now()
+
+	h := Sign("secret", now, []byte(`{"id":"evt_1"}`))
+
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", h, []byte(`{"id":"evt_2"}`), time.Minute, now))
+	assert.Equal(t, ErrInvalidSignature, Verify("other", h, []byte(`{"id":"evt_1"}`), time.Minute, now))
+}
+
+func TestVerifyRejectsOldSignature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"evt_1"}`)
+
+	h := Sign("secret", now.Add(-2*time.Minute), body)
+
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", h, body, time.Minute, now))
+	assert.Equal(t, ErrInvalidSignature, Verify("secret", "v1=abc", body, time.Minute, now))
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1, 30*time.Second, time.Hour))
+	assert.Equal(t, 60*time.Second, Backoff(2, 30*time.Second, time.Hour))
+	assert.Equal(t, 4*time.Minute, Backoff(4, 30*time.Second, time.Hour))
+	assert.Equal(t, time.Hour, Backoff(20, 30*time.Second, time.Hour))
+}
+
+func setupWorker(t *testing.T, status int) (*Worker, *data.MockConnection, *httptest.Server, chan *http.Request) {
+	received := make(chan *http.Request, 1)
+
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, Verify("secret", r.Header.Get(SignatureHeader), b, time.Minute, time.Now()))
+
+		received <- r
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	c := &data.MockConnection{}
+	w := NewWorker(c, &http.Client{Timeout: time.Second}, hclog.NewNullLogger(), 3, 30*time.Second, time.Hour)
+
+	return w, c, s, received
+}
+
+func delivery(url string, attempts int) model.WebhookDelivery {
+	return model.WebhookDelivery{
+		ID:        1,
+		EventID:   "evt_1",
+		EventType: model.EventOrderCreated,
+		Payload:   []byte(`{"id":"evt_1"}`),
+		Status:    model.WebhookPending,
+		Attempts:  attempts,
+		URL:       url,
+		Secret:    "secret",
+	}
+}
+
+func TestDeliverSendsSignedWebhook(t *testing.T) {
+	w, c, s, received := setupWorker(t, http.StatusNoContent)
+
+	c.On("ClaimWebhookDeliveries", batchSize, mock.Anything).Return(model.WebhookDeliveries{delivery(s.URL, 0)}, nil)
+	c.On("UpdateWebhookDelivery", mock.Anything, time.Duration(0)).Return(nil)
+
+	assert.NoError(t, w.Deliver(context.Background()))
+
+	r := <-received
+	assert.Equal(t, "evt_1", r.Header.Get(IDHeader))
+	assert.Equal(t, model.EventOrderCreated, r.Header.Get(EventHeader))
+
+	d := c.Calls[1].Arguments.Get(0).(model.WebhookDelivery)
+	assert.Equal(t, model.WebhookDelivered, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, http.StatusNoContent, d.LastStatusCode)
+}
+
+func TestDeliverRetriesFailedWebhook(t *testing.T) {
+	w, c, s, _ := setupWorker(t, http.StatusInternalServerError)
+
+	c.On("ClaimWebhookDeliveries", batchSize, mock.Anything).Return(model.WebhookDeliveries{delivery(s.URL, 1)}, nil)
+	c.On("UpdateWebhookDelivery", mock.Anything, 60*time.Second).Return(nil)
+
+	assert.NoError(t, w.Deliver(context.Background()))
+
+	d := c.Calls[1].Arguments.Get(0).(model.WebhookDelivery)
+	assert.Equal(t, model.WebhookPending, d.Status)
+	assert.Equal(t, 2, d.Attempts)
+	assert.Contains(t, d.LastError, "unexpected status 500")
+}
+
+func TestDeliverMarksWebhookDeadAfterMaxAttempts(t *testing.T) {
+	w, c, s, _ := setupWorker(t, http.StatusBadGateway)
+
+	c.On("ClaimWebhookDeliveries", batchSize, mock.Anything).Return(model.WebhookDeliveries{delivery(s.URL, 2)}, nil)
+	c.On("UpdateWebhookDelivery", mock.Anything, time.Duration(0)).Return(nil)
+
+	assert.NoError(t, w.Deliver(context.Background()))
+
+	d := c.Calls[1].Arguments.Get(0).(model.WebhookDelivery)
+	assert.Equal(t, model.WebhookDead, d.Status)
+	assert.Equal(t, 3, d.Attempts)
+}
+
+func TestSinkQueuesDeliveries(t *testing.T) {
+	c := &data.MockConnection{}
+	c.On("QueueWebhookDeliveries", mock.Anything).Return(nil)
+
+	e := model.OutboxEvent{EventID: "evt_1", EventType: model.EventOrderCreated}
+
+	assert.NoError(t, NewSink(c).Publish(context.Background(), e))
+	c.AssertCalled(t, "QueueWebhookDeliveries", e)
+}